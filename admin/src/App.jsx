@@ -15,6 +15,7 @@ import { CreateArtistButton, CreateSongButton, CreateAlbumButton } from './compo
 import { Music, Database, Mic, PlayCircle } from 'lucide-react';
 
 import SetupWizard from './pages/SetupWizard';
+import SignedImage from './components/SignedImage';
 
 const SetupGuard = ({ children }) => {
   const [checking, setChecking] = React.useState(true);
@@ -91,8 +92,8 @@ const MainLayout = () => {
                       render: (row) => (
                         <div className="w-10 h-10 bg-white/5 rounded overflow-hidden">
                           {row.album?.id && (
-                            <img
-                              src={`/api/images/covers/${row.album.id}/lq`}
+                            <SignedImage
+                              path={`/api/images/covers/${row.album.id}/lq`}
                               alt={row.album?.title || 'Album Cover'}
                               className="w-full h-full object-cover"
                               onError={(e) => { e.target.style.display = 'none'; }}
@@ -128,8 +129,8 @@ const MainLayout = () => {
                       label: '',
                       render: (row) => (
                         <div className="w-10 h-10 bg-white/5 rounded overflow-hidden">
-                          <img
-                            src={`/api/images/covers/${row.id}/lq`}
+                          <SignedImage
+                            path={`/api/images/covers/${row.id}/lq`}
                             alt={row.title}
                             className="w-full h-full object-cover"
                             onError={(e) => { e.target.style.display = 'none'; }}
@@ -31,9 +31,10 @@ export const AuthProvider = ({ children }) => {
     }, [token]);
 
     const login = async (username, password) => {
-        const res = await api.post('/users/login', { username, password });
-        const { token, user } = res.data;
+        const res = await api.post('/users/login', { username, password, device_name: 'Admin panel' });
+        const { token, refresh_token, user } = res.data;
         localStorage.setItem('token', token);
+        localStorage.setItem('refresh_token', refresh_token);
         localStorage.setItem('user', JSON.stringify(user));
         setToken(token);
         setUser(user);
@@ -41,7 +42,11 @@ export const AuthProvider = ({ children }) => {
     };
 
     const logout = () => {
+        if (localStorage.getItem('token')) {
+            api.post('/users/logout').catch(() => {});
+        }
         localStorage.removeItem('token');
+        localStorage.removeItem('refresh_token');
         localStorage.removeItem('user');
         setToken(null);
         setUser(null);
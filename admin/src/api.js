@@ -18,12 +18,45 @@ api.interceptors.request.use(
     (error) => Promise.reject(error)
 );
 
+// Access tokens are short-lived. Concurrent 401s share one refresh; the refresh
+// token rotates, so sending the same one twice would fail.
+let refreshing = null;
+
+function refreshToken() {
+    if (!refreshing) {
+        const refresh_token = localStorage.getItem('refresh_token');
+        refreshing = (refresh_token
+            ? axios.post(`${api.defaults.baseURL}/users/refresh`, { refresh_token })
+            : Promise.reject(new Error('no refresh token'))
+        ).then((res) => {
+            localStorage.setItem('token', res.data.token);
+            localStorage.setItem('refresh_token', res.data.refresh_token);
+            return res.data.token;
+        }).finally(() => {
+            refreshing = null;
+        });
+    }
+    return refreshing;
+}
+
 api.interceptors.response.use(
     (response) => response,
-    (error) => {
+    async (error) => {
+        const original = error.config;
+        if (error.response && error.response.status === 401 && original && !original._retried && !/^\/users\/(login|refresh|logout)/.test(original.url)) {
+            original._retried = true;
+            try {
+                const token = await refreshToken();
+                original.headers.Authorization = `Bearer ${token}`;
+                return api(original);
+            } catch {
+                // fall through to the login redirect
+            }
+        }
         if (error.response && error.response.status === 401) {
             if (!window.location.pathname.includes('/login')) {
                 localStorage.removeItem('token');
+                localStorage.removeItem('refresh_token');
                 localStorage.removeItem('user');
                 window.location.href = '/login';
             }
@@ -32,4 +65,37 @@ api.interceptors.response.use(
     }
 );
 
+// Library media (covers, downloads) needs a signed URL when loaded outside of axios,
+// e.g. by <img> tags. Paths requested in the same tick are signed in one request.
+const signedUrls = new Map();
+let pendingSign = null;
+
+export function signUrl(path) {
+    const cached = signedUrls.get(path);
+    if (cached && cached.expiresAt - Date.now() > 60 * 1000) {
+        return Promise.resolve(cached.url);
+    }
+
+    if (!pendingSign) {
+        const batch = { paths: [], promise: null };
+        batch.promise = Promise.resolve().then(async () => {
+            pendingSign = null;
+            const res = await api.post('/urls/sign', { paths: batch.paths });
+            const expiresAt = new Date(res.data.expires_at).getTime();
+            const urls = {};
+            batch.paths.forEach((p, i) => {
+                urls[p] = res.data.urls[i];
+                signedUrls.set(p, { url: res.data.urls[i], expiresAt });
+            });
+            return urls;
+        });
+        pendingSign = batch;
+    }
+    const batch = pendingSign;
+    if (!batch.paths.includes(path)) {
+        batch.paths.push(path);
+    }
+    return batch.promise.then((urls) => urls[path]);
+}
+
 export default api;
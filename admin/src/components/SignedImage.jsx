@@ -0,0 +1,24 @@
+import React, { useEffect, useState } from 'react';
+import { signUrl } from '../api';
+
+// SignedImage renders an <img> for a protected library path such as /api/images/covers/:id/lq.
+const SignedImage = ({ path, bust, onError, ...props }) => {
+    const [src, setSrc] = useState(null);
+
+    useEffect(() => {
+        let cancelled = false;
+        signUrl(path)
+            .then((url) => {
+                if (!cancelled) setSrc(bust ? `${url}&t=${bust}` : url);
+            })
+            .catch(() => {
+                if (!cancelled) setSrc(null);
+            });
+        return () => { cancelled = true; };
+    }, [path, bust]);
+
+    if (!src) return null;
+    return <img src={src} onError={onError} {...props} />;
+};
+
+export default SignedImage;
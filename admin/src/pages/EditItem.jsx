@@ -2,7 +2,8 @@ import React, { useEffect, useState, useCallback } from 'react';
 import { useParams, useNavigate } from 'react-router-dom';
 import { useDropzone } from 'react-dropzone';
 import { Save, Trash2, ArrowLeft, Loader, Database, Mic, Music, PlayCircle, Upload, X, Check, Loader2 } from 'lucide-react';
-import api from '../api';
+import api, { signUrl } from '../api';
+import SignedImage from '../components/SignedImage';
 import SearchableSelect from '../components/SearchableSelect';
 import { ArtistPicker } from '../components/Pickers';
 import { Input } from "@/components/ui/input"
@@ -415,8 +416,9 @@ const EditItem = () => {
                             <div className="flex flex-row gap-4 items-stretch">
                                 {/* Current Cover Preview */}
                                 <div className="flex-shrink-0">
-                                    <img
-                                        src={`/api/images/covers/${id}/lq?${Date.now()}`}
+                                    <SignedImage
+                                        path={`/api/images/covers/${id}/lq`}
+                                        bust={Date.now()}
                                         alt="Current Cover"
                                         className="w-24 h-24 object-cover border border-white/10"
                                         onError={(e) => e.target.style.display = 'none'}
@@ -618,7 +620,7 @@ const EditItem = () => {
                                                 </div>
                                             </div>
                                             <div className="flex items-center gap-2">
-                                                <a href={`/api/songs/download/${file.id}`} target="_blank" rel="noreferrer" className="p-2 hover:bg-white/10 rounded text-white/60 hover:text-primary transition-colors">
+                                                <a href="#" onClick={(e) => { e.preventDefault(); signUrl(`/api/songs/download/${file.id}`).then((url) => window.open(url, '_blank', 'noreferrer')); }} className="p-2 hover:bg-white/10 rounded text-white/60 hover:text-primary transition-colors">
                                                     <Upload className="h-4 w-4 rotate-180" />
                                                 </a>
                                                 <button
@@ -131,7 +131,7 @@ const SettingsView = () => {
         setMsg('');
         try {
             await api.post('/doctor');
-            setMsg('SUCCESS: MAINTENANCE TASKS COMPLETE');
+            setMsg('SUCCESS: MAINTENANCE STARTED IN THE BACKGROUND');
             setMsgType('primary');
         } catch (e) {
             console.error(e);
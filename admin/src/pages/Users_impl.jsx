@@ -4,6 +4,8 @@ import { CornerBrackets } from '../components/FUI';
 import { Trash2, UserPlus, Shield, Users } from 'lucide-react';
 import api from '../api';
 
+const ROLES = ['user', 'curator', 'moderator', 'admin'];
+
 const UsersView = () => {
     const [data, setData] = useState([]);
     const [loading, setLoading] = useState(false);
@@ -38,10 +40,32 @@ const UsersView = () => {
         }
     }
 
+    const handleRoleChange = async (id, role) => {
+        try {
+            await api.put(`/admin/users/${id}/role`, { role });
+            fetchUsers();
+        } catch (e) {
+            alert(e.response?.data?.message || "Failed to change role");
+        }
+    }
+
     const columns = [
         { header: 'ID', accessor: 'ID', render: (u) => <span className="font-mono text-[9px] text-white/30">{u.ID}</span> },
         { header: 'USERNAME', accessor: 'Username', render: (u) => <span className="text-white font-bold">{u.Username}</span> },
-        { header: 'ROLE', accessor: 'IsAdmin', render: (u) => u.IsAdmin ? <span className="text-primary font-bold flex items-center gap-1"><Shield className="w-3 h-3" /> ADMIN</span> : <span className="text-white/50">USER</span> },
+        {
+            header: 'ROLE', accessor: 'Role', render: (u) => (
+                <span className={`flex items-center gap-1 ${u.Role === 'user' ? 'text-white/50' : 'text-primary font-bold'}`}>
+                    {u.Role === 'admin' && <Shield className="w-3 h-3" />}
+                    <select
+                        value={u.Role}
+                        onChange={(e) => handleRoleChange(u.ID, e.target.value)}
+                        className="bg-transparent uppercase cursor-pointer outline-none"
+                    >
+                        {ROLES.map(r => <option key={r} value={r} className="bg-black">{r.toUpperCase()}</option>)}
+                    </select>
+                </span>
+            )
+        },
         { header: 'CREATED', accessor: 'CreatedAt', render: (u) => new Date(u.CreatedAt).toLocaleDateString() },
     ];
 
@@ -54,3 +54,17 @@ func BackfillOrdering(db *gorm.DB) error {
 
 	return nil
 }
+
+// BackfillRoles gives admins from before roles existed the admin role.
+func BackfillRoles(db *gorm.DB) error {
+	res := db.Model(&model.User{}).
+		Where("is_admin = ? AND role <> ?", true, model.RoleAdmin).
+		Update("role", model.RoleAdmin)
+	if res.Error != nil {
+		return fmt.Errorf("failed to backfill roles: %w", res.Error)
+	}
+	if res.RowsAffected > 0 {
+		log.Printf("Backfilled admin role for %d users\n", res.RowsAffected)
+	}
+	return nil
+}
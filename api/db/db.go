@@ -44,21 +44,36 @@ func AutoMigrate(db *gorm.DB) error {
 	if err := db.AutoMigrate(
 		&model.Song{},
 		&model.SongFile{},
+		&model.SongRendition{},
 		&model.RequestMail{},
 		&model.Artist{},
 		&model.ArtistIdentifier{},
 		&model.AlbumIdentifier{},
 		&model.SongIdentifier{},
 		&model.Album{},
+		&model.Genre{},
 		&model.User{},
 		&model.Playlist{},
 		&model.PlaylistFolder{},
 		&model.PlaylistSong{},
 		&model.Setting{},
+		&model.Star{},
+		&model.Scrobble{},
+		&model.Session{},
+		&model.AuditEntry{},
+		&model.Invite{},
+		&model.UserIdentity{},
+		&model.APIKey{},
+		&model.StorageMigration{},
+		&model.StorageMigrationItem{},
 	); err != nil {
 		return err
 	}
 
+	if err := BackfillRoles(db); err != nil {
+		return err
+	}
+
 	if err := BackfillOrdering(db); err != nil {
 		log.Printf("WARNING: Backfill failed: %v\n", err)
 		return err
@@ -3,7 +3,9 @@ module github.com/ProjectDistribute/distributor
 go 1.24.2
 
 require (
+	github.com/dhowden/tag v0.0.0-20240417053706-3d75831295e8
 	github.com/disintegration/imaging v1.6.2
+	github.com/fsnotify/fsnotify v1.8.0
 	github.com/go-playground/validator v9.31.0+incompatible
 	github.com/google/uuid v1.6.0
 	github.com/joho/godotenv v1.5.1
@@ -1,28 +1,88 @@
 package handler
 
 import (
+	"errors"
+	"log"
+	"net/http"
+
+	"github.com/ProjectDistribute/distributor/service"
 	"github.com/ProjectDistribute/distributor/task"
+	"github.com/ProjectDistribute/distributor/utils"
 	"github.com/labstack/echo/v4"
 )
 
 // RunDoctor godoc
 // @Summary Run maintenance tasks
-// @Description Runs server-side maintenance (ensures song file durations and sizes). Requires an admin JWT.
+// @Description Starts server-side maintenance as the "doctor" background job: ensures song file durations, sizes and audio properties, then verifies stored audio against the SHA-256 recorded on import. Files whose audio changed are flagged as corrupt. Requires the server.manage permission.
+// @Description Progress is reported in GET /admin/jobs, where corrupt and missing files are listed as failed items. Missing waveforms are generated by another job ("waveforms") when an audio decoder is available.
 // @Tags admin
 // @Security BearerAuth
-// @Success 200 {string} string "OK"
+// @Produce json
+// @Success 202 {object} service.JobSnapshot
 // @Failure 401 {object} ErrorResponse
 // @Failure 403 {object} ErrorResponse
+// @Failure 409 {object} ErrorResponse
+// @Failure 500 {object} ErrorResponse
 // @Router /doctor [post]
 func (h *Handler) RunDoctor(c echo.Context) error {
-	task.EnsureFilesDuration(h.db, *h.song_svc)
-	task.EnsureFilesSize(h.db)
-	return c.NoContent(200)
+	job, err := h.job_svc.Start("doctor", func(job *service.Job) error {
+		job.SetMessage("Probing files")
+		task.EnsureFilesAudioInfo(h.db, *h.song_svc)
+		task.EnsureFilesSize(h.db, *h.song_svc)
+		job.SetMessage("Verifying files")
+		return task.VerifyFilesIntegrity(h.db, *h.song_svc, job)
+	})
+	if errors.Is(err, service.ErrJobRunning) {
+		return c.JSON(http.StatusConflict, ErrorResponse{Error: "Maintenance is already running"})
+	}
+	if err != nil {
+		return c.JSON(http.StatusInternalServerError, ErrorResponse{Error: err.Error()})
+	}
+
+	h.startWaveformBackfill()
+	return c.JSON(http.StatusAccepted, job.Snapshot())
+}
+
+// startWaveformBackfill generates missing waveforms in the background, decoding
+// every file would hold the doctor request for too long.
+func (h *Handler) startWaveformBackfill() {
+	if h.waveform_svc.Decoder == nil {
+		return
+	}
+	_, err := h.job_svc.Start("waveforms", func(job *service.Job) error {
+		return task.GenerateMissingWaveforms(h.db, h.waveform_svc, job)
+	})
+	if err != nil && !errors.Is(err, service.ErrJobRunning) {
+		log.Printf("Failed to start waveform generation: %v\n", err)
+	}
+}
+
+// songFilePathsJob moves song files from the layout keyed by song ID.
+const songFilePathsJob = "song_file_paths"
+
+// StartSongFilePathMigration moves song files still stored under their song ID to
+// their file ID in the background. The migration is resumable and the job is not
+// started again once it has completed.
+func (h *Handler) StartSongFilePathMigration() {
+	if service.SongFilePathsMigrated(h.settings_svc) {
+		return
+	}
+	// The old layout only ever existed on local disk, below STORAGE_ROOT if that is set
+	storage, ok := service.CurrentStorage(h.song_svc.Storage).(utils.LocalFileStorage)
+	if !ok {
+		storage = utils.LocalFileStorage{}
+	}
+	_, err := h.job_svc.Start(songFilePathsJob, func(job *service.Job) error {
+		return task.MigrateSongFilePaths(h.db, storage, h.settings_svc, job)
+	})
+	if err != nil && !errors.Is(err, service.ErrJobRunning) {
+		log.Printf("Failed to start song file path migration: %v\n", err)
+	}
 }
 
 // ReindexSearch godoc
 // @Summary Re-index search database
-// @Description Deletes all documents in Meilisearch and re-indexes them from the database. Requires an admin JWT.
+// @Description Deletes all documents in Meilisearch and re-indexes them from the database. Requires the server.manage permission.
 // @Tags admin
 // @Security BearerAuth
 // @Success 200 {string} string "OK"
@@ -36,7 +96,7 @@ func (h *Handler) ReindexSearch(c echo.Context) error {
 
 // RemoveOrphans godoc
 // @Summary Remove orphan entities
-// @Description Removes orphan songs, albums, artists, broken links, and related metadata (identifiers, files). Requires an admin JWT.
+// @Description Removes orphan songs, albums, artists, broken links, and related metadata (identifiers, files). Requires the server.manage permission.
 // @Tags admin
 // @Security BearerAuth
 // @Success 200 {object} map[string]int64
@@ -64,16 +124,40 @@ func (h *Handler) RemoveOrphans(c echo.Context) error {
 	return c.JSON(200, results)
 }
 
+// GetDuplicateAudio godoc
+// @Summary List duplicate audio
+// @Description Lists songs that have files with identical audio, grouped by SHA-256. Requires the library.edit permission.
+// @Tags admin
+// @Security BearerAuth
+// @Produce json
+// @Success 200 {array} DuplicateAudio
+// @Failure 401 {object} ErrorResponse
+// @Failure 403 {object} ErrorResponse
+// @Failure 500 {object} ErrorResponse
+// @Router /admin/duplicates [get]
+func (h *Handler) GetDuplicateAudio(c echo.Context) error {
+	groups, err := h.song_svc.FindDuplicateAudio()
+	if err != nil {
+		return c.JSON(500, ErrorResponse{Error: "Failed to find duplicates"})
+	}
+	return c.JSON(200, FromDuplicateAudio(groups))
+}
+
 // CleanSongFiles godoc
 // @Summary Remove invalid song files
-// @Description Removes SongFile records where the physical file is missing from storage. Requires an admin JWT.
+// @Description Removes SongFile records where the physical file is missing from storage. Requires the server.manage permission.
 // @Tags admin
 // @Security BearerAuth
 // @Success 200 {object} map[string]int64
 // @Failure 401 {object} ErrorResponse
 // @Failure 403 {object} ErrorResponse
+// @Failure 409 {object} ErrorResponse
 // @Router /admin/files/cleanup [delete]
 func (h *Handler) CleanSongFiles(c echo.Context) error {
+	if !service.SongFilePathsMigrated(h.settings_svc) {
+		// Files not moved yet only exist at their legacy path
+		return c.JSON(http.StatusConflict, ErrorResponse{Error: "Song files are still being moved to their new paths"})
+	}
 	deleted, err := task.CleanupInvalidSongFiles(h.db, *h.song_svc)
 	if err != nil {
 		return c.JSON(500, ErrorResponse{Error: err.Error()})
@@ -0,0 +1,153 @@
+package handler
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/ProjectDistribute/distributor/model"
+	"github.com/ProjectDistribute/distributor/service"
+	"github.com/ProjectDistribute/distributor/utils"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestRunDoctor_VerifiesInBackground(t *testing.T) {
+	s := newTestServer(t)
+	_, auth := s.user(t, "admin", model.RoleAdmin)
+
+	song := &model.Song{Title: "Song"}
+	require.NoError(t, s.h.song_svc.Store.CreateSong(song))
+	intact := &model.SongFile{SongID: song.ID, Format: "flac"}
+	corrupt := &model.SongFile{SongID: song.ID, Format: "flac"}
+	missing := &model.SongFile{SongID: song.ID, Format: "flac"}
+	for _, f := range []*model.SongFile{intact, corrupt, missing} {
+		require.NoError(t, s.h.song_svc.Store.CreateSongFile(f))
+	}
+	for _, f := range []*model.SongFile{intact, corrupt} {
+		require.NoError(t, s.h.song_svc.Storage.Save(f.FilePath(), strings.NewReader("audio "+f.ID.String())))
+	}
+	require.NoError(t, s.db.Model(corrupt).Update("sha256", "0000").Error)
+
+	rec := s.do(t, http.MethodPost, "/api/doctor", nil, auth)
+	require.Equal(t, http.StatusAccepted, rec.Code, rec.Body.String())
+	assert.Equal(t, "doctor", decode[service.JobSnapshot](t, rec).Name)
+
+	var job service.JobSnapshot
+	require.Eventually(t, func() bool {
+		job = s.h.job_svc.Get("doctor").Snapshot()
+		return job.Status == service.JobStatusCompleted
+	}, 5*time.Second, 10*time.Millisecond)
+	assert.Equal(t, 3, job.Total)
+	assert.Equal(t, 2, job.Failed)
+	assert.Len(t, job.Errors, 2)
+	assert.Equal(t, "2 files checked, 1 hashed for the first time, 1 corrupt", job.Message)
+}
+
+func TestStartSongFilePathMigration_LinksSharedPaths(t *testing.T) {
+	s := newTestServer(t)
+	_, auth := s.user(t, "admin", model.RoleAdmin)
+	storage := s.h.song_svc.Storage
+
+	// Two uploads of the same format shared one path, the second overwrote the first
+	shared := &model.Song{Title: "Shared"}
+	require.NoError(t, s.h.song_svc.Store.CreateSong(shared))
+	older := &model.SongFile{SongID: shared.ID, Format: "flac", Size: 10, SHA256: "older", CreatedAt: time.Now().Add(-time.Hour)}
+	newer := &model.SongFile{SongID: shared.ID, Format: "flac", Size: 20, SHA256: "newer"}
+	for _, f := range []*model.SongFile{older, newer} {
+		require.NoError(t, s.h.song_svc.Store.CreateSongFile(f))
+	}
+	require.NoError(t, storage.Save(newer.LegacyFilePath(), strings.NewReader("newer audio")))
+
+	// An interrupted run linked these records but did not move the file
+	resumed := &model.Song{Title: "Resumed"}
+	require.NoError(t, s.h.song_svc.Store.CreateSong(resumed))
+	owner := &model.SongFile{SongID: resumed.ID, Format: "mp3", SHA256: "owner", CreatedAt: time.Now().Add(-time.Minute)}
+	require.NoError(t, s.h.song_svc.Store.CreateSongFile(owner))
+	linked := &model.SongFile{SongID: resumed.ID, Format: "mp3", SHA256: "owner", BlobID: &owner.ID, CreatedAt: time.Now().Add(-2 * time.Minute)}
+	require.NoError(t, s.h.song_svc.Store.CreateSongFile(linked))
+	require.NoError(t, storage.Save(owner.LegacyFilePath(), strings.NewReader("owner audio")))
+
+	// Storage migrations would leave files at their old path behind
+	rec := s.do(t, http.MethodPost, "/api/admin/storage/migration", service.StorageTarget{Backend: service.StorageBackendLocal, Root: t.TempDir()}, auth)
+	assert.Equal(t, http.StatusConflict, rec.Code, rec.Body.String())
+
+	s.h.StartSongFilePathMigration()
+	var job service.JobSnapshot
+	require.Eventually(t, func() bool {
+		job = s.h.job_svc.Get(songFilePathsJob).Snapshot()
+		return job.Status == service.JobStatusCompleted
+	}, 5*time.Second, 10*time.Millisecond)
+	assert.Equal(t, 2, job.Total)
+	assert.Zero(t, job.Failed)
+
+	var got model.SongFile
+	require.NoError(t, s.db.First(&got, "id = ?", older.ID).Error)
+	require.NotNil(t, got.BlobID)
+	assert.Equal(t, newer.ID, *got.BlobID)
+	assert.Equal(t, int64(20), got.Size)
+	assert.Equal(t, "newer", got.SHA256)
+	assert.True(t, storage.Exists(newer.FilePath()))
+	assert.True(t, storage.Exists(got.FilePath()))
+	assert.False(t, storage.Exists(newer.LegacyFilePath()))
+
+	var resumedFile model.SongFile
+	require.NoError(t, s.db.First(&resumedFile, "id = ?", linked.ID).Error)
+	assert.Equal(t, owner.ID, *resumedFile.BlobID)
+	assert.True(t, storage.Exists(owner.FilePath()))
+	assert.False(t, storage.Exists(owner.LegacyFilePath()))
+
+	// Completed migrations are not run again
+	s.h.StartSongFilePathMigration()
+	assert.Equal(t, job.StartedAt, s.h.job_svc.Get(songFilePathsJob).Snapshot().StartedAt)
+}
+
+func TestSongFilePaths_LegacyFallbackUntilMigrated(t *testing.T) {
+	s := newTestServer(t)
+	_, auth := s.user(t, "admin", model.RoleAdmin)
+	// Files live below STORAGE_ROOT, not in the working directory
+	storage := utils.LocalFileStorage{Root: t.TempDir()}
+	s.h.song_svc.Storage.(*service.SwitchableStorage).Switch(storage)
+
+	song := &model.Song{Title: "Song"}
+	require.NoError(t, s.h.song_svc.Store.CreateSong(song))
+	legacy := &model.SongFile{SongID: song.ID, Format: "flac"}
+	require.NoError(t, s.h.song_svc.Store.CreateSongFile(legacy))
+	require.NoError(t, storage.Save(legacy.LegacyFilePath(), strings.NewReader("legacy audio")))
+	other := &model.Song{Title: "Lost"}
+	require.NoError(t, s.h.song_svc.Store.CreateSong(other))
+	lost := &model.SongFile{SongID: other.ID, Format: "mp3"}
+	require.NoError(t, s.h.song_svc.Store.CreateSongFile(lost))
+
+	download := func() *httptest.ResponseRecorder {
+		return s.do(t, http.MethodGet, "/api/songs/download/"+legacy.ID.String(), nil, auth)
+	}
+	rec := download()
+	require.Equal(t, http.StatusOK, rec.Code, rec.Body.String())
+	assert.Equal(t, "legacy audio", rec.Body.String())
+
+	// Cleanup would delete every record that was not moved yet
+	rec = s.do(t, http.MethodDelete, "/api/admin/files/cleanup", nil, auth)
+	assert.Equal(t, http.StatusConflict, rec.Code, rec.Body.String())
+
+	s.h.StartSongFilePathMigration()
+	var job service.JobSnapshot
+	require.Eventually(t, func() bool {
+		job = s.h.job_svc.Get(songFilePathsJob).Snapshot()
+		return job.Status != service.JobStatusRunning
+	}, 5*time.Second, 10*time.Millisecond)
+	assert.Equal(t, service.JobStatusFailed, job.Status)
+	assert.Equal(t, 1, job.Failed)
+	assert.True(t, storage.Exists(legacy.FilePath()))
+
+	// A record without a file keeps the migration from completing
+	assert.False(t, service.SongFilePathsMigrated(s.h.settings_svc))
+	rec = s.do(t, http.MethodDelete, "/api/admin/files/cleanup", nil, auth)
+	assert.Equal(t, http.StatusConflict, rec.Code, rec.Body.String())
+
+	rec = download()
+	require.Equal(t, http.StatusOK, rec.Code, rec.Body.String())
+	assert.Equal(t, "legacy audio", rec.Body.String())
+}
@@ -11,11 +11,17 @@ import (
 // @Summary Serve album cover image
 // @Description Serves a JPG album cover. The `res` parameter selects low or high quality.
 // @Tags images
+// @Security BearerAuth
+// @Security ApiKeyAuth
 // @Produce image/jpeg
 // @Param id path string true "Album ID (UUID)"
 // @Param res path string true "Resolution (lq|hq)" Enums(lq,hq)
+// @Param exp query int false "Signed URL expiry (unix seconds)"
+// @Param sig query string false "Signed URL signature, see POST /urls/sign"
 // @Success 200 {file} file
 // @Failure 400 {string} string "Invalid parameters"
+// @Failure 401 {object} ErrorResponse
+// @Failure 403 {object} ErrorResponse
 // @Router /images/covers/{id}/{res} [get]
 func (h *Handler) ServeAlbumCover(c echo.Context) error {
 	id, err := uuid.Parse(c.Param("id"))
@@ -28,5 +34,5 @@ func (h *Handler) ServeAlbumCover(c echo.Context) error {
 	}
 	format := "jpg"
 	filePath := h.album_svc.GetAlbumCoverPath(id, format, res)
-	return c.File(filePath)
+	return h.serveStoredFile(c, filePath, "", "")
 }
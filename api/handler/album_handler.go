@@ -5,6 +5,8 @@ import (
 	"path/filepath"
 	"strconv"
 
+	"github.com/ProjectDistribute/distributor/model"
+	"github.com/ProjectDistribute/distributor/service"
 	"github.com/ProjectDistribute/distributor/utils"
 	"github.com/google/uuid"
 	"github.com/labstack/echo/v4"
@@ -127,9 +129,10 @@ func (h *Handler) AlbumHasCover(c echo.Context) error {
 
 // AssignAlbumCover godoc
 // @Summary Upload album cover
-// @Description Uploads a JPG album cover for the album. Requires an admin JWT.
+// @Description Uploads a JPG album cover for the album. Requires the library.edit permission.
 // @Tags albums
 // @Security BearerAuth
+// @Security ApiKeyAuth
 // @Accept multipart/form-data
 // @Produce json
 // @Param id path string true "Album ID (UUID)"
@@ -172,9 +175,10 @@ func (h *Handler) AssignAlbumCover(c echo.Context) error {
 
 // AssignAlbumCoverByPath godoc
 // @Summary Assign album cover by path
-// @Description Moves an album cover file from a shared volume path and associates it to an existing album. Requires an admin JWT.
+// @Description Moves an album cover file from a shared volume path and associates it to an existing album. Requires the library.edit permission.
 // @Tags albums
 // @Security BearerAuth
+// @Security ApiKeyAuth
 // @Accept json
 // @Produce json
 // @Param request body AssignAlbumCoverByPathRequest true "Request body"
@@ -215,9 +219,10 @@ func (h *Handler) AssignAlbumCoverByPath(c echo.Context) error {
 
 // UpdateAlbum godoc
 // @Summary Update album
-// @Description Updates album metadata. Requires an admin JWT.
+// @Description Updates album metadata. Requires the library.edit permission.
 // @Tags albums
 // @Security BearerAuth
+// @Security ApiKeyAuth
 // @Accept json
 // @Produce json
 // @Param id path string true "Album ID (UUID)"
@@ -239,7 +244,18 @@ func (h *Handler) UpdateAlbum(c echo.Context) error {
 		return echo.NewHTTPError(http.StatusBadRequest, "Invalid request payload")
 	}
 
-	updatedAlbum, err := h.album_svc.UpdateAlbum(id, req.Title, req.ReleaseDate)
+	if req.Type != "" && !model.ValidAlbumType(req.Type) {
+		return echo.NewHTTPError(http.StatusBadRequest, "Invalid album type")
+	}
+	var artists []model.Artist
+	if req.AlbumArtists != nil {
+		artists, err = h.resolveAlbumArtists(req.AlbumArtists)
+		if err != nil {
+			return err
+		}
+	}
+
+	updatedAlbum, err := h.album_svc.UpdateAlbum(id, req.Title, req.ReleaseDate, req.Type, artists)
 	if err != nil {
 		return echo.NewHTTPError(http.StatusInternalServerError, "Failed to update album: "+err.Error())
 	}
@@ -249,9 +265,10 @@ func (h *Handler) UpdateAlbum(c echo.Context) error {
 
 // DeleteAlbum godoc
 // @Summary Delete album
-// @Description Deletes an album by ID. Requires an admin JWT.
+// @Description Deletes an album by ID. Requires the library.edit permission.
 // @Tags albums
 // @Security BearerAuth
+// @Security ApiKeyAuth
 // @Param id path string true "Album ID (UUID)"
 // @Success 204 {string} string "No Content"
 // @Failure 400 {object} ErrorResponse
@@ -279,9 +296,10 @@ func (h *Handler) DeleteAlbum(c echo.Context) error {
 
 // CreateAlbum godoc
 // @Summary Create album
-// @Description Creates a new album. Requires an admin JWT.
+// @Description Creates a new album. Requires the library.edit permission.
 // @Tags albums
 // @Security BearerAuth
+// @Security ApiKeyAuth
 // @Accept json
 // @Produce json
 // @Param request body CreateAlbumRequest true "Album metadata"
@@ -300,8 +318,15 @@ func (h *Handler) CreateAlbum(c echo.Context) error {
 		return echo.NewHTTPError(http.StatusBadRequest, "Validation failed: "+err.Error())
 	}
 
-	// Artist Name is computed from songs, so initially it's empty
-	album, err := h.album_svc.CreateAlbum(req.Title, req.ReleaseDate, "")
+	if req.Type != "" && !model.ValidAlbumType(req.Type) {
+		return echo.NewHTTPError(http.StatusBadRequest, "Invalid album type")
+	}
+	artists, err := h.resolveAlbumArtists(req.AlbumArtists)
+	if err != nil {
+		return err
+	}
+
+	album, err := h.album_svc.CreateAlbum(req.Title, req.ReleaseDate, req.Type, artists)
 	if err != nil {
 		return echo.NewHTTPError(http.StatusInternalServerError, "Failed to create album: "+err.Error())
 	}
@@ -309,9 +334,25 @@ func (h *Handler) CreateAlbum(c echo.Context) error {
 	return c.JSON(http.StatusCreated, FromAlbumModel(*album))
 }
 
+// resolveAlbumArtists finds or creates the requested album artists, an empty list
+// for none.
+func (h *Handler) resolveAlbumArtists(input []service.SongCreationArtist) ([]model.Artist, error) {
+	artists := []model.Artist{}
+	for _, a := range input {
+		if a.Name == "" || a.Identifier == "" {
+			return nil, echo.NewHTTPError(http.StatusBadRequest, "Album artists need a name and an id")
+		}
+	}
+	resolved, err := h.artist_svc.ResolveArtists(input)
+	if err != nil {
+		return nil, echo.NewHTTPError(http.StatusInternalServerError, "Failed to resolve album artists: "+err.Error())
+	}
+	return append(artists, resolved...), nil
+}
+
 // GetAlbumSongs godoc
 // @Summary List songs in album
-// @Description Returns all songs in an album.
+// @Description Returns all songs in an album, ordered by disc and track number.
 // @Tags albums
 // @Produce json
 // @Param id path string true "Album ID (UUID)"
@@ -0,0 +1,37 @@
+package handler
+
+import (
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/ProjectDistribute/distributor/model"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestGetAlbum_SongLoudness(t *testing.T) {
+	s := newTestServer(t)
+
+	album, err := s.h.album_svc.Store.CreateAlbum(&model.Album{Title: "Loud"})
+	require.NoError(t, err)
+	analyzed := &model.Song{AlbumID: album.ID, Title: "Analyzed", TrackNumber: 1}
+	pending := &model.Song{AlbumID: album.ID, Title: "Pending", TrackNumber: 2}
+	require.NoError(t, s.h.song_svc.Store.CreateSong(analyzed))
+	require.NoError(t, s.h.song_svc.Store.CreateSong(pending))
+	now := time.Now()
+	require.NoError(t, s.h.song_svc.Store.CreateSongFile(&model.SongFile{
+		SongID: analyzed.ID, Format: "flac",
+		LoudnessAnalyzedAt: &now, Loudness: -9.5, TruePeak: -0.3, TrackGain: -8.5, AlbumGain: -8, AlbumPeak: -0.1,
+	}))
+	require.NoError(t, s.h.song_svc.Store.CreateSongFile(&model.SongFile{SongID: pending.ID, Format: "flac"}))
+
+	rec := s.do(t, http.MethodGet, "/api/albums/"+album.ID.String(), nil, "")
+	require.Equal(t, http.StatusOK, rec.Code, rec.Body.String())
+	got := decode[Album](t, rec)
+	require.Len(t, got.Songs, 2)
+	require.NotNil(t, got.Songs[0].Loudness)
+	assert.Equal(t, -8.5, got.Songs[0].Loudness.TrackGain)
+	assert.Equal(t, -8.0, got.Songs[0].Loudness.AlbumGain)
+	assert.Nil(t, got.Songs[1].Loudness)
+}
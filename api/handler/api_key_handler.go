@@ -0,0 +1,170 @@
+package handler
+
+import (
+	"errors"
+	"net/http"
+	"time"
+
+	"github.com/ProjectDistribute/distributor/middleware"
+	"github.com/ProjectDistribute/distributor/model"
+	"github.com/ProjectDistribute/distributor/service"
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/labstack/echo/v4"
+)
+
+// GetAPIKeys godoc
+// @Summary List API keys
+// @Description Lists the API keys of a user, newest first, including revoked ones. Users can list their own keys, admins any user's.
+// @Tags users
+// @Security BearerAuth
+// @Produce json
+// @Param user_id path string true "User ID (UUID)"
+// @Success 200 {array} APIKey
+// @Failure 400 {object} ErrorResponse
+// @Failure 401 {object} ErrorResponse
+// @Failure 403 {object} ErrorResponse
+// @Failure 500 {object} ErrorResponse
+// @Router /users/{user_id}/api-keys [get]
+func (h *Handler) GetAPIKeys(c *middleware.CustomContext) error {
+	userID, err := c.GetUUID("user_id")
+	if err != nil {
+		return echo.NewHTTPError(http.StatusBadRequest, "Invalid user ID")
+	}
+	me := c.Get("user").(*jwt.Token).Claims.(*middleware.JwtCustomClaims)
+	if me.UUID() != userID && !me.Can(model.PermManageUsers) {
+		return echo.NewHTTPError(http.StatusForbidden, "Forbidden: You can only view your own API keys or must be an admin")
+	}
+
+	keys, err := h.user_svc.APIKeys.GetAPIKeysByUserID(userID)
+	if err != nil {
+		return c.JSON(http.StatusInternalServerError, ErrorResponse{Error: "Failed to retrieve API keys"})
+	}
+	return c.JSON(http.StatusOK, fromAPIKeyModels(keys))
+}
+
+// CreateAPIKey godoc
+// @Summary Create API key
+// @Description Creates an API key for automation clients. The key acts as the user but only within its scopes: library:read, playlists:read, playlists:write and mail:write, and for staff roles also library:write (curators and admins), mail:read (moderators and admins) and admin. The key is only returned in this response. Users can only create keys for themselves, and only from a login session.
+// @Tags users
+// @Security BearerAuth
+// @Accept json
+// @Produce json
+// @Param user_id path string true "User ID (UUID)"
+// @Param request body CreateAPIKeyRequest true "API key"
+// @Success 201 {object} CreateAPIKeyResponse
+// @Failure 400 {object} ErrorResponse
+// @Failure 401 {object} ErrorResponse
+// @Failure 403 {object} ErrorResponse
+// @Failure 500 {object} ErrorResponse
+// @Router /users/{user_id}/api-keys [post]
+func (h *Handler) CreateAPIKey(c *middleware.CustomContext) error {
+	userID, err := c.GetUUID("user_id")
+	if err != nil {
+		return echo.NewHTTPError(http.StatusBadRequest, "Invalid user ID")
+	}
+	me := c.Get("user").(*jwt.Token).Claims.(*middleware.JwtCustomClaims)
+	if me.UUID() != userID {
+		return echo.NewHTTPError(http.StatusForbidden, "Forbidden: You can only create API keys for yourself")
+	}
+
+	var input CreateAPIKeyRequest
+	if err := c.BindAndValidate(&input); err != nil {
+		return err
+	}
+	if input.ExpiresAt != nil && !input.ExpiresAt.After(time.Now()) {
+		return c.JSON(http.StatusBadRequest, ErrorResponse{Error: "Expiry must be in the future"})
+	}
+
+	user, err := h.user_svc.Store.GetUserByID(userID)
+	if err != nil {
+		return echo.ErrUnauthorized
+	}
+	if err := service.ValidateScopes(input.Scopes, user.Role); err != nil {
+		return c.JSON(http.StatusBadRequest, ErrorResponse{Error: err.Error()})
+	}
+	key, apiKey, err := h.user_svc.CreateAPIKey(user, input.Name, input.Scopes, input.ExpiresAt)
+	if err != nil {
+		return c.JSON(http.StatusInternalServerError, ErrorResponse{Error: "Failed to create API key"})
+	}
+	return c.JSON(http.StatusCreated, CreateAPIKeyResponse{Key: key, APIKey: FromAPIKeyModel(*apiKey)})
+}
+
+// RevokeAPIKey godoc
+// @Summary Revoke API key
+// @Description Revokes an API key. It stops working immediately. Users can revoke their own keys, admins any user's.
+// @Tags users
+// @Security BearerAuth
+// @Param user_id path string true "User ID (UUID)"
+// @Param key_id path string true "API key ID (UUID)"
+// @Success 204 {string} string "No Content"
+// @Failure 400 {object} ErrorResponse
+// @Failure 401 {object} ErrorResponse
+// @Failure 403 {object} ErrorResponse
+// @Failure 404 {object} ErrorResponse
+// @Failure 500 {object} ErrorResponse
+// @Router /users/{user_id}/api-keys/{key_id} [delete]
+func (h *Handler) RevokeAPIKey(c *middleware.CustomContext) error {
+	userID, err := c.GetUUID("user_id")
+	if err != nil {
+		return echo.NewHTTPError(http.StatusBadRequest, "Invalid user ID")
+	}
+	keyID, err := c.GetUUID("key_id")
+	if err != nil {
+		return echo.NewHTTPError(http.StatusBadRequest, "Invalid API key ID")
+	}
+	me := c.Get("user").(*jwt.Token).Claims.(*middleware.JwtCustomClaims)
+	if me.UUID() != userID && !me.Can(model.PermManageUsers) {
+		return echo.NewHTTPError(http.StatusForbidden, "Forbidden: You can only revoke your own API keys or must be an admin")
+	}
+
+	err = h.user_svc.RevokeAPIKey(me.UUID(), userID, keyID)
+	if errors.Is(err, service.ErrAPIKeyNotFound) {
+		return c.JSON(http.StatusNotFound, ErrorResponse{Error: "API key not found"})
+	}
+	if err != nil {
+		return c.JSON(http.StatusInternalServerError, ErrorResponse{Error: "Failed to revoke API key"})
+	}
+	return c.NoContent(http.StatusNoContent)
+}
+
+// GetAllAPIKeys godoc
+// @Summary List all API keys
+// @Description Lists the API keys of all users, newest first, with when and from where they were last used. Requires the users.manage permission.
+// @Tags admin
+// @Security BearerAuth
+// @Produce json
+// @Success 200 {array} APIKey
+// @Failure 401 {object} ErrorResponse
+// @Failure 403 {object} ErrorResponse
+// @Failure 500 {object} ErrorResponse
+// @Router /admin/api-keys [get]
+func (h *Handler) GetAllAPIKeys(c echo.Context) error {
+	keys, err := h.user_svc.APIKeys.GetAPIKeys()
+	if err != nil {
+		return c.JSON(http.StatusInternalServerError, ErrorResponse{Error: "Failed to retrieve API keys"})
+	}
+	return c.JSON(http.StatusOK, fromAPIKeyModels(keys))
+}
+
+func fromAPIKeyModels(keys []model.APIKey) []APIKey {
+	res := make([]APIKey, 0, len(keys))
+	for _, k := range keys {
+		res = append(res, FromAPIKeyModel(k))
+	}
+	return res
+}
+
+// authorizeAPIKey maps the checks of UserService.AuthorizeAPIKey to HTTP errors.
+func (h *Handler) authorizeAPIKey(key, ip string) (*middleware.JwtCustomClaims, error) {
+	claims, err := h.user_svc.AuthorizeAPIKey(key, ip)
+	if errors.Is(err, service.ErrUserBanned) {
+		return nil, echo.NewHTTPError(http.StatusForbidden, "Account is banned")
+	}
+	if errors.Is(err, service.ErrPendingApproval) {
+		return nil, echo.NewHTTPError(http.StatusForbidden, err.Error())
+	}
+	if err != nil {
+		return nil, echo.NewHTTPError(http.StatusUnauthorized, "Invalid, expired or revoked API key")
+	}
+	return claims, nil
+}
@@ -0,0 +1,65 @@
+package handler
+
+import (
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/ProjectDistribute/distributor/middleware"
+	"github.com/ProjectDistribute/distributor/model"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestAPIKey_ScopeEnforcement(t *testing.T) {
+	s := newTestServer(t)
+	curator, auth := s.user(t, "curator", model.RoleCurator)
+
+	rec := s.do(t, http.MethodPost, "/api/users/"+curator.ID.String()+"/api-keys", CreateAPIKeyRequest{
+		Name:   "bot",
+		Scopes: []string{middleware.ScopePlaylistsRead, middleware.ScopeLibraryWrite},
+	}, auth)
+	require.Equal(t, http.StatusCreated, rec.Code, rec.Body.String())
+	created := decode[CreateAPIKeyResponse](t, rec)
+	key := "ApiKey " + created.Key
+
+	past := time.Now().Add(-time.Minute)
+	expiredKey, _, err := s.h.user_svc.CreateAPIKey(curator, "expired", []string{middleware.ScopePlaylistsRead}, &past)
+	require.NoError(t, err)
+	revokedKey, revoked, err := s.h.user_svc.CreateAPIKey(curator, "revoked", []string{middleware.ScopePlaylistsRead}, nil)
+	require.NoError(t, err)
+	require.NoError(t, s.h.user_svc.RevokeAPIKey(curator.ID, curator.ID, revoked.ID))
+
+	playlists := "/api/users/" + curator.ID.String() + "/playlists"
+	tests := []struct {
+		name   string
+		method string
+		path   string
+		body   any
+		auth   string
+		// want is the expected status, 0 for any status that lets the request through
+		want int
+	}{
+		{"scope granted", http.MethodGet, playlists, nil, key, 0},
+		{"write scope granted", http.MethodPost, "/api/genres", CreateGenreRequest{Name: "Ambient"}, key, 0},
+		{"scope missing", http.MethodPost, playlists, CreatePlaylistRequest{Name: "Mix"}, key, http.StatusForbidden},
+		{"library read missing", http.MethodGet, "/api/songs", nil, key, http.StatusForbidden},
+		{"mail scope missing", http.MethodPost, "/api/mails", nil, key, http.StatusForbidden},
+		{"admin scope missing", http.MethodGet, "/api/admin/artists", nil, key, http.StatusForbidden},
+		{"route without scope", http.MethodGet, "/api/users/me", nil, key, http.StatusUnauthorized},
+		{"session routes", http.MethodGet, "/api/users/" + curator.ID.String() + "/api-keys", nil, key, http.StatusUnauthorized},
+		{"expired key", http.MethodGet, playlists, nil, "ApiKey " + expiredKey, http.StatusUnauthorized},
+		{"revoked key", http.MethodGet, playlists, nil, "ApiKey " + revokedKey, http.StatusUnauthorized},
+		{"unknown key", http.MethodGet, playlists, nil, "ApiKey dk_unknown", http.StatusUnauthorized},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			rec := s.do(t, tt.method, tt.path, tt.body, tt.auth)
+			if tt.want == 0 {
+				assert.NotContains(t, []int{http.StatusUnauthorized, http.StatusForbidden}, rec.Code, rec.Body.String())
+				return
+			}
+			assert.Equal(t, tt.want, rec.Code, rec.Body.String())
+		})
+	}
+}
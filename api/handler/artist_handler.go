@@ -10,9 +10,10 @@ import (
 
 // CreateArtist godoc
 // @Summary Create artist
-// @Description Creates an artist with one or more aliases. Requires an admin JWT.
+// @Description Creates an artist with one or more aliases. Requires the library.edit permission.
 // @Tags artists
 // @Security BearerAuth
+// @Security ApiKeyAuth
 // @Accept json
 // @Produce json
 // @Param request body CreateArtistRequest true "Artist payload"
@@ -71,9 +72,10 @@ func (h *Handler) GetArtistsBatch(c echo.Context) error {
 
 // AddArtistIdentifier godoc
 // @Summary Add artist identifier
-// @Description Adds an identifier to an existing artist. Requires an admin JWT.
+// @Description Adds an identifier to an existing artist. Requires the library.edit permission.
 // @Tags artists
 // @Security BearerAuth
+// @Security ApiKeyAuth
 // @Accept json
 // @Produce json
 // @Param request body AddArtistIdentifierRequest true "Identifier payload"
@@ -106,9 +108,10 @@ func (h *Handler) AddArtistIdentifier(c echo.Context) error {
 
 // UpdateArtist godoc
 // @Summary Update artist
-// @Description Updates artist metadata. Requires an admin JWT.
+// @Description Updates artist metadata. Requires the library.edit permission.
 // @Tags artists
 // @Security BearerAuth
+// @Security ApiKeyAuth
 // @Accept json
 // @Produce json
 // @Param id path string true "Artist ID (UUID)"
@@ -140,9 +143,10 @@ func (h *Handler) UpdateArtist(c echo.Context) error {
 
 // DeleteArtist godoc
 // @Summary Delete artist
-// @Description Deletes an artist by ID. Requires an admin JWT.
+// @Description Deletes an artist by ID. Requires the library.edit permission.
 // @Tags artists
 // @Security BearerAuth
+// @Security ApiKeyAuth
 // @Param id path string true "Artist ID (UUID)"
 // @Success 204 {string} string "No Content"
 // @Failure 400 {object} ErrorResponse
@@ -0,0 +1,373 @@
+package handler
+
+import (
+	"errors"
+	"net/http"
+	"strconv"
+
+	"github.com/ProjectDistribute/distributor/model"
+	"github.com/ProjectDistribute/distributor/service"
+	"github.com/google/uuid"
+	"github.com/labstack/echo/v4"
+	"gorm.io/gorm"
+)
+
+// genreError maps genre service errors to HTTP errors.
+func genreError(err error, action string) error {
+	switch {
+	case errors.Is(err, gorm.ErrRecordNotFound):
+		return echo.NewHTTPError(http.StatusNotFound, "Not found")
+	case errors.Is(err, service.ErrGenreExists):
+		return echo.NewHTTPError(http.StatusConflict, err.Error())
+	case errors.Is(err, service.ErrInvalidGenreKind):
+		return echo.NewHTTPError(http.StatusBadRequest, err.Error())
+	}
+	return echo.NewHTTPError(http.StatusInternalServerError, "Failed to "+action+": "+err.Error())
+}
+
+func pageParams(c echo.Context) (int, int) {
+	page, _ := strconv.Atoi(c.QueryParam("page"))
+	limit, _ := strconv.Atoi(c.QueryParam("limit"))
+	if page < 1 {
+		page = 1
+	}
+	if limit < 1 {
+		limit = 10
+	}
+	return page, limit
+}
+
+// GetGenres godoc
+// @Summary List genres paginated
+// @Description Returns a paginated list of genres, moods and tags by name, with how many songs and albums each is set on.
+// @Tags genres
+// @Produce json
+// @Param kind query string false "Only list this kind" Enums(genre, mood, tag)
+// @Param page query int false "Page number"
+// @Param limit query int false "Items per page"
+// @Success 200 {object} map[string]any
+// @Failure 400 {object} ErrorResponse
+// @Failure 500 {object} ErrorResponse
+// @Router /genres [get]
+func (h *Handler) GetGenres(c echo.Context) error {
+	kind := c.QueryParam("kind")
+	if kind != "" && !model.ValidGenreKind(kind) {
+		return echo.NewHTTPError(http.StatusBadRequest, "Invalid genre kind")
+	}
+	page, limit := pageParams(c)
+
+	genres, hasNext, err := h.genre_svc.Store.GetGenresPaginated(page, limit, kind)
+	if err != nil {
+		return echo.NewHTTPError(http.StatusInternalServerError, "Failed to retrieve genres")
+	}
+	dtos, err := h.genreDetails(genres)
+	if err != nil {
+		return echo.NewHTTPError(http.StatusInternalServerError, "Failed to count genre usage")
+	}
+	return c.JSON(http.StatusOK, map[string]any{
+		"data":     dtos,
+		"has_next": hasNext,
+	})
+}
+
+func (h *Handler) genreDetails(genres []model.Genre) ([]GenreDetail, error) {
+	ids := make([]uuid.UUID, len(genres))
+	for i, g := range genres {
+		ids[i] = g.ID
+	}
+	counts, err := h.genre_svc.Store.GetGenreCounts(ids)
+	if err != nil {
+		return nil, err
+	}
+	dtos := make([]GenreDetail, len(genres))
+	for i, g := range genres {
+		dtos[i] = GenreDetail{
+			Genre:      FromGenreModel(g),
+			SongCount:  counts[g.ID].Songs,
+			AlbumCount: counts[g.ID].Albums,
+		}
+	}
+	return dtos, nil
+}
+
+// GetGenre godoc
+// @Summary Get genre
+// @Description Returns a genre, mood or tag with how many songs and albums it is set on.
+// @Tags genres
+// @Produce json
+// @Param id path string true "Genre ID (UUID)"
+// @Success 200 {object} GenreDetail
+// @Failure 400 {object} ErrorResponse
+// @Failure 404 {object} ErrorResponse
+// @Failure 500 {object} ErrorResponse
+// @Router /genres/{id} [get]
+func (h *Handler) GetGenre(c echo.Context) error {
+	id, err := uuid.Parse(c.Param("id"))
+	if err != nil {
+		return echo.NewHTTPError(http.StatusBadRequest, "Invalid genre ID")
+	}
+
+	genre, err := h.genre_svc.Store.GetGenreByID(id)
+	if err != nil {
+		return genreError(err, "retrieve genre")
+	}
+	dtos, err := h.genreDetails([]model.Genre{*genre})
+	if err != nil {
+		return echo.NewHTTPError(http.StatusInternalServerError, "Failed to count genre usage")
+	}
+	return c.JSON(http.StatusOK, dtos[0])
+}
+
+// GetGenresBatch godoc
+// @Summary Batch get genres
+// @Description Returns a list of genres by IDs.
+// @Tags genres
+// @Accept json
+// @Produce json
+// @Param request body BatchIDRequest true "Genre IDs"
+// @Success 200 {array} Genre
+// @Failure 400 {object} ErrorResponse
+// @Failure 500 {object} ErrorResponse
+// @Router /genres/batch [post]
+func (h *Handler) GetGenresBatch(c echo.Context) error {
+	var req BatchIDRequest
+	if err := c.Bind(&req); err != nil {
+		return echo.NewHTTPError(http.StatusBadRequest, "Invalid request payload")
+	}
+
+	genres, err := h.genre_svc.Store.GetGenresByIDs(req.IDs)
+	if err != nil {
+		return echo.NewHTTPError(http.StatusInternalServerError, "Failed to retrieve genres")
+	}
+	return c.JSON(http.StatusOK, FromGenreModels(genres))
+}
+
+// GetGenreSongs godoc
+// @Summary List songs of a genre
+// @Description Returns a paginated list of the songs a genre, mood or tag is set on, by title.
+// @Tags genres
+// @Produce json
+// @Param id path string true "Genre ID (UUID)"
+// @Param page query int false "Page number"
+// @Param limit query int false "Items per page"
+// @Success 200 {object} map[string]any
+// @Failure 400 {object} ErrorResponse
+// @Failure 500 {object} ErrorResponse
+// @Router /genres/{id}/songs [get]
+func (h *Handler) GetGenreSongs(c echo.Context) error {
+	id, err := uuid.Parse(c.Param("id"))
+	if err != nil {
+		return echo.NewHTTPError(http.StatusBadRequest, "Invalid genre ID")
+	}
+	page, limit := pageParams(c)
+
+	songs, hasNext, err := h.genre_svc.Store.GetSongsForGenre(id, page, limit)
+	if err != nil {
+		return echo.NewHTTPError(http.StatusInternalServerError, "Failed to retrieve songs")
+	}
+	dtos := make([]Song, len(songs))
+	for i, s := range songs {
+		dtos[i] = FromSongModel(s)
+	}
+	return c.JSON(http.StatusOK, map[string]any{
+		"data":     dtos,
+		"has_next": hasNext,
+	})
+}
+
+// GetGenreAlbums godoc
+// @Summary List albums of a genre
+// @Description Returns a paginated list of the albums a genre, mood or tag is set on, by title.
+// @Tags genres
+// @Produce json
+// @Param id path string true "Genre ID (UUID)"
+// @Param page query int false "Page number"
+// @Param limit query int false "Items per page"
+// @Success 200 {object} map[string]any
+// @Failure 400 {object} ErrorResponse
+// @Failure 500 {object} ErrorResponse
+// @Router /genres/{id}/albums [get]
+func (h *Handler) GetGenreAlbums(c echo.Context) error {
+	id, err := uuid.Parse(c.Param("id"))
+	if err != nil {
+		return echo.NewHTTPError(http.StatusBadRequest, "Invalid genre ID")
+	}
+	page, limit := pageParams(c)
+
+	albums, hasNext, err := h.genre_svc.Store.GetAlbumsForGenre(id, page, limit)
+	if err != nil {
+		return echo.NewHTTPError(http.StatusInternalServerError, "Failed to retrieve albums")
+	}
+	dtos := make([]Album, len(albums))
+	for i, a := range albums {
+		dtos[i] = FromAlbumModel(a)
+	}
+	return c.JSON(http.StatusOK, map[string]any{
+		"data":     dtos,
+		"has_next": hasNext,
+	})
+}
+
+// CreateGenre godoc
+// @Summary Create genre
+// @Description Creates a genre, mood or tag. Requires the library.edit permission.
+// @Tags genres
+// @Security BearerAuth
+// @Security ApiKeyAuth
+// @Accept json
+// @Produce json
+// @Param request body CreateGenreRequest true "Genre payload"
+// @Success 201 {object} Genre
+// @Failure 400 {object} ErrorResponse
+// @Failure 401 {object} ErrorResponse
+// @Failure 403 {object} ErrorResponse
+// @Failure 409 {object} ErrorResponse
+// @Failure 500 {object} ErrorResponse
+// @Router /genres [post]
+func (h *Handler) CreateGenre(c echo.Context) error {
+	var req CreateGenreRequest
+	if err := c.Bind(&req); err != nil {
+		return echo.NewHTTPError(http.StatusBadRequest, "Invalid request payload")
+	}
+	if err := c.Validate(&req); err != nil {
+		return echo.NewHTTPError(http.StatusBadRequest, "Name is required")
+	}
+
+	genre, err := h.genre_svc.CreateGenre(req.Name, req.Kind)
+	if err != nil {
+		return genreError(err, "create genre")
+	}
+	return c.JSON(http.StatusCreated, FromGenreModel(*genre))
+}
+
+// UpdateGenre godoc
+// @Summary Update genre
+// @Description Renames a genre or changes its kind. Requires the library.edit permission.
+// @Tags genres
+// @Security BearerAuth
+// @Security ApiKeyAuth
+// @Accept json
+// @Produce json
+// @Param id path string true "Genre ID (UUID)"
+// @Param request body UpdateGenreRequest true "Genre metadata"
+// @Success 200 {object} Genre
+// @Failure 400 {object} ErrorResponse
+// @Failure 401 {object} ErrorResponse
+// @Failure 403 {object} ErrorResponse
+// @Failure 404 {object} ErrorResponse
+// @Failure 409 {object} ErrorResponse
+// @Failure 500 {object} ErrorResponse
+// @Router /genres/{id} [put]
+func (h *Handler) UpdateGenre(c echo.Context) error {
+	id, err := uuid.Parse(c.Param("id"))
+	if err != nil {
+		return echo.NewHTTPError(http.StatusBadRequest, "Invalid genre ID")
+	}
+
+	var req UpdateGenreRequest
+	if err := c.Bind(&req); err != nil {
+		return echo.NewHTTPError(http.StatusBadRequest, "Invalid request payload")
+	}
+
+	genre, err := h.genre_svc.UpdateGenre(id, req.Name, req.Kind)
+	if err != nil {
+		return genreError(err, "update genre")
+	}
+	return c.JSON(http.StatusOK, FromGenreModel(*genre))
+}
+
+// DeleteGenre godoc
+// @Summary Delete genre
+// @Description Deletes a genre and removes it from its songs and albums. Requires the library.edit permission.
+// @Tags genres
+// @Security BearerAuth
+// @Security ApiKeyAuth
+// @Param id path string true "Genre ID (UUID)"
+// @Success 204 {string} string "No Content"
+// @Failure 400 {object} ErrorResponse
+// @Failure 401 {object} ErrorResponse
+// @Failure 403 {object} ErrorResponse
+// @Failure 404 {object} ErrorResponse
+// @Failure 500 {object} ErrorResponse
+// @Router /genres/{id} [delete]
+func (h *Handler) DeleteGenre(c echo.Context) error {
+	id, err := uuid.Parse(c.Param("id"))
+	if err != nil {
+		return echo.NewHTTPError(http.StatusBadRequest, "Invalid genre ID")
+	}
+
+	if err := h.genre_svc.DeleteGenre(id); err != nil {
+		return genreError(err, "delete genre")
+	}
+	return c.NoContent(http.StatusNoContent)
+}
+
+// SetSongGenres godoc
+// @Summary Set song genres
+// @Description Replaces the genres, moods and tags of a song, creating the ones that do not exist. Requires the library.edit permission.
+// @Tags songs
+// @Security BearerAuth
+// @Security ApiKeyAuth
+// @Accept json
+// @Produce json
+// @Param id path string true "Song ID (UUID)"
+// @Param request body SetGenresRequest true "Genres"
+// @Success 200 {object} Song
+// @Failure 400 {object} ErrorResponse
+// @Failure 401 {object} ErrorResponse
+// @Failure 403 {object} ErrorResponse
+// @Failure 404 {object} ErrorResponse
+// @Failure 500 {object} ErrorResponse
+// @Router /songs/{id}/genres [put]
+func (h *Handler) SetSongGenres(c echo.Context) error {
+	id, err := uuid.Parse(c.Param("id"))
+	if err != nil {
+		return echo.NewHTTPError(http.StatusBadRequest, "Invalid song ID")
+	}
+
+	var req SetGenresRequest
+	if err := c.Bind(&req); err != nil {
+		return echo.NewHTTPError(http.StatusBadRequest, "Invalid request payload")
+	}
+
+	song, err := h.genre_svc.SetSongGenres(id, req.Genres)
+	if err != nil {
+		return genreError(err, "set genres")
+	}
+	return c.JSON(http.StatusOK, FromSongModel(*song))
+}
+
+// SetAlbumGenres godoc
+// @Summary Set album genres
+// @Description Replaces the genres, moods and tags of an album, creating the ones that do not exist. Requires the library.edit permission.
+// @Tags albums
+// @Security BearerAuth
+// @Security ApiKeyAuth
+// @Accept json
+// @Produce json
+// @Param id path string true "Album ID (UUID)"
+// @Param request body SetGenresRequest true "Genres"
+// @Success 200 {object} Album
+// @Failure 400 {object} ErrorResponse
+// @Failure 401 {object} ErrorResponse
+// @Failure 403 {object} ErrorResponse
+// @Failure 404 {object} ErrorResponse
+// @Failure 500 {object} ErrorResponse
+// @Router /albums/{id}/genres [put]
+func (h *Handler) SetAlbumGenres(c echo.Context) error {
+	id, err := uuid.Parse(c.Param("id"))
+	if err != nil {
+		return echo.NewHTTPError(http.StatusBadRequest, "Invalid album ID")
+	}
+
+	var req SetGenresRequest
+	if err := c.Bind(&req); err != nil {
+		return echo.NewHTTPError(http.StatusBadRequest, "Invalid request payload")
+	}
+
+	album, err := h.genre_svc.SetAlbumGenres(id, req.Genres)
+	if err != nil {
+		return genreError(err, "set genres")
+	}
+	return c.JSON(http.StatusOK, FromAlbumModel(*album))
+}
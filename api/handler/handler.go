@@ -2,24 +2,41 @@ package handler
 
 import (
 	"log"
+	"runtime"
+	"strconv"
 
 	"github.com/ProjectDistribute/distributor/service"
 	"github.com/ProjectDistribute/distributor/store"
+	"github.com/ProjectDistribute/distributor/utils"
 	"gorm.io/gorm"
 )
 
 type Handler struct {
-	version      string
-	db           *gorm.DB
-	song_svc     *service.SongService
-	mail_svc     *service.MailService
-	artist_svc   *service.ArtistService
-	album_svc    *service.AlbumService
-	user_svc     *service.UserService
-	playlist_svc *service.PlaylistService
-	search_svc   *service.SearchService
-	stats_svc    *service.StatsService
-	settings_svc *store.SettingsStore
+	version        string
+	db             *gorm.DB
+	song_svc       *service.SongService
+	mail_svc       *service.MailService
+	artist_svc     *service.ArtistService
+	album_svc      *service.AlbumService
+	user_svc       *service.UserService
+	playlist_svc   *service.PlaylistService
+	search_svc     *service.SearchService
+	stats_svc      *service.StatsService
+	settings_svc   *store.SettingsStore
+	job_svc        *service.JobService
+	library_svc    *service.LibraryService
+	rendition_svc  *service.RenditionService
+	star_store     *store.StarStore
+	scrobble_store *store.ScrobbleStore
+	oidc_svc       *service.OIDCService
+	login_limiter  *service.LoginLimiter
+	// transcode_svc and transcode_cache are nil when no transcoder is available
+	transcode_svc         *service.TranscodeService
+	transcode_cache       *service.TranscodeCache
+	storage_migration_svc *service.StorageMigrationService
+	genre_svc             *service.GenreService
+	loudness_svc          *service.LoudnessService
+	waveform_svc          *service.WaveformService
 }
 
 func NewHandler(
@@ -34,19 +51,45 @@ func NewHandler(
 	search_svc *service.SearchService,
 	stats_svc *service.StatsService,
 	settings_svc *store.SettingsStore,
+	job_svc *service.JobService,
+	library_svc *service.LibraryService,
+	rendition_svc *service.RenditionService,
+	star_store *store.StarStore,
+	scrobble_store *store.ScrobbleStore,
+	oidc_svc *service.OIDCService,
+	login_limiter *service.LoginLimiter,
+	transcode_svc *service.TranscodeService,
+	transcode_cache *service.TranscodeCache,
+	storage_migration_svc *service.StorageMigrationService,
+	genre_svc *service.GenreService,
+	loudness_svc *service.LoudnessService,
+	waveform_svc *service.WaveformService,
 ) *Handler {
 	return &Handler{
-		version:      version,
-		db:           db,
-		song_svc:     song_svc,
-		mail_svc:     mail_svc,
-		artist_svc:   artist_svc,
-		album_svc:    album_svc,
-		user_svc:     user_svc,
-		playlist_svc: playlist_svc,
-		search_svc:   search_svc,
-		stats_svc:    stats_svc,
-		settings_svc: settings_svc,
+		version:               version,
+		db:                    db,
+		song_svc:              song_svc,
+		mail_svc:              mail_svc,
+		artist_svc:            artist_svc,
+		album_svc:             album_svc,
+		user_svc:              user_svc,
+		playlist_svc:          playlist_svc,
+		search_svc:            search_svc,
+		stats_svc:             stats_svc,
+		settings_svc:          settings_svc,
+		job_svc:               job_svc,
+		library_svc:           library_svc,
+		rendition_svc:         rendition_svc,
+		star_store:            star_store,
+		scrobble_store:        scrobble_store,
+		oidc_svc:              oidc_svc,
+		login_limiter:         login_limiter,
+		transcode_svc:         transcode_svc,
+		transcode_cache:       transcode_cache,
+		storage_migration_svc: storage_migration_svc,
+		genre_svc:             genre_svc,
+		loudness_svc:          loudness_svc,
+		waveform_svc:          waveform_svc,
 	}
 }
 
@@ -59,25 +102,96 @@ func GigaHandler(d *gorm.DB, storage service.FileStorage, version string) *Handl
 	user_store := store.NewUserStore(d)
 	playlist_store := store.NewPlaylistStore(d)
 	settings_store := store.NewSettingsStore(d)
+	rendition_store := store.NewRenditionStore(d)
+	star_store := store.NewStarStore(d)
+	scrobble_store := store.NewScrobbleStore(d)
+	session_store := store.NewSessionStore(d)
+	audit_store := store.NewAuditStore(d)
+	api_key_store := store.NewAPIKeyStore(d)
+	invite_store := store.NewInviteStore(d)
+	identity_store := store.NewIdentityStore(d)
+	storage_migration_store := store.NewStorageMigrationStore(d)
+	genre_store := store.NewGenreStore(d)
 
 	// One-time backfill for playlist ordering
 	if err := playlist_store.BackfillPlaylistOrder(); err != nil {
 		log.Printf("Failed to backfill playlist order: %v\n", err)
 	}
 
+	// Services read and write files through the switchable storage, so a storage
+	// migration can move them to another backend while the server runs
+	live_storage := service.NewSwitchableStorage(storage)
+	storage = live_storage
+
 	// Services
 	search_svc, _ := service.NewSearchService()
 	mail_svc := service.NewMailService(mail_store, settings_store)
 	artist_svc := &service.ArtistService{Store: artist_store, SearchSvc: search_svc}
 	album_svc := &service.AlbumService{Store: album_store, Storage: storage, SearchSvc: search_svc}
-	song_svc := &service.SongService{Store: song_store, Storage: storage, ArtistSvc: artist_svc, AlbumSvc: album_svc, SearchSvc: search_svc}
+	song_svc := &service.SongService{Store: song_store, Storage: storage, ArtistSvc: artist_svc, AlbumSvc: album_svc, SearchSvc: search_svc, Settings: settings_store}
 	playlist_svc := &service.PlaylistService{Store: playlist_store, SearchSvc: search_svc}
 	stats_svc := service.NewStatsService()
+	job_svc := service.NewJobService()
+	genre_svc := &service.GenreService{Store: genre_store, SongStore: song_store, AlbumStore: album_store, SearchSvc: search_svc}
+	library_svc := &service.LibraryService{SongSvc: song_svc, AlbumSvc: album_svc, GenreSvc: genre_svc, Settings: settings_store}
+
+	transcode_svc := newTranscodeService()
+	var transcode_cache *service.TranscodeCache
+	if transcode_svc != nil {
+		cache, err := service.NewTranscodeCache(transcode_svc, settings_store, service.TranscodeCacheDir)
+		if err != nil {
+			log.Printf("Failed to initialize transcode cache: %v\n", err)
+		} else {
+			transcode_cache = cache
+		}
+	}
+
+	rendition_svc := &service.RenditionService{Store: rendition_store, SongStore: song_store, Settings: settings_store, Storage: storage, Transcodes: transcode_svc}
+	var decoder service.PCMDecoder
+	if transcode_svc != nil {
+		if _, ok := transcode_svc.Transcoder.(service.PCMDecoder); ok {
+			decoder = transcode_svc
+		}
+	}
+	loudness_svc := &service.LoudnessService{SongStore: song_store, Storage: storage, Decoder: decoder}
+	waveform_svc := service.NewWaveformService(storage, decoder)
+	song_svc.Waveforms = waveform_svc
+	storage_migration_svc := &service.StorageMigrationService{Store: storage_migration_store, SongStore: song_store, RenditionStore: rendition_store, AlbumSvc: album_svc, Storage: live_storage}
+	if err := storage_migration_svc.ApplyCutover(); err != nil {
+		log.Printf("Failed to apply storage cutover: %v\n", err)
+	}
 
 	secret := getJWTSecret()
-	user_svc := &service.UserService{Store: user_store, PlaylistService: playlist_svc, JWTSecret: secret}
+	user_svc := &service.UserService{Store: user_store, PlaylistService: playlist_svc, Sessions: session_store, Audit: audit_store, Invites: invite_store, APIKeys: api_key_store, Identities: identity_store, Settings: settings_store, JWTSecret: secret}
+
+	oidc_svc := service.NewOIDCService(user_svc, identity_store, settings_store)
+	login_limiter := service.NewLoginLimiter(service.NewMemoryLimiterStore())
 
 	// // Handlers
-	h := NewHandler(version, d, song_svc, mail_svc, artist_svc, album_svc, user_svc, playlist_svc, search_svc, stats_svc, settings_store)
+	h := NewHandler(version, d, song_svc, mail_svc, artist_svc, album_svc, user_svc, playlist_svc, search_svc, stats_svc, settings_store, job_svc, library_svc, rendition_svc, star_store, scrobble_store, oidc_svc, login_limiter, transcode_svc, transcode_cache, storage_migration_svc, genre_svc, loudness_svc, waveform_svc)
+	h.resumeStorageMigration()
 	return h
 }
+
+// newTranscodeService picks the transcoder from the TRANSCODER env var (ffmpeg, fake or none).
+func newTranscodeService() *service.TranscodeService {
+	workers, err := strconv.Atoi(utils.Getenv("TRANSCODE_WORKERS", strconv.Itoa(runtime.NumCPU())))
+	if err != nil || workers < 1 {
+		workers = runtime.NumCPU()
+	}
+
+	switch utils.Getenv("TRANSCODER", "ffmpeg") {
+	case "ffmpeg":
+		ffmpeg := service.NewFFmpegTranscoder()
+		if ffmpeg == nil {
+			log.Println("ffmpeg not found in PATH, on-the-fly transcoding is disabled")
+			return nil
+		}
+		return service.NewTranscodeService(ffmpeg, workers)
+	case "fake":
+		log.Println("Using fake transcoder, streams will not be re-encoded")
+		return service.NewTranscodeService(&service.FakeTranscoder{}, workers)
+	default:
+		return nil
+	}
+}
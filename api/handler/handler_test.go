@@ -0,0 +1,78 @@
+package handler
+
+import (
+	"bytes"
+	"encoding/json"
+	"io"
+	"net/http/httptest"
+	"os"
+	"testing"
+
+	"github.com/ProjectDistribute/distributor/db"
+	"github.com/ProjectDistribute/distributor/model"
+	"github.com/ProjectDistribute/distributor/router"
+	"github.com/ProjectDistribute/distributor/utils"
+	"github.com/labstack/echo/v4"
+	"github.com/stretchr/testify/require"
+	"gorm.io/driver/sqlite"
+	"gorm.io/gorm"
+)
+
+// testServer serves every API route from a fresh database, in a temporary working
+// directory that holds the data and storage folders.
+type testServer struct {
+	e  *echo.Echo
+	h  *Handler
+	db *gorm.DB
+}
+
+func newTestServer(t *testing.T) *testServer {
+	t.Chdir(t.TempDir())
+	t.Setenv("TRANSCODER", "none")
+	require.NoError(t, os.MkdirAll("data/db", 0755))
+
+	d, err := gorm.Open(sqlite.Open("data/db/test.db"), &gorm.Config{})
+	require.NoError(t, err)
+	require.NoError(t, db.AutoMigrate(d))
+
+	h := GigaHandler(d, utils.LocalFileStorage{}, "test")
+	e := router.New()
+	h.Register(e.Group("/api"))
+	return &testServer{e: e, h: h, db: d}
+}
+
+// do sends body, JSON encoded unless nil, with auth as the Authorization header.
+func (s *testServer) do(t *testing.T, method, path string, body any, auth string) *httptest.ResponseRecorder {
+	var r io.Reader
+	if body != nil {
+		b, err := json.Marshal(body)
+		require.NoError(t, err)
+		r = bytes.NewReader(b)
+	}
+	req := httptest.NewRequest(method, path, r)
+	req.Header.Set(echo.HeaderContentType, echo.MIMEApplicationJSON)
+	if auth != "" {
+		req.Header.Set(echo.HeaderAuthorization, auth)
+	}
+	rec := httptest.NewRecorder()
+	s.e.ServeHTTP(rec, req)
+	return rec
+}
+
+// user creates a user with role and returns it with a bearer token of a new session.
+func (s *testServer) user(t *testing.T, username string, role string) (*model.User, string) {
+	user, err := s.h.user_svc.CreateUser(username, "password123")
+	require.NoError(t, err)
+	if role != model.RoleUser {
+		require.NoError(t, s.h.user_svc.Store.SetRole(user, role))
+	}
+	tokens, err := s.h.user_svc.CreateSession(user, "test", "")
+	require.NoError(t, err)
+	return user, "Bearer " + tokens.AccessToken
+}
+
+func decode[T any](t *testing.T, rec *httptest.ResponseRecorder) T {
+	var v T
+	require.NoError(t, json.Unmarshal(rec.Body.Bytes(), &v), rec.Body.String())
+	return v
+}
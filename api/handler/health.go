@@ -34,6 +34,9 @@ func (h *Handler) GetServerInfo(c echo.Context) error {
 		"version":                   h.version,
 		"request_mail_announcement": announcement,
 		"request_mail_categories":   h.mail_svc.GetCategories(),
+		"public_library":            h.isPublicLibrary(),
+		"registration_policy":       h.user_svc.RegistrationPolicy(),
+		"oidc_enabled":              h.oidc_svc.Enabled(),
 	}
 	return c.JSON(http.StatusOK, version)
 }
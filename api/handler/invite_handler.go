@@ -0,0 +1,98 @@
+package handler
+
+import (
+	"net/http"
+	"time"
+
+	"github.com/ProjectDistribute/distributor/middleware"
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/labstack/echo/v4"
+)
+
+// GetInvites godoc
+// @Summary List invites
+// @Description Lists all invite codes, newest first, including used up, expired and revoked ones. Requires the users.manage permission.
+// @Tags admin
+// @Security BearerAuth
+// @Produce json
+// @Success 200 {array} Invite
+// @Failure 401 {object} ErrorResponse
+// @Failure 403 {object} ErrorResponse
+// @Failure 500 {object} ErrorResponse
+// @Router /admin/invites [get]
+func (h *Handler) GetInvites(c echo.Context) error {
+	invites, err := h.user_svc.Invites.GetInvites()
+	if err != nil {
+		return c.JSON(http.StatusInternalServerError, ErrorResponse{Error: "Failed to retrieve invites"})
+	}
+	res := make([]Invite, 0, len(invites))
+	for _, invite := range invites {
+		res = append(res, FromInviteModel(invite))
+	}
+	return c.JSON(http.StatusOK, res)
+}
+
+// CreateInvite godoc
+// @Summary Create invite
+// @Description Mints an invite code for POST /users/signup. Invites are single use unless `max_uses` says otherwise, and may expire or grant admin rights. Requires the users.manage permission.
+// @Tags admin
+// @Security BearerAuth
+// @Accept json
+// @Produce json
+// @Param request body CreateInviteRequest true "Invite"
+// @Success 201 {object} Invite
+// @Failure 400 {object} ErrorResponse
+// @Failure 401 {object} ErrorResponse
+// @Failure 403 {object} ErrorResponse
+// @Failure 500 {object} ErrorResponse
+// @Router /admin/invites [post]
+func (h *Handler) CreateInvite(c *middleware.CustomContext) error {
+	var input CreateInviteRequest
+	if err := c.BindAndValidate(&input); err != nil {
+		return err
+	}
+	if input.ExpiresAt != nil && !input.ExpiresAt.After(time.Now()) {
+		return c.JSON(http.StatusBadRequest, ErrorResponse{Error: "Expiry must be in the future"})
+	}
+	maxUses := 1
+	if input.MaxUses != nil {
+		maxUses = *input.MaxUses
+	}
+
+	me := c.Get("user").(*jwt.Token).Claims.(*middleware.JwtCustomClaims)
+	invite, err := h.user_svc.CreateInvite(me.UUID(), maxUses, input.ExpiresAt, input.GrantAdmin, input.Note)
+	if err != nil {
+		return c.JSON(http.StatusInternalServerError, ErrorResponse{Error: "Failed to create invite"})
+	}
+	return c.JSON(http.StatusCreated, FromInviteModel(*invite))
+}
+
+// RevokeInvite godoc
+// @Summary Revoke invite
+// @Description Revokes an invite code so it can no longer be used. Users who already signed up with it are not affected. Requires the users.manage permission.
+// @Tags admin
+// @Security BearerAuth
+// @Param id path string true "Invite ID (UUID)"
+// @Success 204 {string} string "No Content"
+// @Failure 400 {object} ErrorResponse
+// @Failure 401 {object} ErrorResponse
+// @Failure 403 {object} ErrorResponse
+// @Failure 404 {object} ErrorResponse
+// @Failure 500 {object} ErrorResponse
+// @Router /admin/invites/{id} [delete]
+func (h *Handler) RevokeInvite(c *middleware.CustomContext) error {
+	id, err := c.GetUUID("id")
+	if err != nil {
+		return echo.NewHTTPError(http.StatusBadRequest, "Invalid invite ID")
+	}
+	invite, err := h.user_svc.Invites.GetInviteByID(id)
+	if err != nil {
+		return c.JSON(http.StatusNotFound, ErrorResponse{Error: "Invite not found"})
+	}
+
+	me := c.Get("user").(*jwt.Token).Claims.(*middleware.JwtCustomClaims)
+	if err := h.user_svc.RevokeInvite(me.UUID(), invite); err != nil {
+		return c.JSON(http.StatusInternalServerError, ErrorResponse{Error: "Failed to revoke invite"})
+	}
+	return c.NoContent(http.StatusNoContent)
+}
@@ -0,0 +1,35 @@
+package handler
+
+import (
+	"net/http"
+	"testing"
+
+	"github.com/ProjectDistribute/distributor/model"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestInvites_ReturnInviteDTO(t *testing.T) {
+	s := newTestServer(t)
+	admin, auth := s.user(t, "admin", model.RoleAdmin)
+
+	rec := s.do(t, http.MethodPost, "/api/admin/invites", CreateInviteRequest{Note: "For Sam"}, auth)
+	require.Equal(t, http.StatusCreated, rec.Code, rec.Body.String())
+	created := decode[Invite](t, rec)
+	assert.NotEmpty(t, created.Code)
+	assert.Equal(t, admin.ID, created.CreatedBy)
+	assert.Equal(t, 1, created.MaxUses)
+	assert.True(t, created.Usable)
+	assert.NotContains(t, decode[map[string]any](t, rec), "updated_at")
+
+	rec = s.do(t, http.MethodDelete, "/api/admin/invites/"+created.ID.String(), nil, auth)
+	require.Equal(t, http.StatusNoContent, rec.Code, rec.Body.String())
+
+	rec = s.do(t, http.MethodGet, "/api/admin/invites", nil, auth)
+	require.Equal(t, http.StatusOK, rec.Code, rec.Body.String())
+	invites := decode[[]Invite](t, rec)
+	require.Len(t, invites, 1)
+	assert.Equal(t, created.ID, invites[0].ID)
+	assert.NotNil(t, invites[0].RevokedAt)
+	assert.False(t, invites[0].Usable)
+}
@@ -0,0 +1,79 @@
+package handler
+
+import (
+	"errors"
+	"log"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strconv"
+	"time"
+
+	"github.com/ProjectDistribute/distributor/service"
+	"github.com/ProjectDistribute/distributor/task"
+	"github.com/ProjectDistribute/distributor/utils"
+	"github.com/labstack/echo/v4"
+)
+
+// StartInboxWatcher imports files dropped into INBOX_DIR when INBOX_WATCH is true.
+func (h *Handler) StartInboxWatcher() {
+	if utils.Getenv("INBOX_WATCH", "false") != "true" {
+		return
+	}
+	settle, err := strconv.Atoi(utils.Getenv("INBOX_SETTLE_SECONDS", "10"))
+	if err != nil || settle < 1 {
+		settle = 10
+	}
+	// Quarantined files stay on local disk next to the inbox
+	inbox := service.NewInboxWatcher(utils.Getenv("INBOX_DIR", service.DefaultLibraryScanPath), time.Duration(settle)*time.Second, h.library_svc, utils.LocalFileStorage{})
+	if err := inbox.Start(); err != nil {
+		log.Printf("Failed to start inbox watcher: %v\n", err)
+	}
+}
+
+// ScanLibrary godoc
+// @Summary Scan library directory
+// @Description Starts a background job that walks the configured library_scan_path (default storage/downloads), reads embedded tags and imports every audio file as a song. Requires the server.manage permission.
+// @Tags admin
+// @Security BearerAuth
+// @Security ApiKeyAuth
+// @Produce json
+// @Success 202 {object} service.JobSnapshot
+// @Failure 400 {object} ErrorResponse
+// @Failure 401 {object} ErrorResponse
+// @Failure 403 {object} ErrorResponse
+// @Failure 409 {object} ErrorResponse
+// @Router /admin/library/scan [post]
+func (h *Handler) ScanLibrary(c echo.Context) error {
+	root := filepath.Clean(h.library_svc.ScanPath())
+	if info, err := os.Stat(root); err != nil || !info.IsDir() {
+		return c.JSON(http.StatusBadRequest, ErrorResponse{Error: "Library scan path is not a directory: " + root})
+	}
+
+	job, err := h.job_svc.Start("library_scan", func(job *service.Job) error {
+		return task.ScanLibrary(h.library_svc, root, job)
+	})
+	if errors.Is(err, service.ErrJobRunning) {
+		return c.JSON(http.StatusConflict, ErrorResponse{Error: "A library scan is already running"})
+	}
+	if err != nil {
+		return c.JSON(http.StatusInternalServerError, ErrorResponse{Error: err.Error()})
+	}
+
+	return c.JSON(http.StatusAccepted, job.Snapshot())
+}
+
+// GetJobs godoc
+// @Summary List background jobs
+// @Description Returns the status of the most recent run of every background job. Requires the server.manage permission.
+// @Tags admin
+// @Security BearerAuth
+// @Security ApiKeyAuth
+// @Produce json
+// @Success 200 {array} service.JobSnapshot
+// @Failure 401 {object} ErrorResponse
+// @Failure 403 {object} ErrorResponse
+// @Router /admin/jobs [get]
+func (h *Handler) GetJobs(c echo.Context) error {
+	return c.JSON(http.StatusOK, h.job_svc.List())
+}
@@ -0,0 +1,55 @@
+package handler
+
+import (
+	"errors"
+	"math"
+	"net/http"
+	"strconv"
+
+	"github.com/ProjectDistribute/distributor/service"
+	"github.com/labstack/echo/v4"
+)
+
+// GetLockouts godoc
+// @Summary List login lockouts
+// @Description Lists the usernames (user:<name>) and IP addresses (ip:<address>) that are locked out after repeated failed logins, longest lock first. Lockouts are kept in memory and cleared by a restart. Requires the users.moderate permission.
+// @Tags admin
+// @Security BearerAuth
+// @Produce json
+// @Success 200 {array} service.Lockout
+// @Failure 401 {object} ErrorResponse
+// @Failure 403 {object} ErrorResponse
+// @Router /admin/lockouts [get]
+func (h *Handler) GetLockouts(c echo.Context) error {
+	return c.JSON(http.StatusOK, h.login_limiter.Locks())
+}
+
+// DeleteLockout godoc
+// @Summary Lift login lockout
+// @Description Lifts the lockout of a username or IP address and forgets its failed logins. Requires the users.moderate permission.
+// @Tags admin
+// @Security BearerAuth
+// @Param key query string true "Locked key, e.g. user:alice or ip:203.0.113.7"
+// @Success 204 {string} string "No Content"
+// @Failure 400 {object} ErrorResponse
+// @Failure 401 {object} ErrorResponse
+// @Failure 403 {object} ErrorResponse
+// @Router /admin/lockouts [delete]
+func (h *Handler) DeleteLockout(c echo.Context) error {
+	key := c.QueryParam("key")
+	if key == "" {
+		return c.JSON(http.StatusBadRequest, ErrorResponse{Error: "Missing key"})
+	}
+	h.login_limiter.Unlock(key)
+	return c.NoContent(http.StatusNoContent)
+}
+
+// rateLimited responds to a throttled attempt with 429 and a Retry-After header.
+func rateLimited(c echo.Context, err error) error {
+	var limit *service.RateLimitError
+	if !errors.As(err, &limit) {
+		return c.JSON(http.StatusInternalServerError, ErrorResponse{Error: err.Error()})
+	}
+	c.Response().Header().Set("Retry-After", strconv.Itoa(int(math.Ceil(limit.RetryAfter.Seconds()))))
+	return c.JSON(http.StatusTooManyRequests, ErrorResponse{Error: limit.Error()})
+}
@@ -0,0 +1,60 @@
+package handler
+
+import (
+	"errors"
+	"fmt"
+	"math"
+	"net/http"
+
+	"github.com/ProjectDistribute/distributor/model"
+	"github.com/ProjectDistribute/distributor/service"
+	"github.com/ProjectDistribute/distributor/task"
+	"github.com/labstack/echo/v4"
+)
+
+// AnalyzeLoudness godoc
+// @Summary Analyze loudness
+// @Description Starts a background job that measures the EBU R128 integrated loudness and true peak of song files and stores their ReplayGain 2.0 track and album gain. Albums are gated as a whole and re-analyzed when any of their files has not been analyzed yet; all=true re-analyzes every album. Requires the server.manage permission.
+// @Tags admin
+// @Security BearerAuth
+// @Security ApiKeyAuth
+// @Produce json
+// @Param all query bool false "Re-analyze files that already have loudness values"
+// @Success 202 {object} service.JobSnapshot
+// @Failure 401 {object} ErrorResponse
+// @Failure 403 {object} ErrorResponse
+// @Failure 409 {object} ErrorResponse
+// @Failure 503 {object} ErrorResponse
+// @Router /admin/loudness/analyze [post]
+func (h *Handler) AnalyzeLoudness(c echo.Context) error {
+	if h.loudness_svc.Decoder == nil {
+		return c.JSON(http.StatusServiceUnavailable, ErrorResponse{Error: "No audio decoder is available on this server"})
+	}
+	all := c.QueryParam("all") == "true"
+
+	job, err := h.job_svc.Start("loudness", func(job *service.Job) error {
+		return task.AnalyzeLoudness(h.loudness_svc, job, all)
+	})
+	if errors.Is(err, service.ErrJobRunning) {
+		return c.JSON(http.StatusConflict, ErrorResponse{Error: "Loudness analysis is already running"})
+	}
+	if err != nil {
+		return c.JSON(http.StatusInternalServerError, ErrorResponse{Error: err.Error()})
+	}
+
+	return c.JSON(http.StatusAccepted, job.Snapshot())
+}
+
+// setReplayGainHeaders describes the loudness of file to players that normalize
+// volume. Peaks are linear as in ReplayGain tags.
+func setReplayGainHeaders(c echo.Context, file *model.SongFile) {
+	if file.LoudnessAnalyzedAt == nil {
+		return
+	}
+	header := c.Response().Header()
+	header.Set("X-ReplayGain-Track-Gain", fmt.Sprintf("%.2f dB", file.TrackGain))
+	header.Set("X-ReplayGain-Track-Peak", fmt.Sprintf("%.6f", math.Pow(10, file.TruePeak/20)))
+	header.Set("X-ReplayGain-Album-Gain", fmt.Sprintf("%.2f dB", file.AlbumGain))
+	header.Set("X-ReplayGain-Album-Peak", fmt.Sprintf("%.6f", math.Pow(10, file.AlbumPeak/20)))
+	header.Set("X-Loudness", fmt.Sprintf("%.2f LUFS", file.Loudness))
+}
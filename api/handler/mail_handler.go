@@ -13,6 +13,7 @@ import (
 // @Description Creates a new music request mail entry. Requires authentication.
 // @Tags mails
 // @Security BearerAuth
+// @Security ApiKeyAuth
 // @Accept json
 // @Produce json
 // @Param request body CreateRequestMailRequest true "Request mail payload"
@@ -67,9 +68,10 @@ func (h *Handler) GetCategories(c echo.Context) error {
 
 // GetRequestMails godoc
 // @Summary List request mails
-// @Description Returns all request mails. Requires an admin JWT.
+// @Description Returns all request mails. Requires the mail.manage permission.
 // @Tags mails
 // @Security BearerAuth
+// @Security ApiKeyAuth
 // @Produce json
 // @Success 200 {array} RequestMail
 // @Failure 401 {object} ErrorResponse
@@ -86,9 +88,10 @@ func (h *Handler) GetRequestMails(c echo.Context) error {
 
 // SetMailStatus godoc
 // @Summary Set request mail status
-// @Description Updates the status of a request mail. Requires an admin JWT. Status values: 0=pending, 1=processing, 2=completed, 3=rejected.
+// @Description Updates the status of a request mail. Requires the mail.manage permission. Status values: 0=pending, 1=processing, 2=completed, 3=rejected.
 // @Tags mails
 // @Security BearerAuth
+// @Security ApiKeyAuth
 // @Accept json
 // @Produce json
 // @Param id path int true "Mail ID"
@@ -127,9 +130,10 @@ func (h *Handler) SetMailStatus(c echo.Context) error {
 
 // GetNextRequestMail godoc
 // @Summary Get next pending request mail
-// @Description Returns the next pending request mail (if any). Requires an admin JWT.
+// @Description Returns the next pending request mail (if any). Requires the mail.manage permission.
 // @Tags mails
 // @Security BearerAuth
+// @Security ApiKeyAuth
 // @Produce json
 // @Success 200 {object} RequestMail
 // @Failure 401 {object} ErrorResponse
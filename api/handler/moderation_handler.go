@@ -0,0 +1,284 @@
+package handler
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/ProjectDistribute/distributor/middleware"
+	"github.com/ProjectDistribute/distributor/model"
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/google/uuid"
+	"github.com/labstack/echo/v4"
+)
+
+// moderationTarget loads the user of the :user_id param and makes sure the acting
+// staff member is not moderating their own account, and that only those allowed to
+// manage users act on other staff.
+func (h *Handler) moderationTarget(c *middleware.CustomContext) (*model.User, uuid.UUID, error) {
+	userID, err := c.GetUUID("user_id")
+	if err != nil {
+		return nil, uuid.Nil, echo.NewHTTPError(http.StatusBadRequest, "Invalid user ID")
+	}
+	me := c.Get("user").(*jwt.Token).Claims.(*middleware.JwtCustomClaims)
+	if me.UUID() == userID {
+		return nil, uuid.Nil, echo.NewHTTPError(http.StatusBadRequest, "You cannot moderate your own account")
+	}
+	user, err := h.user_svc.Store.GetUserByID(userID)
+	if err != nil {
+		return nil, uuid.Nil, echo.NewHTTPError(http.StatusNotFound, "User not found")
+	}
+	if model.IsStaffRole(user.Role) && !me.Can(model.PermManageUsers) {
+		return nil, uuid.Nil, echo.NewHTTPError(http.StatusForbidden, "Only admins can moderate staff accounts")
+	}
+	return user, me.UUID(), nil
+}
+
+// BanUser godoc
+// @Summary Ban user
+// @Description Bans a user until the given time, or permanently if `until` is omitted. The user is signed out everywhere and cannot log in or use existing tokens while banned. Requires the users.moderate permission.
+// @Tags admin
+// @Security BearerAuth
+// @Accept json
+// @Produce json
+// @Param user_id path string true "User ID (UUID)"
+// @Param request body BanUserRequest true "Ban"
+// @Success 200 {object} AdminUser
+// @Failure 400 {object} ErrorResponse
+// @Failure 401 {object} ErrorResponse
+// @Failure 403 {object} ErrorResponse
+// @Failure 404 {object} ErrorResponse
+// @Failure 500 {object} ErrorResponse
+// @Router /admin/users/{user_id}/ban [put]
+func (h *Handler) BanUser(c *middleware.CustomContext) error {
+	user, actorID, err := h.moderationTarget(c)
+	if err != nil {
+		return err
+	}
+
+	var input BanUserRequest
+	if err := c.BindAndValidate(&input); err != nil {
+		return err
+	}
+	if input.Until != nil && !input.Until.After(time.Now()) {
+		return c.JSON(http.StatusBadRequest, ErrorResponse{Error: "Ban end must be in the future"})
+	}
+
+	if err := h.user_svc.BanUser(actorID, user, input.Until, input.Reason); err != nil {
+		return c.JSON(http.StatusInternalServerError, ErrorResponse{Error: "Failed to ban user"})
+	}
+	return c.JSON(http.StatusOK, FromAdminUserModel(*user))
+}
+
+// UnbanUser godoc
+// @Summary Unban user
+// @Description Lifts the ban of a user. Requires the users.moderate permission.
+// @Tags admin
+// @Security BearerAuth
+// @Produce json
+// @Param user_id path string true "User ID (UUID)"
+// @Success 200 {object} AdminUser
+// @Failure 400 {object} ErrorResponse
+// @Failure 401 {object} ErrorResponse
+// @Failure 403 {object} ErrorResponse
+// @Failure 404 {object} ErrorResponse
+// @Failure 500 {object} ErrorResponse
+// @Router /admin/users/{user_id}/ban [delete]
+func (h *Handler) UnbanUser(c *middleware.CustomContext) error {
+	user, actorID, err := h.moderationTarget(c)
+	if err != nil {
+		return err
+	}
+	if err := h.user_svc.UnbanUser(actorID, user); err != nil {
+		return c.JSON(http.StatusInternalServerError, ErrorResponse{Error: "Failed to unban user"})
+	}
+	return c.JSON(http.StatusOK, FromAdminUserModel(*user))
+}
+
+// PromoteUser godoc
+// @Summary Promote user to admin
+// @Description Gives the user the admin role. Takes effect on the user's existing sessions immediately. Requires the users.manage permission.
+// @Tags admin
+// @Security BearerAuth
+// @Produce json
+// @Param user_id path string true "User ID (UUID)"
+// @Success 200 {object} AdminUser
+// @Failure 400 {object} ErrorResponse
+// @Failure 401 {object} ErrorResponse
+// @Failure 403 {object} ErrorResponse
+// @Failure 404 {object} ErrorResponse
+// @Failure 500 {object} ErrorResponse
+// @Router /admin/users/{user_id}/promote [post]
+func (h *Handler) PromoteUser(c *middleware.CustomContext) error {
+	return h.setRole(c, model.RoleAdmin)
+}
+
+// DemoteUser godoc
+// @Summary Demote user
+// @Description Makes the user a regular user, whatever their role. Takes effect on the user's existing sessions immediately. Requires the users.manage permission.
+// @Tags admin
+// @Security BearerAuth
+// @Produce json
+// @Param user_id path string true "User ID (UUID)"
+// @Success 200 {object} AdminUser
+// @Failure 400 {object} ErrorResponse
+// @Failure 401 {object} ErrorResponse
+// @Failure 403 {object} ErrorResponse
+// @Failure 404 {object} ErrorResponse
+// @Failure 500 {object} ErrorResponse
+// @Router /admin/users/{user_id}/demote [post]
+func (h *Handler) DemoteUser(c *middleware.CustomContext) error {
+	return h.setRole(c, model.RoleUser)
+}
+
+// SetUserRole godoc
+// @Summary Set user role
+// @Description Sets the role of a user: user, curator (edits library metadata), moderator (processes request mails, bans and approves users) or admin. Takes effect on the user's existing sessions immediately. Requires the users.manage permission.
+// @Tags admin
+// @Security BearerAuth
+// @Accept json
+// @Produce json
+// @Param user_id path string true "User ID (UUID)"
+// @Param request body SetRoleRequest true "Role"
+// @Success 200 {object} AdminUser
+// @Failure 400 {object} ErrorResponse
+// @Failure 401 {object} ErrorResponse
+// @Failure 403 {object} ErrorResponse
+// @Failure 404 {object} ErrorResponse
+// @Failure 500 {object} ErrorResponse
+// @Router /admin/users/{user_id}/role [put]
+func (h *Handler) SetUserRole(c *middleware.CustomContext) error {
+	var input SetRoleRequest
+	if err := c.BindAndValidate(&input); err != nil {
+		return err
+	}
+	if !model.ValidRole(input.Role) {
+		return c.JSON(http.StatusBadRequest, ErrorResponse{Error: "Unknown role: " + input.Role})
+	}
+	return h.setRole(c, input.Role)
+}
+
+func (h *Handler) setRole(c *middleware.CustomContext, role string) error {
+	user, actorID, err := h.moderationTarget(c)
+	if err != nil {
+		return err
+	}
+	if user.Role != role {
+		if err := h.user_svc.SetRole(actorID, user, role); err != nil {
+			return c.JSON(http.StatusInternalServerError, ErrorResponse{Error: "Failed to update role"})
+		}
+	}
+	return c.JSON(http.StatusOK, FromAdminUserModel(*user))
+}
+
+// ResetUserPassword godoc
+// @Summary Reset user password
+// @Description Sets a new password for a user and signs them out everywhere. If no password is given a random one is generated; the password is returned either way. Requires the users.manage permission.
+// @Tags admin
+// @Security BearerAuth
+// @Accept json
+// @Produce json
+// @Param user_id path string true "User ID (UUID)"
+// @Param request body ResetPasswordRequest false "New password"
+// @Success 200 {object} ResetPasswordResponse
+// @Failure 400 {object} ErrorResponse
+// @Failure 401 {object} ErrorResponse
+// @Failure 403 {object} ErrorResponse
+// @Failure 404 {object} ErrorResponse
+// @Failure 500 {object} ErrorResponse
+// @Router /admin/users/{user_id}/reset-password [post]
+func (h *Handler) ResetUserPassword(c *middleware.CustomContext) error {
+	user, actorID, err := h.moderationTarget(c)
+	if err != nil {
+		return err
+	}
+
+	var input ResetPasswordRequest
+	if err := c.BindAndValidate(&input); err != nil {
+		return err
+	}
+	password := input.Password
+	if password == "" {
+		buf := make([]byte, 12)
+		if _, err := rand.Read(buf); err != nil {
+			return c.JSON(http.StatusInternalServerError, ErrorResponse{Error: "Failed to generate password"})
+		}
+		password = hex.EncodeToString(buf)
+	}
+
+	if err := h.user_svc.ResetPassword(actorID, user, password); err != nil {
+		return c.JSON(http.StatusInternalServerError, ErrorResponse{Error: "Failed to reset password"})
+	}
+	return c.JSON(http.StatusOK, ResetPasswordResponse{Password: password})
+}
+
+// GetAuditLog godoc
+// @Summary Get moderation audit log
+// @Description Lists moderation actions, newest first. Requires the users.moderate permission.
+// @Tags admin
+// @Security BearerAuth
+// @Produce json
+// @Param page query int false "Page number"
+// @Param limit query int false "Items per page"
+// @Param target_id query string false "Only actions on this user (UUID)"
+// @Param action query string false "Only this action, e.g. user.ban"
+// @Success 200 {object} AuditLogResponse
+// @Failure 400 {object} ErrorResponse
+// @Failure 401 {object} ErrorResponse
+// @Failure 403 {object} ErrorResponse
+// @Failure 500 {object} ErrorResponse
+// @Router /admin/audit [get]
+func (h *Handler) GetAuditLog(c echo.Context) error {
+	page, _ := strconv.Atoi(c.QueryParam("page"))
+	if page < 1 {
+		page = 1
+	}
+	limit, _ := strconv.Atoi(c.QueryParam("limit"))
+	if limit < 1 || limit > 200 {
+		limit = 50
+	}
+
+	targetID := uuid.Nil
+	if param := c.QueryParam("target_id"); param != "" {
+		id, err := uuid.Parse(param)
+		if err != nil {
+			return c.JSON(http.StatusBadRequest, ErrorResponse{Error: "Invalid target ID"})
+		}
+		targetID = id
+	}
+
+	entries, total, err := h.user_svc.Audit.GetAuditEntries(targetID, c.QueryParam("action"), limit, (page-1)*limit)
+	if err != nil {
+		return c.JSON(http.StatusInternalServerError, ErrorResponse{Error: "Failed to retrieve audit log"})
+	}
+	return c.JSON(http.StatusOK, AuditLogResponse{Data: entries, Total: total, Page: page, Limit: limit})
+}
+
+// ApproveUser godoc
+// @Summary Approve user
+// @Description Lets a user who signed up under the admin_approval registration policy log in. Reject a sign up by deleting the user. Requires the users.moderate permission.
+// @Tags admin
+// @Security BearerAuth
+// @Produce json
+// @Param user_id path string true "User ID (UUID)"
+// @Success 200 {object} AdminUser
+// @Failure 400 {object} ErrorResponse
+// @Failure 401 {object} ErrorResponse
+// @Failure 403 {object} ErrorResponse
+// @Failure 404 {object} ErrorResponse
+// @Failure 500 {object} ErrorResponse
+// @Router /admin/users/{user_id}/approve [post]
+func (h *Handler) ApproveUser(c *middleware.CustomContext) error {
+	user, actorID, err := h.moderationTarget(c)
+	if err != nil {
+		return err
+	}
+	if user.PendingApproval {
+		if err := h.user_svc.ApproveUser(actorID, user); err != nil {
+			return c.JSON(http.StatusInternalServerError, ErrorResponse{Error: "Failed to approve user"})
+		}
+	}
+	return c.JSON(http.StatusOK, FromAdminUserModel(*user))
+}
@@ -0,0 +1,32 @@
+package handler
+
+import (
+	"net/http"
+	"testing"
+
+	"github.com/ProjectDistribute/distributor/model"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestModeration_ReturnsAdminUser(t *testing.T) {
+	s := newTestServer(t)
+	_, auth := s.user(t, "moderator", model.RoleModerator)
+	target, _ := s.user(t, "target", model.RoleUser)
+
+	rec := s.do(t, http.MethodPut, "/api/admin/users/"+target.ID.String()+"/ban", BanUserRequest{Reason: "Spam"}, auth)
+	require.Equal(t, http.StatusOK, rec.Code, rec.Body.String())
+	banned := decode[AdminUser](t, rec)
+	assert.Equal(t, target.ID, banned.ID)
+	require.NotNil(t, banned.BannedUntil)
+	assert.Equal(t, "Spam", banned.BanReason)
+
+	raw := decode[map[string]any](t, rec)
+	for _, field := range []string{"PasswordHash", "SubsonicPassword", "password_hash", "DeletedAt"} {
+		assert.NotContains(t, raw, field)
+	}
+
+	rec = s.do(t, http.MethodDelete, "/api/admin/users/"+target.ID.String()+"/ban", nil, auth)
+	require.Equal(t, http.StatusOK, rec.Code, rec.Body.String())
+	assert.Nil(t, decode[AdminUser](t, rec).BannedUntil)
+}
@@ -0,0 +1,102 @@
+package handler
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/ProjectDistribute/distributor/service"
+	"github.com/labstack/echo/v4"
+)
+
+// OIDCLogin godoc
+// @Summary Start OpenID Connect login
+// @Description Redirects the browser to the configured identity provider. After login the provider returns to /auth/oidc/callback.
+// @Description With `redirect` the callback sends the browser on to that URL with the login result in the fragment (`#token=...&refresh_token=...` or `#error=...`); without it the callback responds with JSON like /users/login.
+// @Description `redirect` must be a path on this server or start with one of the prefixes in the oidc_allowed_redirects setting.
+// @Tags users
+// @Param redirect query string false "Where to send the browser after login"
+// @Success 302 {string} string "Redirect to the identity provider"
+// @Failure 400 {object} ErrorResponse
+// @Failure 404 {object} ErrorResponse
+// @Failure 502 {object} ErrorResponse
+// @Router /auth/oidc/login [get]
+func (h *Handler) OIDCLogin(c echo.Context) error {
+	authURL, err := h.oidc_svc.AuthURL(c.Request().Context(), c.QueryParam("redirect"))
+	switch {
+	case errors.Is(err, service.ErrOIDCNotConfigured):
+		return c.JSON(http.StatusNotFound, ErrorResponse{Error: err.Error()})
+	case errors.Is(err, service.ErrOIDCRedirectNotAllowed):
+		return c.JSON(http.StatusBadRequest, ErrorResponse{Error: err.Error()})
+	case err != nil:
+		log.Printf("OIDC login failed: %v\n", err)
+		return c.JSON(http.StatusBadGateway, ErrorResponse{Error: "Identity provider is unavailable"})
+	}
+	return c.Redirect(http.StatusFound, authURL)
+}
+
+// OIDCCallback godoc
+// @Summary OpenID Connect callback
+// @Description Redirect target registered at the identity provider. Redeems the authorization code, links or provisions the user and starts a session.
+// @Tags users
+// @Produce json
+// @Param code query string false "Authorization code"
+// @Param state query string true "Login state"
+// @Param error query string false "Error reported by the provider"
+// @Success 200 {object} LoginResponse
+// @Success 302 {string} string "Redirect to the client with the login result in the fragment"
+// @Failure 400 {object} ErrorResponse
+// @Failure 401 {object} ErrorResponse
+// @Failure 403 {object} ErrorResponse
+// @Router /auth/oidc/callback [get]
+func (h *Handler) OIDCCallback(c echo.Context) error {
+	state := c.QueryParam("state")
+	if providerErr := c.QueryParam("error"); providerErr != "" {
+		redirect := h.oidc_svc.CancelLogin(state)
+		msg := strings.TrimSpace(providerErr + " " + c.QueryParam("error_description"))
+		return oidcFail(c, redirect, http.StatusUnauthorized, "Login was rejected by the identity provider: "+msg)
+	}
+
+	login, err := h.oidc_svc.Complete(c.Request().Context(), c.QueryParam("code"), state)
+	switch {
+	case errors.Is(err, service.ErrOIDCInvalidState):
+		return c.JSON(http.StatusBadRequest, ErrorResponse{Error: err.Error()})
+	case errors.Is(err, service.ErrOIDCProvisioningDisabled), errors.Is(err, service.ErrRegistrationClosed), errors.Is(err, service.ErrInviteRequired):
+		return oidcFail(c, "", http.StatusForbidden, err.Error())
+	case err != nil:
+		log.Printf("OIDC callback failed: %v\n", err)
+		return oidcFail(c, "", http.StatusUnauthorized, "Login with the identity provider failed")
+	}
+
+	res, failure := h.startSession(c, login.User, "")
+	if failure != nil {
+		if login.Redirect != "" {
+			return oidcFail(c, login.Redirect, failure.Code, fmt.Sprint(failure.Message))
+		}
+		return c.JSON(failure.Code, failure.Message)
+	}
+
+	if login.Redirect == "" {
+		return c.JSON(http.StatusOK, res)
+	}
+	fragment := url.Values{}
+	fragment.Set("token", res["token"].(string))
+	fragment.Set("refresh_token", res["refresh_token"].(string))
+	fragment.Set("expires_at", res["expires_at"].(time.Time).Format(time.RFC3339))
+	fragment.Set("session_id", fmt.Sprint(res["session_id"]))
+	return c.Redirect(http.StatusFound, login.Redirect+"#"+fragment.Encode())
+}
+
+// oidcFail reports a failed login to the client redirect if there is one, else as JSON.
+func oidcFail(c echo.Context, redirect string, code int, msg string) error {
+	if redirect == "" {
+		return c.JSON(code, ErrorResponse{Error: msg})
+	}
+	fragment := url.Values{}
+	fragment.Set("error", msg)
+	return c.Redirect(http.StatusFound, redirect+"#"+fragment.Encode())
+}
@@ -12,26 +12,100 @@ type Song struct {
 	ID        uuid.UUID `json:"id" example:"00000000-0000-0000-0000-000000000000"`
 	CreatedAt time.Time `json:"created_at"`
 	Title     string    `json:"title" example:"Song Title"`
-	AlbumID   uuid.UUID `json:"album_id"`
-	Album     Album     `json:"album"`
-	Artists   []Artist  `json:"artists"`
+	// TrackNumber and DiscNumber are 0 when unknown.
+	TrackNumber int       `json:"track_number" example:"1"`
+	DiscNumber  int       `json:"disc_number" example:"1"`
+	AlbumID     uuid.UUID `json:"album_id"`
+	Album       Album     `json:"album"`
+	Artists     []Artist  `json:"artists"`
+	Genres      []Genre   `json:"genres"`
+	// Loudness is taken from an analyzed file of the song, omitted when none is
+	// or the files were not loaded.
+	Loudness *Loudness `json:"loudness,omitempty"`
+}
+
+// Loudness is the EBU R128 loudness and ReplayGain 2.0 gain of a song file.
+type Loudness struct {
+	Integrated float64   `json:"integrated" example:"-10.48"` // LUFS
+	TruePeak   float64   `json:"true_peak" example:"-0.1"`    // dBTP
+	TrackGain  float64   `json:"track_gain" example:"-7.52"`  // dB
+	AlbumGain  float64   `json:"album_gain" example:"-6.9"`   // dB
+	AlbumPeak  float64   `json:"album_peak" example:"-0.1"`   // dBTP
+	AnalyzedAt time.Time `json:"analyzed_at"`
+}
+
+// FromSongFileLoudness returns nil when m was not analyzed yet.
+func FromSongFileLoudness(m model.SongFile) *Loudness {
+	if m.LoudnessAnalyzedAt == nil {
+		return nil
+	}
+	return &Loudness{
+		Integrated: m.Loudness,
+		TruePeak:   m.TruePeak,
+		TrackGain:  m.TrackGain,
+		AlbumGain:  m.AlbumGain,
+		AlbumPeak:  m.AlbumPeak,
+		AnalyzedAt: *m.LoudnessAnalyzedAt,
+	}
+}
+
+// songLoudness returns the loudness of the first analyzed file of files.
+func songLoudness(files []model.SongFile) *Loudness {
+	for _, f := range files {
+		if l := FromSongFileLoudness(f); l != nil {
+			return l
+		}
+	}
+	return nil
 }
 
 type SongFile struct {
-	ID        uuid.UUID `json:"id"`
-	CreatedAt time.Time `json:"created_at"`
-	Format    string    `json:"format"`
-	Duration  uint      `json:"duration"`
-	Size      int64     `json:"size"`
+	ID         uuid.UUID `json:"id"`
+	CreatedAt  time.Time `json:"created_at"`
+	Format     string    `json:"format"`
+	Duration   uint      `json:"duration"`
+	Size       int64     `json:"size"`
+	Bitrate    int       `json:"bitrate,omitempty" example:"320"`
+	SampleRate int       `json:"sample_rate,omitempty" example:"44100"`
+	BitDepth   int       `json:"bit_depth,omitempty" example:"16"`
+	Channels   int       `json:"channels,omitempty" example:"2"`
+	Codec      string    `json:"codec,omitempty" example:"flac"`
+	SHA256     string    `json:"sha256,omitempty"`
+	Linked     bool      `json:"linked,omitempty"` // shares its audio with a file of another song
+	Corrupt    bool      `json:"corrupt,omitempty"`
+	// Loudness is null until the loudness analysis job measured the file.
+	Loudness   *Loudness       `json:"loudness"`
+	Renditions []SongRendition `json:"renditions"`
+}
+
+type SongRendition struct {
+	ID         uuid.UUID `json:"id"`
+	CreatedAt  time.Time `json:"created_at"`
+	SongFileID uuid.UUID `json:"song_file_id"`
+	SongID     uuid.UUID `json:"song_id"`
+	Profile    string    `json:"profile" example:"opus-128"`
+	Format     string    `json:"format"`
+	Bitrate    int       `json:"bitrate"`
+	Duration   uint      `json:"duration"`
+	Size       int64     `json:"size"`
 }
 
 type User struct {
 	ID           uuid.UUID `json:"id"`
 	Username     string    `json:"username"`
 	IsAdmin      bool      `json:"is_admin"`
+	Role         string    `json:"role" example:"user"`
 	RootFolderID uuid.UUID `json:"root_folder_id"`
 }
 
+// AdminUser is a user as staff see it, with its moderation state.
+type AdminUser struct {
+	User
+	BannedUntil     *time.Time `json:"banned_until,omitempty"`
+	BanReason       string     `json:"ban_reason,omitempty"`
+	PendingApproval bool       `json:"pending_approval"`
+}
+
 type Playlist struct {
 	ID            uuid.UUID              `json:"id"`
 	Name          string                 `json:"name"`
@@ -46,6 +120,8 @@ type Playlist struct {
 type PlaylistSongResponse struct {
 	SongID uuid.UUID `json:"song_id"`
 	Order  string    `json:"order"`
+	// Loudness of the song, see Song.loudness.
+	Loudness *Loudness `json:"loudness,omitempty"`
 }
 
 type PlaylistFolder struct {
@@ -65,6 +141,20 @@ type Artist struct {
 	CreatedAt   time.Time          `json:"created_at"`
 }
 
+type Genre struct {
+	ID        uuid.UUID `json:"id"`
+	Name      string    `json:"name" example:"Shoegaze"`
+	Kind      string    `json:"kind" example:"genre" enums:"genre,mood,tag"`
+	CreatedAt time.Time `json:"created_at"`
+}
+
+// GenreDetail is a genre with the number of songs and albums it is set on.
+type GenreDetail struct {
+	Genre
+	SongCount  int `json:"song_count"`
+	AlbumCount int `json:"album_count"`
+}
+
 type ArtistIdentifier struct {
 	ID         uuid.UUID `json:"id"`
 	ArtistID   uuid.UUID `json:"artist_id"`
@@ -75,9 +165,13 @@ type Album struct {
 	ID          uuid.UUID `json:"id"`
 	Title       string    `json:"title"`
 	ReleaseDate time.Time `json:"release_date"`
-	ArtistName  string    `json:"artist_name"` // Computed
-	Songs       []Song    `json:"songs"`
-	CreatedAt   time.Time `json:"created_at"`
+	Type        string    `json:"type" example:"album" enums:"album,ep,single,compilation"`
+	// ArtistName joins the album artists, or the song artists when there are none
+	ArtistName   string    `json:"artist_name"`
+	AlbumArtists []Artist  `json:"album_artists"`
+	Genres       []Genre   `json:"genres"`
+	Songs        []Song    `json:"songs"`
+	CreatedAt    time.Time `json:"created_at"`
 }
 
 type RequestMail struct {
@@ -90,11 +184,13 @@ type RequestMail struct {
 
 func FromSongModel(m model.Song) Song {
 	s := Song{
-		ID:        m.ID,
-		CreatedAt: m.CreatedAt,
-		Title:     m.Title,
-		AlbumID:   m.AlbumID,
-		Album:     FromAlbumModel(m.Album),
+		ID:          m.ID,
+		CreatedAt:   m.CreatedAt,
+		Title:       m.Title,
+		TrackNumber: m.TrackNumber,
+		DiscNumber:  m.DiscNumber,
+		AlbumID:     m.AlbumID,
+		Album:       FromAlbumModel(m.Album),
 	}
 	if len(m.Artists) > 0 {
 		s.Artists = make([]Artist, len(m.Artists))
@@ -102,6 +198,8 @@ func FromSongModel(m model.Song) Song {
 			s.Artists[i] = FromArtistModel(a)
 		}
 	}
+	s.Genres = FromGenreModels(m.Genres)
+	s.Loudness = songLoudness(m.SongFiles)
 	return s
 }
 
@@ -111,25 +209,295 @@ func FromSongFileModels(ms []model.SongFile) []SongFile {
 	}
 	files := make([]SongFile, len(ms))
 	for i, m := range ms {
-		files[i] = SongFile{
-			ID:        m.ID,
-			CreatedAt: m.CreatedAt,
-			Format:    m.Format,
-			Duration:  m.Duration,
-			Size:      m.Size,
-		}
+		files[i] = FromSongFileModel(m)
 	}
 	return files
 }
 
+func FromSongFileModel(m model.SongFile) SongFile {
+	return SongFile{
+		ID:         m.ID,
+		CreatedAt:  m.CreatedAt,
+		Format:     m.Format,
+		Duration:   m.Duration,
+		Size:       m.Size,
+		Bitrate:    m.Bitrate,
+		SampleRate: m.SampleRate,
+		BitDepth:   m.BitDepth,
+		Channels:   m.Channels,
+		Codec:      m.Codec,
+		SHA256:     m.SHA256,
+		Linked:     m.BlobID != nil,
+		Corrupt:    m.Corrupt,
+		Loudness:   FromSongFileLoudness(m),
+		Renditions: FromSongRenditionModels(m.Renditions),
+	}
+}
+
+// Waveform is a song file waveform in the JSON layout of audiowaveform.
+type Waveform struct {
+	Version         int `json:"version" example:"2"`
+	Channels        int `json:"channels" example:"1"`
+	SampleRate      int `json:"sample_rate" example:"48000"`
+	SamplesPerPixel int `json:"samples_per_pixel" example:"12544"`
+	Bits            int `json:"bits" example:"8"`
+	Length          int `json:"length" example:"1000"`
+	// Data holds a min and a max per bucket.
+	Data []int8 `json:"data"`
+}
+
+func FromWaveform(w *service.Waveform) Waveform {
+	return Waveform{
+		Version:         2,
+		Channels:        1,
+		SampleRate:      w.SampleRate,
+		SamplesPerPixel: w.SamplesPerPixel,
+		Bits:            8,
+		Length:          w.Length(),
+		Data:            w.Data,
+	}
+}
+
+// DuplicateAudio is a set of songs whose files have identical audio.
+type DuplicateAudio struct {
+	SHA256 string     `json:"sha256"`
+	Songs  []Song     `json:"songs"`
+	Files  []SongFile `json:"files"`
+}
+
+func FromDuplicateAudio(groups []service.DuplicateAudio) []DuplicateAudio {
+	out := make([]DuplicateAudio, len(groups))
+	for i, g := range groups {
+		out[i] = DuplicateAudio{SHA256: g.SHA256, Songs: make([]Song, len(g.Songs)), Files: FromSongFileModels(g.Files)}
+		for j, song := range g.Songs {
+			out[i].Songs[j] = FromSongModel(song)
+		}
+	}
+	return out
+}
+
+// EmbeddedTags are the tags read from an audio file, zero values when not tagged.
+type EmbeddedTags struct {
+	Title       string         `json:"title" example:"Come Together"`
+	Artists     []string       `json:"artists" example:"The Beatles"`
+	AlbumArtist string         `json:"album_artist" example:"The Beatles"`
+	Album       string         `json:"album" example:"Abbey Road"`
+	Year        int            `json:"year" example:"1969"`
+	TrackNumber int            `json:"track_number" example:"1"`
+	TrackTotal  int            `json:"track_total" example:"17"`
+	DiscNumber  int            `json:"disc_number" example:"1"`
+	DiscTotal   int            `json:"disc_total" example:"1"`
+	Genre       string         `json:"genre" example:"Rock"`
+	ISRC        string         `json:"isrc" example:"GBAYE0601690"`
+	MusicBrainz MusicBrainzIDs `json:"musicbrainz"`
+	Artwork     *Artwork       `json:"artwork,omitempty"`
+}
+
+type MusicBrainzIDs struct {
+	RecordingID    string   `json:"recording_id,omitempty"`
+	TrackID        string   `json:"track_id,omitempty"`
+	AlbumID        string   `json:"album_id,omitempty"`
+	ReleaseGroupID string   `json:"release_group_id,omitempty"`
+	ArtistIDs      []string `json:"artist_ids,omitempty"`
+	AlbumArtistIDs []string `json:"album_artist_ids,omitempty"`
+}
+
+// Artwork is an embedded picture, Data is base64 encoded.
+type Artwork struct {
+	MIMEType string `json:"mime_type" example:"image/jpeg"`
+	Size     int    `json:"size" example:"48213"`
+	Data     []byte `json:"data" swaggertype:"string" format:"base64"`
+}
+
+type AudioProperties struct {
+	Duration   float64 `json:"duration" example:"259.6"`
+	Bitrate    int     `json:"bitrate" example:"1024"`
+	SampleRate int     `json:"sample_rate" example:"44100"`
+	BitDepth   int     `json:"bit_depth" example:"16"`
+	Channels   int     `json:"channels" example:"2"`
+	Codec      string  `json:"codec" example:"flac"`
+}
+
+func FromAudioInfo(info service.AudioInfo) AudioProperties {
+	return AudioProperties{
+		Duration:   info.Duration,
+		Bitrate:    info.Bitrate,
+		SampleRate: info.SampleRate,
+		BitDepth:   info.BitDepth,
+		Channels:   info.Channels,
+		Codec:      info.Codec,
+	}
+}
+
+// AudioValidation is the result of checking an upload's content against its declared format.
+type AudioValidation struct {
+	Valid          bool   `json:"valid"`
+	DeclaredFormat string `json:"declared_format" example:"mp3"`
+	// DetectedFormat is empty when the content is not a supported audio format.
+	DetectedFormat string `json:"detected_format" example:"mp3"`
+	ContentType    string `json:"content_type" example:"text/html; charset=utf-8"`
+	// Audio is null when the content could not be probed.
+	Audio    *AudioProperties `json:"audio"`
+	Problems []string         `json:"problems"`
+}
+
+func FromAudioValidation(v service.AudioValidation) AudioValidation {
+	out := AudioValidation{
+		Valid:          v.Valid(),
+		DeclaredFormat: v.DeclaredFormat,
+		DetectedFormat: v.DetectedFormat,
+		ContentType:    v.ContentType,
+		Problems:       v.Problems,
+	}
+	if out.Problems == nil {
+		out.Problems = []string{}
+	}
+	if v.Info.SampleRate > 0 || v.Info.Duration > 0 {
+		audio := FromAudioInfo(v.Info)
+		out.Audio = &audio
+	}
+	return out
+}
+
+// InvalidAudioResponse is returned with 422 when an uploaded file is not valid audio.
+type InvalidAudioResponse struct {
+	Message    string          `json:"message" example:"invalid audio file: content is not a supported audio format (detected text/html; charset=utf-8)"`
+	Validation AudioValidation `json:"validation"`
+}
+
+func FromAudioTags(t *service.AudioTags) EmbeddedTags {
+	tags := EmbeddedTags{
+		Title:       t.Title,
+		Artists:     t.Artists,
+		AlbumArtist: t.AlbumArtist,
+		Album:       t.Album,
+		Year:        t.Year,
+		TrackNumber: t.TrackNumber,
+		TrackTotal:  t.TrackTotal,
+		DiscNumber:  t.DiscNumber,
+		DiscTotal:   t.DiscTotal,
+		Genre:       t.Genre,
+		ISRC:        t.ISRC,
+		MusicBrainz: MusicBrainzIDs{
+			RecordingID:    t.MBRecordingID,
+			TrackID:        t.MBTrackID,
+			AlbumID:        t.MBAlbumID,
+			ReleaseGroupID: t.MBReleaseGroupID,
+			ArtistIDs:      t.MBArtistIDs,
+			AlbumArtistIDs: t.MBAlbumArtistIDs,
+		},
+	}
+	if tags.Artists == nil {
+		tags.Artists = []string{}
+	}
+	if len(t.Picture) > 0 {
+		tags.Artwork = &Artwork{MIMEType: t.PictureMIMEType, Size: len(t.Picture), Data: t.Picture}
+	}
+	return tags
+}
+
+// TagProposal is how an inspected file maps onto the library.
+type TagProposal struct {
+	// Song is ready to be sent to POST /songs.
+	Song    CreateSongRequest `json:"song"`
+	Artists []ProposedArtist  `json:"artists"`
+	// Album is the existing album the file matches, null if one would be created.
+	Album         *Album `json:"album"`
+	AlbumHasCover bool   `json:"album_has_cover"`
+	// ExistingSong is the song with this title already on the album, the file can be assigned to it instead.
+	ExistingSong *Song `json:"existing_song"`
+	// Problems lists what is missing to create a song, e.g. "missing album tag".
+	Problems []string `json:"problems"`
+}
+
+type ProposedArtist struct {
+	Name       string `json:"name" example:"The Beatles"`
+	Identifier string `json:"identifier" example:"the-beatles"`
+	// Existing is the artist with this identifier, null if one would be created.
+	Existing *Artist `json:"existing"`
+}
+
+func FromTagProposal(p *service.TagProposal, albums *service.AlbumService) TagProposal {
+	out := TagProposal{
+		Song: CreateSongRequest{
+			Title:      p.Title,
+			Artists:    p.SongCreationArtists(),
+			AlbumTitle: p.AlbumTitle,
+		},
+		Artists:  make([]ProposedArtist, len(p.Artists)),
+		Problems: p.Problems,
+	}
+	for i, a := range p.Artists {
+		out.Artists[i] = ProposedArtist{Name: a.Name, Identifier: a.Identifier}
+		if a.Artist != nil {
+			artist := FromArtistModel(*a.Artist)
+			out.Artists[i].Existing = &artist
+		}
+	}
+	if p.Album != nil {
+		album := FromAlbumModel(*p.Album)
+		out.Album = &album
+		out.Song.AlbumID = p.Album.ID
+		out.AlbumHasCover = albums.AlbumHasCover(p.Album.ID, "jpg")
+	}
+	if p.Song != nil {
+		song := FromSongModel(*p.Song)
+		out.ExistingSong = &song
+	}
+	return out
+}
+
+type InspectFileResponse struct {
+	Format string       `json:"format" example:"flac"`
+	Tags   EmbeddedTags `json:"tags"`
+	// Audio is null when the format cannot be probed.
+	Audio      *AudioProperties `json:"audio"`
+	Validation AudioValidation  `json:"validation"`
+	Proposal   TagProposal      `json:"proposal"`
+}
+
+func FromSongRenditionModel(m model.SongRendition) SongRendition {
+	return SongRendition{
+		ID:         m.ID,
+		CreatedAt:  m.CreatedAt,
+		SongFileID: m.SongFileID,
+		SongID:     m.SongID,
+		Profile:    m.Profile,
+		Format:     m.Format,
+		Bitrate:    m.Bitrate,
+		Duration:   m.Duration,
+		Size:       m.Size,
+	}
+}
+
+func FromSongRenditionModels(ms []model.SongRendition) []SongRendition {
+	renditions := make([]SongRendition, len(ms))
+	for i, m := range ms {
+		renditions[i] = FromSongRenditionModel(m)
+	}
+	return renditions
+}
+
 func FromAlbumModel(m model.Album) Album {
-	return Album{
-		ID:          m.ID,
-		CreatedAt:   m.CreatedAt,
-		Title:       m.Title,
-		ReleaseDate: m.ReleaseDate,
-		ArtistName:  m.GetArtistName(),
+	a := Album{
+		ID:           m.ID,
+		CreatedAt:    m.CreatedAt,
+		Title:        m.Title,
+		ReleaseDate:  m.ReleaseDate,
+		Type:         m.Type,
+		ArtistName:   m.GetArtistName(),
+		AlbumArtists: make([]Artist, len(m.AlbumArtists)),
+		Genres:       FromGenreModels(m.Genres),
 	}
+	for i, artist := range m.AlbumArtists {
+		a.AlbumArtists[i] = FromArtistModel(artist)
+	}
+	// Songs are loaded for album lookups, not for the album of a song
+	a.Songs = make([]Song, len(m.Songs))
+	for i, song := range m.Songs {
+		a.Songs[i] = FromSongModel(song)
+	}
+	return a
 }
 
 func FromArtistModel(m model.Artist) Artist {
@@ -151,15 +519,42 @@ func FromArtistModel(m model.Artist) Artist {
 	return a
 }
 
+func FromGenreModel(m model.Genre) Genre {
+	return Genre{
+		ID:        m.ID,
+		Name:      m.Name,
+		Kind:      m.Kind,
+		CreatedAt: m.CreatedAt,
+	}
+}
+
+func FromGenreModels(ms []model.Genre) []Genre {
+	genres := make([]Genre, len(ms))
+	for i, g := range ms {
+		genres[i] = FromGenreModel(g)
+	}
+	return genres
+}
+
 func FromUserModel(m model.User, rootFolderID uuid.UUID) User {
 	return User{
 		ID:           m.ID,
 		Username:     m.Username,
 		IsAdmin:      m.IsAdmin,
+		Role:         m.Role,
 		RootFolderID: rootFolderID,
 	}
 }
 
+func FromAdminUserModel(m model.User) AdminUser {
+	return AdminUser{
+		User:            FromUserModel(m, uuid.Nil),
+		BannedUntil:     m.BannedUntil,
+		BanReason:       m.BanReason,
+		PendingApproval: m.PendingApproval,
+	}
+}
+
 func FromPlaylistModel(m model.Playlist) Playlist {
 	p := Playlist{
 		ID:        m.ID,
@@ -177,8 +572,9 @@ func FromPlaylistModel(m model.Playlist) Playlist {
 	p.PlaylistSongs = make([]PlaylistSongResponse, len(m.PlaylistSongs))
 	for i, s := range m.PlaylistSongs {
 		p.PlaylistSongs[i] = PlaylistSongResponse{
-			SongID: s.SongID,
-			Order:  s.Order,
+			SongID:   s.SongID,
+			Order:    s.Order,
+			Loudness: songLoudness(s.Song.SongFiles),
 		}
 	}
 	return p
@@ -217,6 +613,49 @@ func FromRequestMailModel(m model.RequestMail) RequestMail {
 	}
 }
 
+func FromSessionModel(m model.Session, currentID string) Session {
+	return Session{
+		ID:         m.ID,
+		DeviceName: m.DeviceName,
+		IP:         m.IP,
+		CreatedAt:  m.CreatedAt,
+		LastUsedAt: m.LastUsedAt,
+		ExpiresAt:  m.ExpiresAt,
+		Current:    m.ID.String() == currentID,
+	}
+}
+
+func FromAPIKeyModel(m model.APIKey) APIKey {
+	return APIKey{
+		ID:         m.ID,
+		UserID:     m.UserID,
+		Name:       m.Name,
+		Prefix:     m.Prefix,
+		Scopes:     m.ScopeList(),
+		CreatedAt:  m.CreatedAt,
+		ExpiresAt:  m.ExpiresAt,
+		LastUsedAt: m.LastUsedAt,
+		LastUsedIP: m.LastUsedIP,
+		RevokedAt:  m.RevokedAt,
+	}
+}
+
+func FromInviteModel(m model.Invite) Invite {
+	return Invite{
+		ID:         m.ID,
+		Code:       m.Code,
+		CreatedBy:  m.CreatedBy,
+		Note:       m.Note,
+		CreatedAt:  m.CreatedAt,
+		ExpiresAt:  m.ExpiresAt,
+		MaxUses:    m.MaxUses,
+		Uses:       m.Uses,
+		GrantAdmin: m.GrantAdmin,
+		RevokedAt:  m.RevokedAt,
+		Usable:     m.Usable(),
+	}
+}
+
 // == Responses ==
 
 type SignupResponse string
@@ -275,9 +714,64 @@ type LibraryResponse struct {
 }
 
 type LoginResponse struct {
-	Token    string    `json:"token" example:"eyJhbGciOiJIUzI1NiIsInR5cCI6IkpXVCJ9..."`
-	Username string    `json:"username" example:"alice"`
-	ID       uuid.UUID `json:"id" example:"00000000-0000-0000-0000-000000000000"`
+	Token        string    `json:"token" example:"eyJhbGciOiJIUzI1NiIsInR5cCI6IkpXVCJ9..."`
+	RefreshToken string    `json:"refresh_token" example:"3q2-7wA0b9Qm..."`
+	ExpiresAt    time.Time `json:"expires_at" example:"2024-01-01T00:15:00Z"`
+	SessionID    uuid.UUID `json:"session_id" example:"00000000-0000-0000-0000-000000000000"`
+	Username     string    `json:"username" example:"alice"`
+	ID           uuid.UUID `json:"id" example:"00000000-0000-0000-0000-000000000000"`
+}
+
+type TokenResponse struct {
+	Token        string    `json:"token" example:"eyJhbGciOiJIUzI1NiIsInR5cCI6IkpXVCJ9..."`
+	RefreshToken string    `json:"refresh_token" example:"3q2-7wA0b9Qm..."`
+	ExpiresAt    time.Time `json:"expires_at" example:"2024-01-01T00:15:00Z"`
+	SessionID    uuid.UUID `json:"session_id" example:"00000000-0000-0000-0000-000000000000"`
+}
+
+type Session struct {
+	ID         uuid.UUID `json:"id"`
+	DeviceName string    `json:"device_name" example:"Pixel 8"`
+	IP         string    `json:"ip" example:"203.0.113.7"`
+	CreatedAt  time.Time `json:"created_at"`
+	LastUsedAt time.Time `json:"last_used_at"`
+	ExpiresAt  time.Time `json:"expires_at"`
+	Current    bool      `json:"current"`
+}
+
+type APIKey struct {
+	ID         uuid.UUID  `json:"id"`
+	UserID     uuid.UUID  `json:"user_id"`
+	Name       string     `json:"name" example:"download bot"`
+	Prefix     string     `json:"prefix" example:"dk_Xf3a9Q"`
+	Scopes     []string   `json:"scopes" example:"library:write,mail:read"`
+	CreatedAt  time.Time  `json:"created_at"`
+	ExpiresAt  *time.Time `json:"expires_at"`
+	LastUsedAt *time.Time `json:"last_used_at"`
+	LastUsedIP string     `json:"last_used_ip" example:"203.0.113.7"`
+	RevokedAt  *time.Time `json:"revoked_at"`
+}
+
+type Invite struct {
+	ID        uuid.UUID  `json:"id"`
+	Code      string     `json:"code" example:"k3Jd9aQx"`
+	CreatedBy uuid.UUID  `json:"created_by"`
+	Note      string     `json:"note" example:"For Sam"`
+	CreatedAt time.Time  `json:"created_at"`
+	ExpiresAt *time.Time `json:"expires_at"`
+	// MaxUses is 0 for invites without a limit.
+	MaxUses    int        `json:"max_uses" example:"1"`
+	Uses       int        `json:"uses" example:"0"`
+	GrantAdmin bool       `json:"grant_admin"`
+	RevokedAt  *time.Time `json:"revoked_at"`
+	// Usable is false once the invite is revoked, expired or used up.
+	Usable bool `json:"usable"`
+}
+
+type CreateAPIKeyResponse struct {
+	// Key is only ever returned here. Send it as "Authorization: ApiKey <key>".
+	Key    string `json:"key" example:"dk_Xf3a9Q..."`
+	APIKey APIKey `json:"api_key"`
 }
 
 type CategoriesResponse struct {
@@ -294,31 +788,44 @@ type CompleteSetupRequest struct {
 	RequestMailAnnouncement string `json:"request_mail_announcement"`
 }
 type SignupRequest struct {
-	Username string `json:"username" validate:"required" example:"alice"`
-	Password string `json:"password" validate:"required" example:"correct horse battery staple"`
+	Username   string `json:"username" validate:"required" example:"alice"`
+	Password   string `json:"password" validate:"required" example:"correct horse battery staple"`
+	InviteCode string `json:"invite_code" example:"MFRGGZDFMZTWQ2LK"`
 }
 
 type LoginRequest struct {
-	Username string `json:"username" validate:"required" example:"alice"`
-	Password string `json:"password" validate:"required" example:"correct horse battery staple"`
+	Username   string `json:"username" validate:"required" example:"alice"`
+	Password   string `json:"password" validate:"required" example:"correct horse battery staple"`
+	DeviceName string `json:"device_name" example:"Pixel 8"`
+}
+
+type RefreshTokenRequest struct {
+	RefreshToken string `json:"refresh_token" validate:"required" example:"3q2-7wA0b9Qm..."`
 }
 type CreateSongRequest struct {
-	Title      string                       `json:"title" validate:"required,max=255" example:"Song Title"`
-	Artists    []service.SongCreationArtist `json:"artists" validate:"required,min=1"`
-	AlbumTitle string                       `json:"album_title" example:"Abbey Road"`
-	AlbumID    uuid.UUID                    `json:"album_id" example:"00000000-0000-0000-0000-000000000000"`
+	Title       string                       `json:"title" validate:"required,max=255" example:"Song Title"`
+	Artists     []service.SongCreationArtist `json:"artists" validate:"required,min=1"`
+	AlbumTitle  string                       `json:"album_title" example:"Abbey Road"`
+	AlbumID     uuid.UUID                    `json:"album_id" example:"00000000-0000-0000-0000-000000000000"`
+	TrackNumber int                          `json:"track_number" validate:"min=0" example:"1"`
+	DiscNumber  int                          `json:"disc_number" validate:"min=0" example:"1"`
 }
 
 type CreateAlbumRequest struct {
 	Title       string    `json:"title" validate:"required" example:"Dark Side of the Moon"`
 	ReleaseDate time.Time `json:"release_date" example:"1973-03-01T00:00:00Z"`
+	// Type defaults to album
+	Type         string                       `json:"type" example:"album" enums:"album,ep,single,compilation"`
+	AlbumArtists []service.SongCreationArtist `json:"album_artists"`
 }
 
 type UpdateSongRequest struct {
-	Title      string                       `json:"title" example:"Song Title"`
-	Artists    []service.SongCreationArtist `json:"artists"`
-	AlbumTitle string                       `json:"album_title" example:"Abbey Road"`
-	AlbumID    uuid.UUID                    `json:"album_id" example:"00000000-0000-0000-0000-000000000000"`
+	Title       string                       `json:"title" example:"Song Title"`
+	Artists     []service.SongCreationArtist `json:"artists"`
+	AlbumTitle  string                       `json:"album_title" example:"Abbey Road"`
+	AlbumID     uuid.UUID                    `json:"album_id" example:"00000000-0000-0000-0000-000000000000"`
+	TrackNumber *int                         `json:"track_number" example:"1"`
+	DiscNumber  *int                         `json:"disc_number" example:"1"`
 }
 
 type AssignFileToSongRequest struct {
@@ -395,14 +902,93 @@ type BatchIDRequest struct {
 type UpdateAlbumRequest struct {
 	Title       string    `json:"title"`
 	ReleaseDate time.Time `json:"release_date"`
+	Type        string    `json:"type" example:"ep" enums:"album,ep,single,compilation"`
+	// AlbumArtists replaces the album artists when present, an empty list removes them.
+	AlbumArtists []service.SongCreationArtist `json:"album_artists"`
 }
 
 type UpdateArtistRequest struct {
 	Name string `json:"name"`
 }
 
+type CreateGenreRequest struct {
+	Name string `json:"name" validate:"required" example:"Shoegaze"`
+	// Kind defaults to genre
+	Kind string `json:"kind" example:"genre" enums:"genre,mood,tag"`
+}
+
+type UpdateGenreRequest struct {
+	Name string `json:"name" example:"Dream Pop"`
+	Kind string `json:"kind" example:"genre" enums:"genre,mood,tag"`
+}
+
+// SetGenresRequest replaces all genres, moods and tags of a song or album.
+type SetGenresRequest struct {
+	Genres []service.GenreInput `json:"genres"`
+}
+
 type CreatePlaylistWithContentsRequest struct {
 	UserID  uuid.UUID   `json:"user_id" validate:"required"`
 	Name    string      `json:"name" validate:"required"`
 	SongIDs []uuid.UUID `json:"song_ids" validate:"required"`
 }
+
+type SubsonicPasswordRequest struct {
+	Password string `json:"password"`
+	Disable  bool   `json:"disable"`
+}
+
+type SubsonicPasswordResponse struct {
+	Password string `json:"password"`
+}
+
+type BannedResponse struct {
+	Error       string    `json:"error" example:"Account is banned"`
+	BannedUntil time.Time `json:"banned_until" example:"2024-02-01T00:00:00Z"`
+	Reason      string    `json:"reason" example:"Spam"`
+}
+
+type SetRoleRequest struct {
+	Role string `json:"role" validate:"required" example:"curator"`
+}
+
+type BanUserRequest struct {
+	// Until is the end of the ban, omit it for a permanent ban.
+	Until  *time.Time `json:"until" example:"2024-02-01T00:00:00Z"`
+	Reason string     `json:"reason" validate:"max=500" example:"Spam"`
+}
+
+type ResetPasswordRequest struct {
+	Password string `json:"password" validate:"max=128"`
+}
+
+type ResetPasswordResponse struct {
+	Password string `json:"password"`
+}
+
+type AuditLogResponse struct {
+	Data  []model.AuditEntry `json:"data"`
+	Total int64              `json:"total"`
+	Page  int                `json:"page"`
+	Limit int                `json:"limit"`
+}
+
+type CreateAPIKeyRequest struct {
+	Name      string     `json:"name" validate:"required,max=100" example:"download bot"`
+	Scopes    []string   `json:"scopes" validate:"required,min=1" example:"library:write,mail:read"`
+	ExpiresAt *time.Time `json:"expires_at" example:"2025-01-01T00:00:00Z"`
+}
+
+type CreateInviteRequest struct {
+	// MaxUses defaults to 1, 0 allows unlimited sign ups.
+	MaxUses    *int       `json:"max_uses" validate:"omitempty,min=0" example:"1"`
+	ExpiresAt  *time.Time `json:"expires_at" example:"2024-02-01T00:00:00Z"`
+	GrantAdmin bool       `json:"grant_admin"`
+	Note       string     `json:"note" validate:"max=200" example:"For Sam"`
+}
+
+type StorageMigrationResponse struct {
+	Migration *model.StorageMigration `json:"migration"`
+	// Job is the progress of the copy while it runs in this process.
+	Job *service.JobSnapshot `json:"job,omitempty"`
+}
@@ -17,6 +17,7 @@ import (
 // @Description Creates a playlist under the given folder for the given user. Requires that the JWT subject matches user_id or that the token has admin privileges.
 // @Tags playlists
 // @Security BearerAuth
+// @Security ApiKeyAuth
 // @Accept json
 // @Produce json
 // @Param request body CreatePlaylistRequest true "Playlist payload"
@@ -61,6 +62,7 @@ func (h *Handler) CreatePlaylist(c *middleware.CustomContext) error {
 // @Description Lists playlists owned by the given user.
 // @Tags playlists
 // @Security BearerAuth
+// @Security ApiKeyAuth
 // @Produce json
 // @Param user_id path string true "User ID (UUID)"
 // @Success 200 {array} Playlist
@@ -91,6 +93,7 @@ func (h *Handler) GetUserPlaylists(c *middleware.CustomContext) error {
 // @Description Returns the user's library contents (folders and playlists).
 // @Tags library
 // @Security BearerAuth
+// @Security ApiKeyAuth
 // @Produce json
 // @Param user_id path string true "User ID (UUID)"
 // @Success 200 {object} LibraryResponse
@@ -148,6 +151,7 @@ func (h *Handler) GetLibrary(c *middleware.CustomContext) error {
 // @Description Creates a playlist folder. Requires that the JWT subject matches user_id or that the token has admin privileges.
 // @Tags folders
 // @Security BearerAuth
+// @Security ApiKeyAuth
 // @Accept json
 // @Produce json
 // @Param user_id path string true "User ID (UUID)"
@@ -195,6 +199,7 @@ func (h *Handler) CreatePlaylistFolder(c *middleware.CustomContext) error {
 // @Description Deletes a playlist folder. Admin tokens can delete any folder; non-admin tokens are restricted to their own.
 // @Tags folders
 // @Security BearerAuth
+// @Security ApiKeyAuth
 // @Param user_id path string true "User ID (UUID)"
 // @Param folder_id path string true "Folder ID (UUID)"
 // @Success 204 {string} string "No Content"
@@ -221,6 +226,7 @@ func (h *Handler) DeletePlaylistFolder(c *middleware.CustomContext) error {
 // @Description Returns a playlist with songs, song files, album and artist preloaded.
 // @Tags playlists
 // @Security BearerAuth
+// @Security ApiKeyAuth
 // @Produce json
 // @Param user_id path string true "User ID (UUID)"
 // @Param playlist_id path string true "Playlist ID (UUID)"
@@ -247,6 +253,7 @@ func (h *Handler) GetPlaylist(c *middleware.CustomContext) error {
 // @Description Adds a song to a playlist.
 // @Tags playlists
 // @Security BearerAuth
+// @Security ApiKeyAuth
 // @Accept json
 // @Produce json
 // @Param playlist_id path string true "Playlist ID (UUID)"
@@ -299,6 +306,7 @@ func (h *Handler) AddSongToPlaylist(c *middleware.CustomContext) error {
 // @Description Removes a song from a playlist.
 // @Tags playlists
 // @Security BearerAuth
+// @Security ApiKeyAuth
 // @Produce json
 // @Param playlist_id path string true "Playlist ID (UUID)"
 // @Param song_id path string true "Song ID (UUID)"
@@ -344,6 +352,7 @@ func (h *Handler) RemoveSongFromPlaylist(c *middleware.CustomContext) error {
 // @Description Updates the order of a song in a playlist.
 // @Tags playlists
 // @Security BearerAuth
+// @Security ApiKeyAuth
 // @Produce json
 // @Param playlist_id path string true "Playlist ID (UUID)"
 // @Param song_id path string true "Song ID (UUID)"
@@ -408,6 +417,7 @@ func (h *Handler) RenamePlaylist(c *middleware.CustomContext) error {
 // @Description Moves a playlist to a different folder.
 // @Tags playlists
 // @Security BearerAuth
+// @Security ApiKeyAuth
 // @Accept json
 // @Produce json
 // @Param playlist_id path string true "Playlist ID (UUID)"
@@ -461,6 +471,7 @@ func (h *Handler) MovePlaylistToFolder(c *middleware.CustomContext) error {
 // @Description Renames a playlist folder and returns the updated library. Requires that the JWT subject matches user_id or that the token has admin privileges.
 // @Tags folders
 // @Security BearerAuth
+// @Security ApiKeyAuth
 // @Accept json
 // @Produce json
 // @Param user_id path string true "User ID (UUID)"
@@ -511,6 +522,7 @@ func (h *Handler) RenamePlaylistFolder(c *middleware.CustomContext) error {
 // @Description Moves a folder to a different parent folder and returns the updated library. Requires that the JWT subject matches user_id or that the token has admin privileges.
 // @Tags folders
 // @Security BearerAuth
+// @Security ApiKeyAuth
 // @Accept json
 // @Produce json
 // @Param user_id path string true "User ID (UUID)"
@@ -558,6 +570,7 @@ func (h *Handler) MoveFolderToFolder(c *middleware.CustomContext) error {
 // @Description Returns a list of playlists by IDs.
 // @Tags playlists
 // @Security BearerAuth
+// @Security ApiKeyAuth
 // @Accept json
 // @Produce json
 // @Param user_id path string true "User ID (UUID)"
@@ -592,6 +605,7 @@ func (h *Handler) GetPlaylistsBatch(c *middleware.CustomContext) error {
 // @Description Returns a list of folders by IDs.
 // @Tags folders
 // @Security BearerAuth
+// @Security ApiKeyAuth
 // @Accept json
 // @Produce json
 // @Param user_id path string true "User ID (UUID)"
@@ -630,6 +644,7 @@ func (h *Handler) GetFoldersBatch(c *middleware.CustomContext) error {
 // @Description Creates a new playlist for the given user in their root folder with the given songs. Requires admin privileges.
 // @Tags admin
 // @Security BearerAuth
+// @Security ApiKeyAuth
 // @Accept json
 // @Produce json
 // @Param request body CreatePlaylistWithContentsRequest true "Create playlist with contents payload"
@@ -697,6 +712,7 @@ func (h *Handler) GetPlaylists(c echo.Context) error {
 // @Description Returns a playlist by ID. Requires admin JWT or ownership.
 // @Tags playlists
 // @Security BearerAuth
+// @Security ApiKeyAuth
 // @Produce json
 // @Param id path string true "Playlist ID (UUID)"
 // @Success 200 {object} Playlist
@@ -736,6 +752,7 @@ func (h *Handler) GetPlaylistByID(c echo.Context) error {
 // @Description Renames a playlist. Requires admin JWT or ownership.
 // @Tags playlists
 // @Security BearerAuth
+// @Security ApiKeyAuth
 // @Accept json
 // @Produce json
 // @Param id path string true "Playlist ID (UUID)"
@@ -791,6 +808,7 @@ func (h *Handler) UpdatePlaylistByID(c echo.Context) error {
 // @Description Deletes a playlist by ID. Requires admin JWT or ownership.
 // @Tags playlists
 // @Security BearerAuth
+// @Security ApiKeyAuth
 // @Param id path string true "Playlist ID (UUID)"
 // @Success 204 {string} string "No Content"
 // @Failure 400 {object} ErrorResponse
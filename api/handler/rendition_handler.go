@@ -0,0 +1,102 @@
+package handler
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+
+	"github.com/ProjectDistribute/distributor/middleware"
+	"github.com/ProjectDistribute/distributor/service"
+	"github.com/ProjectDistribute/distributor/task"
+	"github.com/labstack/echo/v4"
+)
+
+// GetRendition godoc
+// @Summary Get rendition
+// @Description Returns an offline download rendition of a song file, e.g. to resolve IDs from the sync manifest.
+// @Tags songs
+// @Security BearerAuth
+// @Security ApiKeyAuth
+// @Produce json
+// @Param id path string true "Rendition ID (UUID)"
+// @Param exp query int false "Signed URL expiry (unix seconds)"
+// @Param sig query string false "Signed URL signature, see POST /urls/sign"
+// @Success 200 {object} SongRendition
+// @Failure 400 {object} ErrorResponse
+// @Failure 404 {object} ErrorResponse
+// @Failure 401 {object} ErrorResponse
+// @Failure 403 {object} ErrorResponse
+// @Router /songs/renditions/{id} [get]
+func (h *Handler) GetRendition(c *middleware.CustomContext) error {
+	id, err := c.GetUUID("id")
+	if err != nil {
+		return echo.NewHTTPError(http.StatusBadRequest, "Valid rendition id is required")
+	}
+
+	rendition, err := h.rendition_svc.Store.GetRenditionByID(id)
+	if err != nil {
+		return echo.NewHTTPError(http.StatusNotFound, "Rendition not found")
+	}
+	return c.JSON(http.StatusOK, FromSongRenditionModel(*rendition))
+}
+
+// DownloadRendition godoc
+// @Summary Download rendition
+// @Description Downloads a pre-generated lossy rendition of a song file, a smaller alternative to /songs/download/{file_id} for offline caching.
+// @Tags songs
+// @Security BearerAuth
+// @Security ApiKeyAuth
+// @Produce application/octet-stream
+// @Param id path string true "Rendition ID (UUID)"
+// @Param exp query int false "Signed URL expiry (unix seconds)"
+// @Param sig query string false "Signed URL signature, see POST /urls/sign"
+// @Success 200 {file} file
+// @Failure 400 {object} ErrorResponse
+// @Failure 404 {object} ErrorResponse
+// @Failure 401 {object} ErrorResponse
+// @Failure 403 {object} ErrorResponse
+// @Router /songs/renditions/{id}/download [get]
+func (h *Handler) DownloadRendition(c *middleware.CustomContext) error {
+	id, err := c.GetUUID("id")
+	if err != nil {
+		return echo.NewHTTPError(http.StatusBadRequest, "Valid rendition id is required")
+	}
+
+	rendition, err := h.rendition_svc.Store.GetRenditionByID(id)
+	if err != nil {
+		return echo.NewHTTPError(http.StatusNotFound, "Rendition not found")
+	}
+
+	return h.serveStoredFile(c, rendition.FilePath(), "attachment", fmt.Sprintf("%s.%s", rendition.ID, rendition.Format))
+}
+
+// GenerateRenditions godoc
+// @Summary Generate renditions
+// @Description Starts a background job that encodes every song file into each profile of the rendition_profiles setting (e.g. "aac-256,opus-128") and removes renditions of profiles that are no longer configured. Requires the server.manage permission.
+// @Tags admin
+// @Security BearerAuth
+// @Security ApiKeyAuth
+// @Produce json
+// @Success 202 {object} service.JobSnapshot
+// @Failure 401 {object} ErrorResponse
+// @Failure 403 {object} ErrorResponse
+// @Failure 409 {object} ErrorResponse
+// @Failure 503 {object} ErrorResponse
+// @Router /admin/renditions/generate [post]
+func (h *Handler) GenerateRenditions(c echo.Context) error {
+	if h.rendition_svc.Transcodes == nil {
+		return c.JSON(http.StatusServiceUnavailable, ErrorResponse{Error: "No transcoder is available on this server"})
+	}
+
+	job, err := h.job_svc.Start("renditions", func(job *service.Job) error {
+		return task.GenerateRenditions(h.rendition_svc, job)
+	})
+	if errors.Is(err, service.ErrJobRunning) {
+		return c.JSON(http.StatusConflict, ErrorResponse{Error: "Rendition generation is already running"})
+	}
+	if err != nil {
+		return c.JSON(http.StatusInternalServerError, ErrorResponse{Error: err.Error()})
+	}
+
+	return c.JSON(http.StatusAccepted, job.Snapshot())
+}
@@ -8,6 +8,7 @@ import (
 	"os"
 
 	"github.com/ProjectDistribute/distributor/middleware"
+	"github.com/ProjectDistribute/distributor/model"
 	"github.com/golang-jwt/jwt/v5"
 	echojwt "github.com/labstack/echo-jwt/v4"
 	"github.com/labstack/echo/v4"
@@ -15,7 +16,6 @@ import (
 
 func (h *Handler) Register(public *echo.Group) {
 	Handle := middleware.Handle
-	AdminMiddleware := middleware.AdminMiddleware
 
 	secret := h.user_svc.JWTSecret
 
@@ -25,7 +25,27 @@ func (h *Handler) Register(public *echo.Group) {
 		},
 		SigningKey: []byte(secret),
 	}
-	jwt := echojwt.WithConfig(config)
+	jwtAuth := echojwt.WithConfig(config)
+	sessionAuth := middleware.SessionMiddleware(h.authorizeToken)
+	jwt := func(next echo.HandlerFunc) echo.HandlerFunc {
+		return jwtAuth(sessionAuth(next))
+	}
+	// API keys are only accepted on routes that name the scope they need
+	apiKeyAuth := middleware.APIKeyAuth(h.authorizeAPIKey, jwt)
+	scoped := func(scope echo.MiddlewareFunc) echo.MiddlewareFunc {
+		return func(next echo.HandlerFunc) echo.HandlerFunc {
+			return apiKeyAuth(scope(next))
+		}
+	}
+	playlistsRead := scoped(middleware.RequireScope(middleware.ScopePlaylistsRead))
+	playlistsWrite := scoped(middleware.RequireScope(middleware.ScopePlaylistsWrite))
+	libraryWrite := scoped(middleware.RequirePermission(model.PermEditLibrary, middleware.ScopeLibraryWrite))
+	// can guards staff endpoints by the permission of the user's role
+	can := func(perm model.Permission) echo.MiddlewareFunc {
+		return scoped(middleware.RequirePermission(perm, middleware.ScopeAdmin))
+	}
+	// Library media also accepts signed URLs of an active session, or no auth at all in public library mode
+	libraryAuth := middleware.LibraryAuth(middleware.URLSigningKey(secret), scoped(middleware.RequireScope(middleware.ScopeLibraryRead)), h.authorizeToken, h.isPublicLibrary)
 
 	// Setup
 	public.GET("/setup/status", h.SetupStatus)
@@ -39,107 +59,162 @@ func (h *Handler) Register(public *echo.Group) {
 	users.GET("/me", h.GetMe, jwt)
 	users.POST("/signup", h.CreateUser)
 	users.POST("/login", h.LoginUser)
-	user := users.Group("/:user_id", jwt)
-	user.DELETE("", Handle(h.DeleteUser))
-
-	library := user.Group("/library")
-	library.GET("", Handle(h.GetLibrary))
-	user.PUT("/password", h.ChangePassword)
-	user.GET("/sync", Handle(h.GetSync))
+	users.POST("/refresh", h.RefreshToken)
+
+	oidc := public.Group("/auth/oidc")
+	oidc.GET("/login", h.OIDCLogin)
+	oidc.GET("/callback", h.OIDCCallback)
+
+	users.POST("/logout", Handle(h.Logout), jwt)
+	user := users.Group("/:user_id")
+	user.DELETE("", Handle(h.DeleteUser), jwt)
+
+	user.GET("/library", Handle(h.GetLibrary), playlistsRead)
+	user.PUT("/password", h.ChangePassword, jwt)
+	user.PUT("/subsonic-password", Handle(h.SetSubsonicPassword), jwt)
+	user.GET("/sessions", Handle(h.GetSessions), jwt)
+	user.DELETE("/sessions", Handle(h.RevokeAllSessions), jwt)
+	user.DELETE("/sessions/:session_id", Handle(h.RevokeSession), jwt)
+	user.GET("/api-keys", Handle(h.GetAPIKeys), jwt)
+	user.POST("/api-keys", Handle(h.CreateAPIKey), jwt)
+	user.DELETE("/api-keys/:key_id", Handle(h.RevokeAPIKey), jwt)
+	user.GET("/sync", Handle(h.GetSync), playlistsRead)
 	folders := user.Group("/folders")
-	folders.POST("", Handle(h.CreatePlaylistFolder))
-	folders.DELETE("/:folder_id", Handle(h.DeletePlaylistFolder))
-	folders.PATCH("/:folder_id/rename", Handle(h.RenamePlaylistFolder))
-	folders.PATCH("/:folder_id/move", Handle(h.MoveFolderToFolder))
-	folders.POST("/batch", Handle(h.GetFoldersBatch))
+	folders.POST("", Handle(h.CreatePlaylistFolder), playlistsWrite)
+	folders.DELETE("/:folder_id", Handle(h.DeletePlaylistFolder), playlistsWrite)
+	folders.PATCH("/:folder_id/rename", Handle(h.RenamePlaylistFolder), playlistsWrite)
+	folders.PATCH("/:folder_id/move", Handle(h.MoveFolderToFolder), playlistsWrite)
+	folders.POST("/batch", Handle(h.GetFoldersBatch), playlistsRead)
 
 	playlists := user.Group("/playlists")
-	playlists.GET("", Handle(h.GetUserPlaylists))
-	playlists.POST("", Handle(h.CreatePlaylist))
-	playlists.POST("/batch", Handle(h.GetPlaylistsBatch))
+	playlists.GET("", Handle(h.GetUserPlaylists), playlistsRead)
+	playlists.POST("", Handle(h.CreatePlaylist), playlistsWrite)
+	playlists.POST("/batch", Handle(h.GetPlaylistsBatch), playlistsRead)
 
 	playlist := playlists.Group("/:playlist_id")
-	playlist.GET("", Handle(h.GetPlaylist))
-	playlist.DELETE("", Handle(h.DeletePlaylist))
-	playlist.PATCH("/rename", Handle(h.RenamePlaylist))
-	playlist.PATCH("/move", Handle(h.MovePlaylistToFolder))
-	playlist.POST("/songs", Handle(h.AddSongToPlaylist))
-	playlist.POST("/create-with-contents", Handle(h.CreatePlaylistWithContents))
-	playlist.DELETE("/songs/:song_id", Handle(h.RemoveSongFromPlaylist))
-	playlist.PUT("/songs/:song_id", Handle(h.UpdatePlaylistSongOrder))
+	playlist.GET("", Handle(h.GetPlaylist), playlistsRead)
+	playlist.DELETE("", Handle(h.DeletePlaylist), playlistsWrite)
+	playlist.PATCH("/rename", Handle(h.RenamePlaylist), playlistsWrite)
+	playlist.PATCH("/move", Handle(h.MovePlaylistToFolder), playlistsWrite)
+	playlist.POST("/songs", Handle(h.AddSongToPlaylist), playlistsWrite)
+	playlist.POST("/create-with-contents", Handle(h.CreatePlaylistWithContents), playlistsWrite)
+	playlist.DELETE("/songs/:song_id", Handle(h.RemoveSongFromPlaylist), playlistsWrite)
+	playlist.PUT("/songs/:song_id", Handle(h.UpdatePlaylistSongOrder), playlistsWrite)
 
 	songs := public.Group("/songs")
-	songs.GET("", h.GetSongs)
+	songs.GET("", h.GetSongs, libraryAuth)
 	songs.POST("/batch", h.GetSongsBatch)
-	songs.POST("", h.CreateSong, jwt, AdminMiddleware)
-	songs.DELETE("/:id", h.DeleteSong, jwt, AdminMiddleware)
-	songs.PUT("/:id", h.UpdateSong, jwt, AdminMiddleware)
-	songs.GET("/:id/files", h.GetSongFiles)
-	songs.DELETE("/files/:id", h.DeleteSongFile, jwt, AdminMiddleware)
-	songs.GET("/download/:file_id", Handle(h.DownloadFile))
-	songs.GET("/stream/:file_id", Handle(h.StreamFile))
-	songs.POST("/assign-file", h.AssignFileToSong, jwt, AdminMiddleware)
-	songs.POST("/assign-file-by-path", h.AssignFileToSongByPath, jwt, AdminMiddleware)
+	songs.POST("", h.CreateSong, libraryWrite)
+	songs.DELETE("/:id", h.DeleteSong, libraryWrite)
+	songs.PUT("/:id", h.UpdateSong, libraryWrite)
+	songs.GET("/:id/files", h.GetSongFiles, libraryAuth)
+	songs.PUT("/:id/genres", h.SetSongGenres, libraryWrite)
+	songs.DELETE("/files/:id", h.DeleteSongFile, libraryWrite)
+	songs.GET("/download/:file_id", Handle(h.DownloadFile), libraryAuth)
+	songs.GET("/stream/:file_id", Handle(h.StreamFile), libraryAuth)
+	songs.GET("/files/:id/waveform", Handle(h.GetWaveform), libraryAuth)
+	songs.GET("/renditions/:id", Handle(h.GetRendition), libraryAuth)
+	songs.GET("/renditions/:id/download", Handle(h.DownloadRendition), libraryAuth)
+	songs.POST("/inspect", h.InspectFile, libraryWrite)
+	songs.POST("/assign-file", h.AssignFileToSong, libraryWrite)
+	songs.POST("/assign-file-by-path", h.AssignFileToSongByPath, libraryWrite)
 	songs.GET("/:id", h.GetSong)
 
+	public.POST("/urls/sign", h.SignURLs, jwt)
+
 	public.GET("/search", h.SearchItems)
 
 	artist := public.Group("/artists")
 	artist.POST("/batch", h.GetArtistsBatch)
-	artist.POST("", h.CreateArtist, jwt, AdminMiddleware)
-	artist.POST("/aliases", h.AddArtistIdentifier, jwt, AdminMiddleware)
-	artist.PUT("/:id", h.UpdateArtist, jwt, AdminMiddleware)
-	artist.DELETE("/:id", h.DeleteArtist, jwt, AdminMiddleware)
+	artist.POST("", h.CreateArtist, libraryWrite)
+	artist.POST("/aliases", h.AddArtistIdentifier, libraryWrite)
+	artist.PUT("/:id", h.UpdateArtist, libraryWrite)
+	artist.DELETE("/:id", h.DeleteArtist, libraryWrite)
 	artist.GET("/:id", h.GetArtist)
 
 	album := public.Group("/albums")
 	album.POST("/batch", h.GetAlbumsBatch)
-	album.POST("", h.CreateAlbum, jwt, AdminMiddleware)
-	album.POST("/covers-by-path", h.AssignAlbumCoverByPath, jwt, AdminMiddleware)
-	album.POST("/covers/:id", h.AssignAlbumCover, jwt, AdminMiddleware)
+	album.POST("", h.CreateAlbum, libraryWrite)
+	album.POST("/covers-by-path", h.AssignAlbumCoverByPath, libraryWrite)
+	album.POST("/covers/:id", h.AssignAlbumCover, libraryWrite)
 	album.GET("/covers/:id", h.AlbumHasCover)
-	album.PUT("/:id", h.UpdateAlbum, jwt, AdminMiddleware)
-	album.DELETE("/:id", h.DeleteAlbum, jwt, AdminMiddleware)
+	album.PUT("/:id", h.UpdateAlbum, libraryWrite)
+	album.PUT("/:id/genres", h.SetAlbumGenres, libraryWrite)
+	album.DELETE("/:id", h.DeleteAlbum, libraryWrite)
 	album.GET("/:id", h.GetAlbum)
 	album.GET("/:id/songs", h.GetAlbumSongs)
 
+	genre := public.Group("/genres")
+	genre.GET("", h.GetGenres)
+	genre.POST("/batch", h.GetGenresBatch)
+	genre.POST("", h.CreateGenre, libraryWrite)
+	genre.PUT("/:id", h.UpdateGenre, libraryWrite)
+	genre.DELETE("/:id", h.DeleteGenre, libraryWrite)
+	genre.GET("/:id", h.GetGenre)
+	genre.GET("/:id/songs", h.GetGenreSongs)
+	genre.GET("/:id/albums", h.GetGenreAlbums)
+
 	mail := public.Group("/mails")
-	mail.POST("", h.CreateRequestMail, jwt)
+	mail.POST("", h.CreateRequestMail, scoped(middleware.RequireScope(middleware.ScopeMailWrite)))
 	mail.GET("/categories", h.GetCategories)
 
-	mail_private := mail.Group("", jwt, AdminMiddleware)
-	mail_private.GET("", h.GetRequestMails)
-	mail_private.PUT("/:id/status", h.SetMailStatus)
-	mail_private.GET("/next", h.GetNextRequestMail)
+	mailRead := scoped(middleware.RequirePermission(model.PermManageMail, middleware.ScopeMailRead))
+	mail.GET("", h.GetRequestMails, mailRead)
+	mail.PUT("/:id/status", h.SetMailStatus, scoped(middleware.RequirePermission(model.PermManageMail, middleware.ScopeMailWrite)))
+	mail.GET("/next", h.GetNextRequestMail, mailRead)
 
 	images := public.Group("/images")
-	images.GET("/covers/:id/:res", h.ServeAlbumCover)
+	images.GET("/covers/:id/:res", h.ServeAlbumCover, libraryAuth)
 
-	public.POST("/doctor", h.RunDoctor, jwt, AdminMiddleware)
-	public.POST("/search/reindex", h.ReindexSearch, jwt, AdminMiddleware)
+	public.POST("/doctor", h.RunDoctor, can(model.PermManageServer))
+	public.POST("/search/reindex", h.ReindexSearch, can(model.PermManageServer))
 
 	// Global Playlist Endpoints
-	globalPlaylists := public.Group("/playlists", jwt)
-	globalPlaylists.GET("/:playlist_id", h.GetPlaylistByID)
-	globalPlaylists.PUT("/:playlist_id", h.UpdatePlaylistByID)
-	globalPlaylists.DELETE("/:playlist_id", h.DeletePlaylistByID)
-	globalPlaylists.POST("/:playlist_id/songs", Handle(h.AddSongToPlaylist))
-	globalPlaylists.DELETE("/:playlist_id/songs/:song_id", Handle(h.RemoveSongFromPlaylist))
-	globalPlaylists.PUT("/:playlist_id/songs/:song_id", Handle(h.UpdatePlaylistSongOrder))
-	globalPlaylists.PUT("/:playlist_id/move", Handle(h.MovePlaylistToFolder))
-
-	admin := public.Group("/admin", jwt, AdminMiddleware)
-	admin.GET("/stats", h.GetStats)
-	admin.GET("/logs", h.GetServerLogs)
-	admin.GET("/bandwidth", h.GetBandwidth)
-	admin.GET("/users", h.GetUsers)
-	admin.GET("/playlists", h.GetPlaylists)
-	admin.GET("/artists", h.GetArtists)
-	admin.GET("/albums", h.GetAlbums)
-	admin.DELETE("/orphans", h.RemoveOrphans)
-	admin.DELETE("/files/cleanup", h.CleanSongFiles)
-	admin.GET("/settings", h.GetSettings)
-	admin.PUT("/settings", h.UpdateSettings)
+	globalPlaylists := public.Group("/playlists")
+	globalPlaylists.GET("/:playlist_id", h.GetPlaylistByID, playlistsRead)
+	globalPlaylists.PUT("/:playlist_id", h.UpdatePlaylistByID, playlistsWrite)
+	globalPlaylists.DELETE("/:playlist_id", h.DeletePlaylistByID, playlistsWrite)
+	globalPlaylists.POST("/:playlist_id/songs", Handle(h.AddSongToPlaylist), playlistsWrite)
+	globalPlaylists.DELETE("/:playlist_id/songs/:song_id", Handle(h.RemoveSongFromPlaylist), playlistsWrite)
+	globalPlaylists.PUT("/:playlist_id/songs/:song_id", Handle(h.UpdatePlaylistSongOrder), playlistsWrite)
+	globalPlaylists.PUT("/:playlist_id/move", Handle(h.MovePlaylistToFolder), playlistsWrite)
+
+	admin := public.Group("/admin")
+	admin.GET("/stats", h.GetStats, can(model.PermManageServer))
+	admin.GET("/logs", h.GetServerLogs, can(model.PermManageServer))
+	admin.GET("/bandwidth", h.GetBandwidth, can(model.PermManageServer))
+	admin.GET("/users", h.GetUsers, can(model.PermModerateUsers))
+	admin.PUT("/users/:user_id/ban", Handle(h.BanUser), can(model.PermModerateUsers))
+	admin.DELETE("/users/:user_id/ban", Handle(h.UnbanUser), can(model.PermModerateUsers))
+	admin.POST("/users/:user_id/approve", Handle(h.ApproveUser), can(model.PermModerateUsers))
+	admin.PUT("/users/:user_id/role", Handle(h.SetUserRole), can(model.PermManageUsers))
+	admin.POST("/users/:user_id/promote", Handle(h.PromoteUser), can(model.PermManageUsers))
+	admin.POST("/users/:user_id/demote", Handle(h.DemoteUser), can(model.PermManageUsers))
+	admin.POST("/users/:user_id/reset-password", Handle(h.ResetUserPassword), can(model.PermManageUsers))
+	admin.GET("/audit", h.GetAuditLog, can(model.PermModerateUsers))
+	admin.GET("/lockouts", h.GetLockouts, can(model.PermModerateUsers))
+	admin.DELETE("/lockouts", h.DeleteLockout, can(model.PermModerateUsers))
+	admin.GET("/invites", h.GetInvites, can(model.PermManageUsers))
+	admin.POST("/invites", Handle(h.CreateInvite), can(model.PermManageUsers))
+	admin.DELETE("/invites/:id", Handle(h.RevokeInvite), can(model.PermManageUsers))
+	admin.GET("/api-keys", h.GetAllAPIKeys, can(model.PermManageUsers))
+	admin.GET("/playlists", h.GetPlaylists, can(model.PermManageServer))
+	admin.GET("/artists", h.GetArtists, can(model.PermEditLibrary))
+	admin.GET("/albums", h.GetAlbums, can(model.PermEditLibrary))
+	admin.DELETE("/orphans", h.RemoveOrphans, can(model.PermManageServer))
+	admin.DELETE("/files/cleanup", h.CleanSongFiles, can(model.PermManageServer))
+	admin.GET("/duplicates", h.GetDuplicateAudio, can(model.PermEditLibrary))
+	admin.GET("/settings", h.GetSettings, can(model.PermManageServer))
+	admin.PUT("/settings", h.UpdateSettings, can(model.PermManageServer))
+	admin.GET("/jobs", h.GetJobs, can(model.PermManageServer))
+	admin.POST("/library/scan", h.ScanLibrary, can(model.PermManageServer))
+	admin.POST("/renditions/generate", h.GenerateRenditions, can(model.PermManageServer))
+	admin.POST("/loudness/analyze", h.AnalyzeLoudness, can(model.PermManageServer))
+	admin.GET("/storage/migration", h.GetStorageMigration, can(model.PermManageServer))
+	admin.POST("/storage/migration", h.StartStorageMigration, can(model.PermManageServer))
+	admin.POST("/storage/migration/cutover", h.CutoverStorageMigration, can(model.PermManageServer))
+	admin.GET("/transcode-cache", h.GetTranscodeCache, can(model.PermManageServer))
+	admin.DELETE("/transcode-cache", h.PurgeTranscodeCache, can(model.PermManageServer))
 	// admin.POST("/rebalance-playlists", Handle(h.RebalanceAllPlaylists))
 }
 
@@ -0,0 +1,55 @@
+package handler
+
+import (
+	"net/http"
+	"testing"
+
+	"github.com/ProjectDistribute/distributor/model"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestRoutes_PermissionMatrix(t *testing.T) {
+	s := newTestServer(t)
+	roles := []string{model.RoleUser, model.RoleCurator, model.RoleModerator, model.RoleAdmin}
+	auth := make(map[string]string)
+	for _, role := range roles {
+		_, auth[role] = s.user(t, role, role)
+	}
+
+	tests := []struct {
+		method  string
+		path    string
+		allowed []string
+	}{
+		{http.MethodGet, "/api/admin/artists", []string{model.RoleCurator, model.RoleAdmin}},
+		{http.MethodGet, "/api/admin/duplicates", []string{model.RoleCurator, model.RoleAdmin}},
+		{http.MethodGet, "/api/mails", []string{model.RoleModerator, model.RoleAdmin}},
+		{http.MethodGet, "/api/admin/users", []string{model.RoleModerator, model.RoleAdmin}},
+		{http.MethodGet, "/api/admin/audit", []string{model.RoleModerator, model.RoleAdmin}},
+		{http.MethodGet, "/api/admin/lockouts", []string{model.RoleModerator, model.RoleAdmin}},
+		{http.MethodGet, "/api/admin/invites", []string{model.RoleAdmin}},
+		{http.MethodGet, "/api/admin/api-keys", []string{model.RoleAdmin}},
+		{http.MethodGet, "/api/admin/stats", []string{model.RoleAdmin}},
+		{http.MethodGet, "/api/admin/settings", []string{model.RoleAdmin}},
+		{http.MethodGet, "/api/admin/jobs", []string{model.RoleAdmin}},
+	}
+	for _, tt := range tests {
+		for _, role := range roles {
+			t.Run(tt.path+"/"+role, func(t *testing.T) {
+				rec := s.do(t, tt.method, tt.path, nil, auth[role])
+				for _, allowed := range tt.allowed {
+					if allowed == role {
+						assert.NotContains(t, []int{http.StatusUnauthorized, http.StatusForbidden}, rec.Code, rec.Body.String())
+						return
+					}
+				}
+				assert.Equal(t, http.StatusForbidden, rec.Code, rec.Body.String())
+			})
+		}
+	}
+
+	// Without a session every staff route asks for authentication
+	for _, tt := range tests {
+		assert.Equal(t, http.StatusUnauthorized, s.do(t, tt.method, tt.path, nil, "").Code, tt.path)
+	}
+}
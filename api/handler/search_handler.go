@@ -4,6 +4,7 @@ import (
 	"net/http"
 	"strconv"
 
+	"github.com/ProjectDistribute/distributor/service"
 	"github.com/labstack/echo/v4"
 )
 
@@ -14,6 +15,10 @@ import (
 // @Produce json
 // @Param q query string true "Search query"
 // @Param limit query int false "Results limit"
+// @Param type query string false "Only return results of this type" Enums(song, artist, album, playlist)
+// @Param genre query string false "Only return songs and albums of this genre"
+// @Param mood query string false "Only return songs and albums with this mood"
+// @Param tag query string false "Only return songs and albums with this tag"
 // @Success 200 {array} service.SearchResult
 // @Failure 400 {object} ErrorResponse
 // @Failure 500 {object} ErrorResponse
@@ -31,9 +36,14 @@ func (h *Handler) SearchItems(c echo.Context) error {
 		}
 	}
 
-	filterType := c.QueryParam("type")
+	filters := service.SearchFilters{
+		Type:  c.QueryParam("type"),
+		Genre: c.QueryParam("genre"),
+		Mood:  c.QueryParam("mood"),
+		Tag:   c.QueryParam("tag"),
+	}
 
-	results, err := h.search_svc.Search(query, limit, filterType)
+	results, err := h.search_svc.Search(query, limit, filters)
 	if err != nil {
 		return echo.NewHTTPError(http.StatusInternalServerError, "Search failed: "+err.Error())
 	}
@@ -0,0 +1,208 @@
+package handler
+
+import (
+	"errors"
+	"net/http"
+
+	"github.com/ProjectDistribute/distributor/middleware"
+	"github.com/ProjectDistribute/distributor/model"
+	"github.com/ProjectDistribute/distributor/service"
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/google/uuid"
+	"github.com/labstack/echo/v4"
+)
+
+// RefreshToken godoc
+// @Summary Refresh access token
+// @Description Exchanges a refresh token for a new access token. The refresh token rotates: the returned one replaces the one sent, which stops working.
+// @Tags users
+// @Accept json
+// @Produce json
+// @Param request body RefreshTokenRequest true "Refresh token"
+// @Success 200 {object} TokenResponse
+// @Failure 400 {object} ErrorResponse
+// @Failure 401 {object} ErrorResponse
+// @Failure 403 {object} ErrorResponse
+// @Failure 500 {object} ErrorResponse
+// @Router /users/refresh [post]
+func (h *Handler) RefreshToken(c echo.Context) error {
+	var input RefreshTokenRequest
+	if err := c.Bind(&input); err != nil {
+		return c.JSON(http.StatusBadRequest, ErrorResponse{Error: "Invalid input"})
+	}
+	if err := c.Validate(&input); err != nil {
+		return c.JSON(http.StatusBadRequest, ErrorResponse{Error: "Validation failed"})
+	}
+
+	tokens, _, err := h.user_svc.RefreshSession(input.RefreshToken, c.RealIP())
+	if errors.Is(err, service.ErrInvalidRefreshToken) {
+		return c.JSON(http.StatusUnauthorized, ErrorResponse{Error: err.Error()})
+	}
+	if errors.Is(err, service.ErrUserBanned) {
+		return c.JSON(http.StatusForbidden, ErrorResponse{Error: "Account is banned"})
+	}
+	if errors.Is(err, service.ErrPendingApproval) {
+		return c.JSON(http.StatusForbidden, ErrorResponse{Error: err.Error()})
+	}
+	if err != nil {
+		return c.JSON(http.StatusInternalServerError, ErrorResponse{Error: "Could not generate token"})
+	}
+
+	return c.JSON(http.StatusOK, TokenResponse{
+		Token:        tokens.AccessToken,
+		RefreshToken: tokens.RefreshToken,
+		ExpiresAt:    tokens.ExpiresAt,
+		SessionID:    tokens.Session.ID,
+	})
+}
+
+// Logout godoc
+// @Summary Logout
+// @Description Revokes the session of the access token used for this request.
+// @Tags users
+// @Security BearerAuth
+// @Success 204 {string} string "No Content"
+// @Failure 401 {object} ErrorResponse
+// @Failure 500 {object} ErrorResponse
+// @Router /users/logout [post]
+func (h *Handler) Logout(c *middleware.CustomContext) error {
+	me := c.Get("user").(*jwt.Token).Claims.(*middleware.JwtCustomClaims)
+	if me.SessionID == "" {
+		// Tokens from before sessions have none to revoke, the client drops them
+		return c.NoContent(http.StatusNoContent)
+	}
+	sessionID, err := uuid.Parse(me.SessionID)
+	if err != nil {
+		return echo.ErrUnauthorized
+	}
+	if err := h.user_svc.RevokeSession(me.UUID(), sessionID); err != nil {
+		return c.JSON(http.StatusInternalServerError, ErrorResponse{Error: "Failed to revoke session"})
+	}
+	return c.NoContent(http.StatusNoContent)
+}
+
+// GetSessions godoc
+// @Summary List sessions
+// @Description Lists the active sessions of a user, most recently used first. Users can list their own sessions, admins any user's.
+// @Tags users
+// @Security BearerAuth
+// @Produce json
+// @Param user_id path string true "User ID (UUID)"
+// @Success 200 {array} Session
+// @Failure 400 {object} ErrorResponse
+// @Failure 401 {object} ErrorResponse
+// @Failure 403 {object} ErrorResponse
+// @Failure 500 {object} ErrorResponse
+// @Router /users/{user_id}/sessions [get]
+func (h *Handler) GetSessions(c *middleware.CustomContext) error {
+	userID, err := c.GetUUID("user_id")
+	if err != nil {
+		return echo.NewHTTPError(http.StatusBadRequest, "Invalid user ID")
+	}
+	me := c.Get("user").(*jwt.Token).Claims.(*middleware.JwtCustomClaims)
+	if me.UUID() != userID && !me.Can(model.PermManageUsers) {
+		return echo.NewHTTPError(http.StatusForbidden, "Forbidden: You can only view your own sessions or must be an admin")
+	}
+
+	sessions, err := h.user_svc.GetSessions(userID)
+	if err != nil {
+		return c.JSON(http.StatusInternalServerError, ErrorResponse{Error: "Failed to retrieve sessions"})
+	}
+	res := make([]Session, 0, len(sessions))
+	for _, s := range sessions {
+		res = append(res, FromSessionModel(s, me.SessionID))
+	}
+	return c.JSON(http.StatusOK, res)
+}
+
+// RevokeSession godoc
+// @Summary Revoke session
+// @Description Signs a user out of one session. Its access tokens stop working immediately.
+// @Tags users
+// @Security BearerAuth
+// @Param user_id path string true "User ID (UUID)"
+// @Param session_id path string true "Session ID (UUID)"
+// @Success 204 {string} string "No Content"
+// @Failure 400 {object} ErrorResponse
+// @Failure 401 {object} ErrorResponse
+// @Failure 403 {object} ErrorResponse
+// @Failure 404 {object} ErrorResponse
+// @Failure 500 {object} ErrorResponse
+// @Router /users/{user_id}/sessions/{session_id} [delete]
+func (h *Handler) RevokeSession(c *middleware.CustomContext) error {
+	userID, err := c.GetUUID("user_id")
+	if err != nil {
+		return echo.NewHTTPError(http.StatusBadRequest, "Invalid user ID")
+	}
+	sessionID, err := c.GetUUID("session_id")
+	if err != nil {
+		return echo.NewHTTPError(http.StatusBadRequest, "Invalid session ID")
+	}
+	me := c.Get("user").(*jwt.Token).Claims.(*middleware.JwtCustomClaims)
+	if me.UUID() != userID && !me.Can(model.PermManageUsers) {
+		return echo.NewHTTPError(http.StatusForbidden, "Forbidden: You can only revoke your own sessions or must be an admin")
+	}
+
+	err = h.user_svc.RevokeSession(userID, sessionID)
+	if errors.Is(err, service.ErrSessionNotFound) {
+		return c.JSON(http.StatusNotFound, ErrorResponse{Error: "Session not found"})
+	}
+	if err != nil {
+		return c.JSON(http.StatusInternalServerError, ErrorResponse{Error: "Failed to revoke session"})
+	}
+	return c.NoContent(http.StatusNoContent)
+}
+
+// RevokeAllSessions godoc
+// @Summary Revoke all sessions
+// @Description Signs a user out everywhere, including the session making the request.
+// @Tags users
+// @Security BearerAuth
+// @Produce json
+// @Param user_id path string true "User ID (UUID)"
+// @Success 200 {object} map[string]int64
+// @Failure 400 {object} ErrorResponse
+// @Failure 401 {object} ErrorResponse
+// @Failure 403 {object} ErrorResponse
+// @Failure 500 {object} ErrorResponse
+// @Router /users/{user_id}/sessions [delete]
+func (h *Handler) RevokeAllSessions(c *middleware.CustomContext) error {
+	userID, err := c.GetUUID("user_id")
+	if err != nil {
+		return echo.NewHTTPError(http.StatusBadRequest, "Invalid user ID")
+	}
+	me := c.Get("user").(*jwt.Token).Claims.(*middleware.JwtCustomClaims)
+	if me.UUID() != userID && !me.Can(model.PermManageUsers) {
+		return echo.NewHTTPError(http.StatusForbidden, "Forbidden: You can only revoke your own sessions or must be an admin")
+	}
+
+	revoked, err := h.user_svc.RevokeAllSessions(userID)
+	if err != nil {
+		return c.JSON(http.StatusInternalServerError, ErrorResponse{Error: "Failed to revoke sessions"})
+	}
+	return c.JSON(http.StatusOK, map[string]int64{"revoked": revoked})
+}
+
+// authorizeToken maps the checks of UserService.AuthorizeToken to HTTP errors.
+func (h *Handler) authorizeToken(claims *middleware.JwtCustomClaims) error {
+	err := h.user_svc.AuthorizeToken(claims)
+	if errors.Is(err, service.ErrUserBanned) {
+		return echo.NewHTTPError(http.StatusForbidden, "Account is banned")
+	}
+	if errors.Is(err, service.ErrPendingApproval) {
+		return echo.NewHTTPError(http.StatusForbidden, err.Error())
+	}
+	if err != nil {
+		return echo.NewHTTPError(http.StatusUnauthorized, "Session expired or revoked")
+	}
+	return nil
+}
+
+// truncate shortens s to at most n runes.
+func truncate(s string, n int) string {
+	r := []rune(s)
+	if len(r) <= n {
+		return s
+	}
+	return string(r[:n])
+}
@@ -0,0 +1,87 @@
+package handler
+
+import (
+	"fmt"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/ProjectDistribute/distributor/middleware"
+	"github.com/ProjectDistribute/distributor/model"
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// legacyToken signs a token like those issued before sessions existed: no session
+// ID and no issue time, valid for 30 days.
+func (s *testServer) legacyToken(t *testing.T, user *model.User, expires time.Time) string {
+	claims := &middleware.JwtCustomClaims{RegisteredClaims: jwt.RegisteredClaims{
+		Subject:   user.ID.String(),
+		ExpiresAt: jwt.NewNumericDate(expires),
+	}}
+	token, err := jwt.NewWithClaims(jwt.SigningMethodHS256, claims).SignedString([]byte(s.h.user_svc.JWTSecret))
+	require.NoError(t, err)
+	return "Bearer " + token
+}
+
+func TestLegacyTokens_WorkUntilTheyExpire(t *testing.T) {
+	s := newTestServer(t)
+	admin, _ := s.user(t, "admin", model.RoleAdmin)
+	user, _ := s.user(t, "listener", model.RoleUser)
+
+	legacy := func(expires time.Time) string { return s.legacyToken(t, user, expires) }
+	me := func(auth string) int {
+		return s.do(t, http.MethodGet, "/api/users/me", nil, auth).Code
+	}
+
+	auth := legacy(time.Now().Add(10 * 24 * time.Hour))
+	assert.Equal(t, http.StatusOK, me(auth))
+	assert.Equal(t, http.StatusUnauthorized, me(legacy(time.Now().Add(-time.Minute))))
+	assert.Equal(t, http.StatusUnauthorized, me(legacy(time.Now().Add(60*24*time.Hour))), "longer than tokens ever lived")
+
+	// Signed URLs do not outlive the token
+	rec := s.do(t, http.MethodPost, "/api/urls/sign", map[string]any{"paths": []string{"/api/songs/download/x"}, "ttl_seconds": 3600}, legacy(time.Now().Add(time.Minute)))
+	require.Equal(t, http.StatusOK, rec.Code, rec.Body.String())
+	assert.WithinDuration(t, time.Now().Add(time.Minute), decode[SignURLsResponse](t, rec).ExpiresAt, 2*time.Second)
+
+	assert.Equal(t, http.StatusNoContent, s.do(t, http.MethodPost, "/api/users/logout", nil, auth).Code)
+
+	require.NoError(t, s.h.user_svc.BanUser(admin.ID, user, nil, "test"))
+	assert.Equal(t, http.StatusForbidden, me(auth))
+}
+
+func TestLegacyTokens_RevokedBySigningOutEverywhere(t *testing.T) {
+	s := newTestServer(t)
+	_, adminAuth := s.user(t, "admin", model.RoleAdmin)
+
+	tests := []struct {
+		name   string
+		revoke func(user *model.User, auth string) int
+	}{
+		{"logout everywhere", func(user *model.User, auth string) int {
+			return s.do(t, http.MethodDelete, "/api/users/"+user.ID.String()+"/sessions", nil, auth).Code
+		}},
+		{"password change", func(user *model.User, auth string) int {
+			return s.do(t, http.MethodPut, "/api/users/"+user.ID.String()+"/password", map[string]string{"password": "new-password"}, auth).Code
+		}},
+		{"admin password reset", func(user *model.User, _ string) int {
+			return s.do(t, http.MethodPost, "/api/admin/users/"+user.ID.String()+"/reset-password", map[string]string{}, adminAuth).Code
+		}},
+	}
+	for i, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			user, _ := s.user(t, fmt.Sprintf("listener%d", i), model.RoleUser)
+			auth := s.legacyToken(t, user, time.Now().Add(10*24*time.Hour))
+			require.Equal(t, http.StatusOK, s.do(t, http.MethodGet, "/api/users/me", nil, auth).Code)
+
+			require.Equal(t, http.StatusOK, tt.revoke(user, auth))
+			assert.Equal(t, http.StatusUnauthorized, s.do(t, http.MethodGet, "/api/users/me", nil, auth).Code)
+
+			// Logging in again works
+			tokens, err := s.h.user_svc.CreateSession(user, "test", "")
+			require.NoError(t, err)
+			assert.Equal(t, http.StatusOK, s.do(t, http.MethodGet, "/api/users/me", nil, "Bearer "+tokens.AccessToken).Code)
+		})
+	}
+}
@@ -1,12 +1,17 @@
 package handler
 
 import (
+	"fmt"
+	"net/url"
+	"strconv"
+
+	"github.com/ProjectDistribute/distributor/service"
 	"github.com/labstack/echo/v4"
 )
 
 // GetSettings godoc
 // @Summary Get system settings
-// @Description Returns all system settings. Requires admin JWT.
+// @Description Returns all system settings. Requires the server.manage permission.
 // @Tags admin
 // @Security BearerAuth
 // @Produce json
@@ -25,7 +30,7 @@ func (h *Handler) GetSettings(c echo.Context) error {
 
 // UpdateSettings godoc
 // @Summary Update system settings
-// @Description Updates system settings (partial update). Requires admin JWT.
+// @Description Updates system settings (partial update). Requires the server.manage permission.
 // @Tags admin
 // @Security BearerAuth
 // @Accept json
@@ -48,6 +53,30 @@ func (h *Handler) UpdateSettings(c echo.Context) error {
 		"server_url":                true,
 		"mail_categories":           true,
 		"request_mail_announcement": true,
+		"library_scan_path":         true,
+		"transcode_cache_max_mb":    true,
+		"duplicate_audio_policy":    true,
+		"rendition_profiles":        true,
+		"public_library":            true,
+		"registration_policy":       true,
+		"oidc_issuer":               true,
+		"oidc_client_id":            true,
+		"oidc_client_secret":        true,
+		"oidc_redirect_url":         true,
+		"oidc_scopes":               true,
+		"oidc_groups_claim":         true,
+		"oidc_admin_group":          true,
+		"oidc_auto_provision":       true,
+		"oidc_allowed_redirects":    true,
+	}
+
+	for key, value := range input {
+		if !allowedKeys[key] {
+			continue
+		}
+		if err := validateSetting(key, value); err != nil {
+			return c.JSON(400, map[string]string{"error": "Invalid " + key + ": " + err.Error()})
+		}
 	}
 
 	for key, value := range input {
@@ -59,6 +88,10 @@ func (h *Handler) UpdateSettings(c echo.Context) error {
 		}
 	}
 
+	if _, ok := input["transcode_cache_max_mb"]; ok && h.transcode_cache != nil {
+		h.transcode_cache.Trim()
+	}
+
 	// Return fresh settings
 	settings, err := h.settings_svc.GetAll()
 	if err != nil {
@@ -66,3 +99,33 @@ func (h *Handler) UpdateSettings(c echo.Context) error {
 	}
 	return c.JSON(200, settings)
 }
+
+// validateSetting rejects values the services reading the setting could not use.
+func validateSetting(key, value string) error {
+	switch key {
+	case "transcode_cache_max_mb":
+		if mb, err := strconv.Atoi(value); err != nil || mb < 0 {
+			return fmt.Errorf("must be a non-negative number of megabytes")
+		}
+	case "public_library", "oidc_auto_provision":
+		if value != "true" && value != "false" {
+			return fmt.Errorf("must be true or false")
+		}
+	case "oidc_issuer", "oidc_redirect_url":
+		if value == "" {
+			return nil
+		}
+		if u, err := url.Parse(value); err != nil || (u.Scheme != "https" && u.Scheme != "http") || u.Host == "" {
+			return fmt.Errorf("must be an http(s) URL")
+		}
+	case "registration_policy":
+		return service.ValidateRegistrationPolicy(value)
+	case "duplicate_audio_policy":
+		return service.ValidateDuplicateAudioPolicy(value)
+	case "rendition_profiles":
+		if _, err := service.ParseRenditionProfiles(value); err != nil {
+			return err
+		}
+	}
+	return nil
+}
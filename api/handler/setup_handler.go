@@ -1,6 +1,7 @@
 package handler
 
 import (
+	"github.com/ProjectDistribute/distributor/model"
 	"github.com/labstack/echo/v4"
 )
 
@@ -54,7 +55,7 @@ func (h *Handler) CompleteSetup(c echo.Context) error {
 	if err != nil {
 		return c.JSON(500, map[string]string{"error": "Failed to create user: " + err.Error()})
 	}
-	if err := h.user_svc.Store.SetAdminStatus(user, true); err != nil {
+	if err := h.user_svc.Store.SetRole(user, model.RoleAdmin); err != nil {
 		return c.JSON(500, map[string]string{"error": "Failed to set admin status"})
 	}
 
@@ -0,0 +1,97 @@
+package handler
+
+import (
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/ProjectDistribute/distributor/middleware"
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/labstack/echo/v4"
+)
+
+const (
+	defaultSignedURLTTL = time.Hour
+	maxSignedURLTTL     = 24 * time.Hour
+)
+
+// signableURLPrefixes are the library media paths a signed URL may grant access to.
+var signableURLPrefixes = []string{
+	"/api/songs/stream/",
+	"/api/songs/download/",
+	"/api/songs/renditions/",
+	"/api/images/covers/",
+}
+
+type SignURLsRequest struct {
+	Paths      []string `json:"paths" validate:"required,min=1,max=500" example:"/api/songs/stream/8a1c3b0e-6f0f-4a57-9d41-1c8a4f0b6f21"`
+	TTLSeconds int      `json:"ttl_seconds" example:"3600"`
+}
+
+type SignURLsResponse struct {
+	URLs      []string  `json:"urls"`
+	ExpiresAt time.Time `json:"expires_at"`
+}
+
+// SignURLs godoc
+// @Summary Sign library media URLs
+// @Description Returns short-lived signed URLs for stream, download, rendition and cover paths, for players that cannot send an Authorization header. URLs are returned in request order. The TTL defaults to one hour and is capped at 24 hours. The URLs stop working early when the session is revoked or the user banned.
+// @Tags songs
+// @Security BearerAuth
+// @Accept json
+// @Produce json
+// @Param request body SignURLsRequest true "Paths to sign"
+// @Success 200 {object} SignURLsResponse
+// @Failure 400 {object} ErrorResponse
+// @Failure 401 {object} ErrorResponse
+// @Router /urls/sign [post]
+func (h *Handler) SignURLs(c echo.Context) error {
+	var req SignURLsRequest
+	if err := c.Bind(&req); err != nil {
+		return c.JSON(http.StatusBadRequest, ErrorResponse{Error: "Invalid input"})
+	}
+	if err := c.Validate(&req); err != nil {
+		return c.JSON(http.StatusBadRequest, ErrorResponse{Error: "Validation failed"})
+	}
+
+	ttl := defaultSignedURLTTL
+	if req.TTLSeconds > 0 {
+		ttl = min(time.Duration(req.TTLSeconds)*time.Second, maxSignedURLTTL)
+	}
+	expires := time.Now().Add(ttl)
+
+	// The URLs belong to the caller's session and stop working with it. Tokens from
+	// before sessions cannot be revoked, their URLs do not outlive them.
+	me := c.Get("user").(*jwt.Token).Claims.(*middleware.JwtCustomClaims)
+	if me.SessionID == "" && me.ExpiresAt != nil && me.ExpiresAt.Before(expires) {
+		expires = me.ExpiresAt.Time
+	}
+	key := middleware.URLSigningKey(h.user_svc.JWTSecret)
+	urls := make([]string, 0, len(req.Paths))
+	for _, path := range req.Paths {
+		if !isSignablePath(path) {
+			return c.JSON(http.StatusBadRequest, ErrorResponse{Error: "Path cannot be signed: " + path})
+		}
+		urls = append(urls, middleware.SignedURL(key, path, me, expires))
+	}
+
+	return c.JSON(http.StatusOK, SignURLsResponse{URLs: urls, ExpiresAt: expires.UTC().Truncate(time.Second)})
+}
+
+func isSignablePath(path string) bool {
+	if strings.ContainsAny(path, "?#") || strings.Contains(path, "..") {
+		return false
+	}
+	for _, prefix := range signableURLPrefixes {
+		if strings.HasPrefix(path, prefix) && len(path) > len(prefix) {
+			return true
+		}
+	}
+	return false
+}
+
+// isPublicLibrary reports whether the public_library setting opens library media to anyone.
+func (h *Handler) isPublicLibrary() bool {
+	val, err := h.settings_svc.Get("public_library")
+	return err == nil && val == "true"
+}
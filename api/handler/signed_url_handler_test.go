@@ -0,0 +1,50 @@
+package handler
+
+import (
+	"net/http"
+	"net/url"
+	"testing"
+
+	"github.com/ProjectDistribute/distributor/model"
+	"github.com/google/uuid"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestSignedURLs_FollowTheSession(t *testing.T) {
+	s := newTestServer(t)
+	admin, adminAuth := s.user(t, "admin", model.RoleAdmin)
+	user, auth := s.user(t, "listener", model.RoleUser)
+
+	sign := func(auth string) string {
+		rec := s.do(t, http.MethodPost, "/api/urls/sign", SignURLsRequest{Paths: []string{"/api/songs/download/" + uuid.NewString()}}, auth)
+		require.Equal(t, http.StatusOK, rec.Code, rec.Body.String())
+		return decode[SignURLsResponse](t, rec).URLs[0]
+	}
+	get := func(u string) int {
+		return s.do(t, http.MethodGet, u, nil, "").Code
+	}
+
+	// A valid signature gets past auth to the missing file
+	signed := sign(auth)
+	assert.Equal(t, http.StatusNotFound, get(signed))
+
+	// The signature covers the user and the session
+	parsed, err := url.Parse(signed)
+	require.NoError(t, err)
+	for _, param := range []string{"uid", "sid", "exp"} {
+		q := parsed.Query()
+		q.Set(param, "1"+q.Get(param))
+		assert.Equal(t, http.StatusForbidden, get(parsed.Path+"?"+q.Encode()), param)
+	}
+
+	// Banning the user or revoking the session invalidates its URLs
+	require.NoError(t, s.h.user_svc.BanUser(admin.ID, user, nil, "test"))
+	assert.Contains(t, []int{http.StatusUnauthorized, http.StatusForbidden}, get(signed))
+
+	other := sign(adminAuth)
+	assert.Equal(t, http.StatusNotFound, get(other))
+	_, err = s.h.user_svc.RevokeAllSessions(admin.ID)
+	require.NoError(t, err)
+	assert.Equal(t, http.StatusUnauthorized, get(other))
+}
@@ -1,13 +1,18 @@
 package handler
 
 import (
+	"context"
+	"errors"
 	"fmt"
+	"io"
+	"log"
 	"net/http"
-	"os"
 	"path/filepath"
 	"strconv"
 
 	"github.com/ProjectDistribute/distributor/middleware"
+	"github.com/ProjectDistribute/distributor/model"
+	"github.com/ProjectDistribute/distributor/service"
 	"github.com/ProjectDistribute/distributor/utils"
 	"github.com/google/uuid"
 	"github.com/labstack/echo/v4"
@@ -17,11 +22,17 @@ import (
 // @Summary Download song file
 // @Description Downloads a stored song file by its file ID.
 // @Tags songs
+// @Security BearerAuth
+// @Security ApiKeyAuth
 // @Produce application/octet-stream
 // @Param file_id path string true "File ID (UUID)"
+// @Param exp query int false "Signed URL expiry (unix seconds)"
+// @Param sig query string false "Signed URL signature, see POST /urls/sign"
 // @Success 200 {file} file
 // @Failure 400 {object} ErrorResponse
 // @Failure 404 {object} ErrorResponse
+// @Failure 401 {object} ErrorResponse
+// @Failure 403 {object} ErrorResponse
 // @Router /songs/download/{file_id} [get]
 func (h *Handler) DownloadFile(c *middleware.CustomContext) error {
 	fileId, err := c.GetUUID("file_id")
@@ -34,20 +45,34 @@ func (h *Handler) DownloadFile(c *middleware.CustomContext) error {
 		return echo.NewHTTPError(http.StatusNotFound, "File not found")
 	}
 
-	filePath := file.FilePath()
-	return c.File(filePath)
+	return h.serveStoredFile(c, h.song_svc.AudioPath(file), "", "")
 }
 
 // StreamFile godoc
 // @Summary Stream song file
 // @Description Streams a stored song file by its file ID. Supports HTTP Range requests.
+// @Description When `format` is given the file is transcoded on the fly (no Range support); if no transcoder is available the original is served.
+// @Description Once the loudness analysis job has measured the file, its ReplayGain values are sent as X-ReplayGain-* headers (gains in dB, peaks linear) and its integrated loudness as X-Loudness.
 // @Tags songs
+// @Security BearerAuth
+// @Security ApiKeyAuth
 // @Produce application/octet-stream
 // @Param file_id path string true "File ID (UUID)"
+// @Param format query string false "Target format" Enums(opus,mp3,aac,ogg)
+// @Param bitrate query int false "Target bitrate in kbit/s"
+// @Param exp query int false "Signed URL expiry (unix seconds)"
+// @Param sig query string false "Signed URL signature, see POST /urls/sign"
 // @Success 200 {file} file
 // @Success 206 {file} file
+// @Header 200,206 {string} X-ReplayGain-Track-Gain "Track gain, e.g. -7.52 dB"
+// @Header 200,206 {string} X-ReplayGain-Track-Peak "Linear track true peak, e.g. 0.988553"
+// @Header 200,206 {string} X-ReplayGain-Album-Gain "Album gain, e.g. -6.90 dB"
+// @Header 200,206 {string} X-ReplayGain-Album-Peak "Linear album true peak"
+// @Header 200,206 {string} X-Loudness "Integrated loudness, e.g. -10.48 LUFS"
 // @Failure 400 {object} ErrorResponse
 // @Failure 404 {object} ErrorResponse
+// @Failure 401 {object} ErrorResponse
+// @Failure 403 {object} ErrorResponse
 // @Router /songs/stream/{file_id} [get]
 func (h *Handler) StreamFile(c *middleware.CustomContext) error {
 	fileId, err := c.GetUUID("file_id")
@@ -60,10 +85,53 @@ func (h *Handler) StreamFile(c *middleware.CustomContext) error {
 		return echo.NewHTTPError(http.StatusNotFound, "File not found")
 	}
 
-	filePath := file.FilePath()
-	fh, err := os.Open(filePath)
+	var opts *service.TranscodeOptions
+	if format := c.QueryParam("format"); format != "" {
+		bitrate, _ := strconv.Atoi(c.QueryParam("bitrate"))
+		parsed, err := service.ParseTranscodeOptions(format, bitrate)
+		if err != nil {
+			return echo.NewHTTPError(http.StatusBadRequest, err.Error())
+		}
+		opts = &parsed
+	}
+	return h.serveSongFile(c, file, opts)
+}
+
+// serveSongFile streams file, transcoded to opts if given and a transcoder is available.
+func (h *Handler) serveSongFile(c *middleware.CustomContext, file *model.SongFile, opts *service.TranscodeOptions) error {
+	filePath := h.song_svc.AudioPath(file)
+	setReplayGainHeaders(c, file)
+
+	cached := h.transcode_cache != nil && h.transcode_cache.Enabled()
+	if opts != nil && (cached || h.transcode_svc != nil) {
+		src, err := service.TranscodeInput(h.song_svc.Storage, filePath)
+		if err != nil {
+			log.Printf("Failed to prepare transcode input of file %s: %v\n", file.ID, err)
+			return echo.NewHTTPError(http.StatusInternalServerError, "Failed to transcode file")
+		}
+		if cached {
+			return h.serveCachedTranscode(c, file.ID, src, *opts)
+		}
+		return h.streamTranscoded(c, file.ID, src, *opts)
+	} else if opts != nil {
+		log.Printf("Transcoding requested for file %s but no transcoder is available, serving original\n", file.ID)
+	}
+
+	c.Response().Header().Set(echo.HeaderContentType, utils.AudioContentType(file.Format))
+	c.Response().Header().Set("Accept-Ranges", "bytes")
+	return h.serveStoredFile(c, filePath, "inline", filepath.Base(filePath))
+}
+
+// serveCachedTranscode serves a rendition from the transcode cache, encoding it on a miss.
+// Unlike a live transcode, cached renditions support Range requests.
+func (h *Handler) serveCachedTranscode(c *middleware.CustomContext, fileID uuid.UUID, src string, opts service.TranscodeOptions) error {
+	fh, err := h.transcode_cache.Open(c.Request().Context(), fileID, src, opts)
+	if errors.Is(err, context.Canceled) {
+		return nil
+	}
 	if err != nil {
-		return echo.NewHTTPError(http.StatusNotFound, "File not found")
+		log.Printf("Transcoding file %s to %s@%dk failed: %v\n", fileID, opts.Format, opts.Bitrate, err)
+		return echo.NewHTTPError(http.StatusInternalServerError, "Failed to transcode file")
 	}
 	defer fh.Close()
 
@@ -72,20 +140,43 @@ func (h *Handler) StreamFile(c *middleware.CustomContext) error {
 		return echo.NewHTTPError(http.StatusInternalServerError, "Failed to stat file")
 	}
 
-	contentType := utils.AudioContentType(file.Format)
-	c.Response().Header().Set(echo.HeaderContentType, contentType)
+	name := fmt.Sprintf("%s.%s", fileID, opts.Format)
+	c.Response().Header().Set(echo.HeaderContentType, utils.AudioContentType(opts.Format))
 	c.Response().Header().Set("Accept-Ranges", "bytes")
-	c.Response().Header().Set("Content-Disposition", fmt.Sprintf("inline; filename=\"%s\"", filepath.Base(filePath)))
+	c.Response().Header().Set("Content-Disposition", fmt.Sprintf("inline; filename=\"%s\"", name))
 
-	http.ServeContent(c.Response().Writer, c.Request(), filePath, stat.ModTime(), fh)
+	http.ServeContent(c.Response().Writer, c.Request(), name, stat.ModTime(), fh)
+	return nil
+}
+
+// streamTranscoded pipes the transcoder output straight into the response.
+// The request context is cancelled when the client disconnects, which stops the transcoder.
+func (h *Handler) streamTranscoded(c *middleware.CustomContext, fileID uuid.UUID, src string, opts service.TranscodeOptions) error {
+	res := c.Response()
+	res.Header().Set(echo.HeaderContentType, utils.AudioContentType(opts.Format))
+	res.Header().Set("Accept-Ranges", "none")
+	res.Header().Set("Cache-Control", "no-store")
+	res.Header().Set("Content-Disposition", fmt.Sprintf("inline; filename=\"%s.%s\"", fileID, opts.Format))
+
+	err := h.transcode_svc.Transcode(c.Request().Context(), src, opts, res)
+	if err == nil || errors.Is(err, context.Canceled) {
+		return nil
+	}
+	log.Printf("Transcoding file %s to %s@%dk failed: %v\n", fileID, opts.Format, opts.Bitrate, err)
+	if !res.Committed {
+		return echo.NewHTTPError(http.StatusInternalServerError, "Failed to transcode file")
+	}
 	return nil
 }
 
 // AssignFileToSong godoc
 // @Summary Assign audio file to song
-// @Description Uploads an audio file and associates it to an existing song. Requires an admin JWT.
+// @Description Uploads an audio file and associates it to an existing song. Requires the library.edit permission.
+// @Description Audio identical to a file of the same song is refused with 409. Audio identical to a file of another song is linked to it, or refused when the duplicate_audio_policy setting is "reject".
+// @Description The format is detected from the content and must match the file extension. Files that are not audio, truncated or corrupt are refused with 422 and a validation report.
 // @Tags songs
 // @Security BearerAuth
+// @Security ApiKeyAuth
 // @Accept multipart/form-data
 // @Produce json
 // @Param song_id formData string true "Song ID (UUID)"
@@ -94,6 +185,8 @@ func (h *Handler) StreamFile(c *middleware.CustomContext) error {
 // @Failure 400 {object} ErrorResponse
 // @Failure 401 {object} ErrorResponse
 // @Failure 403 {object} ErrorResponse
+// @Failure 409 {object} ErrorResponse
+// @Failure 422 {object} InvalidAudioResponse
 // @Failure 500 {object} ErrorResponse
 // @Router /songs/assign-file [post]
 func (h *Handler) AssignFileToSong(c echo.Context) error {
@@ -107,13 +200,35 @@ func (h *Handler) AssignFileToSong(c echo.Context) error {
 		return echo.NewHTTPError(http.StatusBadRequest, "Form file 'file' is required")
 	}
 
-	filename := fh.Filename
+	format, err := uploadedAudioFormat(fh.Filename)
+	if err != nil {
+		return err
+	}
+
+	src, err := fh.Open()
+	if err != nil {
+		return echo.NewHTTPError(http.StatusInternalServerError, "Failed to read uploaded file")
+	}
+	defer src.Close()
+
+	songFile, err := h.song_svc.AssignFileToSong(songID, format, src)
+	if err != nil {
+		return assignFileError(err)
+	}
+	return c.JSON(http.StatusOK, AssignFileToSongResponse{
+		Status: "File assigned to song successfully",
+		File:   FromSongFileModel(*songFile),
+	})
+}
+
+// uploadedAudioFormat returns the format of an uploaded audio file from its name.
+func uploadedAudioFormat(filename string) (string, error) {
 	if filepath.Base(filename) != filename {
-		return echo.NewHTTPError(http.StatusBadRequest, "Invalid filename")
+		return "", echo.NewHTTPError(http.StatusBadRequest, "Invalid filename")
 	}
 	format := utils.GetFileFormat(filename)
 	if format == nil {
-		return echo.NewHTTPError(http.StatusBadRequest, "Could not determine file format")
+		return "", echo.NewHTTPError(http.StatusBadRequest, "Could not determine file format")
 	}
 	allowed := map[string]bool{
 		"mp3":  true,
@@ -123,7 +238,36 @@ func (h *Handler) AssignFileToSong(c echo.Context) error {
 		"m4a":  true,
 	}
 	if !allowed[*format] {
-		return echo.NewHTTPError(http.StatusBadRequest, "Unsupported file format: "+*format)
+		return "", echo.NewHTTPError(http.StatusBadRequest, "Unsupported file format: "+*format)
+	}
+	return *format, nil
+}
+
+// InspectFile godoc
+// @Summary Inspect audio file tags
+// @Description Reads the embedded tags (ID3v2, Vorbis comments, MP4) and artwork of an uploaded audio file and proposes the song, album and artists it maps to, without storing anything. proposal.song can be sent to POST /songs as is; existing artists and albums are referenced by ID. Requires the library.edit permission.
+// @Description validation reports whether the content matches the file extension and can be stored by POST /songs/assign-file.
+// @Tags songs
+// @Security BearerAuth
+// @Security ApiKeyAuth
+// @Accept multipart/form-data
+// @Produce json
+// @Param file formData file true "Audio file"
+// @Success 200 {object} InspectFileResponse
+// @Failure 400 {object} ErrorResponse
+// @Failure 401 {object} ErrorResponse
+// @Failure 403 {object} ErrorResponse
+// @Failure 422 {object} InvalidAudioResponse
+// @Failure 500 {object} ErrorResponse
+// @Router /songs/inspect [post]
+func (h *Handler) InspectFile(c echo.Context) error {
+	fh, err := c.FormFile("file")
+	if err != nil {
+		return echo.NewHTTPError(http.StatusBadRequest, "Form file 'file' is required")
+	}
+	format, err := uploadedAudioFormat(fh.Filename)
+	if err != nil {
+		return err
 	}
 
 	src, err := fh.Open()
@@ -132,26 +276,60 @@ func (h *Handler) AssignFileToSong(c echo.Context) error {
 	}
 	defer src.Close()
 
-	songFile, err := h.song_svc.AssignFileToSong(songID, *format, src)
+	// Content that is not audio at all has no tags worth reading
+	validation := service.ValidateAudio(src, format)
+	if validation.DetectedFormat == "" {
+		return echo.NewHTTPError(http.StatusUnprocessableEntity, InvalidAudioResponse{
+			Message:    (&service.InvalidAudioError{Report: validation}).Error(),
+			Validation: FromAudioValidation(validation),
+		})
+	}
+	if _, err := src.Seek(0, io.SeekStart); err != nil {
+		return echo.NewHTTPError(http.StatusInternalServerError, "Failed to read uploaded file")
+	}
+
+	tags, err := service.ReadTagsFrom(src)
 	if err != nil {
-		return echo.NewHTTPError(http.StatusInternalServerError, "Failed to assign file to song: "+err.Error())
+		return echo.NewHTTPError(http.StatusUnprocessableEntity, "Failed to read tags: "+err.Error())
 	}
-	return c.JSON(http.StatusOK, AssignFileToSongResponse{
-		Status: "File assigned to song successfully",
-		File: SongFile{
-			ID:        songFile.ID,
-			CreatedAt: songFile.CreatedAt,
-			Format:    songFile.Format,
-			Duration:  songFile.Duration,
-		},
-	})
+	proposal, err := h.library_svc.ProposeMapping(tags, fh.Filename)
+	if err != nil {
+		return echo.NewHTTPError(http.StatusInternalServerError, "Failed to match tags: "+err.Error())
+	}
+
+	res := InspectFileResponse{
+		Format:   format,
+		Tags:     FromAudioTags(tags),
+		Proposal: FromTagProposal(proposal, h.album_svc),
+	}
+	res.Validation = FromAudioValidation(validation)
+	res.Audio = res.Validation.Audio
+	return c.JSON(http.StatusOK, res)
+}
+
+// assignFileError maps an error of AssignFileToSong or AssignFileToSongByPath to a response.
+func assignFileError(err error) error {
+	var dup *service.DuplicateFileError
+	if errors.As(err, &dup) {
+		return echo.NewHTTPError(http.StatusConflict, "Duplicate audio: "+err.Error())
+	}
+	var invalid *service.InvalidAudioError
+	if errors.As(err, &invalid) {
+		return echo.NewHTTPError(http.StatusUnprocessableEntity, InvalidAudioResponse{
+			Message:    invalid.Error(),
+			Validation: FromAudioValidation(invalid.Report),
+		})
+	}
+	return echo.NewHTTPError(http.StatusInternalServerError, "Failed to assign file to song: "+err.Error())
 }
 
 // AssignFileToSongByPath godoc
 // @Summary Assign audio file to song by path
-// @Description Moves an audio file from a shared volume path and associates it to an existing song. Requires an admin JWT.
+// @Description Moves an audio file from a shared volume path and associates it to an existing song. Requires the library.edit permission.
+// @Description Duplicates and invalid audio are handled as in POST /songs/assign-file; a refused file is left at its source path.
 // @Tags songs
 // @Security BearerAuth
+// @Security ApiKeyAuth
 // @Accept json
 // @Produce json
 // @Param request body AssignFileByPathRequest true "Request body"
@@ -159,6 +337,8 @@ func (h *Handler) AssignFileToSong(c echo.Context) error {
 // @Failure 400 {object} ErrorResponse
 // @Failure 401 {object} ErrorResponse
 // @Failure 403 {object} ErrorResponse
+// @Failure 409 {object} ErrorResponse
+// @Failure 422 {object} InvalidAudioResponse
 // @Failure 500 {object} ErrorResponse
 // @Router /songs/assign-file-by-path [post]
 func (h *Handler) AssignFileToSongByPath(c echo.Context) error {
@@ -179,16 +359,11 @@ func (h *Handler) AssignFileToSongByPath(c echo.Context) error {
 
 	songFile, err := h.song_svc.AssignFileToSongByPath(req.SongID, cleanPath)
 	if err != nil {
-		return echo.NewHTTPError(http.StatusInternalServerError, "Failed to assign file to song: "+err.Error())
+		return assignFileError(err)
 	}
 	return c.JSON(http.StatusOK, AssignFileToSongResponse{
 		Status: "File assigned to song successfully",
-		File: SongFile{
-			ID:        songFile.ID,
-			CreatedAt: songFile.CreatedAt,
-			Format:    songFile.Format,
-			Duration:  songFile.Duration,
-		},
+		File:   FromSongFileModel(*songFile),
 	})
 }
 
@@ -196,11 +371,14 @@ func (h *Handler) AssignFileToSongByPath(c echo.Context) error {
 // @Summary List songs
 // @Description Returns the 50 latest songs, or paginated list if page/limit params are provided.
 // @Tags songs
+// @Security BearerAuth
+// @Security ApiKeyAuth
 // @Produce json
 // @Param page query int false "Page number"
 // @Param limit query int false "Items per page"
 // @Success 200 {object} GetSongsResponse
 // @Failure 500 {object} ErrorResponse
+// @Failure 401 {object} ErrorResponse
 // @Router /songs [get]
 func (h *Handler) GetSongs(c echo.Context) error {
 	pageStr := c.QueryParam("page")
@@ -274,13 +452,16 @@ func (h *Handler) GetSong(c echo.Context) error {
 
 // GetSongFiles godoc
 // @Summary List files for a song
-// @Description Returns all files associated with a song.
+// @Description Returns all files associated with a song, each with its pre-generated offline renditions.
 // @Tags songs
+// @Security BearerAuth
+// @Security ApiKeyAuth
 // @Produce json
 // @Param id path string true "Song ID (UUID)"
 // @Success 200 {array} SongFile
 // @Failure 400 {object} ErrorResponse
 // @Failure 500 {object} ErrorResponse
+// @Failure 401 {object} ErrorResponse
 // @Router /songs/{id}/files [get]
 func (h *Handler) GetSongFiles(c echo.Context) error {
 	songID, err := uuid.Parse(c.Param("id"))
@@ -298,9 +479,10 @@ func (h *Handler) GetSongFiles(c echo.Context) error {
 // ADMIN STUFF
 // CreateSong godoc
 // @Summary Create song metadata
-// @Description Creates a new song and (if needed) its artist and album. Requires an admin JWT.
+// @Description Creates a new song and (if needed) its artist and album. Requires the library.edit permission.
 // @Tags songs
 // @Security BearerAuth
+// @Security ApiKeyAuth
 // @Accept json
 // @Produce json
 // @Param request body CreateSongRequest true "Song metadata"
@@ -319,7 +501,7 @@ func (h *Handler) CreateSong(c echo.Context) error {
 		return echo.NewHTTPError(http.StatusBadRequest, "Validation failed: "+err.Error())
 	}
 
-	newSong, err := h.song_svc.CreateSong(req.Title, req.Artists, req.AlbumTitle, req.AlbumID)
+	newSong, err := h.song_svc.CreateSong(req.Title, req.Artists, req.AlbumTitle, req.AlbumID, req.TrackNumber, req.DiscNumber)
 	if err != nil {
 		if newSong != nil {
 			return echo.NewHTTPError(http.StatusConflict,
@@ -347,9 +529,10 @@ func (h *Handler) CreateSong(c echo.Context) error {
 
 // DeleteSong godoc
 // @Summary Delete song
-// @Description Deletes a song by ID. Requires an admin JWT.
+// @Description Deletes a song by ID. Requires the library.edit permission.
 // @Tags songs
 // @Security BearerAuth
+// @Security ApiKeyAuth
 // @Param id path string true "Song ID (UUID)"
 // @Success 204 {string} string "No Content"
 // @Failure 400 {object} ErrorResponse
@@ -372,9 +555,10 @@ func (h *Handler) DeleteSong(c echo.Context) error {
 
 // UpdateSong godoc
 // @Summary Update song
-// @Description Updates song metadata. Requires an admin JWT.
+// @Description Updates song metadata. Requires the library.edit permission.
 // @Tags songs
 // @Security BearerAuth
+// @Security ApiKeyAuth
 // @Accept json
 // @Produce json
 // @Param id path string true "Song ID (UUID)"
@@ -396,7 +580,11 @@ func (h *Handler) UpdateSong(c echo.Context) error {
 		return echo.NewHTTPError(http.StatusBadRequest, "Invalid request payload")
 	}
 
-	updatedSong, err := h.song_svc.UpdateSong(songID, req.Title, req.Artists, req.AlbumTitle, req.AlbumID)
+	if (req.TrackNumber != nil && *req.TrackNumber < 0) || (req.DiscNumber != nil && *req.DiscNumber < 0) {
+		return echo.NewHTTPError(http.StatusBadRequest, "Track and disc numbers cannot be negative")
+	}
+
+	updatedSong, err := h.song_svc.UpdateSong(songID, req.Title, req.Artists, req.AlbumTitle, req.AlbumID, req.TrackNumber, req.DiscNumber)
 	if err != nil {
 		return echo.NewHTTPError(http.StatusInternalServerError, "Failed to update song: "+err.Error())
 	}
@@ -438,9 +626,10 @@ func (h *Handler) GetSongsBatch(c echo.Context) error {
 
 // DeleteSongFile godoc
 // @Summary Delete song file
-// @Description Deletes a song file by ID. Requires an admin JWT.
+// @Description Deletes a song file by ID. Requires the library.edit permission.
 // @Tags songs
 // @Security BearerAuth
+// @Security ApiKeyAuth
 // @Param id path string true "File ID (UUID)"
 // @Success 204 {string} string "No Content"
 // @Failure 400 {object} ErrorResponse
@@ -458,5 +647,11 @@ func (h *Handler) DeleteSongFile(c echo.Context) error {
 	if err != nil {
 		return echo.NewHTTPError(http.StatusInternalServerError, "Failed to delete song file: "+err.Error())
 	}
+	if h.transcode_cache != nil {
+		h.transcode_cache.Purge(fileID)
+	}
+	if err := h.rendition_svc.DeleteRenditionsOfFile(fileID); err != nil {
+		log.Printf("Failed to delete renditions of file %s: %v\n", fileID, err)
+	}
 	return c.NoContent(http.StatusNoContent)
 }
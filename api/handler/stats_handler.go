@@ -7,6 +7,7 @@ import (
 	"time"
 
 	"github.com/ProjectDistribute/distributor/model"
+	"github.com/ProjectDistribute/distributor/service"
 	"github.com/labstack/echo/v4"
 	"github.com/shirou/gopsutil/v3/cpu"
 	"github.com/shirou/gopsutil/v3/disk"
@@ -29,6 +30,8 @@ type StatsResponse struct {
 	Uptime         int64        `json:"uptime"`
 	Cpu            float64      `json:"cpu"`
 	Storage        StorageStats `json:"storage"`
+
+	TranscodeCache *service.TranscodeCacheStats `json:"transcode_cache,omitempty"`
 }
 
 var startTime = time.Now()
@@ -85,6 +88,11 @@ func (h *Handler) GetStats(c echo.Context) error {
 		}
 	}
 
+	if h.transcode_cache != nil {
+		cacheStats := h.transcode_cache.Stats()
+		stats.TranscodeCache = &cacheStats
+	}
+
 	return c.JSON(http.StatusOK, stats)
 }
 
@@ -0,0 +1,152 @@
+package handler
+
+import (
+	"errors"
+	"log"
+	"net/http"
+
+	"github.com/ProjectDistribute/distributor/model"
+	"github.com/ProjectDistribute/distributor/service"
+	"github.com/ProjectDistribute/distributor/task"
+	"github.com/labstack/echo/v4"
+)
+
+const storageMigrationJob = "storage_migration"
+
+// StartStorageMigration godoc
+// @Summary Migrate storage
+// @Description Starts a background job that copies every song file, rendition and album cover to another storage backend and verifies each copy by its SHA-256. Files already copied by an interrupted migration to the same destination are skipped. The server keeps serving from the current storage until the migration is cut over. Requires the server.manage permission.
+// @Tags admin
+// @Security BearerAuth
+// @Security ApiKeyAuth
+// @Accept json
+// @Produce json
+// @Param request body service.StorageTarget true "Destination storage"
+// @Success 202 {object} StorageMigrationResponse
+// @Failure 400 {object} ErrorResponse
+// @Failure 401 {object} ErrorResponse
+// @Failure 403 {object} ErrorResponse
+// @Failure 409 {object} ErrorResponse
+// @Router /admin/storage/migration [post]
+func (h *Handler) StartStorageMigration(c echo.Context) error {
+	var target service.StorageTarget
+	if err := c.Bind(&target); err != nil {
+		return c.JSON(http.StatusBadRequest, ErrorResponse{Error: "Invalid input"})
+	}
+	if err := c.Validate(&target); err != nil {
+		return c.JSON(http.StatusBadRequest, ErrorResponse{Error: err.Error()})
+	}
+	if job := h.job_svc.Get(storageMigrationJob); job != nil && job.Running() {
+		return c.JSON(http.StatusConflict, ErrorResponse{Error: "A storage migration is already running"})
+	}
+	if !service.SongFilePathsMigrated(h.settings_svc) {
+		// Files still at their old path would be left behind
+		return c.JSON(http.StatusConflict, ErrorResponse{Error: "Song files are still being moved to their new paths"})
+	}
+
+	m, err := h.storage_migration_svc.Begin(target)
+	if errors.Is(err, service.ErrStorageMigrationSame) {
+		return c.JSON(http.StatusBadRequest, ErrorResponse{Error: "The server already uses this storage"})
+	}
+	if err != nil {
+		return c.JSON(http.StatusBadRequest, ErrorResponse{Error: err.Error()})
+	}
+
+	// The job updates m as it goes
+	started := *m
+	job, err := h.startStorageMigration(m)
+	if errors.Is(err, service.ErrJobRunning) {
+		return c.JSON(http.StatusConflict, ErrorResponse{Error: "A storage migration is already running"})
+	}
+	if err != nil {
+		return c.JSON(http.StatusInternalServerError, ErrorResponse{Error: err.Error()})
+	}
+
+	snap := job.Snapshot()
+	return c.JSON(http.StatusAccepted, StorageMigrationResponse{Migration: &started, Job: &snap})
+}
+
+// GetStorageMigration godoc
+// @Summary Get storage migration
+// @Description Returns the most recent storage migration with the progress of its job. Requires the server.manage permission.
+// @Tags admin
+// @Security BearerAuth
+// @Security ApiKeyAuth
+// @Produce json
+// @Success 200 {object} StorageMigrationResponse
+// @Failure 401 {object} ErrorResponse
+// @Failure 403 {object} ErrorResponse
+// @Failure 404 {object} ErrorResponse
+// @Router /admin/storage/migration [get]
+func (h *Handler) GetStorageMigration(c echo.Context) error {
+	m, err := h.storage_migration_svc.Latest()
+	if errors.Is(err, service.ErrNoStorageMigration) {
+		return c.JSON(http.StatusNotFound, ErrorResponse{Error: "No storage migration"})
+	}
+	if err != nil {
+		return c.JSON(http.StatusInternalServerError, ErrorResponse{Error: err.Error()})
+	}
+
+	res := StorageMigrationResponse{Migration: m}
+	if job := h.job_svc.Get(storageMigrationJob); job != nil {
+		snap := job.Snapshot()
+		res.Job = &snap
+	}
+	return c.JSON(http.StatusOK, res)
+}
+
+// CutoverStorageMigration godoc
+// @Summary Cut over to migrated storage
+// @Description Switches the server to the destination of the completed storage migration, after copying the files added since it completed. The switch lasts until restart only if the storage configuration is updated; otherwise it is reapplied on startup. Refused while files failed to copy, unless force is set. Requires the server.manage permission.
+// @Tags admin
+// @Security BearerAuth
+// @Security ApiKeyAuth
+// @Produce json
+// @Param force query bool false "Cut over even though some files failed to copy"
+// @Success 200 {object} StorageMigrationResponse
+// @Failure 401 {object} ErrorResponse
+// @Failure 403 {object} ErrorResponse
+// @Failure 404 {object} ErrorResponse
+// @Failure 409 {object} ErrorResponse
+// @Router /admin/storage/migration/cutover [post]
+func (h *Handler) CutoverStorageMigration(c echo.Context) error {
+	if job := h.job_svc.Get(storageMigrationJob); job != nil && job.Running() {
+		return c.JSON(http.StatusConflict, ErrorResponse{Error: "The storage migration is still running"})
+	}
+	m, err := h.storage_migration_svc.Latest()
+	if errors.Is(err, service.ErrNoStorageMigration) {
+		return c.JSON(http.StatusNotFound, ErrorResponse{Error: "No storage migration"})
+	}
+	if err != nil {
+		return c.JSON(http.StatusInternalServerError, ErrorResponse{Error: err.Error()})
+	}
+
+	err = h.storage_migration_svc.Cutover(m, c.QueryParam("force") == "true")
+	switch {
+	case errors.Is(err, service.ErrStorageMigrationNotReady):
+		return c.JSON(http.StatusConflict, ErrorResponse{Error: "The storage migration has not completed"})
+	case errors.Is(err, service.ErrStorageMigrationFailures):
+		return c.JSON(http.StatusConflict, ErrorResponse{Error: "Some files failed to copy, retry the migration or cut over with force=true"})
+	case err != nil:
+		return c.JSON(http.StatusInternalServerError, ErrorResponse{Error: err.Error()})
+	}
+	return c.JSON(http.StatusOK, StorageMigrationResponse{Migration: m})
+}
+
+func (h *Handler) startStorageMigration(m *model.StorageMigration) (*service.Job, error) {
+	return h.job_svc.Start(storageMigrationJob, func(job *service.Job) error {
+		return task.MigrateStorage(h.storage_migration_svc, m, job)
+	})
+}
+
+// resumeStorageMigration restarts a storage migration interrupted by a shutdown.
+func (h *Handler) resumeStorageMigration() {
+	m, err := h.storage_migration_svc.Latest()
+	if err != nil || m.Status != model.StorageMigrationRunning {
+		return
+	}
+	log.Printf("Resuming storage migration %d to %s\n", m.ID, service.DestTarget(m))
+	if _, err := h.startStorageMigration(m); err != nil {
+		log.Printf("Failed to resume storage migration: %v\n", err)
+	}
+}
@@ -0,0 +1,46 @@
+package handler
+
+import (
+	"fmt"
+	"log"
+	"net/http"
+	"path/filepath"
+	"time"
+
+	"github.com/ProjectDistribute/distributor/service"
+	"github.com/labstack/echo/v4"
+)
+
+// presignedRedirectTTL is how long redirects to presigned storage URLs stay valid.
+const presignedRedirectTTL = 15 * time.Minute
+
+// serveStoredFile serves the file at path from storage with Range support, or
+// redirects to a presigned URL when the storage is set up for that. A non-empty
+// disposition ("inline" or "attachment") is sent along with name.
+func (h *Handler) serveStoredFile(c echo.Context, path, disposition, name string) error {
+	storage := h.song_svc.Storage
+	if p, ok := service.CurrentStorage(storage).(service.PresignedStorage); ok && p.RedirectReads() {
+		url, err := p.PresignGet(path, presignedRedirectTTL)
+		if err == nil {
+			return c.Redirect(http.StatusFound, url)
+		}
+		log.Printf("Failed to presign %s, serving it directly: %v\n", path, err)
+	}
+
+	f, err := service.OpenContext(c.Request().Context(), storage, path)
+	if err != nil {
+		return echo.NewHTTPError(http.StatusNotFound, "File not found")
+	}
+	defer f.Close()
+
+	stat, err := f.Stat()
+	if err != nil {
+		return echo.NewHTTPError(http.StatusInternalServerError, "Failed to stat file")
+	}
+
+	if disposition != "" {
+		c.Response().Header().Set("Content-Disposition", fmt.Sprintf("%s; filename=\"%s\"", disposition, name))
+	}
+	http.ServeContent(c.Response().Writer, c.Request(), filepath.Base(path), stat.ModTime(), f)
+	return nil
+}
@@ -0,0 +1,923 @@
+package handler
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+	"unicode"
+
+	"github.com/ProjectDistribute/distributor/middleware"
+	"github.com/ProjectDistribute/distributor/model"
+	"github.com/ProjectDistribute/distributor/service"
+	"github.com/ProjectDistribute/distributor/utils"
+	"github.com/google/uuid"
+	"github.com/labstack/echo/v4"
+)
+
+// The Subsonic API (http://www.subsonic.org/pages/api.jsp) lets third-party players use
+// the library. Every endpoint answers HTTP 200; failures are reported in the body.
+// Requests carry their parameters in the query string or as a form POST.
+
+// RegisterSubsonic registers the Subsonic endpoints on rest, both as /name and /name.view.
+func (h *Handler) RegisterSubsonic(rest *echo.Group) {
+	rest.Use(h.SubsonicAuth)
+
+	endpoints := map[string]echo.HandlerFunc{
+		"ping":                      h.SubsonicPing,
+		"getLicense":                h.SubsonicGetLicense,
+		"getOpenSubsonicExtensions": h.SubsonicGetOpenSubsonicExtensions,
+		"getMusicFolders":           h.SubsonicGetMusicFolders,
+		"getArtists":                h.SubsonicGetArtists,
+		"getArtist":                 h.SubsonicGetArtist,
+		"getAlbum":                  h.SubsonicGetAlbum,
+		"getSong":                   h.SubsonicGetSong,
+		"search3":                   h.SubsonicSearch3,
+		"stream":                    h.SubsonicStream,
+		"download":                  h.SubsonicDownload,
+		"getCoverArt":               h.SubsonicGetCoverArt,
+		"getPlaylists":              h.SubsonicGetPlaylists,
+		"getPlaylist":               h.SubsonicGetPlaylist,
+		"createPlaylist":            h.SubsonicCreatePlaylist,
+		"updatePlaylist":            h.SubsonicUpdatePlaylist,
+		"deletePlaylist":            h.SubsonicDeletePlaylist,
+		"star":                      h.SubsonicStar,
+		"unstar":                    h.SubsonicUnstar,
+		"getStarred2":               h.SubsonicGetStarred2,
+		"scrobble":                  h.SubsonicScrobble,
+	}
+	methods := []string{http.MethodGet, http.MethodPost}
+	for name, fn := range endpoints {
+		rest.Match(methods, "/"+name, fn)
+		rest.Match(methods, "/"+name+".view", fn)
+	}
+}
+
+// SubsonicAuth authenticates the u/p or u/t/s parameters of a Subsonic request.
+func (h *Handler) SubsonicAuth(next echo.HandlerFunc) echo.HandlerFunc {
+	return func(c echo.Context) error {
+		// OpenSubsonic clients probe the extensions before they know whether auth works
+		if strings.TrimSuffix(strings.TrimPrefix(c.Path(), "/rest/"), ".view") == "getOpenSubsonicExtensions" {
+			return next(c)
+		}
+
+		username := c.FormValue("u")
+		password := c.FormValue("p")
+		token := c.FormValue("t")
+		salt := c.FormValue("s")
+		if username == "" || (password == "" && token == "") {
+			return h.subsonicError(c, subsonicErrMissingParameter, "Required parameter is missing: u and either p or t and s")
+		}
+
+		// Players authenticate every request, so only lockouts apply, not the login rate limit
+		ip := c.RealIP()
+		if err := h.login_limiter.CheckLocked(ip, username); err != nil {
+			return h.subsonicError(c, subsonicErrNotAuthorized, "Too many failed logins, try again later")
+		}
+
+		user, err := h.user_svc.AuthenticateSubsonic(username, password, token, salt)
+		if errors.Is(err, service.ErrUserBanned) {
+			return h.subsonicError(c, subsonicErrNotAuthorized, "User is banned")
+		}
+		if errors.Is(err, service.ErrPendingApproval) {
+			return h.subsonicError(c, subsonicErrNotAuthorized, "User is awaiting approval")
+		}
+		if err != nil {
+			h.login_limiter.LoginFailed(ip, username)
+			return h.subsonicError(c, subsonicErrWrongCredentials, "Wrong username or password")
+		}
+		c.Set("subsonic_user", user)
+		return next(c)
+	}
+}
+
+func subsonicUser(c echo.Context) *model.User {
+	return c.Get("subsonic_user").(*model.User)
+}
+
+func (h *Handler) newSubsonicResponse() *SubsonicResponse {
+	return &SubsonicResponse{
+		Xmlns:         subsonicXMLNS,
+		Status:        "ok",
+		Version:       subsonicAPIVersion,
+		Type:          "distributor",
+		ServerVersion: h.version,
+		OpenSubsonic:  true,
+	}
+}
+
+// subsonicCallback matches JSONP callbacks that are plain, possibly dotted, JavaScript
+// identifiers. Anything else would be reflected into a script as is.
+var subsonicCallback = regexp.MustCompile(`^[A-Za-z_$][A-Za-z0-9_$.]*$`)
+
+func subsonicRespond(c echo.Context, resp *SubsonicResponse) error {
+	switch c.FormValue("f") {
+	case "json":
+		return c.JSON(http.StatusOK, map[string]*SubsonicResponse{"subsonic-response": resp})
+	case "jsonp":
+		callback := c.FormValue("callback")
+		if !subsonicCallback.MatchString(callback) {
+			failed := &SubsonicResponse{
+				Xmlns:         resp.Xmlns,
+				Status:        "failed",
+				Version:       resp.Version,
+				Type:          resp.Type,
+				ServerVersion: resp.ServerVersion,
+				OpenSubsonic:  resp.OpenSubsonic,
+				Error:         &SubsonicError{Code: subsonicErrGeneric, Message: "Invalid JSONP callback"},
+			}
+			if callback == "" {
+				failed.Error = &SubsonicError{Code: subsonicErrMissingParameter, Message: "Required parameter is missing: callback"}
+			}
+			return c.JSON(http.StatusOK, map[string]*SubsonicResponse{"subsonic-response": failed})
+		}
+		return c.JSONP(http.StatusOK, callback, map[string]*SubsonicResponse{"subsonic-response": resp})
+	default:
+		return c.XML(http.StatusOK, resp)
+	}
+}
+
+func (h *Handler) subsonicOK(c echo.Context) error {
+	return subsonicRespond(c, h.newSubsonicResponse())
+}
+
+// SubsonicError doubles as error value so helpers can return the code to report.
+func (e *SubsonicError) Error() string {
+	return e.Message
+}
+
+// subsonicFail reports err to the client, with its code if it is a *SubsonicError.
+func (h *Handler) subsonicFail(c echo.Context, err error) error {
+	var se *SubsonicError
+	if !errors.As(err, &se) {
+		se = &SubsonicError{Code: subsonicErrGeneric, Message: err.Error()}
+	}
+	resp := h.newSubsonicResponse()
+	resp.Status = "failed"
+	resp.Error = se
+	return subsonicRespond(c, resp)
+}
+
+func (h *Handler) subsonicError(c echo.Context, code int, message string) error {
+	return h.subsonicFail(c, &SubsonicError{Code: code, Message: message})
+}
+
+// subsonicID parses a required id parameter.
+func subsonicID(c echo.Context, name string) (uuid.UUID, error) {
+	value := c.FormValue(name)
+	if value == "" {
+		return uuid.Nil, &SubsonicError{Code: subsonicErrMissingParameter, Message: "Required parameter is missing: " + name}
+	}
+	id, err := uuid.Parse(value)
+	if err != nil {
+		return uuid.Nil, &SubsonicError{Code: subsonicErrNotFound, Message: "Not found: " + value}
+	}
+	return id, nil
+}
+
+// subsonicIDs parses every value of a repeated id parameter, ignoring malformed ones.
+func subsonicIDs(c echo.Context, name string) []uuid.UUID {
+	params, _ := c.FormParams()
+	var ids []uuid.UUID
+	for _, v := range params[name] {
+		if id, err := uuid.Parse(v); err == nil {
+			ids = append(ids, id)
+		}
+	}
+	return ids
+}
+
+func subsonicInt(c echo.Context, name string, def int) int {
+	if v, err := strconv.Atoi(c.FormValue(name)); err == nil {
+		return v
+	}
+	return def
+}
+
+// starMap returns when the user starred each item.
+func (h *Handler) starMap(user *model.User) map[uuid.UUID]time.Time {
+	stars, err := h.star_store.GetStars(user.ID, "")
+	if err != nil {
+		return map[uuid.UUID]time.Time{}
+	}
+	m := make(map[uuid.UUID]time.Time, len(stars))
+	for _, s := range stars {
+		m[s.ItemID] = s.CreatedAt
+	}
+	return m
+}
+
+func starredAt(stars map[uuid.UUID]time.Time, id uuid.UUID) *time.Time {
+	if t, ok := stars[id]; ok {
+		return &t
+	}
+	return nil
+}
+
+// preferredFile picks the file served to Subsonic clients, the largest one being the best quality.
+func preferredFile(files []model.SongFile) *model.SongFile {
+	var best *model.SongFile
+	for i := range files {
+		if best == nil || files[i].Size > best.Size {
+			best = &files[i]
+		}
+	}
+	return best
+}
+
+// estimatedBitrate returns the average bitrate of a file in kbit/s.
+func estimatedBitrate(file *model.SongFile) int {
+	if file.Bitrate > 0 {
+		return file.Bitrate
+	}
+	if file.Duration == 0 {
+		return 0
+	}
+	// bytes * 8 / ms = kbit/s
+	return int(file.Size * 8 / int64(file.Duration))
+}
+
+// subsonicGenre is the first genre, Subsonic has no moods or tags.
+func subsonicGenre(genres []model.Genre) string {
+	for _, g := range genres {
+		if g.Kind == model.GenreKindGenre {
+			return g.Name
+		}
+	}
+	return ""
+}
+
+func (h *Handler) toSubsonicChild(song model.Song, stars map[uuid.UUID]time.Time) SubsonicChild {
+	child := SubsonicChild{
+		ID:         song.ID.String(),
+		Parent:     song.AlbumID.String(),
+		Title:      song.Title,
+		Album:      song.Album.Title,
+		AlbumID:    song.AlbumID.String(),
+		Track:      song.TrackNumber,
+		DiscNumber: song.DiscNumber,
+		Created:    song.CreatedAt,
+		Starred:    starredAt(stars, song.ID),
+		Genre:      subsonicGenre(song.Genres),
+		Type:       "music",
+		MediaType:  "song",
+	}
+	if !song.Album.ReleaseDate.IsZero() {
+		child.Year = song.Album.ReleaseDate.Year()
+	}
+	if h.album_svc.AlbumHasCover(song.AlbumID, "jpg") {
+		child.CoverArt = song.AlbumID.String()
+	}
+
+	names := make([]string, len(song.Artists))
+	for i, a := range song.Artists {
+		names[i] = a.Name
+	}
+	child.Artist = strings.Join(names, ", ")
+	if len(song.Artists) > 0 {
+		child.ArtistID = song.Artists[0].ID.String()
+	}
+
+	if file := preferredFile(song.SongFiles); file != nil {
+		child.Size = file.Size
+		child.Suffix = file.Format
+		child.ContentType = utils.AudioContentType(file.Format)
+		child.Duration = int(file.Duration / 1000)
+		child.BitRate = estimatedBitrate(file)
+		child.SamplingRate = file.SampleRate
+		child.BitDepth = file.BitDepth
+		child.ChannelCount = file.Channels
+		child.Path = fmt.Sprintf("%s/%s/%s.%s", child.Artist, song.Album.Title, song.Title, file.Format)
+	}
+	return child
+}
+
+func (h *Handler) toSubsonicChildren(songs []model.Song, stars map[uuid.UUID]time.Time) []SubsonicChild {
+	children := make([]SubsonicChild, len(songs))
+	for i, s := range songs {
+		children[i] = h.toSubsonicChild(s, stars)
+	}
+	return children
+}
+
+// toSubsonicAlbum expects album.Songs to be loaded with their artists.
+func (h *Handler) toSubsonicAlbum(album model.Album, durations map[uuid.UUID]uint, stars map[uuid.UUID]time.Time) SubsonicAlbum {
+	res := SubsonicAlbum{
+		ID:        album.ID.String(),
+		Name:      album.Title,
+		Artist:    album.GetArtistName(),
+		SongCount: len(album.Songs),
+		Duration:  int(durations[album.ID] / 1000),
+		Created:   album.CreatedAt,
+		Starred:   starredAt(stars, album.ID),
+		Genre:     subsonicGenre(album.Genres),
+	}
+	if !album.ReleaseDate.IsZero() {
+		res.Year = album.ReleaseDate.Year()
+	}
+	if h.album_svc.AlbumHasCover(album.ID, "jpg") {
+		res.CoverArt = album.ID.String()
+	}
+	if len(album.AlbumArtists) > 0 {
+		res.ArtistID = album.AlbumArtists[0].ID.String()
+	}
+	for _, s := range album.Songs {
+		if res.ArtistID != "" {
+			break
+		}
+		if len(s.Artists) > 0 {
+			res.ArtistID = s.Artists[0].ID.String()
+			break
+		}
+	}
+	return res
+}
+
+func (h *Handler) toSubsonicAlbums(albums []model.Album, stars map[uuid.UUID]time.Time) []SubsonicAlbum {
+	ids := make([]uuid.UUID, len(albums))
+	for i, a := range albums {
+		ids[i] = a.ID
+	}
+	durations, err := h.album_svc.Store.GetAlbumDurations(ids)
+	if err != nil {
+		durations = map[uuid.UUID]uint{}
+	}
+	res := make([]SubsonicAlbum, len(albums))
+	for i, a := range albums {
+		res[i] = h.toSubsonicAlbum(a, durations, stars)
+	}
+	return res
+}
+
+func toSubsonicArtist(artist model.Artist, albumCount int, stars map[uuid.UUID]time.Time) SubsonicArtist {
+	return SubsonicArtist{
+		ID:         artist.ID.String(),
+		Name:       artist.Name,
+		AlbumCount: albumCount,
+		Starred:    starredAt(stars, artist.ID),
+	}
+}
+
+func (h *Handler) toSubsonicArtists(artists []model.Artist, stars map[uuid.UUID]time.Time) []SubsonicArtist {
+	counts, err := h.artist_svc.Store.GetAlbumCounts()
+	if err != nil {
+		counts = map[uuid.UUID]int{}
+	}
+	res := make([]SubsonicArtist, len(artists))
+	for i, a := range artists {
+		res[i] = toSubsonicArtist(a, counts[a.ID], stars)
+	}
+	return res
+}
+
+func (h *Handler) SubsonicPing(c echo.Context) error {
+	return h.subsonicOK(c)
+}
+
+func (h *Handler) SubsonicGetLicense(c echo.Context) error {
+	resp := h.newSubsonicResponse()
+	resp.License = &SubsonicLicense{Valid: true}
+	return subsonicRespond(c, resp)
+}
+
+func (h *Handler) SubsonicGetOpenSubsonicExtensions(c echo.Context) error {
+	resp := h.newSubsonicResponse()
+	resp.OpenSubsonicExtensions = []SubsonicExtension{{Name: "formPost", Versions: []int{1}}}
+	return subsonicRespond(c, resp)
+}
+
+// SubsonicGetMusicFolders reports the whole library as a single music folder.
+func (h *Handler) SubsonicGetMusicFolders(c echo.Context) error {
+	resp := h.newSubsonicResponse()
+	resp.MusicFolders = &SubsonicMusicFolders{MusicFolder: []SubsonicMusicFolder{{ID: 1, Name: "Library"}}}
+	return subsonicRespond(c, resp)
+}
+
+func (h *Handler) SubsonicGetArtists(c echo.Context) error {
+	artists, err := h.artist_svc.Store.GetAllArtists()
+	if err != nil {
+		return h.subsonicFail(c, err)
+	}
+	sort.Slice(artists, func(i, j int) bool {
+		return strings.ToLower(artists[i].Name) < strings.ToLower(artists[j].Name)
+	})
+
+	var indexes []SubsonicIndex
+	for _, a := range h.toSubsonicArtists(artists, h.starMap(subsonicUser(c))) {
+		name := "#"
+		if r := []rune(strings.ToUpper(a.Name)); len(r) > 0 && unicode.IsLetter(r[0]) {
+			name = string(r[0])
+		}
+		if len(indexes) == 0 || indexes[len(indexes)-1].Name != name {
+			indexes = append(indexes, SubsonicIndex{Name: name})
+		}
+		indexes[len(indexes)-1].Artist = append(indexes[len(indexes)-1].Artist, a)
+	}
+
+	resp := h.newSubsonicResponse()
+	resp.Artists = &SubsonicArtists{Index: indexes}
+	return subsonicRespond(c, resp)
+}
+
+func (h *Handler) SubsonicGetArtist(c echo.Context) error {
+	id, err := subsonicID(c, "id")
+	if err != nil {
+		return h.subsonicFail(c, err)
+	}
+	artist, err := h.artist_svc.Store.GetArtistByID(id)
+	if err != nil {
+		return h.subsonicError(c, subsonicErrNotFound, "Artist not found")
+	}
+
+	albumRefs, err := h.artist_svc.Store.GetAlbumsForArtist(id)
+	if err != nil {
+		return h.subsonicFail(c, err)
+	}
+	albumIDs := make([]uuid.UUID, len(albumRefs))
+	for i, a := range albumRefs {
+		albumIDs[i] = a.ID
+	}
+	albums, err := h.album_svc.Store.GetAlbumsByIDs(albumIDs)
+	if err != nil {
+		return h.subsonicFail(c, err)
+	}
+	sort.Slice(albums, func(i, j int) bool { return albums[i].ReleaseDate.Before(albums[j].ReleaseDate) })
+
+	stars := h.starMap(subsonicUser(c))
+	resp := h.newSubsonicResponse()
+	resp.Artist = &SubsonicArtistWithAlbums{
+		SubsonicArtist: toSubsonicArtist(*artist, len(albums), stars),
+		Album:          h.toSubsonicAlbums(albums, stars),
+	}
+	return subsonicRespond(c, resp)
+}
+
+func (h *Handler) SubsonicGetAlbum(c echo.Context) error {
+	id, err := subsonicID(c, "id")
+	if err != nil {
+		return h.subsonicFail(c, err)
+	}
+	album, err := h.album_svc.Store.GetAlbumByID(id)
+	if err != nil {
+		return h.subsonicError(c, subsonicErrNotFound, "Album not found")
+	}
+	songs, err := h.song_svc.Store.GetSongsByAlbumID(id)
+	if err != nil {
+		return h.subsonicFail(c, err)
+	}
+
+	stars := h.starMap(subsonicUser(c))
+	resp := h.newSubsonicResponse()
+	resp.Album = &SubsonicAlbumWithSongs{
+		SubsonicAlbum: h.toSubsonicAlbums([]model.Album{*album}, stars)[0],
+		Song:          h.toSubsonicChildren(songs, stars),
+	}
+	return subsonicRespond(c, resp)
+}
+
+func (h *Handler) SubsonicGetSong(c echo.Context) error {
+	id, err := subsonicID(c, "id")
+	if err != nil {
+		return h.subsonicFail(c, err)
+	}
+	songs, err := h.song_svc.Store.GetSongsByIDs([]uuid.UUID{id})
+	if err != nil || len(songs) == 0 {
+		return h.subsonicError(c, subsonicErrNotFound, "Song not found")
+	}
+
+	child := h.toSubsonicChild(songs[0], h.starMap(subsonicUser(c)))
+	resp := h.newSubsonicResponse()
+	resp.Song = &child
+	return subsonicRespond(c, resp)
+}
+
+func (h *Handler) SubsonicSearch3(c echo.Context) error {
+	// Clients list the whole library with an empty or "" query
+	query := strings.Trim(strings.TrimSpace(c.FormValue("query")), `"`)
+
+	limit := func(name string) int {
+		n := subsonicInt(c, name, 20)
+		if n < 0 {
+			return 0
+		}
+		if n > 500 {
+			return 500
+		}
+		return n
+	}
+
+	result := &SubsonicSearchResult3{Artist: []SubsonicArtist{}, Album: []SubsonicAlbum{}, Song: []SubsonicChild{}}
+	stars := h.starMap(subsonicUser(c))
+
+	if n := limit("artistCount"); n > 0 {
+		artists, err := h.artist_svc.Store.SearchArtists(query, n, subsonicInt(c, "artistOffset", 0))
+		if err != nil {
+			return h.subsonicFail(c, err)
+		}
+		result.Artist = h.toSubsonicArtists(artists, stars)
+	}
+	if n := limit("albumCount"); n > 0 {
+		albums, err := h.album_svc.Store.SearchAlbums(query, n, subsonicInt(c, "albumOffset", 0))
+		if err != nil {
+			return h.subsonicFail(c, err)
+		}
+		result.Album = h.toSubsonicAlbums(albums, stars)
+	}
+	if n := limit("songCount"); n > 0 {
+		songs, err := h.song_svc.Store.SearchSongs(query, n, subsonicInt(c, "songOffset", 0))
+		if err != nil {
+			return h.subsonicFail(c, err)
+		}
+		result.Song = h.toSubsonicChildren(songs, stars)
+	}
+
+	resp := h.newSubsonicResponse()
+	resp.SearchResult3 = result
+	return subsonicRespond(c, resp)
+}
+
+// subsonicFile resolves the id of a stream or download request, a song or one of its files.
+func (h *Handler) subsonicFile(id uuid.UUID) (*model.SongFile, error) {
+	files, err := h.song_svc.GetSongFiles(id)
+	if err != nil {
+		return nil, err
+	}
+	if file := preferredFile(files); file != nil {
+		return file, nil
+	}
+	return h.song_svc.Store.GetFileByID(id)
+}
+
+// SubsonicStream serves the song, transcoded if the client asks for another format
+// or the file exceeds maxBitRate. Without an explicit format, mp3 is used.
+func (h *Handler) SubsonicStream(c echo.Context) error {
+	id, err := subsonicID(c, "id")
+	if err != nil {
+		return h.subsonicFail(c, err)
+	}
+	file, err := h.subsonicFile(id)
+	if err != nil {
+		return h.subsonicError(c, subsonicErrNotFound, "Song not found")
+	}
+
+	format := strings.ToLower(c.FormValue("format"))
+	maxBitRate := subsonicInt(c, "maxBitRate", 0)
+
+	var opts *service.TranscodeOptions
+	switch {
+	case format == "raw" || format == file.Format:
+	case format != "":
+		parsed, err := service.ParseTranscodeOptions(format, maxBitRate)
+		if err != nil {
+			return h.subsonicFail(c, err)
+		}
+		opts = &parsed
+	case maxBitRate > 0 && estimatedBitrate(file) > maxBitRate:
+		parsed, _ := service.ParseTranscodeOptions("mp3", maxBitRate)
+		opts = &parsed
+	}
+
+	return h.serveSongFile(&middleware.CustomContext{Context: c}, file, opts)
+}
+
+func (h *Handler) SubsonicDownload(c echo.Context) error {
+	id, err := subsonicID(c, "id")
+	if err != nil {
+		return h.subsonicFail(c, err)
+	}
+	file, err := h.subsonicFile(id)
+	if err != nil {
+		return h.subsonicError(c, subsonicErrNotFound, "Song not found")
+	}
+	return h.serveStoredFile(c, h.song_svc.AudioPath(file), "attachment", file.SongID.String()+"."+file.Format)
+}
+
+// SubsonicGetCoverArt serves album covers. Song ids resolve to the cover of their album.
+func (h *Handler) SubsonicGetCoverArt(c echo.Context) error {
+	id, err := subsonicID(c, "id")
+	if err != nil {
+		return h.subsonicFail(c, err)
+	}
+	if !h.album_svc.AlbumHasCover(id, "jpg") {
+		songs, err := h.song_svc.Store.GetSongsByIDs([]uuid.UUID{id})
+		if err != nil || len(songs) == 0 || !h.album_svc.AlbumHasCover(songs[0].AlbumID, "jpg") {
+			return h.subsonicError(c, subsonicErrNotFound, "Cover art not found")
+		}
+		id = songs[0].AlbumID
+	}
+
+	res := "hq"
+	if size := subsonicInt(c, "size", 0); size > 0 && size <= 128 {
+		res = "lq"
+	}
+	c.Response().Header().Set("Cache-Control", "public, max-age=86400")
+	return h.serveStoredFile(c, h.album_svc.GetAlbumCoverPath(id, "jpg", res), "", "")
+}
+
+// subsonicPlaylist loads the playlist named by param if the user may access it.
+func (h *Handler) subsonicPlaylist(c echo.Context, param string) (*model.Playlist, error) {
+	id, err := subsonicID(c, param)
+	if err != nil {
+		return nil, err
+	}
+	playlist, err := h.playlist_svc.Store.GetPlaylistByID(id)
+	if err != nil {
+		return nil, &SubsonicError{Code: subsonicErrNotFound, Message: "Playlist not found"}
+	}
+	user := subsonicUser(c)
+	if playlist.UserID != user.ID && !user.IsAdmin {
+		return nil, &SubsonicError{Code: subsonicErrNotAuthorized, Message: "Not your playlist"}
+	}
+	return playlist, nil
+}
+
+// toSubsonicPlaylist expects PlaylistSongs to be loaded with their songs and files.
+func toSubsonicPlaylist(playlist model.Playlist, owner string) SubsonicPlaylist {
+	duration := 0
+	for _, ps := range playlist.PlaylistSongs {
+		if file := preferredFile(ps.Song.SongFiles); file != nil {
+			duration += int(file.Duration / 1000)
+		}
+	}
+	return SubsonicPlaylist{
+		ID:        playlist.ID.String(),
+		Name:      playlist.Name,
+		Owner:     owner,
+		SongCount: len(playlist.PlaylistSongs),
+		Duration:  duration,
+		Created:   playlist.CreatedAt,
+		Changed:   playlist.UpdatedAt,
+	}
+}
+
+func (h *Handler) subsonicPlaylistResponse(c echo.Context, playlistID uuid.UUID) error {
+	playlist, err := h.playlist_svc.Store.GetPlaylistByID(playlistID)
+	if err != nil {
+		return h.subsonicError(c, subsonicErrNotFound, "Playlist not found")
+	}
+
+	owner := subsonicUser(c).Username
+	if playlist.UserID != subsonicUser(c).ID {
+		if u, err := h.user_svc.Store.GetUserByID(playlist.UserID); err == nil {
+			owner = u.Username
+		}
+	}
+
+	songIDs := make([]uuid.UUID, len(playlist.PlaylistSongs))
+	for i, ps := range playlist.PlaylistSongs {
+		songIDs[i] = ps.SongID
+	}
+	songs, err := h.song_svc.Store.GetSongsByIDs(songIDs)
+	if err != nil {
+		return h.subsonicFail(c, err)
+	}
+	byID := make(map[uuid.UUID]model.Song, len(songs))
+	for _, s := range songs {
+		byID[s.ID] = s
+	}
+	stars := h.starMap(subsonicUser(c))
+	entries := make([]SubsonicChild, 0, len(songIDs))
+	for _, id := range songIDs {
+		if s, ok := byID[id]; ok {
+			entries = append(entries, h.toSubsonicChild(s, stars))
+		}
+	}
+
+	resp := h.newSubsonicResponse()
+	resp.Playlist = &SubsonicPlaylistWithSongs{
+		SubsonicPlaylist: toSubsonicPlaylist(*playlist, owner),
+		Entry:            entries,
+	}
+	return subsonicRespond(c, resp)
+}
+
+func (h *Handler) SubsonicGetPlaylists(c echo.Context) error {
+	user := subsonicUser(c)
+	playlists, err := h.playlist_svc.Store.GetUserPlaylists(user.ID)
+	if err != nil {
+		return h.subsonicFail(c, err)
+	}
+
+	res := make([]SubsonicPlaylist, 0, len(playlists))
+	for _, p := range playlists {
+		full, err := h.playlist_svc.Store.GetPlaylistByID(p.ID)
+		if err != nil {
+			continue
+		}
+		res = append(res, toSubsonicPlaylist(*full, user.Username))
+	}
+
+	resp := h.newSubsonicResponse()
+	resp.Playlists = &SubsonicPlaylists{Playlist: res}
+	return subsonicRespond(c, resp)
+}
+
+func (h *Handler) SubsonicGetPlaylist(c echo.Context) error {
+	playlist, err := h.subsonicPlaylist(c, "id")
+	if err != nil {
+		return h.subsonicFail(c, err)
+	}
+	return h.subsonicPlaylistResponse(c, playlist.ID)
+}
+
+// SubsonicCreatePlaylist creates a playlist, or replaces the songs of playlistId if given.
+func (h *Handler) SubsonicCreatePlaylist(c echo.Context) error {
+	user := subsonicUser(c)
+	songIDs := subsonicIDs(c, "songId")
+
+	if c.FormValue("playlistId") == "" {
+		name := c.FormValue("name")
+		if name == "" {
+			return h.subsonicError(c, subsonicErrMissingParameter, "Required parameter is missing: name or playlistId")
+		}
+		playlist, err := h.playlist_svc.CreatePlaylistWithContents(user.ID, name, songIDs)
+		if err != nil {
+			return h.subsonicFail(c, err)
+		}
+		return h.subsonicPlaylistResponse(c, playlist.ID)
+	}
+
+	playlist, err := h.subsonicPlaylist(c, "playlistId")
+	if err != nil {
+		return h.subsonicFail(c, err)
+	}
+	if name := c.FormValue("name"); name != "" {
+		if err := h.playlist_svc.Store.RenamePlaylist(playlist.ID, playlist.UserID, name, user.IsAdmin); err != nil {
+			return h.subsonicFail(c, err)
+		}
+	}
+	for _, ps := range playlist.PlaylistSongs {
+		if err := h.playlist_svc.Store.RemoveSongFromPlaylist(playlist.ID, ps.SongID); err != nil {
+			return h.subsonicFail(c, err)
+		}
+	}
+	for _, songID := range songIDs {
+		_ = h.playlist_svc.Store.AddSongToPlaylist(playlist.ID, songID)
+	}
+	return h.subsonicPlaylistResponse(c, playlist.ID)
+}
+
+func (h *Handler) SubsonicUpdatePlaylist(c echo.Context) error {
+	user := subsonicUser(c)
+	playlist, err := h.subsonicPlaylist(c, "playlistId")
+	if err != nil {
+		return h.subsonicFail(c, err)
+	}
+
+	if name := c.FormValue("name"); name != "" {
+		if err := h.playlist_svc.Store.RenamePlaylist(playlist.ID, playlist.UserID, name, user.IsAdmin); err != nil {
+			return h.subsonicFail(c, err)
+		}
+	}
+
+	// Indexes refer to the order before this update
+	params, _ := c.FormParams()
+	for _, v := range params["songIndexToRemove"] {
+		i, err := strconv.Atoi(v)
+		if err != nil || i < 0 || i >= len(playlist.PlaylistSongs) {
+			continue
+		}
+		if err := h.playlist_svc.Store.RemoveSongFromPlaylist(playlist.ID, playlist.PlaylistSongs[i].SongID); err != nil {
+			return h.subsonicFail(c, err)
+		}
+	}
+	for _, songID := range subsonicIDs(c, "songIdToAdd") {
+		_ = h.playlist_svc.Store.AddSongToPlaylist(playlist.ID, songID)
+	}
+	return h.subsonicOK(c)
+}
+
+func (h *Handler) SubsonicDeletePlaylist(c echo.Context) error {
+	user := subsonicUser(c)
+	playlist, err := h.subsonicPlaylist(c, "id")
+	if err != nil {
+		return h.subsonicFail(c, err)
+	}
+	if err := h.playlist_svc.Store.DeletePlaylist(playlist.ID, playlist.UserID, user.IsAdmin); err != nil {
+		return h.subsonicFail(c, err)
+	}
+	return h.subsonicOK(c)
+}
+
+// starTargets collects the items of a star/unstar request. Plain ids may be songs, albums or artists.
+func (h *Handler) starTargets(c echo.Context) map[uuid.UUID]string {
+	targets := make(map[uuid.UUID]string)
+	for _, id := range subsonicIDs(c, "id") {
+		if _, err := h.song_svc.Store.GetSongByID(id); err == nil {
+			targets[id] = model.StarItemSong
+		} else if _, err := h.album_svc.Store.GetAlbumByID(id); err == nil {
+			targets[id] = model.StarItemAlbum
+		} else if _, err := h.artist_svc.Store.GetArtistByID(id); err == nil {
+			targets[id] = model.StarItemArtist
+		}
+	}
+	for _, id := range subsonicIDs(c, "albumId") {
+		targets[id] = model.StarItemAlbum
+	}
+	for _, id := range subsonicIDs(c, "artistId") {
+		targets[id] = model.StarItemArtist
+	}
+	return targets
+}
+
+func (h *Handler) SubsonicStar(c echo.Context) error {
+	user := subsonicUser(c)
+	for id, itemType := range h.starTargets(c) {
+		if err := h.star_store.Star(user.ID, id, itemType); err != nil {
+			return h.subsonicFail(c, err)
+		}
+	}
+	return h.subsonicOK(c)
+}
+
+func (h *Handler) SubsonicUnstar(c echo.Context) error {
+	user := subsonicUser(c)
+	ids := append(subsonicIDs(c, "id"), subsonicIDs(c, "albumId")...)
+	ids = append(ids, subsonicIDs(c, "artistId")...)
+	for _, id := range ids {
+		if err := h.star_store.Unstar(user.ID, id); err != nil {
+			return h.subsonicFail(c, err)
+		}
+	}
+	return h.subsonicOK(c)
+}
+
+func (h *Handler) SubsonicGetStarred2(c echo.Context) error {
+	user := subsonicUser(c)
+	stars, err := h.star_store.GetStars(user.ID, "")
+	if err != nil {
+		return h.subsonicFail(c, err)
+	}
+
+	starMap := make(map[uuid.UUID]time.Time, len(stars))
+	var songIDs, albumIDs, artistIDs []uuid.UUID
+	for _, s := range stars {
+		starMap[s.ItemID] = s.CreatedAt
+		switch s.ItemType {
+		case model.StarItemSong:
+			songIDs = append(songIDs, s.ItemID)
+		case model.StarItemAlbum:
+			albumIDs = append(albumIDs, s.ItemID)
+		case model.StarItemArtist:
+			artistIDs = append(artistIDs, s.ItemID)
+		}
+	}
+
+	result := &SubsonicStarred2{Artist: []SubsonicArtist{}, Album: []SubsonicAlbum{}, Song: []SubsonicChild{}}
+	if len(artistIDs) > 0 {
+		artists, err := h.artist_svc.Store.GetArtistsByIDs(artistIDs)
+		if err != nil {
+			return h.subsonicFail(c, err)
+		}
+		result.Artist = h.toSubsonicArtists(artists, starMap)
+	}
+	if len(albumIDs) > 0 {
+		albums, err := h.album_svc.Store.GetAlbumsByIDs(albumIDs)
+		if err != nil {
+			return h.subsonicFail(c, err)
+		}
+		result.Album = h.toSubsonicAlbums(albums, starMap)
+	}
+	if len(songIDs) > 0 {
+		songs, err := h.song_svc.Store.GetSongsByIDs(songIDs)
+		if err != nil {
+			return h.subsonicFail(c, err)
+		}
+		result.Song = h.toSubsonicChildren(songs, starMap)
+	}
+
+	resp := h.newSubsonicResponse()
+	resp.Starred2 = result
+	return subsonicRespond(c, resp)
+}
+
+// SubsonicScrobble records plays. "Now playing" notifications (submission=false) are accepted but not stored.
+func (h *Handler) SubsonicScrobble(c echo.Context) error {
+	user := subsonicUser(c)
+	if c.FormValue("submission") == "false" {
+		return h.subsonicOK(c)
+	}
+
+	params, _ := c.FormParams()
+	times := params["time"]
+	for i, v := range params["id"] {
+		songID, err := uuid.Parse(v)
+		if err != nil {
+			continue
+		}
+		playedAt := time.Now()
+		if i < len(times) {
+			if ms, err := strconv.ParseInt(times[i], 10, 64); err == nil {
+				playedAt = time.UnixMilli(ms)
+			}
+		}
+		if err := h.scrobble_store.CreateScrobble(&model.Scrobble{UserID: user.ID, SongID: songID, PlayedAt: playedAt}); err != nil {
+			return h.subsonicFail(c, err)
+		}
+	}
+	return h.subsonicOK(c)
+}
@@ -0,0 +1,81 @@
+package handler
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+
+	"github.com/ProjectDistribute/distributor/model"
+	"github.com/labstack/echo/v4"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestSubsonicRespond_JSONPCallback(t *testing.T) {
+	tests := []struct {
+		name     string
+		callback string
+		wantJSON bool
+		wantCode int
+	}{
+		{"identifier", "cb", false, 0},
+		{"dotted", "jQuery.cb_1$", false, 0},
+		{"missing", "", true, subsonicErrMissingParameter},
+		{"script", "alert(1);cb", true, subsonicErrGeneric},
+		{"leading digit", "1cb", true, subsonicErrGeneric},
+		{"markup", "<script>", true, subsonicErrGeneric},
+	}
+	h := &Handler{version: "test"}
+	e := echo.New()
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest(http.MethodGet, "/rest/ping?f=jsonp&callback="+url.QueryEscape(tt.callback), nil)
+			rec := httptest.NewRecorder()
+			require.NoError(t, h.subsonicOK(e.NewContext(req, rec)))
+			assert.Equal(t, http.StatusOK, rec.Code)
+
+			if !tt.wantJSON {
+				assert.Equal(t, echo.MIMEApplicationJavaScriptCharsetUTF8, rec.Header().Get(echo.HeaderContentType))
+				assert.True(t, strings.HasPrefix(rec.Body.String(), tt.callback+"("), rec.Body.String())
+				return
+			}
+			assert.Equal(t, echo.MIMEApplicationJSON, rec.Header().Get(echo.HeaderContentType))
+			resp := decode[map[string]SubsonicResponse](t, rec)["subsonic-response"]
+			assert.Equal(t, "failed", resp.Status)
+			require.NotNil(t, resp.Error)
+			assert.Equal(t, tt.wantCode, resp.Error.Code)
+		})
+	}
+}
+
+func TestSubsonicGetAlbum_DiscAndTrackOrder(t *testing.T) {
+	s := newTestServer(t)
+	user, _ := s.user(t, "listener", model.RoleUser)
+
+	album, err := s.h.album_svc.Store.CreateAlbum(&model.Album{Title: "Double"})
+	require.NoError(t, err)
+	// Uploaded in reverse, so creation order disagrees with the album order.
+	for _, song := range []*model.Song{
+		{AlbumID: album.ID, Title: "2-1", DiscNumber: 2, TrackNumber: 1},
+		{AlbumID: album.ID, Title: "1-2", DiscNumber: 1, TrackNumber: 2},
+		{AlbumID: album.ID, Title: "1-1", DiscNumber: 1, TrackNumber: 1},
+	} {
+		require.NoError(t, s.h.song_svc.Store.CreateSong(song))
+	}
+
+	req := httptest.NewRequest(http.MethodGet, "/rest/getAlbum?f=json&id="+album.ID.String(), nil)
+	rec := httptest.NewRecorder()
+	c := s.e.NewContext(req, rec)
+	c.Set("subsonic_user", user)
+	require.NoError(t, s.h.SubsonicGetAlbum(c))
+
+	resp := decode[map[string]SubsonicResponse](t, rec)["subsonic-response"]
+	require.NotNil(t, resp.Album, rec.Body.String())
+	var titles []string
+	for _, song := range resp.Album.Song {
+		titles = append(titles, song.Title)
+	}
+	assert.Equal(t, []string{"1-1", "1-2", "2-1"}, titles)
+}
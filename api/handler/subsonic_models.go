@@ -0,0 +1,171 @@
+package handler
+
+import (
+	"encoding/xml"
+	"time"
+)
+
+const (
+	subsonicAPIVersion = "1.16.1"
+	subsonicXMLNS      = "http://subsonic.org/restapi"
+)
+
+// Subsonic error codes, see http://www.subsonic.org/pages/api.jsp
+const (
+	subsonicErrGeneric          = 0
+	subsonicErrMissingParameter = 10
+	subsonicErrWrongCredentials = 40
+	subsonicErrNotAuthorized    = 50
+	subsonicErrNotFound         = 70
+)
+
+// SubsonicResponse is the envelope of every /rest response. Only the field of the
+// called endpoint is set; XML and JSON use the same element names.
+type SubsonicResponse struct {
+	XMLName       xml.Name `xml:"subsonic-response" json:"-"`
+	Xmlns         string   `xml:"xmlns,attr" json:"-"`
+	Status        string   `xml:"status,attr" json:"status"`
+	Version       string   `xml:"version,attr" json:"version"`
+	Type          string   `xml:"type,attr" json:"type"`
+	ServerVersion string   `xml:"serverVersion,attr" json:"serverVersion"`
+	OpenSubsonic  bool     `xml:"openSubsonic,attr" json:"openSubsonic"`
+
+	Error                  *SubsonicError             `xml:"error,omitempty" json:"error,omitempty"`
+	License                *SubsonicLicense           `xml:"license,omitempty" json:"license,omitempty"`
+	MusicFolders           *SubsonicMusicFolders      `xml:"musicFolders,omitempty" json:"musicFolders,omitempty"`
+	Artists                *SubsonicArtists           `xml:"artists,omitempty" json:"artists,omitempty"`
+	Artist                 *SubsonicArtistWithAlbums  `xml:"artist,omitempty" json:"artist,omitempty"`
+	Album                  *SubsonicAlbumWithSongs    `xml:"album,omitempty" json:"album,omitempty"`
+	Song                   *SubsonicChild             `xml:"song,omitempty" json:"song,omitempty"`
+	SearchResult3          *SubsonicSearchResult3     `xml:"searchResult3,omitempty" json:"searchResult3,omitempty"`
+	Playlists              *SubsonicPlaylists         `xml:"playlists,omitempty" json:"playlists,omitempty"`
+	Playlist               *SubsonicPlaylistWithSongs `xml:"playlist,omitempty" json:"playlist,omitempty"`
+	Starred2               *SubsonicStarred2          `xml:"starred2,omitempty" json:"starred2,omitempty"`
+	OpenSubsonicExtensions []SubsonicExtension        `xml:"openSubsonicExtensions,omitempty" json:"openSubsonicExtensions,omitempty"`
+}
+
+type SubsonicError struct {
+	Code    int    `xml:"code,attr" json:"code"`
+	Message string `xml:"message,attr" json:"message"`
+}
+
+type SubsonicLicense struct {
+	Valid bool `xml:"valid,attr" json:"valid"`
+}
+
+type SubsonicMusicFolders struct {
+	MusicFolder []SubsonicMusicFolder `xml:"musicFolder" json:"musicFolder"`
+}
+
+type SubsonicMusicFolder struct {
+	ID   int    `xml:"id,attr" json:"id"`
+	Name string `xml:"name,attr" json:"name"`
+}
+
+type SubsonicArtists struct {
+	IgnoredArticles string          `xml:"ignoredArticles,attr" json:"ignoredArticles"`
+	Index           []SubsonicIndex `xml:"index" json:"index"`
+}
+
+type SubsonicIndex struct {
+	Name   string           `xml:"name,attr" json:"name"`
+	Artist []SubsonicArtist `xml:"artist" json:"artist"`
+}
+
+type SubsonicArtist struct {
+	ID         string     `xml:"id,attr" json:"id"`
+	Name       string     `xml:"name,attr" json:"name"`
+	AlbumCount int        `xml:"albumCount,attr" json:"albumCount"`
+	Starred    *time.Time `xml:"starred,attr,omitempty" json:"starred,omitempty"`
+}
+
+type SubsonicArtistWithAlbums struct {
+	SubsonicArtist
+	Album []SubsonicAlbum `xml:"album" json:"album"`
+}
+
+type SubsonicAlbum struct {
+	ID        string     `xml:"id,attr" json:"id"`
+	Name      string     `xml:"name,attr" json:"name"`
+	Artist    string     `xml:"artist,attr,omitempty" json:"artist,omitempty"`
+	ArtistID  string     `xml:"artistId,attr,omitempty" json:"artistId,omitempty"`
+	CoverArt  string     `xml:"coverArt,attr,omitempty" json:"coverArt,omitempty"`
+	SongCount int        `xml:"songCount,attr" json:"songCount"`
+	Duration  int        `xml:"duration,attr" json:"duration"`
+	Created   time.Time  `xml:"created,attr" json:"created"`
+	Year      int        `xml:"year,attr,omitempty" json:"year,omitempty"`
+	Genre     string     `xml:"genre,attr,omitempty" json:"genre,omitempty"`
+	Starred   *time.Time `xml:"starred,attr,omitempty" json:"starred,omitempty"`
+}
+
+type SubsonicAlbumWithSongs struct {
+	SubsonicAlbum
+	Song []SubsonicChild `xml:"song" json:"song"`
+}
+
+// SubsonicChild is a song in Subsonic terms.
+type SubsonicChild struct {
+	ID           string     `xml:"id,attr" json:"id"`
+	Parent       string     `xml:"parent,attr,omitempty" json:"parent,omitempty"`
+	IsDir        bool       `xml:"isDir,attr" json:"isDir"`
+	Title        string     `xml:"title,attr" json:"title"`
+	Album        string     `xml:"album,attr,omitempty" json:"album,omitempty"`
+	Artist       string     `xml:"artist,attr,omitempty" json:"artist,omitempty"`
+	Track        int        `xml:"track,attr,omitempty" json:"track,omitempty"`
+	DiscNumber   int        `xml:"discNumber,attr,omitempty" json:"discNumber,omitempty"`
+	Year         int        `xml:"year,attr,omitempty" json:"year,omitempty"`
+	Genre        string     `xml:"genre,attr,omitempty" json:"genre,omitempty"`
+	CoverArt     string     `xml:"coverArt,attr,omitempty" json:"coverArt,omitempty"`
+	Size         int64      `xml:"size,attr,omitempty" json:"size,omitempty"`
+	ContentType  string     `xml:"contentType,attr,omitempty" json:"contentType,omitempty"`
+	Suffix       string     `xml:"suffix,attr,omitempty" json:"suffix,omitempty"`
+	Duration     int        `xml:"duration,attr,omitempty" json:"duration,omitempty"`
+	BitRate      int        `xml:"bitRate,attr,omitempty" json:"bitRate,omitempty"`
+	SamplingRate int        `xml:"samplingRate,attr,omitempty" json:"samplingRate,omitempty"`
+	BitDepth     int        `xml:"bitDepth,attr,omitempty" json:"bitDepth,omitempty"`
+	ChannelCount int        `xml:"channelCount,attr,omitempty" json:"channelCount,omitempty"`
+	Path         string     `xml:"path,attr,omitempty" json:"path,omitempty"`
+	Created      time.Time  `xml:"created,attr" json:"created"`
+	Starred      *time.Time `xml:"starred,attr,omitempty" json:"starred,omitempty"`
+	AlbumID      string     `xml:"albumId,attr,omitempty" json:"albumId,omitempty"`
+	ArtistID     string     `xml:"artistId,attr,omitempty" json:"artistId,omitempty"`
+	Type         string     `xml:"type,attr" json:"type"`
+	MediaType    string     `xml:"mediaType,attr" json:"mediaType"`
+}
+
+type SubsonicSearchResult3 struct {
+	Artist []SubsonicArtist `xml:"artist" json:"artist"`
+	Album  []SubsonicAlbum  `xml:"album" json:"album"`
+	Song   []SubsonicChild  `xml:"song" json:"song"`
+}
+
+type SubsonicPlaylists struct {
+	Playlist []SubsonicPlaylist `xml:"playlist" json:"playlist"`
+}
+
+type SubsonicPlaylist struct {
+	ID        string    `xml:"id,attr" json:"id"`
+	Name      string    `xml:"name,attr" json:"name"`
+	Owner     string    `xml:"owner,attr" json:"owner"`
+	Public    bool      `xml:"public,attr" json:"public"`
+	SongCount int       `xml:"songCount,attr" json:"songCount"`
+	Duration  int       `xml:"duration,attr" json:"duration"`
+	Created   time.Time `xml:"created,attr" json:"created"`
+	Changed   time.Time `xml:"changed,attr" json:"changed"`
+}
+
+type SubsonicPlaylistWithSongs struct {
+	SubsonicPlaylist
+	Entry []SubsonicChild `xml:"entry" json:"entry"`
+}
+
+type SubsonicStarred2 struct {
+	Artist []SubsonicArtist `xml:"artist" json:"artist"`
+	Album  []SubsonicAlbum  `xml:"album" json:"album"`
+	Song   []SubsonicChild  `xml:"song" json:"song"`
+}
+
+type SubsonicExtension struct {
+	Name     string `xml:"name,attr" json:"name"`
+	Versions []int  `xml:"versions" json:"versions"`
+}
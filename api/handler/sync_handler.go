@@ -21,6 +21,10 @@ type EntityIDs struct {
 	Songs     []uuid.UUID `json:"songs"`
 	Albums    []uuid.UUID `json:"albums"`
 	Artists   []uuid.UUID `json:"artists"`
+	// Genres include moods and tags, see /genres/batch
+	Genres []uuid.UUID `json:"genres"`
+	// Renditions are the offline download variants of song files, see /songs/renditions/{id}
+	Renditions []uuid.UUID `json:"renditions"`
 }
 
 // GetSync godoc
@@ -28,6 +32,7 @@ type EntityIDs struct {
 // @Description Returns a manifest of changed and removed entities since the given timestamp.
 // @Tags users
 // @Security BearerAuth
+// @Security ApiKeyAuth
 // @Produce json
 // @Param since query string false "Since timestamp (RFC3339)"
 // @Success 200 {object} SyncManifest
@@ -121,5 +126,31 @@ func (h *Handler) GetSync(c *middleware.CustomContext) error {
 	}
 	manifest.Removed.Artists = deletedArtists
 
+	// Genres (Global)
+	changedGenres, err := h.genre_svc.Store.GetChangedGenres(since)
+	if err != nil {
+		return echo.NewHTTPError(500, err.Error())
+	}
+	manifest.Changed.Genres = changedGenres
+
+	deletedGenres, err := h.genre_svc.Store.GetDeletedGenres(since)
+	if err != nil {
+		return echo.NewHTTPError(500, err.Error())
+	}
+	manifest.Removed.Genres = deletedGenres
+
+	// Renditions (Global)
+	changedRenditions, err := h.rendition_svc.Store.GetChangedRenditions(since)
+	if err != nil {
+		return echo.NewHTTPError(500, err.Error())
+	}
+	manifest.Changed.Renditions = changedRenditions
+
+	deletedRenditions, err := h.rendition_svc.Store.GetDeletedRenditions(since)
+	if err != nil {
+		return echo.NewHTTPError(500, err.Error())
+	}
+	manifest.Removed.Renditions = deletedRenditions
+
 	return c.JSON(200, manifest)
 }
@@ -0,0 +1,69 @@
+package handler
+
+import (
+	"net/http"
+
+	"github.com/ProjectDistribute/distributor/service"
+
+	"github.com/google/uuid"
+	"github.com/labstack/echo/v4"
+)
+
+type TranscodeCacheResponse struct {
+	Enabled bool                          `json:"enabled"`
+	Stats   service.TranscodeCacheStats   `json:"stats"`
+	Entries []service.TranscodeCacheEntry `json:"entries"`
+}
+
+// GetTranscodeCache godoc
+// @Summary Inspect transcode cache
+// @Description Returns hit/miss statistics and the cached renditions, most recently used first. Requires the server.manage permission.
+// @Tags admin
+// @Security BearerAuth
+// @Produce json
+// @Success 200 {object} TranscodeCacheResponse
+// @Failure 401 {object} ErrorResponse
+// @Failure 403 {object} ErrorResponse
+// @Failure 404 {object} ErrorResponse
+// @Router /admin/transcode-cache [get]
+func (h *Handler) GetTranscodeCache(c echo.Context) error {
+	if h.transcode_cache == nil {
+		return c.JSON(http.StatusNotFound, ErrorResponse{Error: "Transcoding is not available"})
+	}
+	return c.JSON(http.StatusOK, TranscodeCacheResponse{
+		Enabled: h.transcode_cache.Enabled(),
+		Stats:   h.transcode_cache.Stats(),
+		Entries: h.transcode_cache.Entries(),
+	})
+}
+
+// PurgeTranscodeCache godoc
+// @Summary Purge transcode cache
+// @Description Deletes all cached renditions, or only those of one song file. Requires the server.manage permission.
+// @Tags admin
+// @Security BearerAuth
+// @Produce json
+// @Param file_id query string false "Only purge renditions of this file (UUID)"
+// @Success 200 {object} map[string]int
+// @Failure 400 {object} ErrorResponse
+// @Failure 401 {object} ErrorResponse
+// @Failure 403 {object} ErrorResponse
+// @Failure 404 {object} ErrorResponse
+// @Router /admin/transcode-cache [delete]
+func (h *Handler) PurgeTranscodeCache(c echo.Context) error {
+	if h.transcode_cache == nil {
+		return c.JSON(http.StatusNotFound, ErrorResponse{Error: "Transcoding is not available"})
+	}
+
+	fileID := uuid.Nil
+	if param := c.QueryParam("file_id"); param != "" {
+		id, err := uuid.Parse(param)
+		if err != nil {
+			return c.JSON(http.StatusBadRequest, ErrorResponse{Error: "Invalid file_id"})
+		}
+		fileID = id
+	}
+
+	removed := h.transcode_cache.Purge(fileID)
+	return c.JSON(http.StatusOK, map[string]int{"removed": removed})
+}
@@ -1,11 +1,16 @@
 package handler
 
 import (
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
 	"fmt"
 	"net/http"
+	"strings"
 
 	"github.com/ProjectDistribute/distributor/middleware"
 	"github.com/ProjectDistribute/distributor/model"
+	"github.com/ProjectDistribute/distributor/service"
 	"github.com/golang-jwt/jwt/v5"
 	"github.com/labstack/echo/v4"
 )
@@ -37,19 +42,24 @@ func (h *Handler) GetMe(c echo.Context) error {
 
 // CreateUser godoc
 // @Summary Sign up
-// @Description Creates a new user and initializes their root playlist folder.
+// @Description Creates a new user and initializes their root playlist folder, subject to the registration_policy setting (open, invite_only, closed, admin_approval).
+// @Description Under admin_approval the account can only log in once an admin approves it (202), unless a valid invite code was given.
 // @Tags users
 // @Accept json
 // @Produce json
 // @Param request body SignupRequest true "Signup payload"
 // @Success 201 {string} string "Success"
+// @Success 202 {string} string "Awaiting admin approval"
 // @Failure 400 {object} ErrorResponse
+// @Failure 403 {object} ErrorResponse
+// @Failure 429 {object} ErrorResponse
 // @Failure 500 {object} ErrorResponse
 // @Router /users/signup [post]
 func (h *Handler) CreateUser(c echo.Context) error {
 	type UserInput struct {
-		Username string `json:"username" validate:"required,max=20,username_chars"`
-		Password string `json:"password" validate:"required,max=128"`
+		Username   string `json:"username" validate:"required,max=20,username_chars"`
+		Password   string `json:"password" validate:"required,max=128"`
+		InviteCode string `json:"invite_code" validate:"max=64"`
 	}
 
 	var input UserInput
@@ -59,18 +69,28 @@ func (h *Handler) CreateUser(c echo.Context) error {
 	if err := c.Validate(&input); err != nil {
 		return c.JSON(400, map[string]string{"error": "Validation failed"})
 	}
+	if err := h.login_limiter.AllowSignup(c.RealIP()); err != nil {
+		return rateLimited(c, err)
+	}
 
-	_, err := h.user_svc.CreateUser(input.Username, input.Password)
-	if err != nil {
+	user, err := h.user_svc.Register(input.Username, input.Password, strings.TrimSpace(input.InviteCode))
+	switch {
+	case errors.Is(err, service.ErrRegistrationClosed), errors.Is(err, service.ErrInviteRequired), errors.Is(err, service.ErrInvalidInvite):
+		return c.JSON(403, map[string]string{"error": err.Error()})
+	case err != nil:
 		return c.JSON(500, map[string]string{"error": err.Error()})
 	}
 
+	if user.PendingApproval {
+		return c.JSON(202, "Awaiting admin approval")
+	}
 	return c.JSON(201, "Success")
 }
 
 // LoginUser godoc
 // @Summary Login
-// @Description Validates credentials and returns a JWT Bearer token and user object
+// @Description Validates credentials and starts a session. Returns a short-lived JWT Bearer token, a refresh token for POST /users/refresh and the user object.
+// @Description Attempts are throttled per IP address and username, and repeated failures lock both out for a growing time. Throttled attempts get 429 with a Retry-After header.
 // @Tags users
 // @Accept json
 // @Produce json
@@ -78,12 +98,15 @@ func (h *Handler) CreateUser(c echo.Context) error {
 // @Success 200 {object} LoginResponse
 // @Failure 400 {object} ErrorResponse
 // @Failure 401 {object} ErrorResponse
+// @Failure 403 {object} BannedResponse
+// @Failure 429 {object} ErrorResponse
 // @Failure 500 {object} ErrorResponse
 // @Router /users/login [post]
 func (h *Handler) LoginUser(c echo.Context) error {
 	type LoginInput struct {
-		Username string `json:"username" validate:"required,max=30"`
-		Password string `json:"password" validate:"required,max=128"`
+		Username   string `json:"username" validate:"required,max=30"`
+		Password   string `json:"password" validate:"required,max=128"`
+		DeviceName string `json:"device_name" validate:"max=100"`
 	}
 
 	var input LoginInput
@@ -94,26 +117,63 @@ func (h *Handler) LoginUser(c echo.Context) error {
 		return c.JSON(400, map[string]string{"error": "Validation failed"})
 	}
 
+	ip := c.RealIP()
+	if err := h.login_limiter.AllowLogin(ip, input.Username); err != nil {
+		return rateLimited(c, err)
+	}
+
 	user, err := h.user_svc.GetUserByUsername(input.Username)
 	if err != nil || user == nil {
+		h.login_limiter.LoginFailed(ip, input.Username)
 		return c.JSON(401, map[string]string{"error": "Invalid credentials"})
 	}
 
 	if err := h.user_svc.CheckPassword(user, input.Password); err != nil {
+		h.login_limiter.LoginFailed(ip, input.Username)
 		return c.JSON(401, map[string]string{"error": "Invalid credentials"})
 	}
+	h.login_limiter.LoginSucceeded(input.Username)
+
+	res, failure := h.startSession(c, user, input.DeviceName)
+	if failure != nil {
+		return c.JSON(failure.Code, failure.Message)
+	}
+	return c.JSON(200, res)
+}
+
+// startSession checks that the user may log in and creates a session for them. The
+// result is the login response body; on failure the status and body to respond with
+// are returned instead.
+func (h *Handler) startSession(c echo.Context, user *model.User, deviceName string) (echo.Map, *echo.HTTPError) {
+	if user.IsBanned() {
+		return nil, echo.NewHTTPError(403, BannedResponse{Error: "Account is banned", BannedUntil: *user.BannedUntil, Reason: user.BanReason})
+	}
+	if user.PendingApproval {
+		return nil, echo.NewHTTPError(403, map[string]string{"error": service.ErrPendingApproval.Error()})
+	}
 
-	token, err := h.user_svc.GenerateToken(user)
+	if deviceName == "" {
+		deviceName = truncate(c.Request().UserAgent(), 100)
+	}
+	tokens, err := h.user_svc.CreateSession(user, deviceName, c.RealIP())
 	if err != nil {
-		return c.JSON(500, map[string]string{"error": "Could not generate token"})
+		return nil, echo.NewHTTPError(500, map[string]string{"error": "Could not generate token"})
 	}
 
 	rootFolderID, err := h.user_svc.PlaylistService.GetRootFolderID(user.ID)
 	if err != nil {
-		return c.JSON(500, map[string]string{"error": "Failed to retrieve root folder"})
+		return nil, echo.NewHTTPError(500, map[string]string{"error": "Failed to retrieve root folder"})
 	}
 
-	return c.JSON(200, echo.Map{"token": token, "username": user.Username, "id": user.ID, "user": FromUserModel(*user, rootFolderID)})
+	return echo.Map{
+		"token":         tokens.AccessToken,
+		"refresh_token": tokens.RefreshToken,
+		"expires_at":    tokens.ExpiresAt,
+		"session_id":    tokens.Session.ID,
+		"username":      user.Username,
+		"id":            user.ID,
+		"user":          FromUserModel(*user, rootFolderID),
+	}, nil
 }
 
 // DeleteUser godoc
@@ -139,7 +199,7 @@ func (h *Handler) DeleteUser(c *middleware.CustomContext) error {
 	me := c.Get("user").(*jwt.Token).Claims.(*middleware.JwtCustomClaims)
 	currentUserID := me.UUID()
 
-	if currentUserID != userID && !me.Admin {
+	if currentUserID != userID && !me.Can(model.PermManageUsers) {
 		return echo.NewHTTPError(http.StatusForbidden, "Forbidden: You can only delete your own account or must be an admin")
 	}
 
@@ -152,6 +212,9 @@ func (h *Handler) DeleteUser(c *middleware.CustomContext) error {
 	if err != nil {
 		return echo.NewHTTPError(http.StatusInternalServerError, "Failed to delete user: "+err.Error())
 	}
+	if currentUserID != userID {
+		h.user_svc.RecordAudit(currentUserID, model.AuditUserDeleted, userID, userToDelete.Username)
+	}
 
 	return c.NoContent(http.StatusNoContent)
 }
@@ -164,6 +227,7 @@ func (h *Handler) DeleteUser(c *middleware.CustomContext) error {
 // @Produce json
 // @Param page query int false "Page number"
 // @Param limit query int false "Items per page"
+// @Param pending query bool false "Only users awaiting approval"
 // @Success 200 {array} User
 // @Failure 500 {object} ErrorResponse
 // @Router /admin/users [get]
@@ -181,11 +245,16 @@ func (h *Handler) GetUsers(c echo.Context) error {
 	}
 	offset := (page - 1) * limit
 
-	if err := h.db.Model(&model.User{}).Count(&total).Error; err != nil {
+	query := h.db.Model(&model.User{})
+	if c.QueryParam("pending") == "true" {
+		query = query.Where("pending_approval = ?", true)
+	}
+
+	if err := query.Count(&total).Error; err != nil {
 		return c.JSON(http.StatusInternalServerError, map[string]string{"error": "Failed to count users"})
 	}
 
-	if err := h.db.Limit(limit).Offset(offset).Order("created_at desc").Find(&users).Error; err != nil {
+	if err := query.Limit(limit).Offset(offset).Order("created_at desc").Find(&users).Error; err != nil {
 		return c.JSON(http.StatusInternalServerError, map[string]string{"error": "Failed to retrieve users"})
 	}
 
@@ -204,7 +273,7 @@ func (h *Handler) GetUsers(c echo.Context) error {
 
 // ChangePassword godoc
 // @Summary Change password
-// @Description Updates the authenticated user's password.
+// @Description Updates the authenticated user's password and signs the user out of every session, including the current one.
 // @Tags users
 // @Security BearerAuth
 // @Accept json
@@ -226,7 +295,7 @@ func (h *Handler) ChangePassword(c echo.Context) error {
 	me := c.Get("user").(*jwt.Token).Claims.(*middleware.JwtCustomClaims)
 	currentUserID := me.UUID()
 
-	if currentUserID != userID && !me.Admin {
+	if currentUserID != userID && !me.Can(model.PermManageUsers) {
 		return echo.NewHTTPError(http.StatusForbidden, "Forbidden: You can only change your own password or must be an admin")
 	}
 
@@ -247,5 +316,65 @@ func (h *Handler) ChangePassword(c echo.Context) error {
 		return c.JSON(http.StatusInternalServerError, map[string]string{"error": "Failed to update password"})
 	}
 
+	if _, err := h.user_svc.RevokeAllSessions(user.ID); err != nil {
+		return c.JSON(http.StatusInternalServerError, map[string]string{"error": "Failed to revoke sessions"})
+	}
+
 	return c.JSON(http.StatusOK, "Password updated successfully")
 }
+
+// SetSubsonicPassword godoc
+// @Summary Set Subsonic password
+// @Description Sets the password Subsonic clients use against /rest. If none is given a random one is generated; the password is returned either way. `"disable": true` turns it off.
+// @Tags users
+// @Security BearerAuth
+// @Accept json
+// @Produce json
+// @Param user_id path string true "User ID (UUID)"
+// @Param request body SubsonicPasswordRequest false "Password"
+// @Success 200 {object} SubsonicPasswordResponse
+// @Failure 400 {object} ErrorResponse
+// @Failure 403 {object} ErrorResponse
+// @Failure 404 {object} ErrorResponse
+// @Failure 500 {object} ErrorResponse
+// @Router /users/{user_id}/subsonic-password [put]
+func (h *Handler) SetSubsonicPassword(c *middleware.CustomContext) error {
+	userID, err := c.GetUUID("user_id")
+	if err != nil {
+		return echo.NewHTTPError(http.StatusBadRequest, "Invalid user ID")
+	}
+
+	me := c.Get("user").(*jwt.Token).Claims.(*middleware.JwtCustomClaims)
+	if me.UUID() != userID && !me.Can(model.PermManageUsers) {
+		return echo.NewHTTPError(http.StatusForbidden, "Forbidden: You can only change your own password or must be an admin")
+	}
+
+	var input SubsonicPasswordRequest
+	if err := c.Bind(&input); err != nil {
+		return c.JSON(http.StatusBadRequest, map[string]string{"error": "Invalid input"})
+	}
+	if len(input.Password) > 128 {
+		return c.JSON(http.StatusBadRequest, map[string]string{"error": "Password is too long"})
+	}
+
+	user, err := h.user_svc.Store.GetUserByID(userID)
+	if err != nil {
+		return echo.NewHTTPError(http.StatusNotFound, "User not found")
+	}
+
+	password := input.Password
+	if input.Disable {
+		password = ""
+	} else if password == "" {
+		buf := make([]byte, 12)
+		if _, err := rand.Read(buf); err != nil {
+			return c.JSON(http.StatusInternalServerError, map[string]string{"error": "Failed to generate password"})
+		}
+		password = hex.EncodeToString(buf)
+	}
+
+	if err := h.user_svc.SetSubsonicPassword(user, password); err != nil {
+		return c.JSON(http.StatusInternalServerError, map[string]string{"error": "Failed to update password"})
+	}
+	return c.JSON(http.StatusOK, SubsonicPasswordResponse{Password: password})
+}
@@ -0,0 +1,39 @@
+package handler
+
+import (
+	"net/http"
+	"testing"
+
+	"github.com/ProjectDistribute/distributor/model"
+	"github.com/ProjectDistribute/distributor/service"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestCreateUser_RegistrationPolicy(t *testing.T) {
+	s := newTestServer(t)
+	admin, _ := s.user(t, "admin", model.RoleAdmin)
+	require.NoError(t, s.h.settings_svc.Set("registration_policy", service.RegistrationAdminApproval))
+	invite, err := s.h.user_svc.CreateInvite(admin.ID, 1, nil, true, "")
+	require.NoError(t, err)
+
+	signup := func(username, invite string) int {
+		body := map[string]string{"username": username, "password": "password123", "invite_code": invite}
+		return s.do(t, http.MethodPost, "/api/users/signup", body, "").Code
+	}
+
+	assert.Equal(t, http.StatusAccepted, signup("pending", ""))
+	pending, err := s.h.user_svc.Store.GetUserByUsername("pending")
+	require.NoError(t, err)
+	assert.True(t, pending.PendingApproval)
+	assert.Equal(t, model.RoleUser, pending.Role)
+
+	assert.Equal(t, http.StatusCreated, signup("invited", invite.Code))
+	invited, err := s.h.user_svc.Store.GetUserByUsername("invited")
+	require.NoError(t, err)
+	assert.False(t, invited.PendingApproval)
+	assert.Equal(t, model.RoleAdmin, invited.Role)
+	assert.True(t, invited.IsAdmin)
+
+	assert.Equal(t, http.StatusForbidden, signup("reused", invite.Code))
+}
@@ -0,0 +1,71 @@
+package handler
+
+import (
+	"log"
+	"net/http"
+	"strings"
+
+	"github.com/ProjectDistribute/distributor/middleware"
+	"github.com/labstack/echo/v4"
+)
+
+// GetWaveform godoc
+// @Summary Get song file waveform
+// @Description Returns min/max peaks of a song file for the player's scrubber, at most 1000 pairs of a mono mixdown scaled to -128..127.
+// @Description The JSON and binary layouts are those of audiowaveform (version 2, 8 bit), which peaks.js reads directly. The binary form is returned for format=dat or an Accept header of application/octet-stream.
+// @Description Waveforms are generated in the background on ingestion and backfilled by POST /doctor. A missing one is queued for generation and 202 is returned with a Retry-After header; 404 means it cannot be generated, e.g. without an audio decoder.
+// @Tags songs
+// @Security BearerAuth
+// @Security ApiKeyAuth
+// @Produce json
+// @Produce application/octet-stream
+// @Param id path string true "File ID (UUID)"
+// @Param format query string false "Response format" Enums(json,dat)
+// @Success 200 {object} Waveform
+// @Success 202 {object} MessageResponse
+// @Failure 400 {object} ErrorResponse
+// @Failure 401 {object} ErrorResponse
+// @Failure 403 {object} ErrorResponse
+// @Failure 404 {object} ErrorResponse
+// @Failure 500 {object} ErrorResponse
+// @Router /songs/files/{id}/waveform [get]
+func (h *Handler) GetWaveform(c *middleware.CustomContext) error {
+	id, err := c.GetUUID("id")
+	if err != nil {
+		return echo.NewHTTPError(http.StatusBadRequest, "Valid file id is required")
+	}
+	format := c.QueryParam("format")
+	if format == "" && strings.Contains(c.Request().Header.Get(echo.HeaderAccept), echo.MIMEOctetStream) {
+		format = "dat"
+	}
+	if format != "" && format != "json" && format != "dat" {
+		return echo.NewHTTPError(http.StatusBadRequest, "Unsupported waveform format: "+format)
+	}
+
+	file, err := h.song_svc.Store.GetFileByID(id)
+	if err != nil {
+		return echo.NewHTTPError(http.StatusNotFound, "File not found")
+	}
+
+	if !h.waveform_svc.Exists(file) {
+		if h.waveform_svc.Enqueue(*file) {
+			c.Response().Header().Set("Retry-After", "5")
+			return c.JSON(http.StatusAccepted, MessageResponse{Message: "Waveform is being generated"})
+		}
+		return echo.NewHTTPError(http.StatusNotFound, "Waveform not generated yet")
+	}
+	waveform, err := h.waveform_svc.Get(file)
+	if err != nil {
+		log.Printf("Failed to read waveform of file %s: %v\n", file.ID, err)
+		return echo.NewHTTPError(http.StatusInternalServerError, "Failed to read waveform")
+	}
+
+	if format == "dat" {
+		data, err := waveform.MarshalBinary()
+		if err != nil {
+			return echo.NewHTTPError(http.StatusInternalServerError, "Failed to encode waveform")
+		}
+		return c.Blob(http.StatusOK, echo.MIMEOctetStream, data)
+	}
+	return c.JSON(http.StatusOK, FromWaveform(waveform))
+}
@@ -10,6 +10,7 @@ import (
 	"github.com/ProjectDistribute/distributor/db"
 	"github.com/ProjectDistribute/distributor/handler"
 	"github.com/ProjectDistribute/distributor/router"
+	"github.com/ProjectDistribute/distributor/service"
 	"github.com/ProjectDistribute/distributor/utils"
 	"github.com/labstack/echo/v4"
 )
@@ -23,6 +24,10 @@ var version = "s0.3.0"
 // @in header
 // @name Authorization
 // @description Type "Bearer" followed by a space and JWT token.
+// @securityDefinitions.apikey ApiKeyAuth
+// @in header
+// @name Authorization
+// @description Type "ApiKey" followed by a space and an API key. API keys only work on endpoints within their scopes.
 func main() {
 
 	r := router.New()
@@ -47,10 +52,16 @@ func main() {
 		log.SetOutput(multiWriter)
 	}
 
-	storage := utils.LocalFileStorage{}
+	storage, err := newFileStorage()
+	if err != nil {
+		panic(err)
+	}
 	h := handler.GigaHandler(d, storage, version)
+	h.StartSongFilePathMigration()
+	h.StartInboxWatcher()
 	r.Use(h.BandwidthMiddleware)
 	h.Register(v1)
+	h.RegisterSubsonic(r.Group("/rest"))
 
 	// Route to open distribute://add-server/<SERVER_URL> URL scheme
 	r.GET("/add", func(c echo.Context) error {
@@ -90,3 +101,20 @@ Welcome to
 	listenOn := utils.Getenv("LISTEN_ON", "0.0.0.0:8585")
 	r.Logger.Fatal(r.Start(listenOn))
 }
+
+// newFileStorage picks the storage backend from the STORAGE_BACKEND env var (local or s3).
+// Local storage keeps files below STORAGE_ROOT, the working directory by default.
+func newFileStorage() (service.FileStorage, error) {
+	target := service.StorageTarget{
+		Backend: utils.Getenv("STORAGE_BACKEND", service.StorageBackendLocal),
+		Root:    utils.Getenv("STORAGE_ROOT", ""),
+	}
+	storage, err := service.NewFileStorage(target)
+	if err != nil {
+		return nil, err
+	}
+	if s3, ok := storage.(*utils.S3FileStorage); ok {
+		log.Printf("Storing files in S3 bucket %s at %s\n", s3.Bucket, s3.Endpoint.Host)
+	}
+	return storage, nil
+}
@@ -1,35 +1,80 @@
 package middleware
 
 import (
+	"net/http"
+
+	"github.com/ProjectDistribute/distributor/model"
 	"github.com/golang-jwt/jwt/v5"
 	"github.com/labstack/echo/v4"
 )
 
-func AdminMiddleware(next echo.HandlerFunc) echo.HandlerFunc {
-	return func(c echo.Context) error {
-		data := c.Get("user")
-		if data == nil {
-			return echo.ErrUnauthorized
-		}
+// Scopes an API key can be granted. Tokens of login sessions grant all of them.
+const (
+	ScopeLibraryRead    = "library:read"
+	ScopeLibraryWrite   = "library:write"
+	ScopePlaylistsRead  = "playlists:read"
+	ScopePlaylistsWrite = "playlists:write"
+	ScopeMailRead       = "mail:read"
+	ScopeMailWrite      = "mail:write"
+	ScopeAdmin          = "admin"
+)
 
-		token, ok := data.(*jwt.Token)
-		if !ok || token == nil {
-			return echo.ErrUnauthorized
-		}
+// Scopes lists every scope.
+var Scopes = []string{ScopeLibraryRead, ScopeLibraryWrite, ScopePlaylistsRead, ScopePlaylistsWrite, ScopeMailRead, ScopeMailWrite, ScopeAdmin}
+
+// CanGrantScope reports whether users with role may create API keys with scope.
+// Scopes for staff endpoints need a role that can use those endpoints.
+func CanGrantScope(role, scope string) bool {
+	switch scope {
+	case ScopeLibraryWrite:
+		return model.RoleHasPermission(role, model.PermEditLibrary)
+	case ScopeMailRead:
+		return model.RoleHasPermission(role, model.PermManageMail)
+	case ScopeAdmin:
+		return model.IsStaffRole(role)
+	}
+	return true
+}
 
-		// if !token.Valid {
-		// 	return echo.ErrUnauthorized
-		// }
+func claimsFromContext(c echo.Context) (*JwtCustomClaims, bool) {
+	token, ok := c.Get("user").(*jwt.Token)
+	if !ok || token == nil {
+		return nil, false
+	}
+	claims, ok := token.Claims.(*JwtCustomClaims)
+	return claims, ok && claims != nil
+}
 
-		claims, ok := token.Claims.(*JwtCustomClaims)
-		if !ok || claims == nil {
-			return echo.ErrUnauthorized
+// RequireScope rejects tokens that do not grant scope.
+func RequireScope(scope string) echo.MiddlewareFunc {
+	return func(next echo.HandlerFunc) echo.HandlerFunc {
+		return func(c echo.Context) error {
+			claims, ok := claimsFromContext(c)
+			if !ok {
+				return echo.ErrUnauthorized
+			}
+			if !claims.HasScope(scope) {
+				return echo.NewHTTPError(http.StatusForbidden, "API key lacks the "+scope+" scope")
+			}
+			return next(c)
 		}
+	}
+}
 
-		if !claims.Admin {
-			return echo.ErrUnauthorized
+// RequirePermission rejects users whose role lacks perm, and tokens that do not grant scope.
+func RequirePermission(perm model.Permission, scope string) echo.MiddlewareFunc {
+	withScope := RequireScope(scope)
+	return func(next echo.HandlerFunc) echo.HandlerFunc {
+		next = withScope(next)
+		return func(c echo.Context) error {
+			claims, ok := claimsFromContext(c)
+			if !ok {
+				return echo.ErrUnauthorized
+			}
+			if !claims.Can(perm) {
+				return echo.NewHTTPError(http.StatusForbidden, "Your role lacks the "+string(perm)+" permission")
+			}
+			return next(c)
 		}
-
-		return next(c)
 	}
 }
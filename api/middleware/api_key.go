@@ -0,0 +1,30 @@
+package middleware
+
+import (
+	"strings"
+
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/labstack/echo/v4"
+)
+
+// APIKeyAuth accepts "Authorization: ApiKey <key>" and leaves all other requests to
+// fallback, usually the JWT middleware. authorize resolves a key to the claims of its
+// owner, with Scopes set to the scopes of the key. The claims are stored under "user"
+// like a parsed JWT, so handlers and RequireScope treat both the same way.
+func APIKeyAuth(authorize func(key, ip string) (*JwtCustomClaims, error), fallback echo.MiddlewareFunc) echo.MiddlewareFunc {
+	return func(next echo.HandlerFunc) echo.HandlerFunc {
+		withFallback := fallback(next)
+		return func(c echo.Context) error {
+			key, ok := strings.CutPrefix(c.Request().Header.Get(echo.HeaderAuthorization), "ApiKey ")
+			if !ok {
+				return withFallback(c)
+			}
+			claims, err := authorize(strings.TrimSpace(key), c.RealIP())
+			if err != nil {
+				return err
+			}
+			c.Set("user", &jwt.Token{Claims: claims, Valid: true})
+			return next(c)
+		}
+	}
+}
@@ -1,14 +1,32 @@
 package middleware
 
 import (
+	"slices"
+
+	"github.com/ProjectDistribute/distributor/model"
 	"github.com/golang-jwt/jwt/v5"
 	"github.com/google/uuid"
+	"github.com/labstack/echo/v4"
 )
 
 type JwtCustomClaims struct {
 	jwt.RegisteredClaims
 
-	Admin bool `json:"admin"`
+	Admin bool   `json:"admin"`
+	Role  string `json:"role,omitempty"`
+	// SessionID ties the access token to the session it was refreshed from.
+	SessionID string `json:"sid,omitempty"`
+	// Scopes limits what an API key may do. It is nil for login sessions, which may do everything.
+	Scopes []string `json:"-"`
+}
+
+func (j *JwtCustomClaims) HasScope(scope string) bool {
+	return j.Scopes == nil || slices.Contains(j.Scopes, scope)
+}
+
+// Can reports whether the role of the user grants perm.
+func (j *JwtCustomClaims) Can(perm model.Permission) bool {
+	return model.RoleHasPermission(j.Role, perm)
 }
 
 func (j *JwtCustomClaims) UUID() uuid.UUID {
@@ -18,3 +36,24 @@ func (j *JwtCustomClaims) UUID() uuid.UUID {
 	}
 	return res
 }
+
+// SessionMiddleware runs after the JWT middleware and lets authorize reject tokens,
+// e.g. of revoked sessions or banned users. The error of authorize is returned as is.
+func SessionMiddleware(authorize func(claims *JwtCustomClaims) error) echo.MiddlewareFunc {
+	return func(next echo.HandlerFunc) echo.HandlerFunc {
+		return func(c echo.Context) error {
+			token, ok := c.Get("user").(*jwt.Token)
+			if !ok || token == nil {
+				return echo.ErrUnauthorized
+			}
+			claims, ok := token.Claims.(*JwtCustomClaims)
+			if !ok {
+				return echo.ErrUnauthorized
+			}
+			if err := authorize(claims); err != nil {
+				return err
+			}
+			return next(c)
+		}
+	}
+}
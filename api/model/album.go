@@ -1,6 +1,7 @@
 package model
 
 import (
+	"slices"
 	"strings"
 	"time"
 
@@ -8,6 +9,23 @@ import (
 	"gorm.io/gorm"
 )
 
+// Album types
+const (
+	AlbumTypeAlbum       = "album"
+	AlbumTypeEP          = "ep"
+	AlbumTypeSingle      = "single"
+	AlbumTypeCompilation = "compilation"
+)
+
+var AlbumTypes = []string{AlbumTypeAlbum, AlbumTypeEP, AlbumTypeSingle, AlbumTypeCompilation}
+
+// VariousArtists is the artist name of compilations without album artists.
+const VariousArtists = "Various Artists"
+
+func ValidAlbumType(t string) bool {
+	return slices.Contains(AlbumTypes, t)
+}
+
 type Album struct {
 	ID        uuid.UUID `gorm:"type:uuid;primary_key;"`
 	CreatedAt time.Time
@@ -16,11 +34,28 @@ type Album struct {
 
 	Title       string
 	ReleaseDate time.Time
-	Songs       []Song            `gorm:"constraint:OnDelete:CASCADE;"`
-	Identifiers []AlbumIdentifier `gorm:"constraint:OnDelete:CASCADE;"`
+	Type        string `gorm:"not null;default:album"`
+	// AlbumArtists are credited for the album as a whole, its songs may have others.
+	AlbumArtists []Artist          `gorm:"many2many:album_artists;constraint:OnDelete:CASCADE;"`
+	Genres       []Genre           `gorm:"many2many:album_genres;constraint:OnDelete:CASCADE;"`
+	Songs        []Song            `gorm:"constraint:OnDelete:CASCADE;"`
+	Identifiers  []AlbumIdentifier `gorm:"constraint:OnDelete:CASCADE;"`
 }
 
+// GetArtistName returns the album artists, falling back to the artists of the
+// songs unless the album is a compilation.
 func (a *Album) GetArtistName() string {
+	if len(a.AlbumArtists) > 0 {
+		names := make([]string, len(a.AlbumArtists))
+		for i, artist := range a.AlbumArtists {
+			names[i] = artist.Name
+		}
+		return strings.Join(names, ", ")
+	}
+	if a.Type == AlbumTypeCompilation {
+		return VariousArtists
+	}
+
 	artists := make(map[string]bool)
 	var names []string
 	for _, song := range a.Songs {
@@ -38,5 +73,8 @@ func (s *Album) BeforeCreate(tx *gorm.DB) (err error) {
 	if s.ID == uuid.Nil {
 		s.ID = uuid.New()
 	}
+	if s.Type == "" {
+		s.Type = AlbumTypeAlbum
+	}
 	return
 }
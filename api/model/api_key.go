@@ -0,0 +1,50 @@
+package model
+
+import (
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+)
+
+// APIKey is a long-lived credential for automation clients. It acts as its owner but
+// only grants the scopes it was created with. Only the SHA-256 of the key is stored.
+type APIKey struct {
+	ID        uuid.UUID `gorm:"type:uuid;primary_key;"`
+	CreatedAt time.Time
+	UpdatedAt time.Time
+
+	UserID  uuid.UUID `gorm:"type:uuid;not null;index"`
+	Name    string    `gorm:"not null"`
+	KeyHash string    `gorm:"uniqueIndex;not null"`
+	// Prefix is the start of the key, shown in listings to tell keys apart.
+	Prefix string
+	// Scopes is a comma separated list, e.g. "library:write,mail:read".
+	Scopes     string
+	ExpiresAt  *time.Time `gorm:"default:null"`
+	LastUsedAt *time.Time `gorm:"default:null"`
+	LastUsedIP string
+	RevokedAt  *time.Time `gorm:"default:null"`
+}
+
+func (k *APIKey) ScopeList() []string {
+	if k.Scopes == "" {
+		return []string{}
+	}
+	return strings.Split(k.Scopes, ",")
+}
+
+func (k *APIKey) Active() bool {
+	if k.RevokedAt != nil {
+		return false
+	}
+	return k.ExpiresAt == nil || time.Now().Before(*k.ExpiresAt)
+}
+
+func (k *APIKey) BeforeCreate(tx *gorm.DB) (err error) {
+	if k.ID == uuid.Nil {
+		k.ID = uuid.New()
+	}
+	return
+}
@@ -0,0 +1,33 @@
+package model
+
+import (
+	"time"
+
+	"github.com/google/uuid"
+)
+
+const (
+	AuditUserBanned        = "user.ban"
+	AuditUserUnbanned      = "user.unban"
+	AuditUserPromoted      = "user.promote"
+	AuditUserDemoted       = "user.demote"
+	AuditUserRoleChanged   = "user.role"
+	AuditUserPasswordReset = "user.reset_password"
+	AuditUserDeleted       = "user.delete"
+	AuditUserApproved      = "user.approve"
+	AuditInviteCreated     = "invite.create"
+	AuditInviteRevoked     = "invite.revoke"
+	AuditAPIKeyRevoked     = "api_key.revoke"
+)
+
+// AuditEntry records a moderation action taken by an admin.
+type AuditEntry struct {
+	ID        uint      `gorm:"primaryKey" json:"id"`
+	CreatedAt time.Time `gorm:"index" json:"created_at"`
+
+	ActorID  uuid.UUID `gorm:"type:uuid;not null;index" json:"actor_id"`
+	Action   string    `gorm:"not null;index" json:"action"`
+	TargetID uuid.UUID `gorm:"type:uuid;index" json:"target_id"`
+	// Details is a short human readable note, e.g. the ban reason.
+	Details string `json:"details"`
+}
@@ -0,0 +1,42 @@
+package model
+
+import (
+	"slices"
+	"time"
+
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+)
+
+// Genre kinds. Moods and free-form tags are browsed and filtered like genres.
+const (
+	GenreKindGenre = "genre"
+	GenreKindMood  = "mood"
+	GenreKindTag   = "tag"
+)
+
+var GenreKinds = []string{GenreKindGenre, GenreKindMood, GenreKindTag}
+
+func ValidGenreKind(k string) bool {
+	return slices.Contains(GenreKinds, k)
+}
+
+type Genre struct {
+	ID        uuid.UUID `gorm:"type:uuid;primary_key;"`
+	CreatedAt time.Time
+	UpdatedAt time.Time
+	DeletedAt gorm.DeletedAt `gorm:"index"`
+
+	Name string `gorm:"index;not null"`
+	Kind string `gorm:"index;not null;default:genre"`
+}
+
+func (g *Genre) BeforeCreate(tx *gorm.DB) (err error) {
+	if g.ID == uuid.Nil {
+		g.ID = uuid.New()
+	}
+	if g.Kind == "" {
+		g.Kind = GenreKindGenre
+	}
+	return
+}
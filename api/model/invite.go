@@ -0,0 +1,42 @@
+package model
+
+import (
+	"time"
+
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+)
+
+// Invite lets people sign up while the registration policy requires an invite, or
+// skip admin approval. MaxUses of 0 means unlimited uses.
+type Invite struct {
+	ID        uuid.UUID `gorm:"type:uuid;primary_key;" json:"id"`
+	CreatedAt time.Time `json:"created_at"`
+	UpdatedAt time.Time `json:"updated_at"`
+
+	Code       string     `gorm:"uniqueIndex;not null" json:"code"`
+	CreatedBy  uuid.UUID  `gorm:"type:uuid" json:"created_by"`
+	Note       string     `json:"note"`
+	ExpiresAt  *time.Time `gorm:"default:null" json:"expires_at"`
+	MaxUses    int        `gorm:"not null" json:"max_uses"`
+	Uses       int        `gorm:"not null;default:0" json:"uses"`
+	GrantAdmin bool       `gorm:"default:false" json:"grant_admin"`
+	RevokedAt  *time.Time `gorm:"default:null" json:"revoked_at"`
+}
+
+func (i *Invite) Usable() bool {
+	if i.RevokedAt != nil {
+		return false
+	}
+	if i.ExpiresAt != nil && time.Now().After(*i.ExpiresAt) {
+		return false
+	}
+	return i.MaxUses == 0 || i.Uses < i.MaxUses
+}
+
+func (i *Invite) BeforeCreate(tx *gorm.DB) (err error) {
+	if i.ID == uuid.Nil {
+		i.ID = uuid.New()
+	}
+	return
+}
@@ -0,0 +1,49 @@
+package model
+
+import "slices"
+
+// Roles a user can have. Every user has exactly one.
+const (
+	RoleUser      = "user"
+	RoleCurator   = "curator"
+	RoleModerator = "moderator"
+	RoleAdmin     = "admin"
+)
+
+// Permission is what routes check instead of a role, so roles can be regrouped
+// without touching the routes.
+type Permission string
+
+const (
+	// PermEditLibrary allows creating, editing and deleting songs, albums, artists and covers.
+	PermEditLibrary Permission = "library.edit"
+	// PermManageMail allows reading and processing request mails.
+	PermManageMail Permission = "mail.manage"
+	// PermModerateUsers allows listing, banning and approving users.
+	PermModerateUsers Permission = "users.moderate"
+	// PermManageUsers allows changing roles, resetting passwords, deleting users and managing invites and API keys.
+	PermManageUsers Permission = "users.manage"
+	// PermManageServer allows settings, jobs, maintenance, logs and statistics.
+	PermManageServer Permission = "server.manage"
+)
+
+var Roles = []string{RoleUser, RoleCurator, RoleModerator, RoleAdmin}
+
+var rolePermissions = map[string][]Permission{
+	RoleCurator:   {PermEditLibrary},
+	RoleModerator: {PermManageMail, PermModerateUsers},
+	RoleAdmin:     {PermEditLibrary, PermManageMail, PermModerateUsers, PermManageUsers, PermManageServer},
+}
+
+func ValidRole(role string) bool {
+	return slices.Contains(Roles, role)
+}
+
+func RoleHasPermission(role string, perm Permission) bool {
+	return slices.Contains(rolePermissions[role], perm)
+}
+
+// IsStaffRole reports whether the role has any permission beyond those of regular users.
+func IsStaffRole(role string) bool {
+	return len(rolePermissions[role]) > 0
+}
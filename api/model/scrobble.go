@@ -0,0 +1,17 @@
+package model
+
+import (
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// Scrobble records that a user played a song.
+type Scrobble struct {
+	ID       uint      `gorm:"primaryKey"`
+	UserID   uuid.UUID `gorm:"type:uuid;index;not null"`
+	SongID   uuid.UUID `gorm:"type:uuid;index;not null"`
+	PlayedAt time.Time `gorm:"index"`
+
+	CreatedAt time.Time
+}
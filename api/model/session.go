@@ -0,0 +1,37 @@
+package model
+
+import (
+	"time"
+
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+)
+
+// Session is a login of a user on one device. It holds the refresh token used to
+// obtain new short-lived access tokens, which carry the session ID.
+type Session struct {
+	ID        uuid.UUID `gorm:"type:uuid;primary_key;"`
+	CreatedAt time.Time
+	UpdatedAt time.Time
+
+	UserID uuid.UUID `gorm:"type:uuid;not null;index"`
+
+	// RefreshTokenHash is the SHA-256 of the current refresh token, which rotates on every refresh.
+	RefreshTokenHash string `gorm:"uniqueIndex;not null"`
+	DeviceName       string
+	IP               string
+	LastUsedAt       time.Time
+	ExpiresAt        time.Time  `gorm:"not null"`
+	RevokedAt        *time.Time `gorm:"default:null"`
+}
+
+func (s *Session) Active() bool {
+	return s.RevokedAt == nil && time.Now().Before(s.ExpiresAt)
+}
+
+func (s *Session) BeforeCreate(tx *gorm.DB) (err error) {
+	if s.ID == uuid.Nil {
+		s.ID = uuid.New()
+	}
+	return
+}
@@ -13,10 +13,14 @@ type Song struct {
 	UpdatedAt time.Time
 	DeletedAt gorm.DeletedAt `gorm:"index"`
 
-	AlbumID     uuid.UUID `gorm:"type:uuid"`
-	Album       Album
-	Title       string           `gorm:"index"`
+	AlbumID uuid.UUID `gorm:"type:uuid"`
+	Album   Album
+	Title   string `gorm:"index"`
+	// TrackNumber and DiscNumber are 0 when unknown.
+	TrackNumber int
+	DiscNumber  int
 	Artists     []Artist         `gorm:"many2many:song_artists;constraint:OnDelete:CASCADE;"`
+	Genres      []Genre          `gorm:"many2many:song_genres;constraint:OnDelete:CASCADE;"`
 	SongFiles   []SongFile       `gorm:"constraint:OnDelete:CASCADE;"`
 	Identifiers []SongIdentifier `gorm:"constraint:OnDelete:CASCADE;"`
 }
@@ -15,8 +15,35 @@ type SongFile struct {
 
 	SongID   uuid.UUID `gorm:"type:uuid"`
 	Format   string
-	Duration uint
+	Duration uint // ms
 	Size     int64
+
+	// Audio properties, zero when unknown
+	Bitrate    int // kbit/s
+	SampleRate int // Hz
+	BitDepth   int
+	Channels   int
+	Codec      string // detected from the content, e.g. mp3, flac, pcm, opus, aac
+
+	// SHA256 of the stored audio, hex encoded.
+	SHA256 string `gorm:"index"`
+	// BlobID is set when this file was linked to an identical file of another song
+	// and shares its stored audio.
+	BlobID *uuid.UUID `gorm:"type:uuid"`
+	// Corrupt is set by the doctor when the stored audio no longer matches SHA256.
+	Corrupt    bool
+	VerifiedAt *time.Time
+
+	// EBU R128 loudness, set by the loudness analysis job. The other fields are
+	// only meaningful when LoudnessAnalyzedAt is set.
+	LoudnessAnalyzedAt *time.Time
+	Loudness           float64 // integrated, LUFS
+	TruePeak           float64 // dBTP
+	TrackGain          float64 // dB, ReplayGain 2.0 (-18 LUFS reference)
+	AlbumGain          float64 // dB, gated across the album
+	AlbumPeak          float64 // dBTP
+
+	Renditions []SongRendition `gorm:"constraint:OnDelete:CASCADE;"`
 }
 
 func (s *SongFile) BeforeCreate(tx *gorm.DB) (err error) {
@@ -26,6 +53,28 @@ func (s *SongFile) BeforeCreate(tx *gorm.DB) (err error) {
 	return
 }
 
+// FilePath is keyed by the file ID, so a song can have several files of the same
+// format. Linked files use the path of the file they share audio with.
 func (s *SongFile) FilePath() string {
+	return "storage/songs/" + s.BlobKey().String() + "." + s.Format
+}
+
+// WaveformPath is where the peaks waveform of the audio is stored, next to it.
+// Linked files share it like their audio.
+func (s *SongFile) WaveformPath() string {
+	return "storage/songs/" + s.BlobKey().String() + ".peaks"
+}
+
+// BlobKey identifies the stored audio of the file.
+func (s *SongFile) BlobKey() uuid.UUID {
+	if s.BlobID != nil {
+		return *s.BlobID
+	}
+	return s.ID
+}
+
+// LegacyFilePath is where files were stored before they were keyed by ID. Only
+// task.MigrateSongFilePaths should use it.
+func (s *SongFile) LegacyFilePath() string {
 	return "storage/songs/" + s.SongID.String() + "." + s.Format
 }
@@ -0,0 +1,36 @@
+package model
+
+import (
+	"time"
+
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+)
+
+// SongRendition is a lossy copy of a SongFile generated for offline downloads,
+// e.g. profile "opus-128" is the file encoded as Opus at 128 kbit/s.
+type SongRendition struct {
+	ID        uuid.UUID `gorm:"type:uuid;primary_key;"`
+	CreatedAt time.Time
+	UpdatedAt time.Time
+	DeletedAt gorm.DeletedAt `gorm:"index"`
+
+	SongFileID uuid.UUID `gorm:"type:uuid;uniqueIndex:idx_rendition_file_profile,where:deleted_at IS NULL"`
+	SongID     uuid.UUID `gorm:"type:uuid;index"`
+	Profile    string    `gorm:"uniqueIndex:idx_rendition_file_profile,where:deleted_at IS NULL"`
+	Format     string
+	Bitrate    int
+	Duration   uint
+	Size       int64
+}
+
+func (r *SongRendition) BeforeCreate(tx *gorm.DB) (err error) {
+	if r.ID == uuid.Nil {
+		r.ID = uuid.New()
+	}
+	return
+}
+
+func (r *SongRendition) FilePath() string {
+	return "storage/renditions/" + r.SongFileID.String() + "_" + r.Profile + "." + r.Format
+}
@@ -0,0 +1,22 @@
+package model
+
+import (
+	"time"
+
+	"github.com/google/uuid"
+)
+
+const (
+	StarItemSong   = "song"
+	StarItemAlbum  = "album"
+	StarItemArtist = "artist"
+)
+
+// Star marks a song, album or artist as a favourite of a user.
+type Star struct {
+	UserID   uuid.UUID `gorm:"type:uuid;primaryKey"`
+	ItemID   uuid.UUID `gorm:"type:uuid;primaryKey"`
+	ItemType string    `gorm:"not null;index"`
+
+	CreatedAt time.Time
+}
@@ -0,0 +1,44 @@
+package model
+
+import "time"
+
+const (
+	StorageMigrationRunning   = "running"
+	StorageMigrationCompleted = "completed"
+	StorageMigrationFailed    = "failed"
+	StorageMigrationCutOver   = "cut_over"
+)
+
+// StorageMigration copies every stored file from one storage backend to another.
+// The server keeps using the source until the migration is cut over.
+type StorageMigration struct {
+	ID        uint      `gorm:"primaryKey" json:"id"`
+	CreatedAt time.Time `json:"created_at"`
+	UpdatedAt time.Time `json:"updated_at"`
+
+	SourceBackend string `json:"source_backend"`
+	SourceRoot    string `json:"source_root,omitempty"`
+	DestBackend   string `json:"dest_backend"`
+	DestRoot      string `json:"dest_root,omitempty"`
+
+	Status string `gorm:"index" json:"status"`
+	// Total, Copied and Failed count the files of the last pass, Copied includes
+	// files copied before a restart.
+	Total  int    `json:"total"`
+	Copied int    `json:"copied"`
+	Failed int    `json:"failed"`
+	Error  string `json:"error,omitempty"`
+
+	CompletedAt *time.Time `json:"completed_at,omitempty"`
+	CutoverAt   *time.Time `json:"cutover_at,omitempty"`
+}
+
+// StorageMigrationItem records a file that was copied and verified, so an
+// interrupted migration does not copy it again.
+type StorageMigrationItem struct {
+	MigrationID uint   `gorm:"primaryKey;autoIncrement:false"`
+	Path        string `gorm:"primaryKey"`
+	SHA256      string
+	Size        int64
+	CreatedAt   time.Time
+}
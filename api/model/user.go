@@ -13,10 +13,38 @@ type User struct {
 	UpdatedAt time.Time
 	DeletedAt gorm.DeletedAt `gorm:"index"`
 
-	Username     string     `gorm:"uniqueIndex;not null"`
-	PasswordHash string     `gorm:"not null" json:"-"`
-	IsAdmin      bool       `gorm:"default:false"`
-	BannedUntil  *time.Time `gorm:"default:null"`
+	Username     string `gorm:"uniqueIndex;not null"`
+	PasswordHash string `gorm:"not null" json:"-"`
+	// IsAdmin mirrors Role == RoleAdmin for code and clients that predate roles. Use SetRole to change either.
+	IsAdmin     bool       `gorm:"default:false"`
+	Role        string     `gorm:"not null;default:user"`
+	BannedUntil *time.Time `gorm:"default:null"`
+	BanReason   string
+	// PendingApproval is set for users who signed up under the admin_approval policy.
+	PendingApproval bool `gorm:"default:false"`
+	// TokensRevokedAt is when the user was last signed out everywhere. Access tokens
+	// without a session that were issued before it are rejected.
+	TokensRevokedAt *time.Time `gorm:"default:null" json:"-"`
+
+	// SubsonicPassword is the encrypted password for Subsonic clients. Token auth
+	// needs the plain password, so it cannot be a hash like PasswordHash.
+	SubsonicPassword string `json:"-"`
+}
+
+// PermanentBan is stored in BannedUntil for bans without an end date.
+var PermanentBan = time.Date(9999, 12, 31, 0, 0, 0, 0, time.UTC)
+
+func (u *User) IsBanned() bool {
+	return u.BannedUntil != nil && time.Now().Before(*u.BannedUntil)
+}
+
+func (u *User) SetRole(role string) {
+	u.Role = role
+	u.IsAdmin = role == RoleAdmin
+}
+
+func (u *User) Can(perm Permission) bool {
+	return RoleHasPermission(u.Role, perm)
 }
 
 func (u *User) BeforeCreate(tx *gorm.DB) (err error) {
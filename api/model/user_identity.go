@@ -0,0 +1,29 @@
+package model
+
+import (
+	"time"
+
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+)
+
+// UserIdentity links an account of an external OpenID Connect provider to a user.
+type UserIdentity struct {
+	ID        uuid.UUID `gorm:"type:uuid;primary_key;" json:"id"`
+	CreatedAt time.Time `json:"created_at"`
+	UpdatedAt time.Time `json:"updated_at"`
+
+	UserID  uuid.UUID `gorm:"type:uuid;not null;index" json:"user_id"`
+	Issuer  string    `gorm:"not null;uniqueIndex:idx_identity_issuer_subject" json:"issuer"`
+	Subject string    `gorm:"not null;uniqueIndex:idx_identity_issuer_subject" json:"subject"`
+	Email   string    `json:"email"`
+
+	LastLoginAt time.Time `json:"last_login_at"`
+}
+
+func (i *UserIdentity) BeforeCreate(tx *gorm.DB) (err error) {
+	if i.ID == uuid.Nil {
+		i.ID = uuid.New()
+	}
+	return
+}
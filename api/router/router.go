@@ -2,19 +2,25 @@ package router
 
 import (
 	stdLog "log"
-
+	"net"
+	"net/http"
 	"strings"
+	"sync"
 
 	"github.com/labstack/echo/v4"
 	"github.com/labstack/echo/v4/middleware"
 	"github.com/labstack/gommon/log"
 
 	mymiddleware "github.com/ProjectDistribute/distributor/middleware"
+	"github.com/ProjectDistribute/distributor/utils"
 )
 
 func New() *echo.Echo {
 	e := echo.New()
 	e.HideBanner = true
+	// Rate limits and lockouts are keyed on the client IP, so forwarding headers
+	// are only honored when sent by a proxy listed in TRUSTED_PROXIES
+	e.IPExtractor = IPExtractor(utils.Getenv("TRUSTED_PROXIES", ""))
 	e.Logger.SetLevel(log.DEBUG)
 	e.Pre(middleware.RemoveTrailingSlash())
 	e.Use(middleware.BodyLimit("300M"))
@@ -28,6 +34,8 @@ func New() *echo.Echo {
 			return true
 		case "/api/admin/stats":
 			return true
+		case "/api/admin/jobs":
+			return true
 		}
 		return false
 	}
@@ -38,7 +46,12 @@ func New() *echo.Echo {
 		LogLatency: true,
 		Skipper:    skipper,
 		LogValuesFunc: func(c echo.Context, v middleware.RequestLoggerValues) error {
-			stdLog.Printf("[%s] %v, %v, took: %vms\n", v.Method, v.Status, v.URI, v.Latency.Milliseconds())
+			uri := v.URI
+			if strings.HasPrefix(uri, "/rest/") {
+				// Subsonic clients send credentials in the query string
+				uri = c.Request().URL.Path
+			}
+			stdLog.Printf("[%s] %v, %v, took: %vms\n", v.Method, v.Status, uri, v.Latency.Milliseconds())
 			return nil
 		},
 	}))
@@ -52,6 +65,8 @@ func New() *echo.Echo {
 		AllowOrigins: []string{"*"},
 		AllowHeaders: []string{echo.HeaderOrigin, echo.HeaderContentType, echo.HeaderAccept, echo.HeaderAuthorization},
 		AllowMethods: []string{echo.GET, echo.HEAD, echo.PUT, echo.PATCH, echo.POST, echo.DELETE},
+		// Web players read the loudness of a stream to normalize its volume
+		ExposeHeaders: []string{"X-ReplayGain-Track-Gain", "X-ReplayGain-Track-Peak", "X-ReplayGain-Album-Gain", "X-ReplayGain-Album-Peak", "X-Loudness"},
 	}))
 	e.Validator = NewValidator()
 
@@ -61,9 +76,57 @@ func New() *echo.Echo {
 		HTML5: true, // SPA mode: serves index.html for 404s
 		Skipper: func(c echo.Context) bool {
 			// Skip API routes so they return json/404 correctly
-			return strings.HasPrefix(c.Request().URL.Path, "/api")
+			path := c.Request().URL.Path
+			return strings.HasPrefix(path, "/api") || strings.HasPrefix(path, "/rest")
 		},
 	}))
 
 	return e
 }
+
+// IPExtractor returns the client IP extractor for a comma separated list of
+// trusted proxy IPs or CIDR ranges. Without any, the IP is the address of the
+// connection and X-Forwarded-For / X-Real-IP are ignored, with a warning the first
+// time a request carries them.
+func IPExtractor(trustedProxies string) echo.IPExtractor {
+	var options []echo.TrustOption
+	for _, entry := range strings.Split(trustedProxies, ",") {
+		entry = strings.TrimSpace(entry)
+		if entry == "" {
+			continue
+		}
+		if !strings.Contains(entry, "/") {
+			if ip := net.ParseIP(entry); ip != nil && ip.To4() != nil {
+				entry += "/32"
+			} else {
+				entry += "/128"
+			}
+		}
+		_, ipNet, err := net.ParseCIDR(entry)
+		if err != nil {
+			stdLog.Fatalf("Invalid TRUSTED_PROXIES entry %q: %v\n", entry, err)
+		}
+		options = append(options, echo.TrustIPRange(ipNet))
+	}
+	if len(options) == 0 {
+		return warnForwardedHeaders(echo.ExtractIPDirect())
+	}
+	options = append(options, echo.TrustLoopback(false), echo.TrustLinkLocal(false), echo.TrustPrivateNet(false))
+	return echo.ExtractIPFromXFFHeader(options...)
+}
+
+// warnForwardedHeaders logs once that forwarding headers arrive while no proxy is
+// trusted, which usually means a reverse proxy is in front but TRUSTED_PROXIES is
+// not set and every client shares the proxy's address.
+func warnForwardedHeaders(extract echo.IPExtractor) echo.IPExtractor {
+	var once sync.Once
+	return func(req *http.Request) string {
+		ip := extract(req)
+		if req.Header.Get(echo.HeaderXForwardedFor) != "" || req.Header.Get(echo.HeaderXRealIP) != "" {
+			once.Do(func() {
+				stdLog.Printf("Warning: request from %s has X-Forwarded-For or X-Real-IP headers, but TRUSTED_PROXIES is not set. They are ignored and clients behind a proxy share its address, set TRUSTED_PROXIES to the proxy's IP\n", ip)
+			})
+		}
+		return ip
+	}
+}
@@ -0,0 +1,106 @@
+package router
+
+import (
+	"bytes"
+	"fmt"
+	"log"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"strings"
+	"testing"
+
+	"github.com/ProjectDistribute/distributor/service"
+	"github.com/labstack/echo/v4"
+	"github.com/stretchr/testify/assert"
+)
+
+// newSignupServer mounts a route limited per client IP the way signups are.
+func newSignupServer(trustedProxies string) (*echo.Echo, *service.LoginLimiter) {
+	e := New()
+	e.IPExtractor = IPExtractor(trustedProxies)
+	limiter := service.NewLoginLimiter(service.NewMemoryLimiterStore())
+	e.POST("/api/users/signup", func(c echo.Context) error {
+		if err := limiter.AllowSignup(c.RealIP()); err != nil {
+			return c.NoContent(http.StatusTooManyRequests)
+		}
+		return c.String(http.StatusOK, c.RealIP())
+	})
+	return e, limiter
+}
+
+func signup(e *echo.Echo, remoteAddr string, headers map[string]string) *httptest.ResponseRecorder {
+	req := httptest.NewRequest(http.MethodPost, "/api/users/signup", nil)
+	req.RemoteAddr = remoteAddr
+	for k, v := range headers {
+		req.Header.Set(k, v)
+	}
+	rec := httptest.NewRecorder()
+	e.ServeHTTP(rec, req)
+	return rec
+}
+
+func TestIPExtractor_SpoofedHeadersShareTheBucket(t *testing.T) {
+	e, limiter := newSignupServer("")
+
+	for i := 0; i < limiter.SignupBurst; i++ {
+		rec := signup(e, "203.0.113.7:4000", map[string]string{
+			echo.HeaderXForwardedFor: fmt.Sprintf("198.51.100.%d", i),
+			echo.HeaderXRealIP:       fmt.Sprintf("192.0.2.%d", i),
+		})
+		assert.Equal(t, http.StatusOK, rec.Code)
+		assert.Equal(t, "203.0.113.7", rec.Body.String())
+	}
+
+	// A fresh forwarded address does not get a fresh bucket
+	rec := signup(e, "203.0.113.7:4001", map[string]string{echo.HeaderXForwardedFor: "198.51.100.200"})
+	assert.Equal(t, http.StatusTooManyRequests, rec.Code)
+
+	// Nor can it lock out the address it claims to be
+	rec = signup(e, "198.51.100.200:4000", nil)
+	assert.Equal(t, http.StatusOK, rec.Code)
+}
+
+func TestIPExtractor_TrustedProxy(t *testing.T) {
+	e, _ := newSignupServer("10.0.0.0/8, 2001:db8::1")
+
+	tests := []struct {
+		name       string
+		remoteAddr string
+		xff        string
+		want       string
+	}{
+		{"trusted proxy", "10.1.2.3:4000", "203.0.113.7", "203.0.113.7"},
+		{"trusted proxy chain", "10.1.2.3:4000", "198.51.100.1, 203.0.113.7, 10.9.9.9", "203.0.113.7"},
+		{"trusted IPv6 proxy", "[2001:db8::1]:4000", "203.0.113.8", "203.0.113.8"},
+		{"untrusted peer", "198.51.100.9:4000", "203.0.113.7", "198.51.100.9"},
+		{"private peer not listed", "192.168.1.2:4000", "203.0.113.7", "192.168.1.2"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			rec := signup(e, tt.remoteAddr, map[string]string{echo.HeaderXForwardedFor: tt.xff})
+			assert.Equal(t, http.StatusOK, rec.Code)
+			assert.Equal(t, tt.want, rec.Body.String())
+		})
+	}
+}
+
+func TestIPExtractor_WarnsOnceAboutForwardedHeaders(t *testing.T) {
+	var buf bytes.Buffer
+	log.SetOutput(&buf)
+	t.Cleanup(func() { log.SetOutput(os.Stderr) })
+
+	e, _ := newSignupServer("")
+	signup(e, "203.0.113.7:4000", nil)
+	assert.NotContains(t, buf.String(), "TRUSTED_PROXIES")
+
+	signup(e, "10.0.0.2:4000", map[string]string{echo.HeaderXForwardedFor: "203.0.113.7"})
+	signup(e, "10.0.0.2:4000", map[string]string{echo.HeaderXRealIP: "203.0.113.8"})
+	assert.Equal(t, 1, strings.Count(buf.String(), "TRUSTED_PROXIES is not set"), buf.String())
+
+	// Trusted proxies are expected to forward
+	buf.Reset()
+	e, _ = newSignupServer("10.0.0.0/8")
+	signup(e, "10.0.0.2:4000", map[string]string{echo.HeaderXForwardedFor: "203.0.113.7"})
+	assert.NotContains(t, buf.String(), "TRUSTED_PROXIES")
+}
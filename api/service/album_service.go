@@ -36,7 +36,12 @@ func (s *AlbumService) createAlbumFromModel(album *model.Album) error {
 	return nil
 }
 
-func (s *AlbumService) UpdateAlbum(id uuid.UUID, title string, releaseDate time.Time) (*model.Album, error) {
+// UpdateAlbum changes the given fields of an album, empty ones are left as they are
+// and nil artists keep the album artists.
+func (s *AlbumService) UpdateAlbum(id uuid.UUID, title string, releaseDate time.Time, albumType string, artists []model.Artist) (*model.Album, error) {
+	if albumType != "" && !model.ValidAlbumType(albumType) {
+		return nil, fmt.Errorf("invalid album type %q", albumType)
+	}
 	album, err := s.Store.GetAlbumByID(id)
 	if err != nil {
 		return nil, err
@@ -47,17 +52,35 @@ func (s *AlbumService) UpdateAlbum(id uuid.UUID, title string, releaseDate time.
 	if !releaseDate.IsZero() {
 		album.ReleaseDate = releaseDate
 	}
+	if albumType != "" {
+		album.Type = albumType
+	}
 	if err := s.Store.UpdateAlbum(album); err != nil {
 		return nil, err
 	}
+	if artists != nil {
+		if err := s.Store.ReplaceAlbumArtists(album, artists); err != nil {
+			return nil, err
+		}
+		album.AlbumArtists = artists
+	}
 	_ = s.SearchSvc.IndexAlbum(album)
 	return album, nil
 }
 
-func (s *AlbumService) CreateAlbum(title string, releaseDate time.Time, artistName string) (*model.Album, error) {
+// CreateAlbum creates an album of the given type, an album if empty, credited to artists.
+func (s *AlbumService) CreateAlbum(title string, releaseDate time.Time, albumType string, artists []model.Artist) (*model.Album, error) {
+	if albumType == "" {
+		albumType = model.AlbumTypeAlbum
+	}
+	if !model.ValidAlbumType(albumType) {
+		return nil, fmt.Errorf("invalid album type %q", albumType)
+	}
 	album := &model.Album{
-		Title:       title,
-		ReleaseDate: releaseDate,
+		Title:        title,
+		ReleaseDate:  releaseDate,
+		Type:         albumType,
+		AlbumArtists: artists,
 	}
 
 	createdAlbum, err := s.Store.CreateAlbum(album)
@@ -73,33 +96,54 @@ func (s *AlbumService) CreateAlbum(title string, releaseDate time.Time, artistNa
 }
 
 func (s *AlbumService) GetOrCreateAlbum(title string, artists []model.Artist) (*model.Album, error) {
+	album, err := s.FindAlbum(title, artists)
+	if err != nil {
+		return nil, err
+	}
+	if album != nil {
+		log.Printf("Album %s found, using existing album\n", album.Title)
+		return album, nil
+	}
+
+	log.Printf("Album %s not found, creating new album\n", title)
+	newAlbum := &model.Album{Title: title}
+	if err := s.createAlbumFromModel(newAlbum); err != nil {
+		return nil, err
+	}
+	return newAlbum, nil
+}
+
+// FindAlbum returns the album GetOrCreateAlbum would pick for title and artists, nil if
+// it would create one: an album of that title credited to one of the artists, with
+// a song by one of them, or without songs.
+func (s *AlbumService) FindAlbum(title string, artists []model.Artist) (*model.Album, error) {
 	albums, err := s.Store.GetAlbumsByTitle(title)
 	if err != nil {
 		return nil, err
 	}
 
 	for _, album := range albums {
-		if len(album.Songs) == 0 {
+		if len(album.Songs) == 0 && len(album.AlbumArtists) == 0 {
 			return &album, nil
 		}
+		for _, albumArtist := range album.AlbumArtists {
+			for _, artist := range artists {
+				if albumArtist.ID == artist.ID {
+					return &album, nil
+				}
+			}
+		}
 		for _, song := range album.Songs {
 			for _, songArtist := range song.Artists {
 				for _, artist := range artists {
 					if songArtist.ID == artist.ID {
-						log.Printf("Album %s found, using existing album\n", album.Title)
 						return &album, nil
 					}
 				}
 			}
 		}
 	}
-
-	log.Printf("Album %s not found, creating new album\n", title)
-	newAlbum := &model.Album{Title: title}
-	if err := s.createAlbumFromModel(newAlbum); err != nil {
-		return nil, err
-	}
-	return newAlbum, nil
+	return nil, nil
 }
 
 func (s *AlbumService) GetAlbumByID(uuid uuid.UUID) (*model.Album, error) {
@@ -132,14 +176,14 @@ func (s *AlbumService) WriteAlbumCover(albumID uuid.UUID, data io.Reader, id str
 func (s *AlbumService) AssignAlbumCoverByPath(albumID uuid.UUID, sourcePath string, format string) error {
 	pathMax := s.GetAlbumCoverPath(albumID, format, "hq")
 
-	if err := s.Storage.Move(sourcePath, pathMax); err != nil {
-		return err
-	}
-
 	// Read the file data for resizing
-	data, err := os.ReadFile(pathMax)
+	data, err := os.ReadFile(sourcePath)
 	if err != nil {
-		return fmt.Errorf("failed to read moved cover file: %w", err)
+		return fmt.Errorf("failed to read cover file: %w", err)
+	}
+
+	if err := s.Storage.Move(sourcePath, pathMax); err != nil {
+		return err
 	}
 
 	pathLQ := s.GetAlbumCoverPath(albumID, format, "lq")
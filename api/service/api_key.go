@@ -0,0 +1,121 @@
+package service
+
+import (
+	"crypto/rand"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"log"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/ProjectDistribute/distributor/middleware"
+	"github.com/ProjectDistribute/distributor/model"
+	"github.com/google/uuid"
+)
+
+const (
+	// apiKeyPrefix marks keys so they are recognizable in config files and secret scanners.
+	apiKeyPrefix = "dk_"
+
+	// apiKeyTouchInterval limits how often using a key updates LastUsedAt.
+	apiKeyTouchInterval = time.Minute
+)
+
+var (
+	ErrInvalidAPIKey  = errors.New("invalid, expired or revoked API key")
+	ErrAPIKeyNotFound = errors.New("API key not found")
+)
+
+// ValidateScopes checks that scopes are known and that users with role may grant them.
+func ValidateScopes(scopes []string, role string) error {
+	if len(scopes) == 0 {
+		return errors.New("at least one scope is required")
+	}
+	for _, scope := range scopes {
+		if !slices.Contains(middleware.Scopes, scope) {
+			return fmt.Errorf("unknown scope %q", scope)
+		}
+		if !middleware.CanGrantScope(role, scope) {
+			return fmt.Errorf("the %s role cannot grant the %s scope", role, scope)
+		}
+	}
+	return nil
+}
+
+// CreateAPIKey mints a key for the user. The key itself is only returned here, the
+// database keeps its hash.
+func (s *UserService) CreateAPIKey(user *model.User, name string, scopes []string, expiresAt *time.Time) (string, *model.APIKey, error) {
+	if err := ValidateScopes(scopes, user.Role); err != nil {
+		return "", nil, err
+	}
+
+	buf := make([]byte, 32)
+	if _, err := rand.Read(buf); err != nil {
+		return "", nil, err
+	}
+	key := apiKeyPrefix + base64.RawURLEncoding.EncodeToString(buf)
+
+	slices.Sort(scopes)
+	apiKey := &model.APIKey{
+		UserID:    user.ID,
+		Name:      name,
+		KeyHash:   hashToken(key),
+		Prefix:    key[:len(apiKeyPrefix)+6],
+		Scopes:    strings.Join(slices.Compact(scopes), ","),
+		ExpiresAt: expiresAt,
+	}
+	if err := s.APIKeys.CreateAPIKey(apiKey); err != nil {
+		return "", nil, err
+	}
+	return key, apiKey, nil
+}
+
+// AuthorizeAPIKey resolves a key to claims for its owner, applying the same user
+// checks as AuthorizeToken.
+func (s *UserService) AuthorizeAPIKey(key, ip string) (*middleware.JwtCustomClaims, error) {
+	apiKey, err := s.APIKeys.GetAPIKeyByHash(hashToken(key))
+	if err != nil || !apiKey.Active() {
+		return nil, ErrInvalidAPIKey
+	}
+	user, err := s.Store.GetUserByID(apiKey.UserID)
+	if err != nil {
+		return nil, ErrInvalidAPIKey
+	}
+	if user.IsBanned() {
+		return nil, ErrUserBanned
+	}
+	if user.PendingApproval {
+		return nil, ErrPendingApproval
+	}
+
+	if now := time.Now(); apiKey.LastUsedAt == nil || now.Sub(*apiKey.LastUsedAt) > apiKeyTouchInterval || apiKey.LastUsedIP != ip {
+		if err := s.APIKeys.TouchAPIKey(apiKey.ID, now, ip); err != nil {
+			log.Printf("Failed to update API key %s: %v\n", apiKey.ID, err)
+		}
+	}
+
+	claims := &middleware.JwtCustomClaims{
+		Admin:  user.IsAdmin,
+		Role:   user.Role,
+		Scopes: apiKey.ScopeList(),
+	}
+	claims.Subject = user.ID.String()
+	return claims, nil
+}
+
+// RevokeAPIKey revokes a key of a user. Revoking someone else's key is audited.
+func (s *UserService) RevokeAPIKey(actorID, userID, keyID uuid.UUID) error {
+	apiKey, err := s.APIKeys.GetAPIKeyByID(keyID)
+	if err != nil || apiKey.UserID != userID {
+		return ErrAPIKeyNotFound
+	}
+	if err := s.APIKeys.RevokeAPIKey(apiKey.ID); err != nil {
+		return err
+	}
+	if actorID != userID {
+		s.RecordAudit(actorID, model.AuditAPIKeyRevoked, userID, apiKey.Name)
+	}
+	return nil
+}
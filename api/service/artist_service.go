@@ -14,6 +14,40 @@ type ArtistService struct {
 	SearchSvc *SearchService
 }
 
+// ResolveArtists finds each artist by ID or identifier, creating the ones that do not exist.
+func (s *ArtistService) ResolveArtists(artistsInput []SongCreationArtist) ([]model.Artist, error) {
+	var artists []model.Artist
+	for _, a := range artistsInput {
+		var artist *model.Artist
+		var err error
+
+		// Try to parse as UUID first
+		if id, uuidErr := uuid.Parse(a.Identifier); uuidErr == nil {
+			artist, err = s.Store.GetArtistByID(id)
+			if err == nil {
+				log.Printf("Artist %s found by ID, using existing artist\n", a.Name)
+			} else {
+				artist = nil
+			}
+		}
+
+		if artist == nil {
+			artist, err = s.GetArtistByIdentifier(a.Identifier)
+			if err != nil {
+				log.Printf("Artist %s not found, creating new artist\n", a.Name)
+				artist, err = s.CreateArtist(a.Name, []string{a.Identifier})
+				if err != nil {
+					return nil, err
+				}
+			} else {
+				log.Printf("Artist %s found, using existing artist\n", a.Name)
+			}
+		}
+		artists = append(artists, *artist)
+	}
+	return artists, nil
+}
+
 func (s *ArtistService) GetArtistByIdentifier(identifier string) (*model.Artist, error) {
 	return s.Store.GetArtistByIdentifier(identifier)
 }
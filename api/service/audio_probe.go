@@ -0,0 +1,757 @@
+package service
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"strings"
+
+	"github.com/mewkiz/flac"
+	"github.com/mewkiz/flac/frame"
+	"github.com/mewkiz/flac/meta"
+	"github.com/tcolgate/mp3"
+)
+
+var errNotAudio = errors.New("not a recognized audio stream")
+
+// ErrTruncatedAudio is returned when a file ends before the length its headers declare.
+var ErrTruncatedAudio = errors.New("file is truncated")
+
+func probeAudio(f io.ReadSeeker, ext string) (AudioInfo, error) {
+	var info AudioInfo
+	ext = strings.ToLower(ext)
+	switch ext {
+	case ".mp3":
+		return probeMP3(f)
+
+	case ".flac":
+		return probeFLAC(f)
+
+	case ".wav":
+		return probeWAV(f)
+
+	case ".ogg", ".opus":
+		return probeOgg(f)
+
+	case ".m4a", ".mp4":
+		return probeMP4(f)
+
+	default:
+		// Unsupported format for probing
+		log.Printf("Warning: Audio probing not supported for %s\n", ext)
+		return info, nil
+	}
+}
+
+// readAt reads exactly len(buf) bytes at offset off.
+func readAt(r io.ReadSeeker, off int64, buf []byte) error {
+	if _, err := r.Seek(off, io.SeekStart); err != nil {
+		return err
+	}
+	_, err := io.ReadFull(r, buf)
+	return err
+}
+
+func streamSize(r io.ReadSeeker) (int64, error) {
+	return r.Seek(0, io.SeekEnd)
+}
+
+// averageBitrate returns the bitrate in kbit/s of n bytes of audio lasting seconds.
+func averageBitrate(n int64, seconds float64) int {
+	if seconds <= 0 {
+		return 0
+	}
+	return int(float64(n) * 8 / seconds / 1000)
+}
+
+// FLAC
+
+// probeFLAC reads STREAMINFO and checks that the first and the last audio frame decode.
+func probeFLAC(r io.ReadSeeker) (AudioInfo, error) {
+	info := AudioInfo{Codec: "flac"}
+	// Sniffing leaves r past the start, the stream is parsed from its signature
+	if _, err := r.Seek(0, io.SeekStart); err != nil {
+		return info, err
+	}
+	stream, err := flac.Parse(r)
+	if err != nil {
+		return info, err
+	}
+	si := stream.Info
+	if si.SampleRate == 0 || si.NChannels == 0 || si.BitsPerSample < 4 || si.BlockSizeMax < 16 {
+		return info, fmt.Errorf("flac: invalid STREAMINFO")
+	}
+	info.SampleRate = int(si.SampleRate)
+	info.BitDepth = int(si.BitsPerSample)
+	info.Channels = int(si.NChannels)
+	info.Duration = float64(si.NSamples) / float64(si.SampleRate)
+	if _, err := stream.ParseNext(); err != nil {
+		if errors.Is(err, io.EOF) || errors.Is(err, io.ErrUnexpectedEOF) {
+			return info, fmt.Errorf("flac: %w", ErrTruncatedAudio)
+		}
+		return info, fmt.Errorf("flac: invalid first frame: %v", err)
+	}
+	if err := checkFLACEnd(r, si); err != nil {
+		return info, fmt.Errorf("flac: %w", err)
+	}
+	return info, nil
+}
+
+// flacTailSize is how much of the end of a FLAC file is searched for its last frame.
+const flacTailSize = 1 << 20
+
+// checkFLACEnd finds the last frame that decodes and checks that it ends at the sample
+// count in STREAMINFO. A file cut inside the audio ends in a partial frame, so the last
+// frame that decodes is an earlier one.
+func checkFLACEnd(r io.ReadSeeker, si *meta.StreamInfo) error {
+	if si.NSamples == 0 {
+		// The encoder did not know the length, there is nothing to compare against
+		return nil
+	}
+	size, err := streamSize(r)
+	if err != nil {
+		return err
+	}
+	tail := make([]byte, min(size, flacTailSize))
+	if err := readAt(r, size-int64(len(tail)), tail); err != nil {
+		return err
+	}
+
+	for i := len(tail) - 2; i >= 0; i-- {
+		// Frames start with a 14 bit sync code, the header CRC rules out most false matches
+		if tail[i] != 0xFF || tail[i+1]&0xFE != 0xF8 {
+			continue
+		}
+		f, err := frame.Parse(bytes.NewReader(tail[i:]))
+		if err != nil {
+			continue
+		}
+		first := f.Num
+		if f.HasFixedBlockSize {
+			first *= uint64(si.BlockSizeMax)
+		}
+		if first+uint64(f.BlockSize) < si.NSamples {
+			return ErrTruncatedAudio
+		}
+		return nil
+	}
+	return ErrTruncatedAudio
+}
+
+// MP3
+
+// mp3Header is the part of an MPEG audio frame header needed to find and read a
+// Xing or VBRI header.
+type mp3Header struct {
+	version    int // 1, 2 or 25 for MPEG 2.5
+	layer      int
+	bitrate    int // kbit/s
+	sampleRate int
+	channels   int
+	padding    bool
+}
+
+// mp3Bitrates by MPEG version 1 or 2 (2.5 uses the 2 table) and layer, in kbit/s
+var mp3Bitrates = map[[2]int][15]int{
+	{1, 1}: {0, 32, 64, 96, 128, 160, 192, 224, 256, 288, 320, 352, 384, 416, 448},
+	{1, 2}: {0, 32, 48, 56, 64, 80, 96, 112, 128, 160, 192, 224, 256, 320, 384},
+	{1, 3}: {0, 32, 40, 48, 56, 64, 80, 96, 112, 128, 160, 192, 224, 256, 320},
+	{2, 1}: {0, 32, 48, 56, 64, 80, 96, 112, 128, 144, 160, 176, 192, 224, 256},
+	{2, 2}: {0, 8, 16, 24, 32, 40, 48, 56, 64, 80, 96, 112, 128, 144, 160},
+	{2, 3}: {0, 8, 16, 24, 32, 40, 48, 56, 64, 80, 96, 112, 128, 144, 160},
+}
+
+var mp3SampleRates = map[int][3]int{
+	1:  {44100, 48000, 32000},
+	2:  {22050, 24000, 16000},
+	25: {11025, 12000, 8000},
+}
+
+func parseMP3Header(b []byte) (mp3Header, bool) {
+	if b[0] != 0xFF || b[1]&0xE0 != 0xE0 {
+		return mp3Header{}, false
+	}
+	var h mp3Header
+	switch (b[1] >> 3) & 3 {
+	case 0:
+		h.version = 25
+	case 2:
+		h.version = 2
+	case 3:
+		h.version = 1
+	default:
+		return h, false
+	}
+	h.layer = 4 - int((b[1]>>1)&3)
+	if h.layer == 4 {
+		return h, false
+	}
+	bitrateIndex, rateIndex := b[2]>>4, (b[2]>>2)&3
+	if bitrateIndex == 0 || bitrateIndex == 15 || rateIndex == 3 {
+		return h, false
+	}
+	table := h.version
+	if table == 25 {
+		table = 2
+	}
+	h.bitrate = mp3Bitrates[[2]int{table, h.layer}][bitrateIndex]
+	h.sampleRate = mp3SampleRates[h.version][rateIndex]
+	h.padding = b[2]&2 != 0
+	h.channels = 2
+	if b[3]>>6 == 3 {
+		h.channels = 1
+	}
+	return h, true
+}
+
+// frameLength is the length of the frame in bytes, header included.
+func (h mp3Header) frameLength() int {
+	pad := 0
+	if h.padding {
+		pad = 1
+	}
+	if h.layer == 1 {
+		return (12*h.bitrate*1000/h.sampleRate + pad) * 4
+	}
+	return h.samplesPerFrame()/8*h.bitrate*1000/h.sampleRate + pad
+}
+
+func (h mp3Header) codec() string {
+	return fmt.Sprintf("mp%d", h.layer)
+}
+
+func (h mp3Header) samplesPerFrame() int {
+	switch {
+	case h.layer == 1:
+		return 384
+	case h.layer == 3 && h.version != 1:
+		return 576
+	}
+	return 1152
+}
+
+// xingOffset is where the Xing header starts in a Layer III frame, after the side information.
+func (h mp3Header) xingOffset() int {
+	if h.version == 1 {
+		if h.channels == 1 {
+			return 4 + 17
+		}
+		return 4 + 32
+	}
+	if h.channels == 1 {
+		return 4 + 9
+	}
+	return 4 + 17
+}
+
+// id3v2Size returns the length of the ID3v2 tag at the start of r, 0 if there is none.
+func id3v2Size(r io.ReadSeeker) int64 {
+	var b [10]byte
+	if readAt(r, 0, b[:]) != nil || string(b[:3]) != "ID3" {
+		return 0
+	}
+	size := int64(b[6]&0x7F)<<21 | int64(b[7]&0x7F)<<14 | int64(b[8]&0x7F)<<7 | int64(b[9]&0x7F)
+	size += 10
+	if b[5]&0x10 != 0 {
+		size += 10 // footer
+	}
+	return size
+}
+
+// probeMP3 reads the frame count from the Xing, Info or VBRI header of the first
+// frame and only decodes every frame when there is none.
+func probeMP3(r io.ReadSeeker) (AudioInfo, error) {
+	var info AudioInfo
+	size, err := streamSize(r)
+	if err != nil {
+		return info, err
+	}
+
+	start := id3v2Size(r)
+	buf := make([]byte, 64*1024)
+	n := 0
+	if _, err := r.Seek(start, io.SeekStart); err == nil {
+		n, _ = io.ReadFull(r, buf)
+	}
+	buf = buf[:n]
+	for i := 0; i+4 <= len(buf); i++ {
+		h, ok := parseMP3Header(buf[i:])
+		if !ok {
+			continue
+		}
+		frame := buf[i:]
+		frames, bytesInStream := mp3VBRFrames(h, frame)
+		if frames == 0 {
+			break
+		}
+		info.Codec = h.codec()
+		info.SampleRate = h.sampleRate
+		info.Channels = h.channels
+		info.Duration = float64(frames) * float64(h.samplesPerFrame()) / float64(h.sampleRate)
+		available := size - start - int64(i)
+		if bytesInStream == 0 {
+			bytesInStream = available
+		}
+		info.Bitrate = averageBitrate(bytesInStream, info.Duration)
+		// Encoders are not always exact, allow 1% less than declared
+		if available < bytesInStream-bytesInStream/100 {
+			return info, fmt.Errorf("mp3: %w", ErrTruncatedAudio)
+		}
+		return info, nil
+	}
+
+	if _, err := r.Seek(0, io.SeekStart); err != nil {
+		return info, err
+	}
+	return decodeMP3(r)
+}
+
+// mp3VBRFrames returns the number of frames and bytes from a Xing/Info or VBRI
+// header in frame, zero if there is none. The byte count may be missing.
+func mp3VBRFrames(h mp3Header, frame []byte) (frames uint32, size int64) {
+	if h.layer == 3 {
+		if off := h.xingOffset(); len(frame) >= off+16 {
+			tag := string(frame[off : off+4])
+			if tag == "Xing" || tag == "Info" {
+				flags := binary.BigEndian.Uint32(frame[off+4:])
+				p := off + 8
+				if flags&1 != 0 {
+					frames = binary.BigEndian.Uint32(frame[p:])
+					p += 4
+				}
+				if flags&2 != 0 && len(frame) >= p+4 {
+					size = int64(binary.BigEndian.Uint32(frame[p:]))
+				}
+				return frames, size
+			}
+		}
+	}
+	// VBRI always follows 32 bytes of side information
+	if len(frame) >= 36+18 && string(frame[36:40]) == "VBRI" {
+		size = int64(binary.BigEndian.Uint32(frame[46:]))
+		frames = binary.BigEndian.Uint32(frame[50:])
+	}
+	return frames, size
+}
+
+// decodeMP3 walks every frame, for files without a VBR header.
+func decodeMP3(f io.Reader) (AudioInfo, error) {
+	var info AudioInfo
+	d := mp3.NewDecoder(f)
+	var frame mp3.Frame
+	var skipped int
+	var bits float64
+	for {
+		if err := d.Decode(&frame, &skipped); err != nil {
+			break
+		}
+		seconds := frame.Duration().Seconds()
+		info.Duration += seconds
+		h := frame.Header()
+		bits += float64(h.BitRate()) * seconds
+		if info.SampleRate == 0 {
+			info.Codec = "mp3"
+			info.SampleRate = int(h.SampleRate())
+			info.Channels = 2
+			if h.ChannelMode() == mp3.SingleChannel {
+				info.Channels = 1
+			}
+		}
+	}
+	if info.Duration == 0 {
+		return info, fmt.Errorf("mp3: no valid frames")
+	}
+	info.Bitrate = int(bits / info.Duration / 1000)
+	return info, nil
+}
+
+// WAV
+
+// probeWAV reads the fmt and data chunks of a RIFF/WAVE or RF64 file.
+func probeWAV(r io.ReadSeeker) (AudioInfo, error) {
+	var info AudioInfo
+	size, err := streamSize(r)
+	if err != nil {
+		return info, err
+	}
+	var hdr [12]byte
+	if err := readAt(r, 0, hdr[:]); err != nil {
+		return info, err
+	}
+	riff := string(hdr[:4])
+	if (riff != "RIFF" && riff != "RF64") || string(hdr[8:12]) != "WAVE" {
+		return info, fmt.Errorf("wav: %w", errNotAudio)
+	}
+
+	var byteRate uint32
+	var dataSize int64 = -1
+	var rf64DataSize int64 = -1
+	for off := int64(12); off+8 <= size; {
+		var ch [8]byte
+		if err := readAt(r, off, ch[:]); err != nil {
+			return info, err
+		}
+		id := string(ch[:4])
+		chunkSize := int64(binary.LittleEndian.Uint32(ch[4:]))
+		body := off + 8
+		switch id {
+		case "ds64":
+			var ds [16]byte
+			if err := readAt(r, body, ds[:]); err != nil {
+				return info, err
+			}
+			rf64DataSize = int64(binary.LittleEndian.Uint64(ds[8:]))
+		case "fmt ":
+			var fmtChunk [16]byte
+			if err := readAt(r, body, fmtChunk[:]); err != nil {
+				return info, err
+			}
+			info.Codec = wavCodec(binary.LittleEndian.Uint16(fmtChunk[:2]))
+			info.Channels = int(binary.LittleEndian.Uint16(fmtChunk[2:]))
+			info.SampleRate = int(binary.LittleEndian.Uint32(fmtChunk[4:]))
+			byteRate = binary.LittleEndian.Uint32(fmtChunk[8:])
+			info.BitDepth = int(binary.LittleEndian.Uint16(fmtChunk[14:]))
+		case "data":
+			dataSize = chunkSize
+			if riff == "RF64" && rf64DataSize >= 0 {
+				dataSize = rf64DataSize
+			}
+			// Streamed files may leave the size unset
+			if chunkSize == 0xFFFFFFFF || chunkSize == 0 {
+				dataSize = size - body
+			} else if dataSize > size-body {
+				return info, fmt.Errorf("wav: %w", ErrTruncatedAudio)
+			}
+		}
+		if dataSize >= 0 && byteRate > 0 {
+			break
+		}
+		off = body + chunkSize + chunkSize%2
+	}
+	if byteRate == 0 || dataSize < 0 {
+		return info, fmt.Errorf("wav: missing fmt or data chunk")
+	}
+	info.Duration = float64(dataSize) / float64(byteRate)
+	info.Bitrate = int(byteRate) * 8 / 1000
+	return info, nil
+}
+
+// wavCodec names the WAVE format tag. Extensible files name the sub format in an
+// extension the probe does not read, they are reported as extensible.
+func wavCodec(tag uint16) string {
+	switch tag {
+	case 1:
+		return "pcm"
+	case 3:
+		return "pcm_float"
+	case 6:
+		return "alaw"
+	case 7:
+		return "mulaw"
+	case 0xFFFE:
+		return "pcm_extensible"
+	}
+	return fmt.Sprintf("wav_0x%04x", tag)
+}
+
+// Ogg
+
+// oggPage is the header of an Ogg page, see RFC 3533.
+type oggPage struct {
+	granule  int64
+	serial   uint32
+	segments []byte
+}
+
+const oggHeaderSize = 27
+
+func parseOggPage(b []byte) (oggPage, bool) {
+	if len(b) < oggHeaderSize || string(b[:4]) != "OggS" || b[4] != 0 {
+		return oggPage{}, false
+	}
+	n := int(b[26])
+	if len(b) < oggHeaderSize+n {
+		return oggPage{}, false
+	}
+	return oggPage{
+		granule:  int64(binary.LittleEndian.Uint64(b[6:])),
+		serial:   binary.LittleEndian.Uint32(b[14:]),
+		segments: b[oggHeaderSize : oggHeaderSize+n],
+	}, true
+}
+
+// probeOgg reads the Vorbis or Opus identification header from the first page and
+// the duration from the granule position of the last page of the same stream.
+func probeOgg(r io.ReadSeeker) (AudioInfo, error) {
+	var info AudioInfo
+	size, err := streamSize(r)
+	if err != nil {
+		return info, err
+	}
+
+	first := make([]byte, oggHeaderSize+255+64)
+	n := 0
+	if _, err := r.Seek(0, io.SeekStart); err == nil {
+		n, _ = io.ReadFull(r, first)
+	}
+	page, ok := parseOggPage(first[:n])
+	if !ok {
+		return info, fmt.Errorf("ogg: %w", errNotAudio)
+	}
+	packet := first[oggHeaderSize+len(page.segments) : n]
+
+	var rate, preSkip int64
+	switch {
+	case len(packet) >= 19 && string(packet[:8]) == "OpusHead":
+		info.Channels = int(packet[9])
+		preSkip = int64(binary.LittleEndian.Uint16(packet[10:]))
+		// Opus always decodes at 48 kHz, granule positions count 48 kHz samples
+		rate = 48000
+		info.Codec = "opus"
+		info.SampleRate = 48000
+	case len(packet) >= 30 && string(packet[:7]) == "\x01vorbis":
+		info.Channels = int(packet[11])
+		rate = int64(binary.LittleEndian.Uint32(packet[12:]))
+		info.Codec = "vorbis"
+		info.SampleRate = int(rate)
+	default:
+		return info, fmt.Errorf("ogg: %w", errNotAudio)
+	}
+	if rate == 0 {
+		return info, fmt.Errorf("ogg: missing sample rate")
+	}
+
+	// A page is at most 65307 bytes, so the last one starts within the tail
+	tailStart := max(size-65307-oggHeaderSize, 0)
+	tail := make([]byte, size-tailStart)
+	if err := readAt(r, tailStart, tail); err != nil {
+		return info, err
+	}
+	granule := int64(-1)
+	for i := len(tail) - oggHeaderSize; i >= 0; i-- {
+		if tail[i] != 'O' {
+			continue
+		}
+		p, ok := parseOggPage(tail[i:])
+		if ok && p.serial == page.serial && p.granule >= 0 {
+			granule = p.granule
+			body := 0
+			for _, seg := range p.segments {
+				body += int(seg)
+			}
+			if i+oggHeaderSize+len(p.segments)+body > len(tail) {
+				return info, fmt.Errorf("ogg: %w", ErrTruncatedAudio)
+			}
+			break
+		}
+	}
+	if granule < 0 {
+		return info, fmt.Errorf("ogg: no page with a granule position")
+	}
+	info.Duration = float64(max(granule-preSkip, 0)) / float64(rate)
+	info.Bitrate = averageBitrate(size, info.Duration)
+	return info, nil
+}
+
+// MP4
+
+type mp4Box struct {
+	typ        string
+	start, end int64 // of the body
+}
+
+// mp4Boxes lists the boxes between start and end.
+func mp4Boxes(r io.ReadSeeker, start, end int64) ([]mp4Box, error) {
+	var boxes []mp4Box
+	for off := start; off+8 <= end; {
+		var hdr [16]byte
+		if err := readAt(r, off, hdr[:8]); err != nil {
+			return nil, err
+		}
+		size := int64(binary.BigEndian.Uint32(hdr[:4]))
+		typ := string(hdr[4:8])
+		body := off + 8
+		switch size {
+		case 0:
+			size = end - off
+		case 1:
+			if err := readAt(r, off+8, hdr[8:16]); err != nil {
+				return nil, err
+			}
+			size = int64(binary.BigEndian.Uint64(hdr[8:16]))
+			body += 8
+		}
+		if size < body-off {
+			return nil, fmt.Errorf("mp4: invalid %q box size", typ)
+		}
+		if off+size > end {
+			return nil, fmt.Errorf("mp4: %q box: %w", typ, ErrTruncatedAudio)
+		}
+		boxes = append(boxes, mp4Box{typ: typ, start: body, end: off + size})
+		off += size
+	}
+	return boxes, nil
+}
+
+func findMP4Box(boxes []mp4Box, typ string) (mp4Box, bool) {
+	for _, b := range boxes {
+		if b.typ == typ {
+			return b, true
+		}
+	}
+	return mp4Box{}, false
+}
+
+// mp4Duration reads the time scale and duration of an mvhd or mdhd box.
+func mp4Duration(r io.ReadSeeker, b mp4Box) (float64, error) {
+	var buf [32]byte
+	if err := readAt(r, b.start, buf[:1]); err != nil {
+		return 0, err
+	}
+	var scale uint32
+	var duration uint64
+	if buf[0] == 1 {
+		if err := readAt(r, b.start, buf[:32]); err != nil {
+			return 0, err
+		}
+		scale = binary.BigEndian.Uint32(buf[20:])
+		duration = binary.BigEndian.Uint64(buf[24:])
+	} else {
+		if err := readAt(r, b.start, buf[:20]); err != nil {
+			return 0, err
+		}
+		scale = binary.BigEndian.Uint32(buf[12:])
+		duration = uint64(binary.BigEndian.Uint32(buf[16:]))
+	}
+	if scale == 0 {
+		return 0, fmt.Errorf("mp4: zero time scale")
+	}
+	return float64(duration) / float64(scale), nil
+}
+
+// probeMP4 reads the duration from the mdhd box of the sound track, falling back to
+// the mvhd box of the movie, and the channels and sample rate from its sample description.
+func probeMP4(r io.ReadSeeker) (AudioInfo, error) {
+	var info AudioInfo
+	size, err := streamSize(r)
+	if err != nil {
+		return info, err
+	}
+	top, err := mp4Boxes(r, 0, size)
+	if err != nil {
+		return info, err
+	}
+	if _, ok := findMP4Box(top, "ftyp"); !ok {
+		return info, fmt.Errorf("mp4: %w", errNotAudio)
+	}
+	moov, ok := findMP4Box(top, "moov")
+	if !ok {
+		return info, fmt.Errorf("mp4: missing moov box")
+	}
+	boxes, err := mp4Boxes(r, moov.start, moov.end)
+	if err != nil {
+		return info, err
+	}
+
+	for _, trak := range boxes {
+		if trak.typ != "trak" {
+			continue
+		}
+		if ok, err := probeMP4Track(r, trak, &info); err != nil {
+			return info, err
+		} else if ok {
+			break
+		}
+	}
+	if info.Duration == 0 {
+		if mvhd, ok := findMP4Box(boxes, "mvhd"); ok {
+			if info.Duration, err = mp4Duration(r, mvhd); err != nil {
+				return info, err
+			}
+		}
+	}
+
+	audio := size
+	if mdat, ok := findMP4Box(top, "mdat"); ok {
+		audio = mdat.end - mdat.start
+	}
+	info.Bitrate = averageBitrate(audio, info.Duration)
+	return info, nil
+}
+
+// probeMP4Track fills in info from trak if it is a sound track.
+func probeMP4Track(r io.ReadSeeker, trak mp4Box, info *AudioInfo) (bool, error) {
+	trakBoxes, err := mp4Boxes(r, trak.start, trak.end)
+	if err != nil {
+		return false, err
+	}
+	mdia, ok := findMP4Box(trakBoxes, "mdia")
+	if !ok {
+		return false, nil
+	}
+	mdiaBoxes, err := mp4Boxes(r, mdia.start, mdia.end)
+	if err != nil {
+		return false, err
+	}
+	hdlr, ok := findMP4Box(mdiaBoxes, "hdlr")
+	if !ok {
+		return false, nil
+	}
+	var handler [12]byte
+	if err := readAt(r, hdlr.start, handler[:]); err != nil || string(handler[8:12]) != "soun" {
+		return false, err
+	}
+
+	if mdhd, ok := findMP4Box(mdiaBoxes, "mdhd"); ok {
+		if info.Duration, err = mp4Duration(r, mdhd); err != nil {
+			return false, err
+		}
+	}
+
+	// mdia > minf > stbl > stsd holds the sample entry
+	box := mdia
+	for _, typ := range []string{"minf", "stbl", "stsd"} {
+		children, err := mp4Boxes(r, box.start, box.end)
+		if err != nil {
+			return true, err
+		}
+		if box, ok = findMP4Box(children, typ); !ok {
+			return true, nil
+		}
+	}
+	// stsd: version, flags and entry count, then the first sample entry
+	var entry [8 + 36]byte
+	if err := readAt(r, box.start, entry[:]); err != nil {
+		return true, nil
+	}
+	sample := entry[8:]
+	info.Codec = mp4Codec(string(sample[4:8]))
+	info.Channels = int(binary.BigEndian.Uint16(sample[24:]))
+	info.SampleRate = int(binary.BigEndian.Uint32(sample[32:]) >> 16)
+	if info.Codec == "alac" {
+		info.BitDepth = int(binary.BigEndian.Uint16(sample[26:]))
+	}
+	return true, nil
+}
+
+// mp4Codec names the codec of an MP4 sample entry type.
+func mp4Codec(entry string) string {
+	switch entry {
+	case "mp4a":
+		return "aac"
+	case "alac":
+		return "alac"
+	case "fLaC":
+		return "flac"
+	case "Opus":
+		return "opus"
+	case "ac-3":
+		return "ac3"
+	case "ec-3":
+		return "eac3"
+	}
+	return strings.TrimSpace(entry)
+}
@@ -0,0 +1,206 @@
+package service
+
+import (
+	"bytes"
+	"encoding/binary"
+	"math/rand"
+	"testing"
+
+	"github.com/mewkiz/flac"
+	"github.com/mewkiz/flac/frame"
+	"github.com/mewkiz/flac/meta"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func le16(v uint16) []byte { return binary.LittleEndian.AppendUint16(nil, v) }
+func le32(v uint32) []byte { return binary.LittleEndian.AppendUint32(nil, v) }
+func be16(v uint16) []byte { return binary.BigEndian.AppendUint16(nil, v) }
+func be32(v uint32) []byte { return binary.BigEndian.AppendUint32(nil, v) }
+
+func join(parts ...[]byte) []byte { return bytes.Join(parts, nil) }
+
+func riffChunk(id string, body []byte) []byte {
+	chunk := join([]byte(id), le32(uint32(len(body))), body)
+	if len(body)%2 == 1 {
+		chunk = append(chunk, 0)
+	}
+	return chunk
+}
+
+func oggPageBytes(granule int64, serial uint32, packet []byte) []byte {
+	return join([]byte("OggS"), []byte{0, 0},
+		binary.LittleEndian.AppendUint64(nil, uint64(granule)),
+		le32(serial), le32(0), le32(0),
+		[]byte{1, byte(len(packet))}, packet)
+}
+
+func mp4BoxBytes(typ string, body ...[]byte) []byte {
+	b := join(body...)
+	return join(be32(uint32(8+len(b))), []byte(typ), b)
+}
+
+// mp3Frame returns an MPEG-1 Layer III, 44.1 kHz, 128 kbit/s stereo frame (417 bytes)
+// with tag written after the side information.
+func mp3Frame(tag []byte) []byte {
+	frame := make([]byte, 417)
+	copy(frame, []byte{0xFF, 0xFB, 0x90, 0x00})
+	copy(frame[4+32:], tag)
+	return frame
+}
+
+// flacFile encodes frames blocks of 4096 samples of mono noise, so frames do not
+// compress to a few bytes.
+func flacFile(t *testing.T, frames int) []byte {
+	const blockSize = 4096
+	info := &meta.StreamInfo{
+		BlockSizeMin:  blockSize,
+		BlockSizeMax:  blockSize,
+		SampleRate:    44100,
+		NChannels:     1,
+		BitsPerSample: 16,
+		NSamples:      uint64(frames * blockSize),
+	}
+	var buf bytes.Buffer
+	enc, err := flac.NewEncoder(&buf, info)
+	require.NoError(t, err)
+	rng := rand.New(rand.NewSource(1))
+	for range frames {
+		samples := make([]int32, blockSize)
+		for i := range samples {
+			samples[i] = int32(rng.Intn(1<<16) - 1<<15)
+		}
+		f := &frame.Frame{
+			Header: frame.Header{
+				HasFixedBlockSize: true,
+				BlockSize:         blockSize,
+				SampleRate:        44100,
+				Channels:          frame.ChannelsMono,
+				BitsPerSample:     16,
+			},
+			Subframes: []*frame.Subframe{{SubHeader: frame.SubHeader{Pred: frame.PredVerbatim}, Samples: samples, NSamples: blockSize}},
+		}
+		require.NoError(t, enc.WriteFrame(f))
+	}
+	require.NoError(t, enc.Close())
+	return buf.Bytes()
+}
+
+func TestProbeFLAC(t *testing.T) {
+	file := flacFile(t, 4)
+
+	info, err := probeAudio(bytes.NewReader(file), ".flac")
+	require.NoError(t, err)
+	assert.InDelta(t, 4*4096/44100.0, info.Duration, 0.001)
+	assert.Equal(t, 44100, info.SampleRate)
+	assert.Equal(t, 16, info.BitDepth)
+	assert.Equal(t, 1, info.Channels)
+
+	// Tags after the audio do not count as truncation
+	_, err = probeAudio(bytes.NewReader(join(file, []byte("TAG"), make([]byte, 125))), ".flac")
+	require.NoError(t, err)
+
+	// Cut inside the last frame, and after the first frame
+	for _, n := range []int{len(file) - 100, len(file) / 2} {
+		_, err = probeAudio(bytes.NewReader(file[:n]), ".flac")
+		assert.ErrorIs(t, err, ErrTruncatedAudio)
+	}
+}
+
+func TestProbeWAV(t *testing.T) {
+	fmtChunk := join(le16(1), le16(2), le32(44100), le32(44100*4), le16(4), le16(16))
+	file := join([]byte("RIFF"), le32(0), []byte("WAVE"),
+		riffChunk("LIST", []byte("INFOjunk!")),
+		riffChunk("fmt ", fmtChunk),
+		riffChunk("data", make([]byte, 44100*4*2)))
+
+	info, err := probeAudio(bytes.NewReader(file), ".wav")
+	require.NoError(t, err)
+	assert.InDelta(t, 2.0, info.Duration, 0.001)
+	assert.Equal(t, 44100, info.SampleRate)
+	assert.Equal(t, 16, info.BitDepth)
+	assert.Equal(t, 2, info.Channels)
+	assert.Equal(t, 1411, info.Bitrate)
+	assert.Equal(t, "pcm", info.Codec)
+
+	_, err = probeAudio(bytes.NewReader(file[:len(file)-1000]), ".wav")
+	assert.ErrorIs(t, err, ErrTruncatedAudio)
+}
+
+func TestProbeOgg_Opus(t *testing.T) {
+	head := join([]byte("OpusHead"), []byte{1, 2}, le16(312), le32(44100), le16(0), []byte{0})
+	file := join(
+		oggPageBytes(0, 7, head),
+		oggPageBytes(0, 7, []byte("OpusTags")),
+		oggPageBytes(48000, 7, make([]byte, 200)),
+		oggPageBytes(3*48000+312, 7, make([]byte, 200)),
+		// A page of another logical stream must not count
+		oggPageBytes(10*48000, 9, make([]byte, 10)),
+	)
+
+	info, err := probeAudio(bytes.NewReader(file), ".ogg")
+	require.NoError(t, err)
+	assert.InDelta(t, 3.0, info.Duration, 0.001)
+	assert.Equal(t, 48000, info.SampleRate)
+	assert.Equal(t, 2, info.Channels)
+}
+
+func TestProbeOgg_Vorbis(t *testing.T) {
+	ident := join([]byte("\x01vorbis"), le32(0), []byte{1}, le32(22050), le32(0), le32(64000), le32(0), []byte{0xb8, 1})
+	file := join(oggPageBytes(0, 1, ident), oggPageBytes(22050*5, 1, make([]byte, 100)))
+
+	info, err := probeAudio(bytes.NewReader(file), ".ogg")
+	require.NoError(t, err)
+	assert.InDelta(t, 5.0, info.Duration, 0.001)
+	assert.Equal(t, 22050, info.SampleRate)
+	assert.Equal(t, 1, info.Channels)
+}
+
+func TestProbeMP4(t *testing.T) {
+	mvhd := mp4BoxBytes("mvhd", []byte{0, 0, 0, 0}, be32(0), be32(0), be32(1000), be32(99000), make([]byte, 80))
+	// Version 1 mdhd with a 44.1 kHz time scale
+	mdhd := mp4BoxBytes("mdhd", []byte{1, 0, 0, 0}, make([]byte, 16), be32(44100), binary.BigEndian.AppendUint64(nil, 44100*185), make([]byte, 4))
+	hdlr := mp4BoxBytes("hdlr", make([]byte, 8), []byte("soun"), make([]byte, 13))
+	entry := mp4BoxBytes("alac", make([]byte, 6), be16(1), make([]byte, 8), be16(2), be16(24), be16(0), be16(0), be32(48000<<16))
+	stsd := mp4BoxBytes("stsd", be32(0), be32(1), entry)
+	trak := mp4BoxBytes("trak", mp4BoxBytes("tkhd", make([]byte, 84)),
+		mp4BoxBytes("mdia", mdhd, hdlr, mp4BoxBytes("minf", mp4BoxBytes("stbl", stsd))))
+	mdat := mp4BoxBytes("mdat", make([]byte, 1000))
+	// moov after mdat, as written by encoders that do not optimize for streaming
+	file := join(mp4BoxBytes("ftyp", []byte("M4A "), be32(0)), mdat, mp4BoxBytes("moov", mvhd, trak))
+
+	info, err := probeAudio(bytes.NewReader(file), ".m4a")
+	require.NoError(t, err)
+	assert.InDelta(t, 185.0, info.Duration, 0.001)
+	assert.Equal(t, 48000, info.SampleRate)
+	assert.Equal(t, 2, info.Channels)
+	assert.Equal(t, 24, info.BitDepth)
+	assert.Equal(t, "alac", info.Codec)
+
+	_, err = probeAudio(bytes.NewReader(file[:len(file)-10]), ".m4a")
+	assert.ErrorIs(t, err, ErrTruncatedAudio)
+}
+
+func TestProbeMP3_VBRHeaders(t *testing.T) {
+	id3 := join([]byte("ID3"), []byte{4, 0, 0}, []byte{0, 0, 0, 10}, make([]byte, 10))
+	xing := join([]byte("Xing"), be32(3), be32(1000), be32(2*417))
+	file := join(id3, mp3Frame(xing), mp3Frame(nil))
+
+	info, err := probeAudio(bytes.NewReader(file), ".mp3")
+	require.NoError(t, err)
+	assert.InDelta(t, 1000*1152/44100.0, info.Duration, 0.001)
+	assert.Equal(t, 44100, info.SampleRate)
+	assert.Equal(t, 2, info.Channels)
+	assert.Equal(t, "mp3", info.Codec)
+
+	// A Xing byte count past the end of the file means it was cut short
+	short := join(id3, mp3Frame(join([]byte("Xing"), be32(3), be32(1000), be32(500000))), mp3Frame(nil))
+	_, err = probeAudio(bytes.NewReader(short), ".mp3")
+	assert.ErrorIs(t, err, ErrTruncatedAudio)
+
+	frame := mp3Frame(nil)
+	copy(frame[36:], join([]byte("VBRI"), be16(1), be16(0), be16(75), be32(417), be32(2000)))
+	info, err = probeAudio(bytes.NewReader(frame), ".mp3")
+	require.NoError(t, err)
+	assert.InDelta(t, 2000*1152/44100.0, info.Duration, 0.001)
+}
@@ -0,0 +1,163 @@
+package service
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+)
+
+// AudioValidation reports whether an upload's content matches its declared
+// format and can be probed.
+type AudioValidation struct {
+	DeclaredFormat string
+	DetectedFormat string // empty when the content is not a supported audio format
+	ContentType    string // sniffed MIME type, describes non-audio content such as text/html
+	Info           AudioInfo
+	Problems       []string
+}
+
+func (v *AudioValidation) Valid() bool {
+	return len(v.Problems) == 0
+}
+
+// InvalidAudioError is returned when an upload fails validation.
+type InvalidAudioError struct {
+	Report AudioValidation
+}
+
+func (e *InvalidAudioError) Error() string {
+	if len(e.Report.Problems) == 0 {
+		return "invalid audio file"
+	}
+	return "invalid audio file: " + e.Report.Problems[0]
+}
+
+// sniffLen is how much of the file is read to detect its format.
+const sniffLen = 64 * 1024
+
+// ValidateAudio detects the format of r from its content, checks it against
+// declared (a format as returned by utils.GetFileFormat, may be empty) and probes
+// the stream for truncation and codec parameters. r is left at an unspecified offset.
+func ValidateAudio(r io.ReadSeeker, declared string) AudioValidation {
+	v := AudioValidation{DeclaredFormat: declared}
+	head, err := readHead(r, 0)
+	if err != nil {
+		v.Problems = append(v.Problems, fmt.Sprintf("could not read file: %v", err))
+		return v
+	}
+	if len(head) == 0 {
+		v.Problems = append(v.Problems, "file is empty")
+		return v
+	}
+	v.ContentType = http.DetectContentType(head)
+	if v.DetectedFormat, err = sniffAudioFormat(r, head); err != nil {
+		v.Problems = append(v.Problems, fmt.Sprintf("could not read file: %v", err))
+		return v
+	}
+
+	switch {
+	case v.DetectedFormat == "":
+		v.Problems = append(v.Problems, fmt.Sprintf("content is not a supported audio format (detected %s)", v.ContentType))
+		return v
+	case declared != "" && !sameAudioFormat(declared, v.DetectedFormat):
+		v.Problems = append(v.Problems, fmt.Sprintf("content is %s, not %s", v.DetectedFormat, declared))
+		return v
+	}
+
+	info, err := probeAudio(r, "."+v.DetectedFormat)
+	v.Info = info
+	switch {
+	case errors.Is(err, ErrTruncatedAudio):
+		v.Problems = append(v.Problems, "file is truncated")
+	case err != nil:
+		v.Problems = append(v.Problems, err.Error())
+	case info.Duration <= 0:
+		v.Problems = append(v.Problems, "audio has no duration")
+	}
+	return v
+}
+
+// readHead reads up to sniffLen bytes of r from off.
+func readHead(r io.ReadSeeker, off int64) ([]byte, error) {
+	if _, err := r.Seek(off, io.SeekStart); err != nil {
+		return nil, err
+	}
+	head := make([]byte, sniffLen)
+	n, err := io.ReadFull(r, head)
+	if err == io.ErrUnexpectedEOF || err == io.EOF {
+		err = nil
+	}
+	return head[:n], err
+}
+
+// sniffAudioFormat returns the format of r from its content, or "" if it is not
+// one we store. head is the start of r as returned by readHead.
+func sniffAudioFormat(r io.ReadSeeker, head []byte) (string, error) {
+	if len(head) >= 12 {
+		switch {
+		case (bytes.HasPrefix(head, []byte("RIFF")) || bytes.HasPrefix(head, []byte("RF64"))) && string(head[8:12]) == "WAVE":
+			return "wav", nil
+		case string(head[4:8]) == "ftyp":
+			return "m4a", nil
+		}
+	}
+	if bytes.HasPrefix(head, []byte("OggS")) {
+		return "ogg", nil
+	}
+
+	// FLAC and MP3 may both start with an ID3v2 tag, which can hold cover art
+	// larger than head
+	if start := id3v2Size(r); start > 0 {
+		var err error
+		if head, err = readHead(r, start); err != nil {
+			return "", err
+		}
+	}
+	if bytes.HasPrefix(head, []byte("fLaC")) {
+		return "flac", nil
+	}
+	if findMP3Sync(head) >= 0 {
+		return "mp3", nil
+	}
+	return "", nil
+}
+
+// findMP3Sync returns the offset of the first MPEG audio frame in b that is
+// followed by another valid frame (or the end of b), -1 if there is none. A single
+// sync word is too weak a signal, it turns up by chance in text and binary files.
+func findMP3Sync(b []byte) int {
+	// Only a little padding or junk is expected before the first frame
+	limit := min(len(b), 8*1024)
+	for i := 0; i+4 <= limit; i++ {
+		h, ok := parseMP3Header(b[i:])
+		if !ok {
+			continue
+		}
+		next := i + h.frameLength()
+		if next == len(b) {
+			return i
+		}
+		if next+4 > len(b) {
+			continue
+		}
+		if n, ok := parseMP3Header(b[next:]); ok && n.version == h.version && n.layer == h.layer && n.sampleRate == h.sampleRate {
+			return i
+		}
+	}
+	return -1
+}
+
+func sameAudioFormat(declared, detected string) bool {
+	if declared == detected {
+		return true
+	}
+	switch declared {
+	case "mp4", "m4a":
+		return detected == "m4a"
+	case "opus", "oga":
+		return detected == "ogg"
+	}
+	return false
+}
@@ -0,0 +1,70 @@
+package service
+
+import (
+	"bytes"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestValidateAudio_HTMLSavedAsMP3(t *testing.T) {
+	page := []byte("<!DOCTYPE html><html><head><title>502 Bad Gateway</title></head><body>nginx</body></html>")
+
+	v := ValidateAudio(bytes.NewReader(page), "mp3")
+	assert.False(t, v.Valid())
+	assert.Empty(t, v.DetectedFormat)
+	assert.Equal(t, "text/html; charset=utf-8", v.ContentType)
+	assert.Len(t, v.Problems, 1)
+}
+
+func TestValidateAudio_FormatMismatch(t *testing.T) {
+	fmtChunk := join(le16(1), le16(2), le32(44100), le32(44100*4), le16(4), le16(16))
+	wav := join([]byte("RIFF"), le32(0), []byte("WAVE"), riffChunk("fmt ", fmtChunk), riffChunk("data", make([]byte, 44100*4)))
+
+	v := ValidateAudio(bytes.NewReader(wav), "flac")
+	assert.False(t, v.Valid())
+	assert.Equal(t, "wav", v.DetectedFormat)
+	assert.Equal(t, []string{"content is wav, not flac"}, v.Problems)
+
+	v = ValidateAudio(bytes.NewReader(wav), "wav")
+	assert.True(t, v.Valid(), v.Problems)
+	assert.Equal(t, "pcm", v.Info.Codec)
+
+	v = ValidateAudio(bytes.NewReader(wav[:len(wav)-100]), "wav")
+	assert.Equal(t, []string{"file is truncated"}, v.Problems)
+}
+
+func TestValidateAudio_MP3(t *testing.T) {
+	id3 := join([]byte("ID3"), []byte{4, 0, 0}, []byte{0, 0, 0, 10}, make([]byte, 10))
+	file := join(id3, mp3Frame(nil), mp3Frame(nil), mp3Frame(nil))
+
+	v := ValidateAudio(bytes.NewReader(file), "mp3")
+	assert.True(t, v.Valid(), v.Problems)
+	assert.Equal(t, "mp3", v.Info.Codec)
+
+	// A lone sync word in otherwise random data is not an MP3 stream
+	junk := make([]byte, 2000)
+	copy(junk[100:], []byte{0xFF, 0xFB, 0x90, 0x00})
+	v = ValidateAudio(bytes.NewReader(junk), "mp3")
+	assert.False(t, v.Valid())
+	assert.Empty(t, v.DetectedFormat)
+}
+
+func TestValidateAudio_FLACBadStreamInfo(t *testing.T) {
+	// STREAMINFO with a zero sample rate
+	info := make([]byte, 34)
+	copy(info, be16(4096))
+	copy(info[2:], be16(4096))
+	file := join([]byte("fLaC"), []byte{0x80, 0, 0, 34}, info)
+
+	v := ValidateAudio(bytes.NewReader(file), "flac")
+	assert.Equal(t, "flac", v.DetectedFormat)
+	assert.False(t, v.Valid())
+}
+
+func TestValidateAudio_FLAC(t *testing.T) {
+	v := ValidateAudio(bytes.NewReader(flacFile(t, 2)), "flac")
+	assert.True(t, v.Valid(), v.Problems)
+	assert.Equal(t, "flac", v.DetectedFormat)
+	assert.Equal(t, 44100, v.Info.SampleRate)
+}
@@ -0,0 +1,19 @@
+package service
+
+import (
+	"path/filepath"
+	"testing"
+
+	"github.com/ProjectDistribute/distributor/db"
+	"github.com/stretchr/testify/require"
+	"gorm.io/driver/sqlite"
+	"gorm.io/gorm"
+)
+
+// newTestDB opens a migrated database in a temporary directory of t.
+func newTestDB(t *testing.T) *gorm.DB {
+	gdb, err := gorm.Open(sqlite.Open(filepath.Join(t.TempDir(), "test.db")), &gorm.Config{})
+	require.NoError(t, err)
+	require.NoError(t, db.AutoMigrate(gdb))
+	return gdb
+}
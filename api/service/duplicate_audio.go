@@ -0,0 +1,153 @@
+package service
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"os"
+
+	"github.com/ProjectDistribute/distributor/model"
+	"github.com/google/uuid"
+)
+
+// Duplicate audio policies, set with the duplicate_audio_policy setting. They apply
+// when the audio of a new file is identical to a file of another song; a second
+// identical file for the same song is always refused.
+const (
+	// DuplicateAudioLink stores the audio once and lets both files share it.
+	DuplicateAudioLink = "link"
+	// DuplicateAudioReject refuses the new file.
+	DuplicateAudioReject = "reject"
+)
+
+func ValidateDuplicateAudioPolicy(policy string) error {
+	switch policy {
+	case DuplicateAudioLink, DuplicateAudioReject:
+		return nil
+	}
+	return fmt.Errorf("must be one of %s, %s", DuplicateAudioLink, DuplicateAudioReject)
+}
+
+// DuplicateFileError is returned when a new file is refused because its audio is
+// identical to that of Existing.
+type DuplicateFileError struct {
+	Existing model.SongFile
+}
+
+func (e *DuplicateFileError) Error() string {
+	return fmt.Sprintf("identical audio is already stored as file %s of song %s", e.Existing.ID, e.Existing.SongID)
+}
+
+// DuplicateAudio is a set of songs with files of identical audio.
+type DuplicateAudio struct {
+	SHA256 string
+	Songs  []model.Song
+	Files  []model.SongFile
+}
+
+// DuplicateAudioPolicy returns the configured policy, link if none is set.
+func (s *SongService) DuplicateAudioPolicy() string {
+	if s.Settings == nil {
+		return DuplicateAudioLink
+	}
+	policy, err := s.Settings.Get("duplicate_audio_policy")
+	if err != nil || ValidateDuplicateAudioPolicy(policy) != nil {
+		return DuplicateAudioLink
+	}
+	return policy
+}
+
+// resolveDuplicate looks for stored audio identical to sf. It returns the file sf
+// should share its audio with, nil if there is none, or a DuplicateFileError if sf
+// must be refused.
+func (s *SongService) resolveDuplicate(sf *model.SongFile) (*model.SongFile, error) {
+	existing, err := s.Store.GetSongFilesBySHA256(sf.SHA256)
+	if err != nil || len(existing) == 0 {
+		return nil, err
+	}
+	for _, f := range existing {
+		if f.SongID == sf.SongID {
+			return nil, &DuplicateFileError{Existing: f}
+		}
+	}
+	if s.DuplicateAudioPolicy() == DuplicateAudioReject {
+		return nil, &DuplicateFileError{Existing: existing[0]}
+	}
+	for i := range existing {
+		if !existing[i].Corrupt {
+			return &existing[i], nil
+		}
+	}
+	// Every stored copy is corrupt, keep the new one
+	return nil, nil
+}
+
+// FindDuplicateAudio lists the songs that share identical audio.
+func (s *SongService) FindDuplicateAudio() ([]DuplicateAudio, error) {
+	files, err := s.Store.GetSharedAudioFiles()
+	if err != nil {
+		return nil, err
+	}
+
+	var groups []DuplicateAudio
+	var songIDs []uuid.UUID
+	for _, f := range files {
+		if len(groups) == 0 || groups[len(groups)-1].SHA256 != f.SHA256 {
+			groups = append(groups, DuplicateAudio{SHA256: f.SHA256})
+		}
+		g := &groups[len(groups)-1]
+		g.Files = append(g.Files, f)
+		songIDs = append(songIDs, f.SongID)
+	}
+	if len(groups) == 0 {
+		return groups, nil
+	}
+
+	songs, err := s.Store.GetSongsByIDs(songIDs)
+	if err != nil {
+		return nil, err
+	}
+	byID := make(map[uuid.UUID]model.Song, len(songs))
+	for _, song := range songs {
+		byID[song.ID] = song
+	}
+	for i := range groups {
+		seen := make(map[uuid.UUID]bool)
+		for _, f := range groups[i].Files {
+			if song, ok := byID[f.SongID]; ok && !seen[f.SongID] {
+				seen[f.SongID] = true
+				groups[i].Songs = append(groups[i].Songs, song)
+			}
+		}
+	}
+	return groups, nil
+}
+
+// HashFile returns the hex encoded SHA-256 of the local file at path.
+func HashFile(path string) (string, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return "", err
+	}
+	defer f.Close()
+	return HashReader(f)
+}
+
+// HashStoredFile returns the hex encoded SHA-256 of the file at path in storage.
+func HashStoredFile(storage FileStorage, path string) (string, error) {
+	f, err := storage.Open(path)
+	if err != nil {
+		return "", err
+	}
+	defer f.Close()
+	return HashReader(f)
+}
+
+func HashReader(r io.Reader) (string, error) {
+	h := sha256.New()
+	if _, err := io.Copy(h, r); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(h.Sum(nil)), nil
+}
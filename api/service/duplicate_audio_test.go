@@ -0,0 +1,128 @@
+package service
+
+import (
+	"bytes"
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/ProjectDistribute/distributor/model"
+	"github.com/ProjectDistribute/distributor/store"
+	"github.com/ProjectDistribute/distributor/utils"
+	"github.com/google/uuid"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"gorm.io/gorm"
+)
+
+func newTestSongService(t *testing.T) (*SongService, *gorm.DB) {
+	gdb := newTestDB(t)
+	return &SongService{
+		Store:    store.NewSongStore(gdb),
+		Storage:  utils.LocalFileStorage{Root: t.TempDir()},
+		Settings: store.NewSettingsStore(gdb),
+	}, gdb
+}
+
+func addTestSong(t *testing.T, svc *SongService, title string) *model.Song {
+	song := &model.Song{Title: title}
+	require.NoError(t, svc.Store.CreateSong(song))
+	return song
+}
+
+// addStoredSongFile stores audio as a file of song.
+func addStoredSongFile(t *testing.T, svc *SongService, song *model.Song, audio []byte) *model.SongFile {
+	hash, err := HashReader(bytes.NewReader(audio))
+	require.NoError(t, err)
+	sf := &model.SongFile{ID: uuid.New(), SongID: song.ID, Format: "flac", SHA256: hash}
+	require.NoError(t, svc.Storage.Save(sf.FilePath(), bytes.NewReader(audio)))
+	require.NoError(t, svc.Store.CreateSongFile(sf))
+	return sf
+}
+
+func writeSourceFile(t *testing.T, audio []byte) string {
+	path := filepath.Join(t.TempDir(), "upload.flac")
+	require.NoError(t, os.WriteFile(path, audio, 0o644))
+	return path
+}
+
+func TestResolveDuplicate(t *testing.T) {
+	svc, gdb := newTestSongService(t)
+	audio := flacFile(t, 2)
+	hash, err := HashReader(bytes.NewReader(audio))
+	require.NoError(t, err)
+
+	owner := addTestSong(t, svc, "Owner")
+	other := addTestSong(t, svc, "Other")
+	stored := addStoredSongFile(t, svc, owner, audio)
+
+	// Unknown audio is kept
+	blob, err := svc.resolveDuplicate(&model.SongFile{SongID: other.ID, SHA256: "unknown"})
+	require.NoError(t, err)
+	assert.Nil(t, blob)
+
+	// Another song links to the stored copy
+	blob, err = svc.resolveDuplicate(&model.SongFile{SongID: other.ID, SHA256: hash})
+	require.NoError(t, err)
+	require.NotNil(t, blob)
+	assert.Equal(t, stored.ID, blob.ID)
+
+	// The same song never gets the audio twice, whatever the policy
+	_, err = svc.resolveDuplicate(&model.SongFile{SongID: owner.ID, SHA256: hash})
+	var dup *DuplicateFileError
+	require.ErrorAs(t, err, &dup)
+	assert.Equal(t, stored.ID, dup.Existing.ID)
+
+	// A corrupt stored copy is not linked to
+	require.NoError(t, gdb.Model(stored).UpdateColumn("corrupt", true).Error)
+	blob, err = svc.resolveDuplicate(&model.SongFile{SongID: other.ID, SHA256: hash})
+	require.NoError(t, err)
+	assert.Nil(t, blob)
+
+	require.NoError(t, svc.Settings.Set("duplicate_audio_policy", DuplicateAudioReject))
+	_, err = svc.resolveDuplicate(&model.SongFile{SongID: other.ID, SHA256: hash})
+	require.ErrorAs(t, err, &dup)
+}
+
+func TestAssignFileToSongByPath_DuplicatePolicy(t *testing.T) {
+	svc, _ := newTestSongService(t)
+	audio := flacFile(t, 2)
+	stored := addStoredSongFile(t, svc, addTestSong(t, svc, "Owner"), audio)
+	song := addTestSong(t, svc, "Copy")
+
+	require.NoError(t, svc.Settings.Set("duplicate_audio_policy", DuplicateAudioReject))
+	source := writeSourceFile(t, audio)
+	_, err := svc.AssignFileToSongByPath(song.ID, source)
+	var dup *DuplicateFileError
+	require.ErrorAs(t, err, &dup)
+	assert.FileExists(t, source, "a rejected duplicate keeps its source")
+
+	require.NoError(t, svc.Settings.Set("duplicate_audio_policy", DuplicateAudioLink))
+	sf, err := svc.AssignFileToSongByPath(song.ID, source)
+	require.NoError(t, err)
+	require.NotNil(t, sf.BlobID)
+	assert.Equal(t, stored.ID, *sf.BlobID)
+	assert.Equal(t, stored.FilePath(), sf.FilePath())
+	assert.NotZero(t, sf.Duration)
+	assert.NoFileExists(t, source, "a linked duplicate drops its source")
+	assert.False(t, svc.Storage.Exists("storage/songs/"+sf.ID.String()+".flac"))
+}
+
+func TestAssignFileToSongByPath_LinkKeepsSourceOnFailure(t *testing.T) {
+	svc, gdb := newTestSongService(t)
+	audio := flacFile(t, 2)
+	addStoredSongFile(t, svc, addTestSong(t, svc, "Owner"), audio)
+	song := addTestSong(t, svc, "Copy")
+
+	require.NoError(t, gdb.Callback().Create().Before("gorm:create").Register("test:fail_song_files", func(tx *gorm.DB) {
+		if tx.Statement.Table == "song_files" {
+			_ = tx.AddError(errors.New("disk full"))
+		}
+	}))
+
+	source := writeSourceFile(t, audio)
+	_, err := svc.AssignFileToSongByPath(song.ID, source)
+	require.Error(t, err)
+	assert.FileExists(t, source, "the source must survive a failed assignment")
+}
@@ -0,0 +1,233 @@
+package service
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"strings"
+
+	"github.com/ProjectDistribute/distributor/model"
+	"github.com/ProjectDistribute/distributor/store"
+	"github.com/google/uuid"
+)
+
+var (
+	ErrGenreExists      = errors.New("a genre with this name already exists")
+	ErrInvalidGenreKind = errors.New("invalid genre kind")
+)
+
+// GenreInput names a genre, mood or tag. Kind defaults to genre.
+type GenreInput struct {
+	Name string `json:"name" validate:"required" example:"Shoegaze"`
+	Kind string `json:"kind" example:"genre" enums:"genre,mood,tag"`
+}
+
+type GenreService struct {
+	Store      *store.GenreStore
+	SongStore  *store.SongStore
+	AlbumStore *store.AlbumStore
+	SearchSvc  *SearchService
+}
+
+// SplitGenreTag splits an embedded genre tag holding several genres, separated by
+// semicolons or NUL as in ID3v2.4.
+func SplitGenreTag(raw string) []string {
+	var names []string
+	for _, part := range strings.FieldsFunc(raw, func(r rune) bool { return r == ';' || r == 0 }) {
+		if name := strings.TrimSpace(part); name != "" {
+			names = append(names, name)
+		}
+	}
+	return names
+}
+
+// normalizeGenres trims names, defaults kinds and drops duplicates.
+func normalizeGenres(inputs []GenreInput) ([]GenreInput, error) {
+	seen := make(map[string]bool)
+	var out []GenreInput
+	for _, in := range inputs {
+		in.Name = strings.Join(strings.Fields(in.Name), " ")
+		if in.Kind == "" {
+			in.Kind = model.GenreKindGenre
+		}
+		if !model.ValidGenreKind(in.Kind) {
+			return nil, fmt.Errorf("%w %q", ErrInvalidGenreKind, in.Kind)
+		}
+		key := in.Kind + "\x00" + strings.ToLower(in.Name)
+		if in.Name == "" || seen[key] {
+			continue
+		}
+		seen[key] = true
+		out = append(out, in)
+	}
+	return out, nil
+}
+
+// ResolveGenres finds each genre by name and kind, creating the ones that do not exist.
+func (s *GenreService) ResolveGenres(inputs []GenreInput) ([]model.Genre, error) {
+	inputs, err := normalizeGenres(inputs)
+	if err != nil {
+		return nil, err
+	}
+	genres := []model.Genre{}
+	for _, in := range inputs {
+		genre, err := s.Store.GetGenreByName(in.Name, in.Kind)
+		if err != nil {
+			return nil, err
+		}
+		if genre == nil {
+			genre = &model.Genre{Name: in.Name, Kind: in.Kind}
+			if err := s.Store.CreateGenre(genre); err != nil {
+				return nil, err
+			}
+		}
+		genres = append(genres, *genre)
+	}
+	return genres, nil
+}
+
+func (s *GenreService) CreateGenre(name, kind string) (*model.Genre, error) {
+	inputs, err := normalizeGenres([]GenreInput{{Name: name, Kind: kind}})
+	if err != nil {
+		return nil, err
+	}
+	if len(inputs) == 0 {
+		return nil, fmt.Errorf("name is required")
+	}
+	existing, err := s.Store.GetGenreByName(inputs[0].Name, inputs[0].Kind)
+	if err != nil {
+		return nil, err
+	}
+	if existing != nil {
+		return nil, ErrGenreExists
+	}
+	genre := &model.Genre{Name: inputs[0].Name, Kind: inputs[0].Kind}
+	if err := s.Store.CreateGenre(genre); err != nil {
+		return nil, err
+	}
+	return genre, nil
+}
+
+// UpdateGenre renames a genre or changes its kind, empty fields are left as they are.
+// Its songs and albums are re-indexed under the new name.
+func (s *GenreService) UpdateGenre(id uuid.UUID, name, kind string) (*model.Genre, error) {
+	genre, err := s.Store.GetGenreByID(id)
+	if err != nil {
+		return nil, err
+	}
+	in := GenreInput{Name: genre.Name, Kind: genre.Kind}
+	if strings.TrimSpace(name) != "" {
+		in.Name = name
+	}
+	if kind != "" {
+		in.Kind = kind
+	}
+	inputs, err := normalizeGenres([]GenreInput{in})
+	if err != nil {
+		return nil, err
+	}
+	existing, err := s.Store.GetGenreByName(inputs[0].Name, inputs[0].Kind)
+	if err != nil {
+		return nil, err
+	}
+	if existing != nil && existing.ID != genre.ID {
+		return nil, ErrGenreExists
+	}
+	genre.Name = inputs[0].Name
+	genre.Kind = inputs[0].Kind
+	if err := s.Store.UpdateGenre(genre); err != nil {
+		return nil, err
+	}
+	s.reindexGenre(genre.ID)
+	return genre, nil
+}
+
+func (s *GenreService) DeleteGenre(id uuid.UUID) error {
+	genre, err := s.Store.GetGenreByID(id)
+	if err != nil {
+		return err
+	}
+	songIDs, albumIDs, err := s.Store.GetGenreUsage(id)
+	if err != nil {
+		return err
+	}
+	if err := s.Store.DeleteGenre(genre); err != nil {
+		return err
+	}
+	s.reindex(songIDs, albumIDs)
+	return nil
+}
+
+// SetSongGenres replaces the genres, moods and tags of a song.
+func (s *GenreService) SetSongGenres(songID uuid.UUID, inputs []GenreInput) (*model.Song, error) {
+	song, err := s.SongStore.GetSongByID(songID)
+	if err != nil {
+		return nil, err
+	}
+	genres, err := s.ResolveGenres(inputs)
+	if err != nil {
+		return nil, err
+	}
+	if err := s.Store.ReplaceSongGenres(song, genres); err != nil {
+		return nil, err
+	}
+	songs, err := s.SongStore.GetSongsByIDs([]uuid.UUID{song.ID})
+	if err != nil || len(songs) == 0 {
+		return nil, fmt.Errorf("failed to reload song: %v", err)
+	}
+	if err := s.SearchSvc.IndexSong(&songs[0]); err != nil {
+		log.Printf("Error re-indexing song %s: %v\n", song.ID, err)
+	}
+	return &songs[0], nil
+}
+
+// SetAlbumGenres replaces the genres, moods and tags of an album.
+func (s *GenreService) SetAlbumGenres(albumID uuid.UUID, inputs []GenreInput) (*model.Album, error) {
+	album, err := s.AlbumStore.GetAlbumByID(albumID)
+	if err != nil {
+		return nil, err
+	}
+	genres, err := s.ResolveGenres(inputs)
+	if err != nil {
+		return nil, err
+	}
+	if err := s.Store.ReplaceAlbumGenres(album, genres); err != nil {
+		return nil, err
+	}
+	album.Genres = genres
+	if err := s.SearchSvc.IndexAlbum(album); err != nil {
+		log.Printf("Error re-indexing album %s: %v\n", album.ID, err)
+	}
+	return album, nil
+}
+
+// reindexGenre re-indexes everything a genre is set on.
+func (s *GenreService) reindexGenre(id uuid.UUID) {
+	songIDs, albumIDs, err := s.Store.GetGenreUsage(id)
+	if err != nil {
+		log.Printf("Error listing songs and albums of genre %s: %v\n", id, err)
+		return
+	}
+	s.reindex(songIDs, albumIDs)
+}
+
+func (s *GenreService) reindex(songIDs, albumIDs []uuid.UUID) {
+	if len(songIDs) > 0 {
+		songs, err := s.SongStore.GetSongsByIDs(songIDs)
+		if err == nil {
+			err = s.SearchSvc.IndexSongs(songs)
+		}
+		if err != nil {
+			log.Printf("Error re-indexing songs: %v\n", err)
+		}
+	}
+	if len(albumIDs) > 0 {
+		albums, err := s.AlbumStore.GetAlbumsByIDs(albumIDs)
+		if err == nil {
+			err = s.SearchSvc.IndexAlbums(albums)
+		}
+		if err != nil {
+			log.Printf("Error re-indexing albums: %v\n", err)
+		}
+	}
+}
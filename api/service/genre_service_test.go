@@ -0,0 +1,70 @@
+package service
+
+import (
+	"testing"
+
+	"github.com/ProjectDistribute/distributor/model"
+	"github.com/ProjectDistribute/distributor/store"
+	"github.com/google/uuid"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func newTestGenreService(t *testing.T) *GenreService {
+	gdb := newTestDB(t)
+	return &GenreService{
+		Store:      store.NewGenreStore(gdb),
+		SongStore:  store.NewSongStore(gdb),
+		AlbumStore: store.NewAlbumStore(gdb),
+	}
+}
+
+func TestSplitGenreTag(t *testing.T) {
+	assert.Equal(t, []string{"Rock", "Hip-Hop/Rap", "Folk, World, & Country"}, SplitGenreTag(" Rock;Hip-Hop/Rap\x00Folk, World, & Country; "))
+	assert.Empty(t, SplitGenreTag(""))
+}
+
+func TestResolveGenres_ReusesByNameAndKind(t *testing.T) {
+	svc := newTestGenreService(t)
+
+	first, err := svc.ResolveGenres([]GenreInput{{Name: "Dream  Pop"}, {Name: "dream pop"}, {Name: "Dream Pop", Kind: model.GenreKindMood}})
+	require.NoError(t, err)
+	require.Len(t, first, 2)
+	assert.Equal(t, "Dream Pop", first[0].Name)
+	assert.Equal(t, model.GenreKindGenre, first[0].Kind)
+	assert.Equal(t, model.GenreKindMood, first[1].Kind)
+
+	again, err := svc.ResolveGenres([]GenreInput{{Name: "DREAM POP"}})
+	require.NoError(t, err)
+	assert.Equal(t, first[0].ID, again[0].ID)
+
+	_, err = svc.ResolveGenres([]GenreInput{{Name: "Loud", Kind: "vibe"}})
+	assert.ErrorIs(t, err, ErrInvalidGenreKind)
+
+	_, err = svc.CreateGenre("dream pop", "")
+	assert.ErrorIs(t, err, ErrGenreExists)
+}
+
+func TestDeleteGenre_DetachesSongsAndAlbums(t *testing.T) {
+	svc := newTestGenreService(t)
+	genres, err := svc.ResolveGenres([]GenreInput{{Name: "Shoegaze"}})
+	require.NoError(t, err)
+	album, err := svc.AlbumStore.CreateAlbum(&model.Album{Title: "Loveless"})
+	require.NoError(t, err)
+	song := &model.Song{Title: "Only Shallow", AlbumID: album.ID}
+	require.NoError(t, svc.SongStore.CreateSong(song))
+	require.NoError(t, svc.Store.ReplaceSongGenres(song, genres))
+	require.NoError(t, svc.Store.ReplaceAlbumGenres(album, genres))
+
+	counts, err := svc.Store.GetGenreCounts([]uuid.UUID{genres[0].ID})
+	require.NoError(t, err)
+	assert.Equal(t, store.GenreCounts{Songs: 1, Albums: 1}, counts[genres[0].ID])
+
+	require.NoError(t, svc.Store.DeleteGenre(&genres[0]))
+	songs, err := svc.SongStore.GetSongsByIDs([]uuid.UUID{song.ID})
+	require.NoError(t, err)
+	assert.Empty(t, songs[0].Genres)
+	reloaded, err := svc.AlbumStore.GetAlbumByID(album.ID)
+	require.NoError(t, err)
+	assert.Empty(t, reloaded.Genres)
+}
@@ -0,0 +1,327 @@
+package service
+
+import (
+	"errors"
+	"fmt"
+	"image"
+	"io/fs"
+	"log"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/ProjectDistribute/distributor/utils"
+	"github.com/fsnotify/fsnotify"
+	"github.com/google/uuid"
+)
+
+const QuarantineDir = "storage/quarantine"
+
+// coverWaitLimit is how long a cover image may wait in the inbox for an audio file
+// from the same directory before it is quarantined.
+const coverWaitLimit = 10 * time.Minute
+
+type inboxEntry struct {
+	firstSeen  time.Time
+	lastChange time.Time
+	size       int64
+	modTime    time.Time
+}
+
+// InboxWatcher ingests audio and cover files dropped into a directory once they stop changing.
+type InboxWatcher struct {
+	Dir        string
+	SettleTime time.Duration
+	Library    *LibraryService
+	Storage    FileStorage
+
+	mu        sync.Mutex
+	pending   map[string]*inboxEntry
+	dirAlbums map[string]uuid.UUID
+	watcher   *fsnotify.Watcher
+}
+
+func NewInboxWatcher(dir string, settle time.Duration, library *LibraryService, storage FileStorage) *InboxWatcher {
+	return &InboxWatcher{
+		Dir:        filepath.Clean(dir),
+		SettleTime: settle,
+		Library:    library,
+		Storage:    storage,
+		pending:    make(map[string]*inboxEntry),
+		dirAlbums:  make(map[string]uuid.UUID),
+	}
+}
+
+// Start begins watching Dir recursively. Files already present are queued as well.
+func (w *InboxWatcher) Start() error {
+	if err := os.MkdirAll(w.Dir, 0o755); err != nil {
+		return err
+	}
+	watcher, err := fsnotify.NewWatcher()
+	if err != nil {
+		return err
+	}
+	w.watcher = watcher
+
+	if err := w.addTree(w.Dir); err != nil {
+		watcher.Close()
+		return err
+	}
+
+	go w.loop()
+	log.Printf("[inbox] Watching %s (settle time %s)\n", w.Dir, w.SettleTime)
+	return nil
+}
+
+// addTree watches dir and all of its subdirectories and queues the files inside them.
+func (w *InboxWatcher) addTree(dir string) error {
+	return filepath.WalkDir(dir, func(path string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return nil
+		}
+		if d.IsDir() {
+			if err := w.watcher.Add(path); err != nil {
+				log.Printf("[inbox] Failed to watch %s: %v\n", path, err)
+			}
+			return nil
+		}
+		w.touch(path)
+		return nil
+	})
+}
+
+func (w *InboxWatcher) loop() {
+	ticker := time.NewTicker(time.Second)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case event, ok := <-w.watcher.Events:
+			if !ok {
+				return
+			}
+			w.handleEvent(event)
+		case err, ok := <-w.watcher.Errors:
+			if !ok {
+				return
+			}
+			log.Printf("[inbox] Watcher error: %v\n", err)
+		case <-ticker.C:
+			w.processSettled()
+		}
+	}
+}
+
+func (w *InboxWatcher) handleEvent(event fsnotify.Event) {
+	if event.Has(fsnotify.Remove) || event.Has(fsnotify.Rename) {
+		w.mu.Lock()
+		delete(w.pending, event.Name)
+		w.mu.Unlock()
+		return
+	}
+	if !event.Has(fsnotify.Create) && !event.Has(fsnotify.Write) {
+		return
+	}
+
+	info, err := os.Stat(event.Name)
+	if err != nil {
+		return
+	}
+	if info.IsDir() {
+		if err := w.addTree(event.Name); err != nil {
+			log.Printf("[inbox] Failed to watch new directory %s: %v\n", event.Name, err)
+		}
+		return
+	}
+	w.touch(event.Name)
+}
+
+func (w *InboxWatcher) touch(path string) {
+	if strings.HasPrefix(filepath.Base(path), ".") {
+		return
+	}
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	now := time.Now()
+	if e, ok := w.pending[path]; ok {
+		e.lastChange = now
+		return
+	}
+	w.pending[path] = &inboxEntry{firstSeen: now, lastChange: now, size: -1}
+}
+
+// processSettled ingests every pending file whose size and modification time
+// have not changed for SettleTime. Audio is handled before covers so that a
+// directory's album is known by the time its cover is processed.
+func (w *InboxWatcher) processSettled() {
+	now := time.Now()
+	var settled []string
+
+	w.mu.Lock()
+	for path, e := range w.pending {
+		info, err := os.Stat(path)
+		if err != nil {
+			delete(w.pending, path)
+			continue
+		}
+		if info.Size() != e.size || !info.ModTime().Equal(e.modTime) {
+			e.size = info.Size()
+			e.modTime = info.ModTime()
+			e.lastChange = now
+			continue
+		}
+		if now.Sub(e.lastChange) >= w.SettleTime {
+			settled = append(settled, path)
+		}
+	}
+	w.mu.Unlock()
+
+	sort.Slice(settled, func(i, j int) bool {
+		ai, aj := isAudioPath(settled[i]), isAudioPath(settled[j])
+		if ai != aj {
+			return ai
+		}
+		return settled[i] < settled[j]
+	})
+
+	for _, path := range settled {
+		if w.ingest(path) {
+			w.mu.Lock()
+			delete(w.pending, path)
+			w.mu.Unlock()
+		}
+	}
+}
+
+// ingest processes a settled file and reports whether it is done with it.
+func (w *InboxWatcher) ingest(path string) bool {
+	switch {
+	case isAudioPath(path):
+		w.ingestAudio(path)
+		return true
+	case isCoverPath(path):
+		return w.ingestCover(path)
+	case isImagePath(path):
+		// Album covers are stored and served as JPEG only
+		w.quarantine(path, "unsupported cover format, covers must be JPEG")
+		return true
+	default:
+		log.Printf("[inbox] Ignoring %s: not an audio or cover file\n", path)
+		return true
+	}
+}
+
+func (w *InboxWatcher) ingestAudio(path string) {
+	res, err := w.Library.ImportFile(path)
+	if errors.Is(err, ErrAlreadyImported) {
+		w.quarantine(path, fmt.Sprintf("song %s already has a %s file", res.Song.ID, res.File.Format))
+		return
+	}
+	if err != nil {
+		w.quarantine(path, err.Error())
+		return
+	}
+
+	w.mu.Lock()
+	w.dirAlbums[filepath.Dir(path)] = res.Song.AlbumID
+	w.mu.Unlock()
+
+	log.Printf("[inbox] Imported %s as song %s (%s), file %s\n", path, res.Song.ID, res.Song.Title, res.File.ID)
+	w.removeIfEmpty(filepath.Dir(path))
+}
+
+func (w *InboxWatcher) ingestCover(path string) bool {
+	dir := filepath.Dir(path)
+
+	w.mu.Lock()
+	albumID, ok := w.dirAlbums[dir]
+	entry := w.pending[path]
+	w.mu.Unlock()
+
+	if !ok {
+		if entry != nil && time.Since(entry.firstSeen) > coverWaitLimit {
+			w.quarantine(path, "no audio file from the same directory was imported")
+			return true
+		}
+		// Wait for an audio file from this directory to tell us the album
+		return false
+	}
+
+	// AssignAlbumCoverByPath moves the file before decoding it, so reject broken images up front
+	format, err := checkImage(path)
+	if err != nil {
+		w.quarantine(path, "unreadable cover image: "+err.Error())
+		return true
+	}
+	if format != "jpeg" {
+		w.quarantine(path, "unsupported cover format "+format+", covers must be JPEG")
+		return true
+	}
+	if err := w.Library.AlbumSvc.AssignAlbumCoverByPath(albumID, path, "jpg"); err != nil {
+		w.quarantine(path, "failed to assign cover: "+err.Error())
+		return true
+	}
+	log.Printf("[inbox] Assigned %s as cover of album %s\n", path, albumID)
+	w.removeIfEmpty(dir)
+	return true
+}
+
+// quarantine moves a file that could not be ingested out of the inbox, next to a note explaining why.
+func (w *InboxWatcher) quarantine(path string, reason string) {
+	dst := filepath.Join(QuarantineDir, time.Now().Format("20060102-150405")+"_"+filepath.Base(path))
+	if err := w.Storage.Move(path, dst); err != nil {
+		log.Printf("[inbox] Failed to quarantine %s (%s): %v\n", path, reason, err)
+		return
+	}
+	_ = w.Storage.Save(dst+".reason.txt", strings.NewReader(reason+"\n"))
+	log.Printf("[inbox] Quarantined %s as %s: %s\n", path, dst, reason)
+	w.removeIfEmpty(filepath.Dir(path))
+}
+
+// removeIfEmpty cleans up directories left behind in the inbox, never the inbox itself.
+func (w *InboxWatcher) removeIfEmpty(dir string) {
+	if filepath.Clean(dir) == w.Dir {
+		return
+	}
+	entries, err := os.ReadDir(dir)
+	if err != nil || len(entries) > 0 {
+		return
+	}
+	if err := os.Remove(dir); err == nil {
+		w.mu.Lock()
+		delete(w.dirAlbums, dir)
+		w.mu.Unlock()
+	}
+}
+
+// checkImage returns the format of the image at path as detected from its content.
+func checkImage(path string) (string, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return "", err
+	}
+	defer f.Close()
+	_, format, err := image.DecodeConfig(f)
+	return format, err
+}
+
+func isAudioPath(path string) bool {
+	return utils.IsAudioFormat(strings.TrimPrefix(filepath.Ext(path), "."))
+}
+
+func isCoverPath(path string) bool {
+	ext := strings.ToLower(filepath.Ext(path))
+	return ext == ".jpg" || ext == ".jpeg"
+}
+
+// isImagePath matches images that could be meant as a cover but are not JPEG.
+func isImagePath(path string) bool {
+	switch strings.ToLower(filepath.Ext(path)) {
+	case ".png", ".gif", ".webp", ".bmp", ".tif", ".tiff", ".heic", ".avif":
+		return true
+	}
+	return false
+}
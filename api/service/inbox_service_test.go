@@ -0,0 +1,123 @@
+package service
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/ProjectDistribute/distributor/utils"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+const testSettleTime = 50 * time.Millisecond
+
+func newTestInboxWatcher(t *testing.T) *InboxWatcher {
+	library := newTestLibraryService(t)
+	return NewInboxWatcher(t.TempDir(), testSettleTime, library, library.SongSvc.Storage)
+}
+
+// drop writes a file into the inbox and reports it to the watcher like fsnotify would.
+func dropInboxFile(t *testing.T, w *InboxWatcher, name string, data []byte) string {
+	path := filepath.Join(w.Dir, name)
+	require.NoError(t, os.MkdirAll(filepath.Dir(path), 0o755))
+	require.NoError(t, os.WriteFile(path, data, 0o644))
+	w.touch(path)
+	return path
+}
+
+// settleInbox runs the watcher until the files dropped so far have been unchanged for the settle time.
+func settleInbox(w *InboxWatcher) {
+	w.processSettled()
+	time.Sleep(testSettleTime)
+	w.processSettled()
+}
+
+func pendingCount(w *InboxWatcher) int {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	return len(w.pending)
+}
+
+func quarantined(t *testing.T, w *InboxWatcher, name string) []string {
+	matches, err := filepath.Glob(filepath.Join(w.Storage.(utils.LocalFileStorage).FullPath(QuarantineDir), "*_"+name+"*"))
+	require.NoError(t, err)
+	return matches
+}
+
+func TestInboxWatcher_WaitsForFilesToSettle(t *testing.T) {
+	w := newTestInboxWatcher(t)
+	audio := taggedFLAC(t, "ARTIST=Band", "ALBUM=Record", "TITLE=Track")
+
+	// Still being copied
+	path := dropInboxFile(t, w, "Track.flac", audio[:len(audio)/2])
+	w.processSettled()
+	time.Sleep(testSettleTime)
+	f, err := os.OpenFile(path, os.O_APPEND|os.O_WRONLY, 0)
+	require.NoError(t, err)
+	_, err = f.Write(audio[len(audio)/2:])
+	require.NoError(t, err)
+	require.NoError(t, f.Close())
+
+	w.processSettled()
+	assert.FileExists(t, path, "a file that changed since the last check is not ingested")
+	assert.Equal(t, 1, pendingCount(w))
+
+	time.Sleep(testSettleTime)
+	w.processSettled()
+	assert.NoFileExists(t, path)
+	assert.Zero(t, pendingCount(w))
+	assert.Empty(t, quarantined(t, w, "Track.flac"))
+
+	songs, err := w.Library.SongSvc.Store.GetAllSongs()
+	require.NoError(t, err)
+	require.Len(t, songs, 1)
+	assert.Equal(t, "Track", songs[0].Title)
+}
+
+func TestInboxWatcher_AudioBeforeCover(t *testing.T) {
+	w := newTestInboxWatcher(t)
+	// The cover sorts first, but needs the album of the audio file
+	cover := dropInboxFile(t, w, "Record/cover.jpg", testJPEG(t))
+	track := dropInboxFile(t, w, "Record/track.flac", taggedFLAC(t, "ARTIST=Band", "ALBUM=Record", "TITLE=Track"))
+
+	settleInbox(w)
+	assert.NoFileExists(t, cover)
+	assert.NoFileExists(t, track)
+	assert.NoDirExists(t, filepath.Join(w.Dir, "Record"), "emptied directories are removed")
+	assert.Zero(t, pendingCount(w))
+
+	songs, err := w.Library.SongSvc.Store.GetAllSongs()
+	require.NoError(t, err)
+	require.Len(t, songs, 1)
+	assert.True(t, w.Library.AlbumSvc.AlbumHasCover(songs[0].AlbumID, "jpg"))
+}
+
+func TestInboxWatcher_Quarantine(t *testing.T) {
+	w := newTestInboxWatcher(t)
+	broken := dropInboxFile(t, w, "Bad/broken.flac", []byte("<html>not audio</html>"))
+	png := dropInboxFile(t, w, "Record/art.png", testPNG(t))
+	disguised := dropInboxFile(t, w, "Record/cover.jpg", testPNG(t))
+	dropInboxFile(t, w, "Record/track.flac", taggedFLAC(t, "ARTIST=Band", "ALBUM=Record", "TITLE=Track"))
+
+	settleInbox(w)
+	assert.Zero(t, pendingCount(w))
+	for _, path := range []string{broken, png, disguised} {
+		assert.NoFileExists(t, path)
+		name := filepath.Base(path)
+		matches := quarantined(t, w, name)
+		require.Len(t, matches, 2, "%s and its reason", name)
+		reason, err := os.ReadFile(matches[1])
+		require.NoError(t, err)
+		assert.NotEmpty(t, reason)
+	}
+	reason, err := os.ReadFile(quarantined(t, w, "cover.jpg")[1])
+	require.NoError(t, err)
+	assert.Contains(t, string(reason), "covers must be JPEG")
+
+	songs, err := w.Library.SongSvc.Store.GetAllSongs()
+	require.NoError(t, err)
+	require.Len(t, songs, 1)
+	assert.False(t, w.Library.AlbumSvc.AlbumHasCover(songs[0].AlbumID, "jpg"))
+}
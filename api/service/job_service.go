@@ -0,0 +1,197 @@
+package service
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"sort"
+	"sync"
+	"time"
+)
+
+var ErrJobRunning = errors.New("job is already running")
+
+type JobStatus string
+
+const (
+	JobStatusRunning   JobStatus = "running"
+	JobStatusCompleted JobStatus = "completed"
+	JobStatusFailed    JobStatus = "failed"
+)
+
+// maxJobErrors caps how many per-item errors a job keeps around for the admin panel.
+const maxJobErrors = 100
+
+// Job tracks the progress of a long-running background task.
+type Job struct {
+	mu sync.RWMutex
+
+	name       string
+	status     JobStatus
+	total      int
+	processed  int
+	failed     int
+	skipped    int
+	errors     []string
+	message    string
+	startedAt  time.Time
+	finishedAt *time.Time
+}
+
+// JobSnapshot is a point-in-time copy of a Job, safe to serialize.
+type JobSnapshot struct {
+	Name       string     `json:"name"`
+	Status     JobStatus  `json:"status"`
+	Total      int        `json:"total"`
+	Processed  int        `json:"processed"`
+	Failed     int        `json:"failed"`
+	Skipped    int        `json:"skipped"`
+	Errors     []string   `json:"errors"`
+	Message    string     `json:"message,omitempty"`
+	StartedAt  time.Time  `json:"started_at"`
+	FinishedAt *time.Time `json:"finished_at,omitempty"`
+}
+
+func (j *Job) SetTotal(total int) {
+	j.mu.Lock()
+	defer j.mu.Unlock()
+	j.total = total
+}
+
+func (j *Job) AddTotal(n int) {
+	j.mu.Lock()
+	defer j.mu.Unlock()
+	j.total += n
+}
+
+func (j *Job) Advance() {
+	j.mu.Lock()
+	defer j.mu.Unlock()
+	j.processed++
+}
+
+func (j *Job) Skip() {
+	j.mu.Lock()
+	defer j.mu.Unlock()
+	j.processed++
+	j.skipped++
+}
+
+func (j *Job) Fail(item string, err error) {
+	j.mu.Lock()
+	defer j.mu.Unlock()
+	j.processed++
+	j.failed++
+	if len(j.errors) < maxJobErrors {
+		j.errors = append(j.errors, fmt.Sprintf("%s: %v", item, err))
+	}
+}
+
+func (j *Job) SetMessage(msg string) {
+	j.mu.Lock()
+	defer j.mu.Unlock()
+	j.message = msg
+}
+
+func (j *Job) Running() bool {
+	j.mu.RLock()
+	defer j.mu.RUnlock()
+	return j.status == JobStatusRunning
+}
+
+func (j *Job) Snapshot() JobSnapshot {
+	j.mu.RLock()
+	defer j.mu.RUnlock()
+	errs := make([]string, len(j.errors))
+	copy(errs, j.errors)
+	return JobSnapshot{
+		Name:       j.name,
+		Status:     j.status,
+		Total:      j.total,
+		Processed:  j.processed,
+		Failed:     j.failed,
+		Skipped:    j.skipped,
+		Errors:     errs,
+		Message:    j.message,
+		StartedAt:  j.startedAt,
+		FinishedAt: j.finishedAt,
+	}
+}
+
+func (j *Job) finish(err error) {
+	j.mu.Lock()
+	defer j.mu.Unlock()
+	now := time.Now()
+	j.finishedAt = &now
+	if err != nil {
+		j.status = JobStatusFailed
+		j.message = err.Error()
+		return
+	}
+	j.status = JobStatusCompleted
+}
+
+// JobService runs named background jobs, at most one instance per name.
+type JobService struct {
+	mu   sync.Mutex
+	jobs map[string]*Job
+}
+
+func NewJobService() *JobService {
+	return &JobService{jobs: make(map[string]*Job)}
+}
+
+// Start launches run in the background under the given name.
+// It returns ErrJobRunning if a job with the same name has not finished yet.
+func (s *JobService) Start(name string, run func(job *Job) error) (*Job, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if existing, ok := s.jobs[name]; ok && existing.Running() {
+		return existing, ErrJobRunning
+	}
+
+	job := &Job{
+		name:      name,
+		status:    JobStatusRunning,
+		errors:    []string{},
+		startedAt: time.Now(),
+	}
+	s.jobs[name] = job
+
+	go func() {
+		log.Printf("Job %s started\n", name)
+		err := run(job)
+		job.finish(err)
+		snap := job.Snapshot()
+		if err != nil {
+			log.Printf("Job %s failed: %v\n", name, err)
+		} else {
+			log.Printf("Job %s completed: %d processed, %d failed, %d skipped\n", name, snap.Processed, snap.Failed, snap.Skipped)
+		}
+	}()
+
+	return job, nil
+}
+
+func (s *JobService) Get(name string) *Job {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.jobs[name]
+}
+
+func (s *JobService) List() []JobSnapshot {
+	s.mu.Lock()
+	jobs := make([]*Job, 0, len(s.jobs))
+	for _, j := range s.jobs {
+		jobs = append(jobs, j)
+	}
+	s.mu.Unlock()
+
+	snaps := make([]JobSnapshot, len(jobs))
+	for i, j := range jobs {
+		snaps[i] = j.Snapshot()
+	}
+	sort.Slice(snaps, func(a, b int) bool { return snaps[a].StartedAt.After(snaps[b].StartedAt) })
+	return snaps
+}
@@ -0,0 +1,238 @@
+package service
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/ProjectDistribute/distributor/model"
+	"github.com/ProjectDistribute/distributor/store"
+	"github.com/ProjectDistribute/distributor/utils"
+	"github.com/google/uuid"
+)
+
+var ErrAlreadyImported = errors.New("song already has a file in this format")
+
+// DefaultLibraryScanPath is used when the library_scan_path setting is empty.
+const DefaultLibraryScanPath = "storage/downloads"
+
+// coverFileNames are picked up from an imported file's directory when the file has no embedded artwork.
+var coverFileNames = []string{"cover.jpg", "folder.jpg", "front.jpg"}
+
+type LibraryService struct {
+	SongSvc  *SongService
+	AlbumSvc *AlbumService
+	GenreSvc *GenreService
+	Settings *store.SettingsStore
+
+	// importMu serializes imports so concurrent scans and inbox events
+	// cannot create the same song or album twice.
+	importMu sync.Mutex
+}
+
+type ImportResult struct {
+	Song    *model.Song
+	File    *model.SongFile
+	Created bool // true if the song did not exist before the import
+}
+
+// ScanPath returns the configured directory the library scanner walks.
+func (s *LibraryService) ScanPath() string {
+	path, err := s.Settings.Get("library_scan_path")
+	if err != nil || strings.TrimSpace(path) == "" {
+		return DefaultLibraryScanPath
+	}
+	return path
+}
+
+// ImportFile reads the tags of the audio file at path, resolves its artists and album,
+// creates the song if needed and moves the file into song storage.
+func (s *LibraryService) ImportFile(path string) (*ImportResult, error) {
+	s.importMu.Lock()
+	defer s.importMu.Unlock()
+
+	format := strings.ToLower(strings.TrimPrefix(filepath.Ext(path), "."))
+	if !utils.IsAudioFormat(format) {
+		return nil, fmt.Errorf("unsupported file format: %s", format)
+	}
+
+	tags, err := ReadTags(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read tags: %w", err)
+	}
+
+	artistNames := tags.ArtistNames()
+	if len(artistNames) == 0 {
+		return nil, fmt.Errorf("missing artist tag")
+	}
+	if tags.Album == "" {
+		return nil, fmt.Errorf("missing album tag")
+	}
+
+	// Validate before anything is created, AssignFileToSongByPath deletes files it cannot probe
+	report, err := s.SongSvc.ValidateAudioFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read file: %w", err)
+	}
+	if !report.Valid() {
+		return nil, &InvalidAudioError{Report: report}
+	}
+
+	artistsInput := make([]SongCreationArtist, len(artistNames))
+	for i, name := range artistNames {
+		artistsInput[i] = SongCreationArtist{Name: name, Identifier: utils.Slugify(name)}
+	}
+
+	albumID := uuid.Nil
+	if tags.AlbumArtist != "" || tags.Compilation {
+		album, err := s.albumFromTags(tags)
+		if err != nil {
+			return nil, err
+		}
+		albumID = album.ID
+	}
+
+	title := tags.TitleOrFilename(path)
+	created := true
+	song, err := s.SongSvc.CreateSong(title, artistsInput, tags.Album, albumID, tags.TrackNumber, tags.DiscNumber)
+	if err != nil {
+		if song == nil {
+			return nil, err
+		}
+		// Song already exists, only attach the file if that format is missing
+		created = false
+		files, err := s.SongSvc.GetSongFiles(song.ID)
+		if err != nil {
+			return nil, err
+		}
+		for _, f := range files {
+			if strings.EqualFold(f.Format, format) {
+				return &ImportResult{Song: song, File: &f}, ErrAlreadyImported
+			}
+		}
+	}
+
+	sf, err := s.SongSvc.AssignFileToSongByPath(song.ID, path)
+	if err != nil {
+		if created {
+			_ = s.SongSvc.DeleteSong(song.ID)
+		}
+		return nil, err
+	}
+
+	if genres := SplitGenreTag(tags.Genre); len(genres) > 0 {
+		if err := s.importGenres(song, created, genres); err != nil {
+			log.Printf("Failed to import genres for song %s: %v\n", song.ID, err)
+		}
+	}
+
+	if song.AlbumID != uuid.Nil && !s.AlbumSvc.AlbumHasCover(song.AlbumID, "jpg") {
+		if err := s.importCover(song.AlbumID, filepath.Dir(path), tags); err != nil {
+			log.Printf("Failed to import cover for album %s: %v\n", song.AlbumID, err)
+		}
+	}
+
+	return &ImportResult{Song: song, File: sf, Created: created}, nil
+}
+
+// albumFromTags finds or creates the album of a file tagged with an album artist or
+// as part of a compilation, so tracks by different artists end up on the same album.
+func (s *LibraryService) albumFromTags(tags *AudioTags) (*model.Album, error) {
+	albumType := model.AlbumTypeAlbum
+	if tags.Compilation || tags.AlbumArtist == model.VariousArtists {
+		albumType = model.AlbumTypeCompilation
+	}
+	var artists []model.Artist
+	if tags.AlbumArtist != "" && tags.AlbumArtist != model.VariousArtists {
+		var err error
+		artists, err = s.SongSvc.ArtistSvc.ResolveArtists([]SongCreationArtist{{Name: tags.AlbumArtist, Identifier: utils.Slugify(tags.AlbumArtist)}})
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	var album *model.Album
+	if len(artists) > 0 {
+		found, err := s.AlbumSvc.FindAlbum(tags.Album, artists)
+		if err != nil {
+			return nil, err
+		}
+		album = found
+	} else {
+		albums, err := s.AlbumSvc.Store.GetAlbumsByTitle(tags.Album)
+		if err != nil {
+			return nil, err
+		}
+		for i := range albums {
+			if albums[i].Type == model.AlbumTypeCompilation && len(albums[i].AlbumArtists) == 0 {
+				album = &albums[i]
+				break
+			}
+		}
+	}
+	if album == nil {
+		return s.AlbumSvc.CreateAlbum(tags.Album, time.Time{}, albumType, artists)
+	}
+
+	// Albums created before their album artist was known get it from the tags
+	if len(album.AlbumArtists) == 0 && len(artists) > 0 {
+		if err := s.AlbumSvc.Store.ReplaceAlbumArtists(album, artists); err != nil {
+			return nil, err
+		}
+	}
+	return album, nil
+}
+
+// importGenres sets the tagged genres on a new song, and on its album unless a curator
+// or an earlier import already gave it genres.
+func (s *LibraryService) importGenres(song *model.Song, created bool, names []string) error {
+	inputs := make([]GenreInput, len(names))
+	for i, name := range names {
+		inputs[i] = GenreInput{Name: name, Kind: model.GenreKindGenre}
+	}
+	if created {
+		if _, err := s.GenreSvc.SetSongGenres(song.ID, inputs); err != nil {
+			return err
+		}
+	}
+	if song.AlbumID == uuid.Nil {
+		return nil
+	}
+	album, err := s.AlbumSvc.GetAlbumByID(song.AlbumID)
+	if err != nil {
+		return err
+	}
+	if len(album.Genres) == 0 {
+		_, err = s.GenreSvc.SetAlbumGenres(album.ID, inputs)
+	}
+	return err
+}
+
+// importCover stores embedded JPEG artwork, or a cover image found next to the audio file.
+// The sibling image is copied rather than moved since other tracks of the album may still need it.
+func (s *LibraryService) importCover(albumID uuid.UUID, dir string, tags *AudioTags) error {
+	if len(tags.Picture) > 0 && tags.PictureMIMEType == "image/jpeg" {
+		return s.AlbumSvc.WriteAlbumCover(albumID, bytes.NewReader(tags.Picture), albumID.String(), "jpg")
+	}
+
+	for _, name := range coverFileNames {
+		path := filepath.Join(dir, name)
+		// Covers are stored as JPEG, whatever the name of the file says
+		if format, err := checkImage(path); err != nil || format != "jpeg" {
+			continue
+		}
+		f, err := os.Open(path)
+		if err != nil {
+			continue
+		}
+		defer f.Close()
+		return s.AlbumSvc.WriteAlbumCover(albumID, f, albumID.String(), "jpg")
+	}
+	return nil
+}
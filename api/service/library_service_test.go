@@ -0,0 +1,108 @@
+package service
+
+import (
+	"bytes"
+	"image"
+	"image/jpeg"
+	"image/png"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/ProjectDistribute/distributor/store"
+	"github.com/ProjectDistribute/distributor/utils"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func newTestLibraryService(t *testing.T) *LibraryService {
+	gdb := newTestDB(t)
+	search, _ := NewSearchService()
+	storage := utils.LocalFileStorage{Root: t.TempDir()}
+	settings := store.NewSettingsStore(gdb)
+	artists := &ArtistService{Store: store.NewArtistStore(gdb), SearchSvc: search}
+	albums := &AlbumService{Store: store.NewAlbumStore(gdb), Storage: storage, SearchSvc: search}
+	songs := &SongService{Store: store.NewSongStore(gdb), Storage: storage, ArtistSvc: artists, AlbumSvc: albums, SearchSvc: search, Settings: settings}
+	genres := &GenreService{Store: store.NewGenreStore(gdb), SongStore: songs.Store, AlbumStore: albums.Store, SearchSvc: search}
+	return &LibraryService{SongSvc: songs, AlbumSvc: albums, GenreSvc: genres, Settings: settings}
+}
+
+// taggedFLAC is a valid FLAC file with the given Vorbis comments.
+func taggedFLAC(t *testing.T, comments ...string) []byte {
+	file := flacFile(t, 2)
+	// STREAMINFO is no longer the last metadata block
+	head := append([]byte{}, file[:42]...)
+	head[4] &^= 0x80
+	return join(head, flacBlock(4, true, vorbisComments(comments...)), file[42:])
+}
+
+func testJPEG(t *testing.T) []byte {
+	var buf bytes.Buffer
+	require.NoError(t, jpeg.Encode(&buf, image.NewRGBA(image.Rect(0, 0, 16, 16)), nil))
+	return buf.Bytes()
+}
+
+func testPNG(t *testing.T) []byte {
+	var buf bytes.Buffer
+	require.NoError(t, png.Encode(&buf, image.NewRGBA(image.Rect(0, 0, 16, 16))))
+	return buf.Bytes()
+}
+
+func TestImportFile_UppercaseExtension(t *testing.T) {
+	svc := newTestLibraryService(t)
+	path := filepath.Join(t.TempDir(), "01 Track.FLAC")
+	require.NoError(t, os.WriteFile(path, taggedFLAC(t, "ARTIST=Band", "ALBUM=Record", "TITLE=Track", "TRACKNUMBER=1"), 0o644))
+
+	res, err := svc.ImportFile(path)
+	require.NoError(t, err)
+	assert.True(t, res.Created)
+	assert.Equal(t, "Track", res.Song.Title)
+	assert.Equal(t, "flac", res.File.Format)
+	assert.True(t, svc.SongSvc.Storage.Exists(res.File.FilePath()))
+	assert.NoFileExists(t, path)
+
+	_, err = svc.ImportFile(path)
+	assert.Error(t, err)
+}
+
+func TestImportFile_InvalidAudioCreatesNothing(t *testing.T) {
+	svc := newTestLibraryService(t)
+	path := filepath.Join(t.TempDir(), "Track.FLAC")
+	tagged := taggedFLAC(t, "ARTIST=Band", "ALBUM=Record")
+	// Cut in the middle of the first frame
+	firstFrame := len(tagged) - (len(flacFile(t, 2)) - 42)
+	require.NoError(t, os.WriteFile(path, tagged[:firstFrame+16], 0o644))
+
+	_, err := svc.ImportFile(path)
+	var invalid *InvalidAudioError
+	require.ErrorAs(t, err, &invalid)
+	assert.FileExists(t, path)
+
+	artists, err := svc.SongSvc.ArtistSvc.Store.GetAllArtists()
+	require.NoError(t, err)
+	assert.Empty(t, artists)
+}
+
+func TestImportFile_DirectoryCover(t *testing.T) {
+	tests := []struct {
+		name      string
+		cover     []byte
+		wantCover bool
+	}{
+		{"jpeg", testJPEG(t), true},
+		{"png named jpg", testPNG(t), false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			svc := newTestLibraryService(t)
+			dir := t.TempDir()
+			path := filepath.Join(dir, "Track.flac")
+			require.NoError(t, os.WriteFile(path, taggedFLAC(t, "ARTIST=Band", "ALBUM=Record"), 0o644))
+			require.NoError(t, os.WriteFile(filepath.Join(dir, "cover.jpg"), tt.cover, 0o644))
+
+			res, err := svc.ImportFile(path)
+			require.NoError(t, err)
+			assert.Equal(t, tt.wantCover, svc.AlbumSvc.AlbumHasCover(res.Song.AlbumID, "jpg"))
+		})
+	}
+}
@@ -0,0 +1,291 @@
+package service
+
+import (
+	"fmt"
+	"log"
+	"math"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// LimiterStore holds the state of a LoginLimiter: token buckets, failure counts and
+// locks, each under a key such as "ip:203.0.113.7". MemoryLimiterStore keeps it in
+// the process; a store backed by a shared cache lets several instances enforce the
+// same limits.
+type LimiterStore interface {
+	// Take takes a token from the bucket of key, which holds up to burst tokens and
+	// gains one every interval. If the bucket is empty it returns how long until the
+	// next token.
+	Take(key string, burst int, interval time.Duration) (bool, time.Duration)
+	// Fail records a failed attempt and returns the number of failures of key, not
+	// counting failures older than window.
+	Fail(key string, window time.Duration) int
+	// Reset forgets the failures and the lock of key.
+	Reset(key string)
+	Lock(key string, d time.Duration)
+	// LockedFor returns how long key stays locked, or 0.
+	LockedFor(key string) time.Duration
+	Locks() []Lockout
+}
+
+// Lockout is a username or IP address that is currently locked out.
+type Lockout struct {
+	Key         string    `json:"key" example:"ip:203.0.113.7"`
+	LockedUntil time.Time `json:"locked_until"`
+	Failures    int       `json:"failures" example:"7"`
+}
+
+// RateLimitError is returned when an attempt is throttled or locked out.
+type RateLimitError struct {
+	RetryAfter time.Duration
+	// Locked is set when the attempt was refused because of repeated failures.
+	Locked bool
+}
+
+func (e *RateLimitError) Error() string {
+	if e.Locked {
+		return fmt.Sprintf("too many failed attempts, locked for %s", e.RetryAfter.Round(time.Second))
+	}
+	return fmt.Sprintf("too many attempts, retry in %s", e.RetryAfter.Round(time.Second))
+}
+
+// LoginLimiter throttles credential checks per IP address and per username with
+// token buckets, and locks either out after repeated failures. Each further failure
+// doubles the lock, up to LockoutMax.
+type LoginLimiter struct {
+	Store LimiterStore
+
+	IPBurst      int
+	IPInterval   time.Duration
+	UserBurst    int
+	UserInterval time.Duration
+	// Signups are limited per IP address only.
+	SignupBurst    int
+	SignupInterval time.Duration
+
+	// LockoutThreshold failures within FailureWindow lock the key for LockoutBase.
+	LockoutThreshold int
+	LockoutBase      time.Duration
+	LockoutMax       time.Duration
+	FailureWindow    time.Duration
+}
+
+func NewLoginLimiter(store LimiterStore) *LoginLimiter {
+	return &LoginLimiter{
+		Store:            store,
+		IPBurst:          10,
+		IPInterval:       6 * time.Second,
+		UserBurst:        5,
+		UserInterval:     12 * time.Second,
+		SignupBurst:      5,
+		SignupInterval:   2 * time.Minute,
+		LockoutThreshold: 5,
+		LockoutBase:      time.Minute,
+		LockoutMax:       time.Hour,
+		FailureWindow:    time.Hour,
+	}
+}
+
+func ipKey(ip string) string {
+	return "ip:" + ip
+}
+
+func userKey(username string) string {
+	return "user:" + strings.ToLower(username)
+}
+
+// CheckLocked refuses attempts for a locked IP address or username without taking
+// tokens, for clients such as Subsonic players that authenticate every request.
+func (l *LoginLimiter) CheckLocked(ip, username string) error {
+	locked := max(l.Store.LockedFor(ipKey(ip)), l.Store.LockedFor(userKey(username)))
+	if locked > 0 {
+		return &RateLimitError{RetryAfter: locked, Locked: true}
+	}
+	return nil
+}
+
+// AllowLogin is called before checking the password of an interactive login.
+func (l *LoginLimiter) AllowLogin(ip, username string) error {
+	if err := l.CheckLocked(ip, username); err != nil {
+		return err
+	}
+	if ok, wait := l.Store.Take(ipKey(ip), l.IPBurst, l.IPInterval); !ok {
+		return &RateLimitError{RetryAfter: wait}
+	}
+	if ok, wait := l.Store.Take(userKey(username), l.UserBurst, l.UserInterval); !ok {
+		return &RateLimitError{RetryAfter: wait}
+	}
+	return nil
+}
+
+func (l *LoginLimiter) AllowSignup(ip string) error {
+	if ok, wait := l.Store.Take("signup:"+ip, l.SignupBurst, l.SignupInterval); !ok {
+		return &RateLimitError{RetryAfter: wait}
+	}
+	return nil
+}
+
+// LoginFailed counts a wrong password or unknown username against both the IP
+// address and the username.
+func (l *LoginLimiter) LoginFailed(ip, username string) {
+	for _, key := range []string{ipKey(ip), userKey(username)} {
+		failures := l.Store.Fail(key, l.FailureWindow)
+		if failures < l.LockoutThreshold {
+			continue
+		}
+		d := l.lockoutDuration(failures)
+		l.Store.Lock(key, d)
+		log.Printf("Locked out %s for %s after %d failed logins (last from %s)\n", key, d, failures, ip)
+	}
+}
+
+// LoginSucceeded clears the failures of the username. Those of the IP address are
+// kept, so one valid account does not let an attacker reset the count.
+func (l *LoginLimiter) LoginSucceeded(username string) {
+	l.Store.Reset(userKey(username))
+}
+
+func (l *LoginLimiter) lockoutDuration(failures int) time.Duration {
+	exp := failures - l.LockoutThreshold
+	if exp > 30 {
+		return l.LockoutMax
+	}
+	return time.Duration(math.Min(float64(l.LockoutBase)*math.Pow(2, float64(exp)), float64(l.LockoutMax)))
+}
+
+// Locks lists the current lockouts, longest first.
+func (l *LoginLimiter) Locks() []Lockout {
+	locks := l.Store.Locks()
+	sort.Slice(locks, func(i, j int) bool { return locks[i].LockedUntil.After(locks[j].LockedUntil) })
+	return locks
+}
+
+// Unlock lifts the lockout of key, e.g. "user:alice" or "ip:203.0.113.7", and forgets its failures.
+func (l *LoginLimiter) Unlock(key string) {
+	l.Store.Reset(key)
+}
+
+// limiterSweepInterval is how often MemoryLimiterStore drops idle entries, and
+// limiterIdleTTL how long an entry must be idle for that.
+const (
+	limiterSweepInterval = 10 * time.Minute
+	limiterIdleTTL       = 24 * time.Hour
+)
+
+type limiterEntry struct {
+	tokens      float64
+	refilled    time.Time
+	failures    []time.Time
+	lockedUntil time.Time
+	lastSeen    time.Time
+}
+
+// MemoryLimiterStore is a LimiterStore for a single instance. Its state is lost on restart.
+type MemoryLimiterStore struct {
+	mu        sync.Mutex
+	entries   map[string]*limiterEntry
+	lastSweep time.Time
+	// now is replaced in tests.
+	now func() time.Time
+}
+
+func NewMemoryLimiterStore() *MemoryLimiterStore {
+	return &MemoryLimiterStore{entries: make(map[string]*limiterEntry), now: time.Now}
+}
+
+// entry returns the entry of key, creating it if needed. Callers hold mu.
+func (s *MemoryLimiterStore) entry(key string, now time.Time) *limiterEntry {
+	if now.Sub(s.lastSweep) > limiterSweepInterval {
+		s.lastSweep = now
+		for k, e := range s.entries {
+			if now.Sub(e.lastSeen) > limiterIdleTTL && now.After(e.lockedUntil) {
+				delete(s.entries, k)
+			}
+		}
+	}
+
+	e, ok := s.entries[key]
+	if !ok {
+		e = &limiterEntry{tokens: -1}
+		s.entries[key] = e
+	}
+	e.lastSeen = now
+	return e
+}
+
+func (s *MemoryLimiterStore) Take(key string, burst int, interval time.Duration) (bool, time.Duration) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	now := s.now()
+	e := s.entry(key, now)
+
+	if e.tokens < 0 {
+		e.tokens = float64(burst)
+	} else {
+		e.tokens = math.Min(float64(burst), e.tokens+float64(now.Sub(e.refilled))/float64(interval))
+	}
+	e.refilled = now
+
+	if e.tokens < 1 {
+		return false, time.Duration((1 - e.tokens) * float64(interval))
+	}
+	e.tokens--
+	return true, 0
+}
+
+func (s *MemoryLimiterStore) Fail(key string, window time.Duration) int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	now := s.now()
+	e := s.entry(key, now)
+
+	recent := e.failures[:0]
+	for _, t := range e.failures {
+		if now.Sub(t) < window {
+			recent = append(recent, t)
+		}
+	}
+	e.failures = append(recent, now)
+	return len(e.failures)
+}
+
+func (s *MemoryLimiterStore) Reset(key string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if e, ok := s.entries[key]; ok {
+		e.failures = nil
+		e.lockedUntil = time.Time{}
+	}
+}
+
+func (s *MemoryLimiterStore) Lock(key string, d time.Duration) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	now := s.now()
+	s.entry(key, now).lockedUntil = now.Add(d)
+}
+
+func (s *MemoryLimiterStore) LockedFor(key string) time.Duration {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	e, ok := s.entries[key]
+	if !ok {
+		return 0
+	}
+	return max(e.lockedUntil.Sub(s.now()), 0)
+}
+
+func (s *MemoryLimiterStore) Locks() []Lockout {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	now := s.now()
+	locks := []Lockout{}
+	for key, e := range s.entries {
+		if now.Before(e.lockedUntil) {
+			locks = append(locks, Lockout{Key: key, LockedUntil: e.lockedUntil, Failures: len(e.failures)})
+		}
+	}
+	return locks
+}
@@ -0,0 +1,63 @@
+package service
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func newTestLoginLimiter() (*LoginLimiter, *time.Time) {
+	now := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	store := NewMemoryLimiterStore()
+	store.now = func() time.Time { return now }
+	return NewLoginLimiter(store), &now
+}
+
+func TestLoginLimiter_TokenBucket(t *testing.T) {
+	l, now := newTestLoginLimiter()
+
+	for i := 0; i < l.UserBurst; i++ {
+		require.NoError(t, l.AllowLogin("203.0.113.7", "alice"))
+	}
+	err := l.AllowLogin("203.0.113.7", "Alice")
+	var limit *RateLimitError
+	require.ErrorAs(t, err, &limit)
+	assert.False(t, limit.Locked)
+	assert.Equal(t, l.UserInterval, limit.RetryAfter)
+
+	// Other users are not affected, and the bucket refills over time
+	assert.NoError(t, l.AllowLogin("203.0.113.7", "bob"))
+	*now = now.Add(l.UserInterval)
+	assert.NoError(t, l.AllowLogin("203.0.113.7", "alice"))
+}
+
+func TestLoginLimiter_ProgressiveLockout(t *testing.T) {
+	l, now := newTestLoginLimiter()
+
+	for i := 0; i < l.LockoutThreshold-1; i++ {
+		l.LoginFailed("203.0.113.7", "alice")
+	}
+	assert.NoError(t, l.CheckLocked("198.51.100.1", "alice"))
+
+	l.LoginFailed("203.0.113.7", "alice")
+	err := l.CheckLocked("198.51.100.1", "alice")
+	var limit *RateLimitError
+	require.ErrorAs(t, err, &limit)
+	assert.True(t, limit.Locked)
+	assert.Equal(t, l.LockoutBase, limit.RetryAfter)
+	assert.Error(t, l.CheckLocked("203.0.113.7", "bob"), "the IP address is locked too")
+	assert.Len(t, l.Locks(), 2)
+
+	// The next failure after the lock ends doubles it
+	*now = now.Add(l.LockoutBase)
+	assert.NoError(t, l.CheckLocked("198.51.100.1", "alice"))
+	l.LoginFailed("198.51.100.1", "alice")
+	require.ErrorAs(t, l.CheckLocked("198.51.100.1", "alice"), &limit)
+	assert.Equal(t, 2*l.LockoutBase, limit.RetryAfter)
+
+	l.Unlock("user:alice")
+	assert.NoError(t, l.CheckLocked("198.51.100.1", "alice"))
+	assert.Len(t, l.Locks(), 0)
+}
@@ -0,0 +1,353 @@
+package service
+
+import (
+	"context"
+	"encoding/binary"
+	"errors"
+	"io"
+	"math"
+	"time"
+
+	"github.com/ProjectDistribute/distributor/model"
+	"github.com/ProjectDistribute/distributor/store"
+)
+
+// PCM produced by a PCMDecoder: interleaved little endian float32 samples, in
+// stereo unless mono is asked for.
+const (
+	PCMSampleRate = 48000
+	PCMChannels   = 2
+)
+
+var ErrNoDecoder = errors.New("no audio decoder available")
+
+// PCMDecoder decodes the first audio stream of src (a local path or URL, see
+// TranscodeInput) to PCMSampleRate float32 PCM with channels channels, 1 or 2,
+// written to w. Other channel counts are mixed down or up.
+type PCMDecoder interface {
+	DecodePCM(ctx context.Context, src string, channels int, w io.Writer) error
+}
+
+// ReplayGainReference is the loudness track and album gains bring audio to,
+// as in ReplayGain 2.0.
+const ReplayGainReference = -18.0 // LUFS
+
+// maxReplayGain bounds track and album gains, so very quiet audio is not
+// amplified into noise.
+const maxReplayGain = 24.0 // dB
+
+// Gating thresholds of ITU-R BS.1770-4.
+const (
+	absoluteGate = -70.0 // LUFS
+	relativeGate = -10.0 // LU below the ungated loudness
+)
+
+// Loudness is the measured loudness of a track.
+type Loudness struct {
+	Integrated float64 // LUFS, absoluteGate for silence
+	TruePeak   float64 // linear, 1.0 is full scale
+
+	// blocks are the energies of the 400 ms gating blocks, kept to gate an album as a whole
+	blocks []float64
+}
+
+// Gain returns the gain in dB that brings the track to ReplayGainReference,
+// within maxReplayGain. Audio with nothing above the absolute gate, such as
+// silence, gets no gain.
+func (l *Loudness) Gain() float64 {
+	if l.Integrated <= absoluteGate {
+		return 0
+	}
+	return max(-maxReplayGain, min(maxReplayGain, ReplayGainReference-l.Integrated))
+}
+
+// AlbumLoudness gates the blocks of all tracks together, which is not the same as
+// averaging their loudness: quiet interludes do not pull the album level down.
+func AlbumLoudness(tracks []*Loudness) *Loudness {
+	album := &Loudness{}
+	for _, t := range tracks {
+		album.blocks = append(album.blocks, t.blocks...)
+		album.TruePeak = max(album.TruePeak, t.TruePeak)
+	}
+	album.Integrated = gatedLoudness(album.blocks)
+	return album
+}
+
+// MeasureLoudness reads PCMSampleRate float32 PCM with channels channels from r
+// until EOF.
+func MeasureLoudness(r io.Reader, channels int) (*Loudness, error) {
+	m := newLoudnessMeter(PCMSampleRate, channels)
+	err := readPCM(r, channels, m.add)
+	if err != nil {
+		return nil, err
+	}
+	return m.result(), nil
+}
+
+// readPCM calls fn for every frame of float32 PCM in r. A partial frame at the
+// end is dropped.
+func readPCM(r io.Reader, channels int, fn func(frame []float64)) error {
+	frameSize := 4 * channels
+	buf := make([]byte, 1024*frameSize)
+	frame := make([]float64, channels)
+	for {
+		n, err := io.ReadFull(r, buf)
+		for off := 0; off+frameSize <= n; off += frameSize {
+			for ch := range frame {
+				frame[ch] = float64(math.Float32frombits(binary.LittleEndian.Uint32(buf[off+4*ch:])))
+			}
+			fn(frame)
+		}
+		if err == io.EOF || err == io.ErrUnexpectedEOF {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+	}
+}
+
+// loudnessMeter implements the ITU-R BS.1770-4 measurement.
+type loudnessMeter struct {
+	channels []kWeighting
+	peaks    []truePeak
+
+	// energy of the current 100 ms step, and of the steps seen so far
+	step      int
+	stepLen   int
+	stepSum   float64
+	steps     []float64
+	truePeak  float64
+	blockSize int // steps per gating block
+}
+
+func newLoudnessMeter(rate, channels int) *loudnessMeter {
+	m := &loudnessMeter{
+		channels:  make([]kWeighting, channels),
+		peaks:     make([]truePeak, channels),
+		stepLen:   rate / 10,
+		blockSize: 4,
+	}
+	for i := range m.channels {
+		m.channels[i] = newKWeighting(float64(rate))
+		m.peaks[i] = newTruePeak(rate)
+	}
+	return m
+}
+
+// add processes one frame of samples, one per channel.
+func (m *loudnessMeter) add(frame []float64) {
+	for ch, x := range frame {
+		// Mono and both channels of a stereo signal have a weight of 1
+		y := m.channels[ch].filter(x)
+		m.stepSum += y * y
+		m.truePeak = max(m.truePeak, m.peaks[ch].add(x))
+	}
+	m.step++
+	if m.step == m.stepLen {
+		m.steps = append(m.steps, m.stepSum/float64(m.stepLen))
+		m.step, m.stepSum = 0, 0
+	}
+}
+
+func (m *loudnessMeter) result() *Loudness {
+	// Blocks of 400 ms overlapping by 75%
+	var blocks []float64
+	for i := 0; i+m.blockSize <= len(m.steps); i++ {
+		e := 0.0
+		for _, s := range m.steps[i : i+m.blockSize] {
+			e += s
+		}
+		blocks = append(blocks, e/float64(m.blockSize))
+	}
+	return &Loudness{Integrated: gatedLoudness(blocks), TruePeak: m.truePeak, blocks: blocks}
+}
+
+func energyToLoudness(e float64) float64 {
+	return -0.691 + 10*math.Log10(e)
+}
+
+// gatedLoudness applies the absolute and relative gates to the block energies.
+func gatedLoudness(blocks []float64) float64 {
+	mean := func(threshold float64) (float64, bool) {
+		sum, n := 0.0, 0
+		for _, e := range blocks {
+			if e > 0 && energyToLoudness(e) > threshold {
+				sum += e
+				n++
+			}
+		}
+		if n == 0 {
+			return 0, false
+		}
+		return sum / float64(n), true
+	}
+
+	ungated, ok := mean(absoluteGate)
+	if !ok {
+		return absoluteGate
+	}
+	gated, ok := mean(energyToLoudness(ungated) + relativeGate)
+	if !ok {
+		return absoluteGate
+	}
+	return energyToLoudness(gated)
+}
+
+type biquad struct {
+	b0, b1, b2, a1, a2 float64
+	z1, z2             float64
+}
+
+func (f *biquad) filter(x float64) float64 {
+	y := f.b0*x + f.z1
+	f.z1 = f.b1*x - f.a1*y + f.z2
+	f.z2 = f.b2*x - f.a2*y
+	return y
+}
+
+// kWeighting is the BS.1770 pre-filter, a high shelf followed by a high pass.
+// The coefficients are derived for the sample rate from the analog prototypes,
+// at 48 kHz they match those given in the recommendation.
+type kWeighting struct {
+	shelf, highPass biquad
+}
+
+func newKWeighting(rate float64) kWeighting {
+	var k kWeighting
+
+	f0, gain, q := 1681.974450955533, 3.999843853973347, 0.7071752369554196
+	K := math.Tan(math.Pi * f0 / rate)
+	vh := math.Pow(10, gain/20)
+	vb := math.Pow(vh, 0.4996667741545416)
+	a0 := 1 + K/q + K*K
+	k.shelf = biquad{
+		b0: (vh + vb*K/q + K*K) / a0,
+		b1: 2 * (K*K - vh) / a0,
+		b2: (vh - vb*K/q + K*K) / a0,
+		a1: 2 * (K*K - 1) / a0,
+		a2: (1 - K/q + K*K) / a0,
+	}
+
+	f0, q = 38.13547087602444, 0.5003270373238773
+	K = math.Tan(math.Pi * f0 / rate)
+	a0 = 1 + K/q + K*K
+	k.highPass = biquad{
+		b0: 1, b1: -2, b2: 1,
+		a1: 2 * (K*K - 1) / a0,
+		a2: (1 - K/q + K*K) / a0,
+	}
+	return k
+}
+
+func (k *kWeighting) filter(x float64) float64 {
+	return k.highPass.filter(k.shelf.filter(x))
+}
+
+// truePeak estimates the peak of the reconstructed signal by oversampling with a
+// windowed sinc interpolator, 4x below 96 kHz as in BS.1770 Annex 2.
+type truePeak struct {
+	phases  [][]float64 // one filter per interpolated sample
+	history []float64   // most recent sample last
+}
+
+const truePeakTaps = 12 // per phase
+
+func newTruePeak(rate int) truePeak {
+	factor := 4
+	if rate >= 96000 {
+		factor = 2
+	}
+	n := factor * truePeakTaps
+	center := float64(n-1) / 2
+	t := truePeak{phases: make([][]float64, factor), history: make([]float64, truePeakTaps)}
+	for p := range t.phases {
+		phase := make([]float64, truePeakTaps)
+		sum := 0.0
+		for k := range phase {
+			i := p + factor*k
+			x := (float64(i) - center) / float64(factor)
+			h := 1.0
+			if x != 0 {
+				h = math.Sin(math.Pi*x) / (math.Pi * x)
+			}
+			// Hann window
+			h *= 0.5 - 0.5*math.Cos(2*math.Pi*(float64(i)+0.5)/float64(n))
+			phase[k] = h
+			sum += h
+		}
+		// Unity gain for every phase so DC is not over-read
+		for k := range phase {
+			phase[k] /= sum
+		}
+		t.phases[p] = phase
+	}
+	return t
+}
+
+// add pushes x and returns the largest absolute interpolated value it produced.
+func (t *truePeak) add(x float64) float64 {
+	copy(t.history, t.history[1:])
+	t.history[len(t.history)-1] = x
+	peak := math.Abs(x)
+	for _, phase := range t.phases {
+		y := 0.0
+		for k, h := range phase {
+			y += h * t.history[len(t.history)-1-k]
+		}
+		peak = max(peak, math.Abs(y))
+	}
+	return peak
+}
+
+// LoudnessService measures song files and stores their EBU R128 loudness and
+// ReplayGain values.
+type LoudnessService struct {
+	SongStore *store.SongStore
+	Storage   FileStorage
+	Decoder   PCMDecoder // nil when no decoder is available
+}
+
+// Measure decodes file and measures its loudness.
+func (s *LoudnessService) Measure(ctx context.Context, file *model.SongFile) (*Loudness, error) {
+	if s.Decoder == nil {
+		return nil, ErrNoDecoder
+	}
+	src, err := TranscodeInput(s.Storage, file.FilePath())
+	if err != nil {
+		return nil, err
+	}
+
+	// A mono source played on two channels would read 3 LU too loud
+	channels := PCMChannels
+	if file.Channels == 1 {
+		channels = 1
+	}
+	pr, pw := io.Pipe()
+	go func() {
+		pw.CloseWithError(s.Decoder.DecodePCM(ctx, src, channels, pw))
+	}()
+	loudness, err := MeasureLoudness(pr, channels)
+	pr.Close()
+	return loudness, err
+}
+
+// Save stores the track and album loudness on file.
+func (s *LoudnessService) Save(file *model.SongFile, track, album *Loudness) error {
+	now := time.Now()
+	file.LoudnessAnalyzedAt = &now
+	file.Loudness = track.Integrated
+	file.TruePeak = linearToDB(track.TruePeak)
+	file.TrackGain = track.Gain()
+	file.AlbumGain = album.Gain()
+	file.AlbumPeak = linearToDB(album.TruePeak)
+	return s.SongStore.UpdateSongFileLoudness(file)
+}
+
+// linearToDB converts a peak to dBFS/dBTP, silence is floored to -120 dB.
+func linearToDB(v float64) float64 {
+	if v <= 1e-6 {
+		return -120
+	}
+	return 20 * math.Log10(v)
+}
@@ -0,0 +1,76 @@
+package service
+
+import (
+	"bytes"
+	"encoding/binary"
+	"math"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// sinePCM returns seconds of a stereo sine of the given frequency and amplitude as
+// PCMDecoder output, starting at an eighth of a period.
+func sinePCM(freq, amplitude, seconds float64) []byte {
+	return sinePCMChannels(freq, amplitude, seconds, PCMChannels)
+}
+
+func sinePCMChannels(freq, amplitude, seconds float64, channels int) []byte {
+	var buf bytes.Buffer
+	n := int(seconds * PCMSampleRate)
+	for i := 0; i < n; i++ {
+		v := float32(amplitude * math.Sin(2*math.Pi*freq*float64(i)/PCMSampleRate+math.Pi/4))
+		for ch := 0; ch < channels; ch++ {
+			_ = binary.Write(&buf, binary.LittleEndian, v)
+		}
+	}
+	return buf.Bytes()
+}
+
+func TestMeasureLoudness_Sine(t *testing.T) {
+	// A 997 Hz sine at -6 dBFS on both channels reads -6.02 LUFS
+	l, err := MeasureLoudness(bytes.NewReader(sinePCM(997, 0.5, 5)), PCMChannels)
+	require.NoError(t, err)
+	assert.InDelta(t, -6.02, l.Integrated, 0.05)
+	assert.InDelta(t, 0.5, l.TruePeak, 0.01)
+	assert.InDelta(t, -11.98, l.Gain(), 0.05)
+
+	// At a quarter of the sample rate every sample is at 0.354, between the peaks
+	l, err = MeasureLoudness(bytes.NewReader(sinePCM(PCMSampleRate/4, 0.5, 1)), PCMChannels)
+	require.NoError(t, err)
+	assert.InDelta(t, 0.5, l.TruePeak, 0.03)
+
+	// The same sine in mono has half the energy
+	l, err = MeasureLoudness(bytes.NewReader(sinePCMChannels(997, 0.5, 5, 1)), 1)
+	require.NoError(t, err)
+	assert.InDelta(t, -9.03, l.Integrated, 0.05)
+	assert.InDelta(t, -8.97, l.Gain(), 0.05)
+}
+
+func TestMeasureLoudness_Silence(t *testing.T) {
+	l, err := MeasureLoudness(bytes.NewReader(make([]byte, PCMSampleRate*PCMChannels*4)), PCMChannels)
+	require.NoError(t, err)
+	assert.Equal(t, absoluteGate, l.Integrated)
+	assert.Zero(t, l.TruePeak)
+	assert.Zero(t, l.Gain())
+
+	// Audio just above the gate is not amplified by more than maxReplayGain
+	l, err = MeasureLoudness(bytes.NewReader(sinePCM(997, 0.0005, 2)), PCMChannels)
+	require.NoError(t, err)
+	assert.InDelta(t, -66.02, l.Integrated, 0.05)
+	assert.Equal(t, maxReplayGain, l.Gain())
+}
+
+func TestAlbumLoudness(t *testing.T) {
+	loud, err := MeasureLoudness(bytes.NewReader(sinePCM(997, 0.5, 10)), PCMChannels)
+	require.NoError(t, err)
+	quiet, err := MeasureLoudness(bytes.NewReader(sinePCM(997, 0.05, 2)), PCMChannels)
+	require.NoError(t, err)
+	assert.InDelta(t, -26.02, quiet.Integrated, 0.05)
+
+	// The interlude is more than 10 LU below the album and gated out
+	album := AlbumLoudness([]*Loudness{loud, quiet})
+	assert.InDelta(t, loud.Integrated, album.Integrated, 0.05)
+	assert.InDelta(t, 0.5, album.TruePeak, 0.01)
+}
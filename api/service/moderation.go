@@ -0,0 +1,77 @@
+package service
+
+import (
+	"errors"
+	"log"
+	"time"
+
+	"github.com/ProjectDistribute/distributor/model"
+	"github.com/google/uuid"
+)
+
+var ErrUserBanned = errors.New("user is banned")
+
+// BanUser bans the user until the given time, or permanently if until is nil, and
+// ends all of their sessions.
+func (s *UserService) BanUser(actorID uuid.UUID, user *model.User, until *time.Time, reason string) error {
+	bannedUntil := model.PermanentBan
+	if until != nil {
+		bannedUntil = *until
+	}
+	user.BannedUntil = &bannedUntil
+	user.BanReason = reason
+	if _, err := s.Store.UpdateUser(user); err != nil {
+		return err
+	}
+	if _, err := s.RevokeAllSessions(user.ID); err != nil {
+		return err
+	}
+
+	details := reason
+	if until != nil {
+		details = "until " + until.UTC().Format(time.RFC3339) + ": " + reason
+	}
+	s.RecordAudit(actorID, model.AuditUserBanned, user.ID, details)
+	return nil
+}
+
+func (s *UserService) UnbanUser(actorID uuid.UUID, user *model.User) error {
+	user.BannedUntil = nil
+	user.BanReason = ""
+	if _, err := s.Store.UpdateUser(user); err != nil {
+		return err
+	}
+	s.RecordAudit(actorID, model.AuditUserUnbanned, user.ID, "")
+	return nil
+}
+
+// SetRole changes the role of the user. Roles are read from the database on every
+// request, so the change applies to existing sessions right away.
+func (s *UserService) SetRole(actorID uuid.UUID, user *model.User, role string) error {
+	previous := user.Role
+	if err := s.Store.SetRole(user, role); err != nil {
+		return err
+	}
+	s.RecordAudit(actorID, model.AuditUserRoleChanged, user.ID, previous+" -> "+role)
+	return nil
+}
+
+// ResetPassword sets a new password chosen by an admin and signs the user out everywhere.
+func (s *UserService) ResetPassword(actorID uuid.UUID, user *model.User, password string) error {
+	if err := s.UpdatePassword(user, password); err != nil {
+		return err
+	}
+	if _, err := s.RevokeAllSessions(user.ID); err != nil {
+		return err
+	}
+	s.RecordAudit(actorID, model.AuditUserPasswordReset, user.ID, "")
+	return nil
+}
+
+// RecordAudit stores an audit entry. Failures are logged, they never undo the action.
+func (s *UserService) RecordAudit(actorID uuid.UUID, action string, targetID uuid.UUID, details string) {
+	entry := &model.AuditEntry{ActorID: actorID, Action: action, TargetID: targetID, Details: details}
+	if err := s.Audit.CreateAuditEntry(entry); err != nil {
+		log.Printf("Failed to record audit entry %s for %s: %v\n", action, targetID, err)
+	}
+}
@@ -0,0 +1,655 @@
+package service
+
+import (
+	"context"
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"math/big"
+	"net/http"
+	"net/url"
+	"regexp"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/ProjectDistribute/distributor/model"
+	"github.com/ProjectDistribute/distributor/store"
+	"github.com/golang-jwt/jwt/v5"
+)
+
+const (
+	oidcLoginTimeout      = 10 * time.Minute
+	oidcMaxPendingLogins  = 10000
+	oidcDiscoveryTTL      = time.Hour
+	oidcJWKSRefetchPeriod = time.Minute
+)
+
+var (
+	ErrOIDCNotConfigured        = errors.New("OpenID Connect login is not configured")
+	ErrOIDCInvalidState         = errors.New("login request is unknown or has expired")
+	ErrOIDCRedirectNotAllowed   = errors.New("redirect is not allowed")
+	ErrOIDCProvisioningDisabled = errors.New("no account is linked to this identity")
+)
+
+// OIDCConfig is read from the oidc_* settings on every login, so changes apply without a restart.
+type OIDCConfig struct {
+	Issuer       string
+	ClientID     string
+	ClientSecret string
+	// RedirectURL is the callback registered at the provider, e.g. https://music.example.com/api/auth/oidc/callback
+	RedirectURL string
+	Scopes      []string
+	// GroupsClaim may be a dotted path such as realm_access.roles.
+	GroupsClaim string
+	// AdminGroup gives members the admin role and makes admins who are not members regular users. Empty leaves roles alone.
+	AdminGroup string
+	// AutoProvision signs up unknown identities under the registration policy. Off unless enabled.
+	AutoProvision bool
+	// AllowedRedirects are prefixes of absolute URLs clients may be sent back to after login,
+	// e.g. an app's custom scheme. Relative paths on this server are always allowed.
+	AllowedRedirects []string
+}
+
+type oidcProvider struct {
+	Issuer                string `json:"issuer"`
+	AuthorizationEndpoint string `json:"authorization_endpoint"`
+	TokenEndpoint         string `json:"token_endpoint"`
+	JWKSURI               string `json:"jwks_uri"`
+
+	fetched     time.Time
+	keys        map[string]crypto.PublicKey
+	keysFetched time.Time
+}
+
+type oidcPendingLogin struct {
+	verifier string
+	nonce    string
+	redirect string
+	expires  time.Time
+}
+
+// OIDCLogin is the outcome of a completed authorization code flow.
+type OIDCLogin struct {
+	User *model.User
+	// Redirect is where the client asked to be sent afterwards, empty for a JSON response.
+	Redirect string
+	Created  bool
+}
+
+// OIDCService signs users in through an external OpenID Connect provider using the
+// authorization code flow with PKCE. Identities are linked to users through
+// model.UserIdentity; unknown identities get a new user if auto provisioning is on.
+type OIDCService struct {
+	Users      *UserService
+	Identities *store.IdentityStore
+	Settings   *store.SettingsStore
+	Client     *http.Client
+
+	mu        sync.Mutex
+	pending   map[string]*oidcPendingLogin
+	providers map[string]*oidcProvider
+}
+
+func NewOIDCService(users *UserService, identities *store.IdentityStore, settings *store.SettingsStore) *OIDCService {
+	return &OIDCService{
+		Users:      users,
+		Identities: identities,
+		Settings:   settings,
+		Client:     &http.Client{Timeout: 10 * time.Second},
+		pending:    make(map[string]*oidcPendingLogin),
+		providers:  make(map[string]*oidcProvider),
+	}
+}
+
+func (s *OIDCService) setting(key, fallback string) string {
+	val, err := s.Settings.Get(key)
+	if err != nil || strings.TrimSpace(val) == "" {
+		return fallback
+	}
+	return strings.TrimSpace(val)
+}
+
+func (s *OIDCService) Config() (*OIDCConfig, error) {
+	cfg := &OIDCConfig{
+		Issuer:        strings.TrimSuffix(s.setting("oidc_issuer", ""), "/"),
+		ClientID:      s.setting("oidc_client_id", ""),
+		ClientSecret:  s.setting("oidc_client_secret", ""),
+		RedirectURL:   s.setting("oidc_redirect_url", ""),
+		Scopes:        strings.Fields(strings.ReplaceAll(s.setting("oidc_scopes", "openid profile email"), ",", " ")),
+		GroupsClaim:   s.setting("oidc_groups_claim", "groups"),
+		AdminGroup:    s.setting("oidc_admin_group", ""),
+		AutoProvision: s.setting("oidc_auto_provision", "false") == "true",
+	}
+	for _, prefix := range strings.Split(s.setting("oidc_allowed_redirects", ""), ",") {
+		if prefix = strings.TrimSpace(prefix); prefix != "" {
+			cfg.AllowedRedirects = append(cfg.AllowedRedirects, prefix)
+		}
+	}
+	if cfg.Issuer == "" || cfg.ClientID == "" || cfg.RedirectURL == "" {
+		return nil, ErrOIDCNotConfigured
+	}
+	if !slices.Contains(cfg.Scopes, "openid") {
+		cfg.Scopes = append([]string{"openid"}, cfg.Scopes...)
+	}
+	return cfg, nil
+}
+
+func (s *OIDCService) Enabled() bool {
+	_, err := s.Config()
+	return err == nil
+}
+
+// AuthURL starts a login and returns the provider URL to send the browser to.
+func (s *OIDCService) AuthURL(ctx context.Context, redirect string) (string, error) {
+	cfg, err := s.Config()
+	if err != nil {
+		return "", err
+	}
+	if redirect != "" && !redirectAllowed(redirect, cfg.AllowedRedirects) {
+		return "", ErrOIDCRedirectNotAllowed
+	}
+	provider, err := s.provider(ctx, cfg.Issuer)
+	if err != nil {
+		return "", err
+	}
+
+	state, err := randomToken(24)
+	if err != nil {
+		return "", err
+	}
+	nonce, err := randomToken(24)
+	if err != nil {
+		return "", err
+	}
+	verifier, err := randomToken(48)
+	if err != nil {
+		return "", err
+	}
+
+	s.mu.Lock()
+	now := time.Now()
+	for key, p := range s.pending {
+		if now.After(p.expires) {
+			delete(s.pending, key)
+		}
+	}
+	if len(s.pending) >= oidcMaxPendingLogins {
+		s.mu.Unlock()
+		return "", errors.New("too many logins in progress")
+	}
+	s.pending[state] = &oidcPendingLogin{verifier: verifier, nonce: nonce, redirect: redirect, expires: now.Add(oidcLoginTimeout)}
+	s.mu.Unlock()
+
+	challenge := sha256.Sum256([]byte(verifier))
+	q := url.Values{}
+	q.Set("response_type", "code")
+	q.Set("client_id", cfg.ClientID)
+	q.Set("redirect_uri", cfg.RedirectURL)
+	q.Set("scope", strings.Join(cfg.Scopes, " "))
+	q.Set("state", state)
+	q.Set("nonce", nonce)
+	q.Set("code_challenge", base64.RawURLEncoding.EncodeToString(challenge[:]))
+	q.Set("code_challenge_method", "S256")
+
+	sep := "?"
+	if strings.Contains(provider.AuthorizationEndpoint, "?") {
+		sep = "&"
+	}
+	return provider.AuthorizationEndpoint + sep + q.Encode(), nil
+}
+
+// CancelLogin drops a login in progress, e.g. after the provider reported an error,
+// and returns its client redirect so the error can be passed on.
+func (s *OIDCService) CancelLogin(state string) string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	p, ok := s.pending[state]
+	if !ok {
+		return ""
+	}
+	delete(s.pending, state)
+	return p.redirect
+}
+
+// Complete finishes a login: it redeems the authorization code, verifies the ID token
+// and returns the linked user, provisioning one if needed.
+func (s *OIDCService) Complete(ctx context.Context, code, state string) (*OIDCLogin, error) {
+	s.mu.Lock()
+	pending, ok := s.pending[state]
+	delete(s.pending, state)
+	s.mu.Unlock()
+	if !ok || time.Now().After(pending.expires) {
+		return nil, ErrOIDCInvalidState
+	}
+
+	cfg, err := s.Config()
+	if err != nil {
+		return nil, err
+	}
+	provider, err := s.provider(ctx, cfg.Issuer)
+	if err != nil {
+		return nil, err
+	}
+
+	rawIDToken, err := s.exchangeCode(ctx, cfg, provider, code, pending.verifier)
+	if err != nil {
+		return nil, err
+	}
+	claims, err := s.verifyIDToken(ctx, cfg, rawIDToken, pending.nonce)
+	if err != nil {
+		return nil, err
+	}
+
+	user, created, err := s.linkedUser(cfg, claims)
+	if err != nil {
+		return nil, err
+	}
+
+	if cfg.AdminGroup != "" {
+		isAdmin := slices.Contains(claimStrings(claims, cfg.GroupsClaim), cfg.AdminGroup)
+		if user.IsAdmin != isAdmin {
+			// Demoted admins become regular users, other roles are left to the admins of this server
+			role := model.RoleUser
+			if isAdmin {
+				role = model.RoleAdmin
+			}
+			log.Printf("Setting role of %s to %s from the %s claim\n", user.Username, role, cfg.GroupsClaim)
+			if err := s.Users.Store.SetRole(user, role); err != nil {
+				return nil, err
+			}
+		}
+	}
+
+	return &OIDCLogin{User: user, Redirect: pending.redirect, Created: created}, nil
+}
+
+// linkedUser returns the user linked to the identity in claims, creating the user and
+// the link if the identity is new.
+func (s *OIDCService) linkedUser(cfg *OIDCConfig, claims jwt.MapClaims) (*model.User, bool, error) {
+	subject, _ := claims["sub"].(string)
+	if subject == "" {
+		return nil, false, errors.New("ID token has no subject")
+	}
+	email, _ := claims["email"].(string)
+
+	identity, err := s.Identities.GetIdentity(cfg.Issuer, subject)
+	if err == nil {
+		user, err := s.Users.Store.GetUserByID(identity.UserID)
+		if err == nil {
+			identity.Email = email
+			identity.LastLoginAt = time.Now()
+			if err := s.Identities.UpdateIdentity(identity); err != nil {
+				log.Printf("Failed to update identity %s: %v\n", identity.ID, err)
+			}
+			return user, false, nil
+		}
+		// The user was deleted, the identity may start over with a new account
+		if err := s.Identities.DeleteIdentity(identity.ID); err != nil {
+			return nil, false, err
+		}
+	}
+
+	if !cfg.AutoProvision {
+		return nil, false, ErrOIDCProvisioningDisabled
+	}
+	// Provisioning is a sign up and follows the registration policy. There is no
+	// way to present an invite through the provider.
+	policy := s.Users.RegistrationPolicy()
+	switch policy {
+	case RegistrationClosed:
+		return nil, false, ErrRegistrationClosed
+	case RegistrationInviteOnly:
+		return nil, false, ErrInviteRequired
+	}
+
+	username, err := s.availableUsername(claims)
+	if err != nil {
+		return nil, false, err
+	}
+	// The account can only be used through the provider, nobody knows this password
+	password, err := randomToken(32)
+	if err != nil {
+		return nil, false, err
+	}
+	user, err := s.Users.createUser(&model.User{
+		Username:        username,
+		PendingApproval: policy == RegistrationAdminApproval,
+	}, password)
+	if err != nil {
+		return nil, false, err
+	}
+
+	identity = &model.UserIdentity{
+		UserID:      user.ID,
+		Issuer:      cfg.Issuer,
+		Subject:     subject,
+		Email:       email,
+		LastLoginAt: time.Now(),
+	}
+	if err := s.Identities.CreateIdentity(identity); err != nil {
+		return nil, false, err
+	}
+	log.Printf("Provisioned user %s for %s identity %s\n", user.Username, cfg.Issuer, subject)
+	return user, true, nil
+}
+
+var usernameInvalidChars = regexp.MustCompile(`[^a-zA-Z0-9_\-]+`)
+
+// maxUsernameLength matches the signup validation.
+const maxUsernameLength = 20
+
+// availableUsername derives a username that passes signup validation from the ID token
+// claims and appends a number if it is already taken.
+func (s *OIDCService) availableUsername(claims jwt.MapClaims) (string, error) {
+	base := ""
+	for _, key := range []string{"preferred_username", "email", "name", "nickname"} {
+		val, _ := claims[key].(string)
+		if key == "email" {
+			val, _, _ = strings.Cut(val, "@")
+		}
+		val = strings.Trim(usernameInvalidChars.ReplaceAllString(val, "_"), "_")
+		if val != "" {
+			base = val
+			break
+		}
+	}
+	if base == "" {
+		base = "user"
+	}
+	if len(base) > maxUsernameLength {
+		base = base[:maxUsernameLength]
+	}
+
+	for i := 1; i <= 1000; i++ {
+		candidate := base
+		if i > 1 {
+			suffix := fmt.Sprintf("_%d", i)
+			candidate = base[:min(len(base), maxUsernameLength-len(suffix))] + suffix
+		}
+		if _, err := s.Users.Store.GetUserByUsername(candidate); err != nil {
+			return candidate, nil
+		}
+	}
+	return "", fmt.Errorf("no free username for %q", base)
+}
+
+func (s *OIDCService) exchangeCode(ctx context.Context, cfg *OIDCConfig, provider *oidcProvider, code, verifier string) (string, error) {
+	form := url.Values{}
+	form.Set("grant_type", "authorization_code")
+	form.Set("code", code)
+	form.Set("redirect_uri", cfg.RedirectURL)
+	form.Set("client_id", cfg.ClientID)
+	form.Set("code_verifier", verifier)
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, provider.TokenEndpoint, strings.NewReader(form.Encode()))
+	if err != nil {
+		return "", err
+	}
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	req.Header.Set("Accept", "application/json")
+	if cfg.ClientSecret != "" {
+		req.SetBasicAuth(url.QueryEscape(cfg.ClientID), url.QueryEscape(cfg.ClientSecret))
+	}
+
+	resp, err := s.Client.Do(req)
+	if err != nil {
+		return "", fmt.Errorf("token request failed: %w", err)
+	}
+	defer resp.Body.Close()
+
+	var body struct {
+		IDToken          string `json:"id_token"`
+		Error            string `json:"error"`
+		ErrorDescription string `json:"error_description"`
+	}
+	if err := json.NewDecoder(io.LimitReader(resp.Body, 1<<20)).Decode(&body); err != nil {
+		return "", fmt.Errorf("token response: %w", err)
+	}
+	if body.Error != "" {
+		return "", fmt.Errorf("token request rejected: %s %s", body.Error, body.ErrorDescription)
+	}
+	if resp.StatusCode != http.StatusOK || body.IDToken == "" {
+		return "", fmt.Errorf("token request failed with status %d", resp.StatusCode)
+	}
+	return body.IDToken, nil
+}
+
+func (s *OIDCService) verifyIDToken(ctx context.Context, cfg *OIDCConfig, raw, nonce string) (jwt.MapClaims, error) {
+	claims := jwt.MapClaims{}
+	_, err := jwt.ParseWithClaims(raw, claims, func(token *jwt.Token) (interface{}, error) {
+		kid, _ := token.Header["kid"].(string)
+		return s.signingKey(ctx, cfg.Issuer, kid)
+	},
+		jwt.WithValidMethods([]string{"RS256", "RS384", "RS512", "PS256", "PS384", "PS512", "ES256", "ES384", "ES512"}),
+		jwt.WithIssuer(cfg.Issuer),
+		jwt.WithAudience(cfg.ClientID),
+		jwt.WithExpirationRequired(),
+		jwt.WithLeeway(time.Minute),
+	)
+	if err != nil {
+		return nil, fmt.Errorf("invalid ID token: %w", err)
+	}
+	if got, _ := claims["nonce"].(string); got != nonce {
+		return nil, errors.New("invalid ID token: nonce mismatch")
+	}
+	return claims, nil
+}
+
+// provider returns the discovery document of issuer, refreshing it once it is older than oidcDiscoveryTTL.
+func (s *OIDCService) provider(ctx context.Context, issuer string) (*oidcProvider, error) {
+	s.mu.Lock()
+	p, ok := s.providers[issuer]
+	s.mu.Unlock()
+	if ok && time.Since(p.fetched) < oidcDiscoveryTTL {
+		return p, nil
+	}
+
+	fetched := &oidcProvider{}
+	if err := s.getJSON(ctx, issuer+"/.well-known/openid-configuration", fetched); err != nil {
+		return nil, fmt.Errorf("OpenID discovery failed: %w", err)
+	}
+	if strings.TrimSuffix(fetched.Issuer, "/") != issuer {
+		return nil, fmt.Errorf("OpenID discovery returned issuer %q, expected %q", fetched.Issuer, issuer)
+	}
+	if fetched.AuthorizationEndpoint == "" || fetched.TokenEndpoint == "" || fetched.JWKSURI == "" {
+		return nil, errors.New("OpenID discovery document is missing endpoints")
+	}
+	fetched.fetched = time.Now()
+
+	s.mu.Lock()
+	if ok && p.JWKSURI == fetched.JWKSURI {
+		fetched.keys, fetched.keysFetched = p.keys, p.keysFetched
+	}
+	s.providers[issuer] = fetched
+	s.mu.Unlock()
+	return fetched, nil
+}
+
+// signingKey looks up kid in the provider's key set, fetching the set again if the key
+// is unknown, e.g. after the provider rotated its keys.
+func (s *OIDCService) signingKey(ctx context.Context, issuer, kid string) (crypto.PublicKey, error) {
+	s.mu.Lock()
+	p := s.providers[issuer]
+	key, ok := lookupKey(p.keys, kid)
+	refetch := !ok && time.Since(p.keysFetched) > oidcJWKSRefetchPeriod
+	s.mu.Unlock()
+	if ok {
+		return key, nil
+	}
+	if !refetch {
+		return nil, fmt.Errorf("unknown signing key %q", kid)
+	}
+
+	var set struct {
+		Keys []jsonWebKey `json:"keys"`
+	}
+	if err := s.getJSON(ctx, p.JWKSURI, &set); err != nil {
+		return nil, fmt.Errorf("fetching signing keys failed: %w", err)
+	}
+	keys := make(map[string]crypto.PublicKey)
+	for _, jwk := range set.Keys {
+		if jwk.Use != "" && jwk.Use != "sig" {
+			continue
+		}
+		pub, err := jwk.publicKey()
+		if err != nil {
+			log.Printf("Skipping signing key %q of %s: %v\n", jwk.Kid, issuer, err)
+			continue
+		}
+		keys[jwk.Kid] = pub
+	}
+
+	s.mu.Lock()
+	p.keys, p.keysFetched = keys, time.Now()
+	s.mu.Unlock()
+
+	if key, ok := lookupKey(keys, kid); ok {
+		return key, nil
+	}
+	return nil, fmt.Errorf("unknown signing key %q", kid)
+}
+
+// lookupKey finds kid, or the only key if the token does not name one.
+func lookupKey(keys map[string]crypto.PublicKey, kid string) (crypto.PublicKey, bool) {
+	if kid == "" && len(keys) == 1 {
+		for _, key := range keys {
+			return key, true
+		}
+	}
+	key, ok := keys[kid]
+	return key, ok
+}
+
+func (s *OIDCService) getJSON(ctx context.Context, url string, v any) error {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, url, nil)
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Accept", "application/json")
+	resp, err := s.Client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("%s returned status %d", url, resp.StatusCode)
+	}
+	return json.NewDecoder(io.LimitReader(resp.Body, 1<<20)).Decode(v)
+}
+
+type jsonWebKey struct {
+	Kty string `json:"kty"`
+	Kid string `json:"kid"`
+	Use string `json:"use"`
+	N   string `json:"n"`
+	E   string `json:"e"`
+	Crv string `json:"crv"`
+	X   string `json:"x"`
+	Y   string `json:"y"`
+}
+
+func (k jsonWebKey) publicKey() (crypto.PublicKey, error) {
+	decode := func(s string) (*big.Int, error) {
+		b, err := base64.RawURLEncoding.DecodeString(strings.TrimRight(s, "="))
+		if err != nil {
+			return nil, err
+		}
+		return new(big.Int).SetBytes(b), nil
+	}
+
+	switch k.Kty {
+	case "RSA":
+		n, err := decode(k.N)
+		if err != nil {
+			return nil, err
+		}
+		e, err := decode(k.E)
+		if err != nil {
+			return nil, err
+		}
+		if !e.IsInt64() {
+			return nil, errors.New("RSA exponent too large")
+		}
+		return &rsa.PublicKey{N: n, E: int(e.Int64())}, nil
+	case "EC":
+		var curve elliptic.Curve
+		switch k.Crv {
+		case "P-256":
+			curve = elliptic.P256()
+		case "P-384":
+			curve = elliptic.P384()
+		case "P-521":
+			curve = elliptic.P521()
+		default:
+			return nil, fmt.Errorf("unsupported curve %q", k.Crv)
+		}
+		x, err := decode(k.X)
+		if err != nil {
+			return nil, err
+		}
+		y, err := decode(k.Y)
+		if err != nil {
+			return nil, err
+		}
+		return &ecdsa.PublicKey{Curve: curve, X: x, Y: y}, nil
+	}
+	return nil, fmt.Errorf("unsupported key type %q", k.Kty)
+}
+
+// claimStrings reads a string or list of strings at a dotted claim path.
+func claimStrings(claims jwt.MapClaims, path string) []string {
+	var cur any = map[string]any(claims)
+	for _, part := range strings.Split(path, ".") {
+		m, ok := cur.(map[string]any)
+		if !ok {
+			return nil
+		}
+		cur = m[part]
+	}
+
+	switch v := cur.(type) {
+	case string:
+		return []string{v}
+	case []any:
+		out := make([]string, 0, len(v))
+		for _, item := range v {
+			if s, ok := item.(string); ok {
+				out = append(out, s)
+			}
+		}
+		return out
+	}
+	return nil
+}
+
+// redirectAllowed accepts paths on this server and absolute URLs starting with one of the allowed prefixes.
+func redirectAllowed(redirect string, allowed []string) bool {
+	if strings.HasPrefix(redirect, "/") && !strings.HasPrefix(redirect, "//") && !strings.HasPrefix(redirect, "/\\") {
+		return true
+	}
+	for _, prefix := range allowed {
+		if strings.HasPrefix(redirect, prefix) {
+			return true
+		}
+	}
+	return false
+}
+
+func randomToken(n int) (string, error) {
+	buf := make([]byte, n)
+	if _, err := rand.Read(buf); err != nil {
+		return "", err
+	}
+	return base64.RawURLEncoding.EncodeToString(buf), nil
+}
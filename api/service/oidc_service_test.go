@@ -0,0 +1,220 @@
+package service
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/ProjectDistribute/distributor/store"
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// stubIdentityProvider is a minimal OpenID provider: it hands out one authorization
+// code per Authorize call and signs ID tokens with a fresh RSA key.
+type stubIdentityProvider struct {
+	*httptest.Server
+	key    *rsa.PrivateKey
+	claims jwt.MapClaims
+
+	mu    sync.Mutex
+	codes map[string]url.Values // code -> authorization request
+}
+
+func newStubIdentityProvider(t *testing.T) *stubIdentityProvider {
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	require.NoError(t, err)
+	idp := &stubIdentityProvider{key: key, codes: make(map[string]url.Values)}
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("/.well-known/openid-configuration", func(w http.ResponseWriter, r *http.Request) {
+		json.NewEncoder(w).Encode(map[string]string{
+			"issuer":                 idp.URL,
+			"authorization_endpoint": idp.URL + "/authorize",
+			"token_endpoint":         idp.URL + "/token",
+			"jwks_uri":               idp.URL + "/jwks",
+		})
+	})
+	mux.HandleFunc("/jwks", func(w http.ResponseWriter, r *http.Request) {
+		json.NewEncoder(w).Encode(map[string]any{"keys": []map[string]string{{
+			"kty": "RSA",
+			"kid": "test-key",
+			"use": "sig",
+			"n":   base64.RawURLEncoding.EncodeToString(key.N.Bytes()),
+			"e":   base64.RawURLEncoding.EncodeToString(big.NewInt(int64(key.E)).Bytes()),
+		}}})
+	})
+	mux.HandleFunc("/token", func(w http.ResponseWriter, r *http.Request) {
+		r.ParseForm()
+		idp.mu.Lock()
+		authReq, ok := idp.codes[r.PostForm.Get("code")]
+		delete(idp.codes, r.PostForm.Get("code"))
+		idp.mu.Unlock()
+
+		challenge := sha256.Sum256([]byte(r.PostForm.Get("code_verifier")))
+		if !ok || base64.RawURLEncoding.EncodeToString(challenge[:]) != authReq.Get("code_challenge") {
+			w.WriteHeader(http.StatusBadRequest)
+			json.NewEncoder(w).Encode(map[string]string{"error": "invalid_grant"})
+			return
+		}
+
+		claims := jwt.MapClaims{
+			"iss":   idp.URL,
+			"aud":   authReq.Get("client_id"),
+			"exp":   time.Now().Add(time.Minute).Unix(),
+			"nonce": authReq.Get("nonce"),
+		}
+		for k, v := range idp.claims {
+			claims[k] = v
+		}
+		token := jwt.NewWithClaims(jwt.SigningMethodRS256, claims)
+		token.Header["kid"] = "test-key"
+		signed, _ := token.SignedString(key)
+		json.NewEncoder(w).Encode(map[string]string{"id_token": signed, "token_type": "Bearer"})
+	})
+	idp.Server = httptest.NewServer(mux)
+	t.Cleanup(idp.Close)
+	return idp
+}
+
+// Authorize plays the browser's round trip through the provider and returns the code and state.
+func (idp *stubIdentityProvider) Authorize(t *testing.T, authURL string) (string, string) {
+	u, err := url.Parse(authURL)
+	require.NoError(t, err)
+	q := u.Query()
+	assert.Equal(t, "S256", q.Get("code_challenge_method"))
+
+	code, err := randomToken(16)
+	require.NoError(t, err)
+	idp.mu.Lock()
+	idp.codes[code] = q
+	idp.mu.Unlock()
+	return code, q.Get("state")
+}
+
+func newTestOIDCService(t *testing.T, idp *stubIdentityProvider) *OIDCService {
+	gdb := newTestDB(t)
+
+	settings := store.NewSettingsStore(gdb)
+	for key, val := range map[string]string{
+		"oidc_issuer":         idp.URL,
+		"oidc_client_id":      "distributor",
+		"oidc_redirect_url":   "http://localhost/api/auth/oidc/callback",
+		"oidc_admin_group":    "music-admins",
+		"oidc_auto_provision": "true",
+	} {
+		require.NoError(t, settings.Set(key, val))
+	}
+
+	identities := store.NewIdentityStore(gdb)
+	users := &UserService{
+		Store:           store.NewUserStore(gdb),
+		PlaylistService: &PlaylistService{Store: store.NewPlaylistStore(gdb)},
+		Sessions:        store.NewSessionStore(gdb),
+		Audit:           store.NewAuditStore(gdb),
+		Identities:      identities,
+		Settings:        settings,
+	}
+	return NewOIDCService(users, identities, settings)
+}
+
+func TestOIDCService_LoginProvisionsAndLinks(t *testing.T) {
+	idp := newStubIdentityProvider(t)
+	svc := newTestOIDCService(t, idp)
+	ctx := context.Background()
+
+	idp.claims = jwt.MapClaims{"sub": "abc-123", "preferred_username": "jane.doe", "groups": []string{"music-admins"}}
+	authURL, err := svc.AuthURL(ctx, "/login")
+	require.NoError(t, err)
+	code, state := idp.Authorize(t, authURL)
+
+	login, err := svc.Complete(ctx, code, state)
+	require.NoError(t, err)
+	assert.True(t, login.Created)
+	assert.Equal(t, "/login", login.Redirect)
+	assert.Equal(t, "jane_doe", login.User.Username)
+	assert.True(t, login.User.IsAdmin)
+	_, err = svc.Users.PlaylistService.Store.GetRootFolderID(login.User.ID)
+	assert.NoError(t, err, "provisioned users get a root folder")
+
+	// The state is single use
+	_, err = svc.Complete(ctx, code, state)
+	assert.ErrorIs(t, err, ErrOIDCInvalidState)
+
+	// Logging in again links to the same user and follows group changes
+	idp.claims = jwt.MapClaims{"sub": "abc-123", "preferred_username": "renamed", "groups": []string{}}
+	authURL, err = svc.AuthURL(ctx, "")
+	require.NoError(t, err)
+	code, state = idp.Authorize(t, authURL)
+	again, err := svc.Complete(ctx, code, state)
+	require.NoError(t, err)
+	assert.False(t, again.Created)
+	assert.Equal(t, login.User.ID, again.User.ID)
+	assert.False(t, again.User.IsAdmin)
+}
+
+func TestOIDCService_RejectsBadLogins(t *testing.T) {
+	idp := newStubIdentityProvider(t)
+	svc := newTestOIDCService(t, idp)
+	ctx := context.Background()
+	idp.claims = jwt.MapClaims{"sub": "abc-123"}
+
+	_, err := svc.AuthURL(ctx, "https://evil.example.com/")
+	assert.ErrorIs(t, err, ErrOIDCRedirectNotAllowed)
+
+	// A code redeemed without the matching PKCE verifier is rejected by the provider
+	authURL, err := svc.AuthURL(ctx, "")
+	require.NoError(t, err)
+	_, state := idp.Authorize(t, authURL)
+	_, err = svc.Complete(ctx, "not-the-code", state)
+	assert.Error(t, err)
+
+	// Without auto provisioning unknown identities cannot log in
+	require.NoError(t, svc.Settings.Set("oidc_auto_provision", "false"))
+	authURL, err = svc.AuthURL(ctx, "")
+	require.NoError(t, err)
+	code, state := idp.Authorize(t, authURL)
+	_, err = svc.Complete(ctx, code, state)
+	assert.ErrorIs(t, err, ErrOIDCProvisioningDisabled)
+}
+
+func TestOIDCService_ProvisioningFollowsRegistrationPolicy(t *testing.T) {
+	idp := newStubIdentityProvider(t)
+	svc := newTestOIDCService(t, idp)
+	ctx := context.Background()
+
+	login := func(subject string) (*OIDCLogin, error) {
+		idp.claims = jwt.MapClaims{"sub": subject, "preferred_username": subject}
+		authURL, err := svc.AuthURL(ctx, "")
+		require.NoError(t, err)
+		code, state := idp.Authorize(t, authURL)
+		return svc.Complete(ctx, code, state)
+	}
+
+	require.NoError(t, svc.Settings.Set("registration_policy", RegistrationClosed))
+	_, err := login("closed")
+	assert.ErrorIs(t, err, ErrRegistrationClosed)
+
+	require.NoError(t, svc.Settings.Set("registration_policy", RegistrationInviteOnly))
+	_, err = login("invited")
+	assert.ErrorIs(t, err, ErrInviteRequired)
+
+	require.NoError(t, svc.Settings.Set("registration_policy", RegistrationAdminApproval))
+	pending, err := login("pending")
+	require.NoError(t, err)
+	assert.True(t, pending.Created)
+	stored, err := svc.Users.Store.GetUserByID(pending.User.ID)
+	require.NoError(t, err)
+	assert.True(t, stored.PendingApproval)
+}
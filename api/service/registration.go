@@ -0,0 +1,130 @@
+package service
+
+import (
+	"crypto/rand"
+	"encoding/base32"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/ProjectDistribute/distributor/model"
+	"github.com/google/uuid"
+)
+
+// Registration policies, stored in the registration_policy setting.
+const (
+	RegistrationOpen          = "open"
+	RegistrationInviteOnly    = "invite_only"
+	RegistrationClosed        = "closed"
+	RegistrationAdminApproval = "admin_approval"
+)
+
+var (
+	ErrRegistrationClosed = errors.New("registration is closed")
+	ErrInviteRequired     = errors.New("an invite code is required to sign up")
+	ErrInvalidInvite      = errors.New("invite code is invalid, expired or used up")
+	ErrPendingApproval    = errors.New("account is awaiting admin approval")
+)
+
+func ValidateRegistrationPolicy(policy string) error {
+	switch policy {
+	case RegistrationOpen, RegistrationInviteOnly, RegistrationClosed, RegistrationAdminApproval:
+		return nil
+	}
+	return fmt.Errorf("must be one of %s, %s, %s, %s", RegistrationOpen, RegistrationInviteOnly, RegistrationClosed, RegistrationAdminApproval)
+}
+
+// RegistrationPolicy returns the configured policy, open if none is set.
+func (s *UserService) RegistrationPolicy() string {
+	policy, err := s.Settings.Get("registration_policy")
+	if err != nil || ValidateRegistrationPolicy(policy) != nil {
+		return RegistrationOpen
+	}
+	return policy
+}
+
+// Register signs up a user according to the registration policy. A valid invite is
+// required under invite_only, skips approval under admin_approval and may grant admin
+// rights. Users created under admin_approval without an invite cannot log in until an
+// admin approves them.
+func (s *UserService) Register(username, password, inviteCode string) (*model.User, error) {
+	policy := s.RegistrationPolicy()
+	if policy == RegistrationClosed {
+		return nil, ErrRegistrationClosed
+	}
+	if inviteCode == "" && policy == RegistrationInviteOnly {
+		return nil, ErrInviteRequired
+	}
+
+	var invite *model.Invite
+	if inviteCode != "" {
+		found, err := s.Invites.GetInviteByCode(inviteCode)
+		if err != nil || !found.Usable() {
+			return nil, ErrInvalidInvite
+		}
+		ok, err := s.Invites.UseInvite(found.ID)
+		if err != nil {
+			return nil, err
+		}
+		if !ok {
+			return nil, ErrInvalidInvite
+		}
+		invite = found
+	}
+
+	user := &model.User{Username: username, PendingApproval: invite == nil && policy == RegistrationAdminApproval}
+	if invite != nil && invite.GrantAdmin {
+		user.SetRole(model.RoleAdmin)
+	}
+	if _, err := s.createUser(user, password); err != nil {
+		if invite != nil {
+			_ = s.Invites.ReleaseInvite(invite.ID)
+		}
+		return nil, err
+	}
+	return user, nil
+}
+
+// ApproveUser lets a user who signed up under admin_approval log in.
+func (s *UserService) ApproveUser(actorID uuid.UUID, user *model.User) error {
+	user.PendingApproval = false
+	if _, err := s.Store.UpdateUser(user); err != nil {
+		return err
+	}
+	s.RecordAudit(actorID, model.AuditUserApproved, user.ID, "")
+	return nil
+}
+
+// CreateInvite mints a new invite code. A maxUses of 0 allows unlimited sign ups.
+func (s *UserService) CreateInvite(actorID uuid.UUID, maxUses int, expiresAt *time.Time, grantAdmin bool, note string) (*model.Invite, error) {
+	buf := make([]byte, 10)
+	if _, err := rand.Read(buf); err != nil {
+		return nil, err
+	}
+	invite := &model.Invite{
+		Code:       base32.StdEncoding.WithPadding(base32.NoPadding).EncodeToString(buf),
+		CreatedBy:  actorID,
+		Note:       note,
+		ExpiresAt:  expiresAt,
+		MaxUses:    maxUses,
+		GrantAdmin: grantAdmin,
+	}
+	if err := s.Invites.CreateInvite(invite); err != nil {
+		return nil, err
+	}
+
+	details := note
+	if grantAdmin {
+		details = "grants admin; " + note
+	}
+	s.RecordAudit(actorID, model.AuditInviteCreated, invite.ID, details)
+	return invite, nil
+}
+
+func (s *UserService) RevokeInvite(actorID uuid.UUID, invite *model.Invite) error {
+	if err := s.Invites.RevokeInvite(invite.ID); err != nil {
+		return err
+	}
+	s.RecordAudit(actorID, model.AuditInviteRevoked, invite.ID, invite.Note)
+	return nil
+}
@@ -0,0 +1,149 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"os"
+	"strconv"
+	"strings"
+
+	"github.com/ProjectDistribute/distributor/model"
+	"github.com/ProjectDistribute/distributor/store"
+	"github.com/google/uuid"
+)
+
+const RenditionDir = "storage/renditions"
+
+var ErrNoTranscoder = errors.New("no transcoder available")
+
+// RenditionService pre-generates lossy renditions of song files for offline downloads.
+// Which renditions exist is controlled by the rendition_profiles setting, a comma
+// separated list of <format>-<bitrate> profiles such as "aac-256,opus-128".
+type RenditionService struct {
+	Store      *store.RenditionStore
+	SongStore  *store.SongStore
+	Settings   *store.SettingsStore
+	Storage    FileStorage
+	Transcodes *TranscodeService // nil when no transcoder is available
+}
+
+// RenditionProfileName returns the canonical <format>-<bitrate> name of a profile.
+func RenditionProfileName(opts TranscodeOptions) string {
+	return fmt.Sprintf("%s-%d", opts.Format, opts.Bitrate)
+}
+
+// ParseRenditionProfiles parses the rendition_profiles setting. Duplicates are dropped.
+func ParseRenditionProfiles(value string) ([]TranscodeOptions, error) {
+	var profiles []TranscodeOptions
+	seen := make(map[string]bool)
+	for _, part := range strings.Split(value, ",") {
+		part = strings.TrimSpace(part)
+		if part == "" {
+			continue
+		}
+		format, bitrateStr, ok := strings.Cut(part, "-")
+		if !ok {
+			return nil, fmt.Errorf("invalid rendition profile %q, expected <format>-<bitrate>", part)
+		}
+		bitrate, err := strconv.Atoi(bitrateStr)
+		if err != nil || bitrate <= 0 {
+			return nil, fmt.Errorf("invalid bitrate in rendition profile %q", part)
+		}
+		opts, err := ParseTranscodeOptions(format, bitrate)
+		if err != nil {
+			return nil, err
+		}
+		name := RenditionProfileName(opts)
+		if seen[name] {
+			continue
+		}
+		seen[name] = true
+		profiles = append(profiles, opts)
+	}
+	return profiles, nil
+}
+
+// Profiles returns the configured rendition profiles. An unset or invalid setting means none.
+func (s *RenditionService) Profiles() []TranscodeOptions {
+	value, err := s.Settings.Get("rendition_profiles")
+	if err != nil {
+		return nil
+	}
+	profiles, err := ParseRenditionProfiles(value)
+	if err != nil {
+		log.Printf("Ignoring invalid rendition_profiles setting: %v\n", err)
+		return nil
+	}
+	return profiles
+}
+
+// Generate encodes the rendition of file described by opts unless it already exists.
+func (s *RenditionService) Generate(ctx context.Context, file *model.SongFile, opts TranscodeOptions) (*model.SongRendition, error) {
+	if s.Transcodes == nil {
+		return nil, ErrNoTranscoder
+	}
+
+	r := model.SongRendition{
+		SongFileID: file.ID,
+		SongID:     file.SongID,
+		Profile:    RenditionProfileName(opts),
+		Format:     opts.Format,
+		Bitrate:    opts.Bitrate,
+		Duration:   file.Duration,
+	}
+	dst := r.FilePath()
+
+	src, err := TranscodeInput(s.Storage, file.FilePath())
+	if err != nil {
+		return nil, err
+	}
+	tmp, err := os.CreateTemp("", ".rendition-*")
+	if err != nil {
+		return nil, err
+	}
+	defer os.Remove(tmp.Name())
+
+	err = s.Transcodes.Transcode(ctx, src, opts, tmp)
+	if closeErr := tmp.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		return nil, err
+	}
+	if info, err := os.Stat(tmp.Name()); err == nil {
+		r.Size = info.Size()
+	}
+	if err := s.Storage.Move(tmp.Name(), dst); err != nil {
+		return nil, err
+	}
+
+	if err := s.Store.CreateRendition(&r); err != nil {
+		_ = s.Storage.Delete(dst)
+		return nil, fmt.Errorf("failed to create rendition record: %v", err)
+	}
+	return &r, nil
+}
+
+// DeleteRendition removes a rendition and its file.
+func (s *RenditionService) DeleteRendition(r *model.SongRendition) error {
+	if err := s.Storage.Delete(r.FilePath()); err != nil && !os.IsNotExist(err) {
+		log.Printf("Warning: failed to delete rendition from storage %s: %v\n", r.FilePath(), err)
+	}
+	return s.Store.DeleteRendition(r.ID)
+}
+
+// DeleteRenditionsOfFile removes every rendition of a song file, e.g. after the file itself was deleted.
+func (s *RenditionService) DeleteRenditionsOfFile(fileID uuid.UUID) error {
+	renditions, err := s.Store.GetRenditionsBySongFileID(fileID)
+	if err != nil {
+		return err
+	}
+	for i := range renditions {
+		if err := s.DeleteRendition(&renditions[i]); err != nil {
+			return err
+		}
+	}
+	return nil
+}
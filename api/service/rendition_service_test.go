@@ -0,0 +1,38 @@
+package service
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestParseRenditionProfiles(t *testing.T) {
+	tests := []struct {
+		name    string
+		value   string
+		want    []TranscodeOptions
+		wantErr bool
+	}{
+		{"empty", "", nil, false},
+		{"single", "opus-128", []TranscodeOptions{{Format: "opus", Bitrate: 128}}, false},
+		{"spaces and case", " AAC-256 , opus-96,", []TranscodeOptions{{Format: "aac", Bitrate: 256}, {Format: "opus", Bitrate: 96}}, false},
+		{"duplicates", "opus-128,mp3-320,opus-128", []TranscodeOptions{{Format: "opus", Bitrate: 128}, {Format: "mp3", Bitrate: 320}}, false},
+		{"clamped duplicates", "mp3-320,mp3-500", []TranscodeOptions{{Format: "mp3", Bitrate: 320}}, false},
+		{"missing bitrate", "opus", nil, true},
+		{"bad bitrate", "opus-fast", nil, true},
+		{"zero bitrate", "opus-0", nil, true},
+		{"negative bitrate", "opus--128", nil, true},
+		{"unknown format", "flac-1000", nil, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := ParseRenditionProfiles(tt.value)
+			if tt.wantErr {
+				assert.Error(t, err)
+				return
+			}
+			assert.NoError(t, err)
+			assert.Equal(t, tt.want, got)
+		})
+	}
+}
@@ -32,6 +32,9 @@ type SearchResult struct {
 	Artists    []SearchArtist `json:"artists,omitempty"`
 	AlbumID    *uuid.UUID     `json:"album_id,omitempty"`
 	AlbumTitle *string        `json:"album_title,omitempty"`
+
+	// For songs and albums
+	Genres []string `json:"genres,omitempty"`
 }
 
 func NewSearchService() (*SearchService, error) {
@@ -86,7 +89,7 @@ func NewSearchService() (*SearchService, error) {
 		}
 		// Prioritize "title" (Artist Name) over "sub" (Artist Name on Song)
 		searchableAttributes := []string{"title", "sub", "type"}
-		filterableAttributes := []string{"type"}
+		filterableAttributes := []string{"type", "album_type", "genres", "moods", "tags"}
 		sortableAttributes := []string{"weight"}
 
 		_, err = index.UpdateSettings(&meilisearch.Settings{
@@ -133,9 +136,27 @@ func (s *SearchService) songToDoc(song *model.Song) map[string]interface{} {
 	if song.Album.ID != uuid.Nil {
 		doc["album_id"] = song.Album.ID
 	}
+	addGenres(doc, song.Genres)
+	if song.TrackNumber > 0 {
+		doc["track_number"] = song.TrackNumber
+	}
+	if song.DiscNumber > 0 {
+		doc["disc_number"] = song.DiscNumber
+	}
 	return doc
 }
 
+// addGenres adds the genre, mood and tag names as the genres, moods and tags attributes.
+func addGenres(doc map[string]interface{}, genres []model.Genre) {
+	attrs := map[string]string{model.GenreKindGenre: "genres", model.GenreKindMood: "moods", model.GenreKindTag: "tags"}
+	for _, g := range genres {
+		if attr, ok := attrs[g.Kind]; ok {
+			names, _ := doc[attr].([]string)
+			doc[attr] = append(names, g.Name)
+		}
+	}
+}
+
 func (s *SearchService) artistToDoc(artist *model.Artist) map[string]interface{} {
 	doc := map[string]interface{}{
 		"id":     artist.ID,
@@ -164,6 +185,20 @@ func (s *SearchService) albumToDoc(album *model.Album) map[string]interface{} {
 	if album.GetArtistName() != "" {
 		doc["sub"] = album.GetArtistName()
 	}
+	if album.Type != "" {
+		doc["album_type"] = album.Type
+	}
+	addGenres(doc, album.Genres)
+	if len(album.AlbumArtists) > 0 {
+		var albumArtists []map[string]interface{}
+		for _, a := range album.AlbumArtists {
+			albumArtists = append(albumArtists, map[string]interface{}{
+				"id":   a.ID,
+				"name": a.Name,
+			})
+		}
+		doc["album_artists"] = albumArtists
+	}
 	return doc
 }
 
@@ -242,12 +277,36 @@ func (s *SearchService) IndexPlaylists(playlists []model.Playlist) error {
 	return err
 }
 
-func (s *SearchService) Search(query string, limit int, filterType string) ([]SearchResult, error) {
+// SearchFilters narrow down search results, empty fields match everything.
+type SearchFilters struct {
+	Type  string
+	Genre string
+	Mood  string
+	Tag   string
+}
+
+func (f SearchFilters) expression() string {
+	var parts []string
+	for _, c := range []struct{ attr, value string }{
+		{"type", f.Type},
+		{"genres", f.Genre},
+		{"moods", f.Mood},
+		{"tags", f.Tag},
+	} {
+		if c.value != "" {
+			value := strings.ReplaceAll(strings.ReplaceAll(c.value, `\`, `\\`), `"`, `\"`)
+			parts = append(parts, fmt.Sprintf("%s = \"%s\"", c.attr, value))
+		}
+	}
+	return strings.Join(parts, " AND ")
+}
+
+func (s *SearchService) Search(query string, limit int, filters SearchFilters) ([]SearchResult, error) {
 	req := &meilisearch.SearchRequest{
 		Limit: int64(limit),
 	}
-	if filterType != "" {
-		req.Filter = fmt.Sprintf("type = \"%s\"", filterType)
+	if expr := filters.expression(); expr != "" {
+		req.Filter = expr
 	}
 
 	resp, err := s.index.Search(query, req)
@@ -265,6 +324,7 @@ func (s *SearchService) Search(query string, limit int, filterType string) ([]Se
 			Artists    []SearchArtist `json:"artists"`
 			AlbumID    *uuid.UUID     `json:"album_id"`
 			AlbumTitle *string        `json:"album_title"`
+			Genres     []string       `json:"genres"`
 		}
 		if err := hit.DecodeInto(&res); err != nil {
 			continue
@@ -278,6 +338,7 @@ func (s *SearchService) Search(query string, limit int, filterType string) ([]Se
 			Artists:    res.Artists,
 			AlbumID:    res.AlbumID,
 			AlbumTitle: res.AlbumTitle,
+			Genres:     res.Genres,
 		})
 	}
 
@@ -0,0 +1,216 @@
+package service
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
+	"log"
+	"time"
+
+	"github.com/ProjectDistribute/distributor/middleware"
+	"github.com/ProjectDistribute/distributor/model"
+	"github.com/google/uuid"
+)
+
+const (
+	AccessTokenTTL  = 15 * time.Minute
+	RefreshTokenTTL = 60 * 24 * time.Hour
+
+	// sessionTouchInterval limits how often using an access token updates LastUsedAt.
+	sessionTouchInterval = 5 * time.Minute
+)
+
+var (
+	ErrInvalidRefreshToken = errors.New("invalid or expired refresh token")
+	ErrSessionNotFound     = errors.New("session not found")
+	ErrSessionRevoked      = errors.New("session expired or revoked")
+)
+
+// TokenPair is what a client receives on login and on every refresh. The refresh
+// token rotates each time, the previous one stops working.
+type TokenPair struct {
+	AccessToken  string
+	RefreshToken string
+	ExpiresAt    time.Time
+	Session      *model.Session
+}
+
+// CreateSession logs the user in on a new device.
+func (s *UserService) CreateSession(user *model.User, deviceName, ip string) (*TokenPair, error) {
+	refresh, hash, err := newRefreshToken()
+	if err != nil {
+		return nil, err
+	}
+
+	now := time.Now()
+	session := &model.Session{
+		UserID:           user.ID,
+		RefreshTokenHash: hash,
+		DeviceName:       deviceName,
+		IP:               ip,
+		LastUsedAt:       now,
+		ExpiresAt:        now.Add(RefreshTokenTTL),
+	}
+	if err := s.Sessions.CreateSession(session); err != nil {
+		return nil, err
+	}
+
+	if removed, err := s.Sessions.DeleteStaleSessions(now.Add(-RefreshTokenTTL)); err != nil {
+		log.Printf("Failed to delete stale sessions: %v\n", err)
+	} else if removed > 0 {
+		log.Printf("Deleted %d stale sessions\n", removed)
+	}
+
+	return s.issueTokens(user, session, refresh)
+}
+
+// RefreshSession exchanges a refresh token for a new token pair.
+func (s *UserService) RefreshSession(refreshToken, ip string) (*TokenPair, *model.User, error) {
+	session, err := s.Sessions.GetSessionByRefreshTokenHash(hashToken(refreshToken))
+	if err != nil || !session.Active() {
+		return nil, nil, ErrInvalidRefreshToken
+	}
+	user, err := s.Store.GetUserByID(session.UserID)
+	if err != nil {
+		return nil, nil, ErrInvalidRefreshToken
+	}
+	if user.IsBanned() {
+		return nil, nil, ErrUserBanned
+	}
+	if user.PendingApproval {
+		return nil, nil, ErrPendingApproval
+	}
+
+	refresh, hash, err := newRefreshToken()
+	if err != nil {
+		return nil, nil, err
+	}
+	now := time.Now()
+	session.RefreshTokenHash = hash
+	session.IP = ip
+	session.LastUsedAt = now
+	session.ExpiresAt = now.Add(RefreshTokenTTL)
+	if err := s.Sessions.UpdateSession(session); err != nil {
+		return nil, nil, err
+	}
+
+	pair, err := s.issueTokens(user, session, refresh)
+	return pair, user, err
+}
+
+func (s *UserService) issueTokens(user *model.User, session *model.Session, refresh string) (*TokenPair, error) {
+	expires := time.Now().Add(AccessTokenTTL)
+	access, err := s.GenerateToken(user, session.ID, expires)
+	if err != nil {
+		return nil, err
+	}
+	return &TokenPair{AccessToken: access, RefreshToken: refresh, ExpiresAt: expires, Session: session}, nil
+}
+
+// AuthorizeToken checks an access token against the current state of its session and
+// user: the session must be active and the user must exist, not be banned and not be
+// awaiting approval. The role and admin claims are overwritten with the stored role, so
+// role changes apply to tokens issued before them. Tokens issued before sessions
+// existed carry no session ID, they are checked against the user alone until they
+// expire or the user is signed out everywhere, see legacyTokenTTL.
+func (s *UserService) AuthorizeToken(claims *middleware.JwtCustomClaims) error {
+	if claims.SessionID == "" {
+		return s.authorizeLegacyToken(claims)
+	}
+	sessionID, err := uuid.Parse(claims.SessionID)
+	if err != nil {
+		return ErrSessionRevoked
+	}
+	session, err := s.Sessions.GetSessionByID(sessionID)
+	if err != nil || !session.Active() || session.UserID != claims.UUID() {
+		return ErrSessionRevoked
+	}
+	if _, err := s.authorizeUser(claims); err != nil {
+		return err
+	}
+
+	if now := time.Now(); now.Sub(session.LastUsedAt) > sessionTouchInterval {
+		if err := s.Sessions.TouchSession(session.ID, now); err != nil {
+			log.Printf("Failed to update session %s: %v\n", session.ID, err)
+		}
+	}
+	return nil
+}
+
+// legacyTokenTTL is how long tokens were valid before sessions existed. Tokens
+// without a session ID that claim to expire later were not issued by this server.
+const legacyTokenTTL = 30 * 24 * time.Hour
+
+// authorizeLegacyToken lets tokens issued before sessions existed run out instead of
+// logging everyone out on upgrade. Bans apply to them, and signing the user out
+// everywhere revokes them. They carry no issue time, but were always issued
+// legacyTokenTTL before they expire.
+func (s *UserService) authorizeLegacyToken(claims *middleware.JwtCustomClaims) error {
+	if claims.ExpiresAt == nil || time.Until(claims.ExpiresAt.Time) > legacyTokenTTL {
+		return ErrSessionRevoked
+	}
+	user, err := s.authorizeUser(claims)
+	if err != nil {
+		return err
+	}
+	issuedAt := claims.ExpiresAt.Add(-legacyTokenTTL)
+	if user.TokensRevokedAt != nil && issuedAt.Before(*user.TokensRevokedAt) {
+		return ErrSessionRevoked
+	}
+	return nil
+}
+
+// authorizeUser checks the user of claims and updates its role claims.
+func (s *UserService) authorizeUser(claims *middleware.JwtCustomClaims) (*model.User, error) {
+	user, err := s.Store.GetUserByID(claims.UUID())
+	if err != nil {
+		return nil, ErrSessionRevoked
+	}
+	if user.IsBanned() {
+		return nil, ErrUserBanned
+	}
+	if user.PendingApproval {
+		return nil, ErrPendingApproval
+	}
+	claims.Admin = user.IsAdmin
+	claims.Role = user.Role
+	return user, nil
+}
+
+func (s *UserService) GetSessions(userID uuid.UUID) ([]model.Session, error) {
+	return s.Sessions.GetActiveSessionsByUserID(userID)
+}
+
+// RevokeSession ends one session of a user. Its access tokens stop working immediately.
+func (s *UserService) RevokeSession(userID, sessionID uuid.UUID) error {
+	session, err := s.Sessions.GetSessionByID(sessionID)
+	if err != nil || session.UserID != userID {
+		return ErrSessionNotFound
+	}
+	return s.Sessions.RevokeSession(session.ID)
+}
+
+// RevokeAllSessions signs the user out everywhere and returns the number of ended
+// sessions. Access tokens without a session stop working as well.
+func (s *UserService) RevokeAllSessions(userID uuid.UUID) (int64, error) {
+	if err := s.Store.RevokeTokens(userID, time.Now()); err != nil {
+		return 0, err
+	}
+	return s.Sessions.RevokeUserSessions(userID)
+}
+
+func newRefreshToken() (token, hash string, err error) {
+	buf := make([]byte, 32)
+	if _, err := rand.Read(buf); err != nil {
+		return "", "", err
+	}
+	token = base64.RawURLEncoding.EncodeToString(buf)
+	return token, hashToken(token), nil
+}
+
+func hashToken(token string) string {
+	sum := sha256.Sum256([]byte(token))
+	return hex.EncodeToString(sum[:])
+}
@@ -1,6 +1,8 @@
 package service
 
 import (
+	"crypto/sha256"
+	"encoding/hex"
 	"fmt"
 	"io"
 	"log"
@@ -11,23 +13,44 @@ import (
 	"github.com/ProjectDistribute/distributor/model"
 	"github.com/ProjectDistribute/distributor/store"
 	"github.com/google/uuid"
-	"github.com/mewkiz/flac"
-	"github.com/tcolgate/mp3"
 )
 
-type FileStorage interface {
-	Save(path string, r io.Reader) error
-	Exists(path string) bool
-	Delete(path string) error
-	Move(src, dst string) error
-}
-
 type SongService struct {
 	Store     *store.SongStore
 	Storage   FileStorage
 	ArtistSvc *ArtistService
 	AlbumSvc  *AlbumService
 	SearchSvc *SearchService
+	Settings  *store.SettingsStore
+	Waveforms *WaveformService // may be nil
+}
+
+// songFileLayoutKey is set once task.MigrateSongFilePaths has moved every song file
+// from its song ID path to its file ID path.
+const songFileLayoutKey = "song_file_layout"
+
+// SongFilePathsMigrated reports whether every song file is stored at its file ID path.
+func SongFilePathsMigrated(settings *store.SettingsStore) bool {
+	layout, _ := settings.Get(songFileLayoutKey)
+	return layout == "by_file_id"
+}
+
+// MarkSongFilePathsMigrated records that no song file is left at its legacy path.
+func MarkSongFilePathsMigrated(settings *store.SettingsStore) error {
+	return settings.Set(songFileLayoutKey, "by_file_id")
+}
+
+// AudioPath returns where the audio of file is stored. Until the song file path
+// migration has completed, files it did not move yet are read from their legacy path.
+func (s *SongService) AudioPath(file *model.SongFile) string {
+	path := file.FilePath()
+	if s.Storage.Exists(path) || s.Settings == nil || SongFilePathsMigrated(s.Settings) {
+		return path
+	}
+	if legacy := file.LegacyFilePath(); s.Storage.Exists(legacy) {
+		return legacy
+	}
+	return path
 }
 
 type SongCreationArtist struct {
@@ -35,9 +58,12 @@ type SongCreationArtist struct {
 	Identifier string `json:"id" validate:"required"`
 }
 
-func (s *SongService) CreateSong(title string, artistsInput []SongCreationArtist, albumTitle string, albumID uuid.UUID) (*model.Song, error) {
+// CreateSong creates a song on the album albumID, or on the album titled albumTitle by
+// one of the artists, which is created if there is none. Track and disc number are
+// 0 when unknown.
+func (s *SongService) CreateSong(title string, artistsInput []SongCreationArtist, albumTitle string, albumID uuid.UUID, trackNumber, discNumber int) (*model.Song, error) {
 	// Resolve all artists
-	artists, err := s.resolveArtists(artistsInput)
+	artists, err := s.ArtistSvc.ResolveArtists(artistsInput)
 	if err != nil {
 		return nil, err
 	}
@@ -74,9 +100,11 @@ func (s *SongService) CreateSong(title string, artistsInput []SongCreationArtist
 	}
 
 	song := &model.Song{
-		Title:   title,
-		AlbumID: album.ID,
-		Artists: artists,
+		Title:       title,
+		AlbumID:     album.ID,
+		Artists:     artists,
+		TrackNumber: trackNumber,
+		DiscNumber:  discNumber,
 	}
 	log.Printf("Creating song %s\n", song.Title)
 	if err := s.Store.CreateSong(song); err != nil {
@@ -100,7 +128,8 @@ func (s *SongService) CreateSong(title string, artistsInput []SongCreationArtist
 	return song, nil
 }
 
-func (s *SongService) UpdateSong(songID uuid.UUID, title string, artistsInput []SongCreationArtist, albumTitle string, albumID uuid.UUID) (*model.Song, error) {
+// UpdateSong changes the given fields of a song, empty and nil ones are left as they are.
+func (s *SongService) UpdateSong(songID uuid.UUID, title string, artistsInput []SongCreationArtist, albumTitle string, albumID uuid.UUID, trackNumber, discNumber *int) (*model.Song, error) {
 	song, err := s.Store.GetSongByID(songID)
 	if err != nil {
 		return nil, fmt.Errorf("song not found")
@@ -110,10 +139,16 @@ func (s *SongService) UpdateSong(songID uuid.UUID, title string, artistsInput []
 	if title != "" {
 		song.Title = title
 	}
+	if trackNumber != nil {
+		song.TrackNumber = *trackNumber
+	}
+	if discNumber != nil {
+		song.DiscNumber = *discNumber
+	}
 
 	// Update Artists if provided
 	if artistsInput != nil {
-		artists, err := s.resolveArtists(artistsInput)
+		artists, err := s.ArtistSvc.ResolveArtists(artistsInput)
 		if err != nil {
 			return nil, err
 		}
@@ -172,31 +207,51 @@ func (s *SongService) UpdateSong(songID uuid.UUID, title string, artistsInput []
 	return song, nil
 }
 
-func (s *SongService) AssignFileToSong(songID uuid.UUID, format string, data io.Reader) (*model.SongFile, error) {
+// AssignFileToSong stores data as a file of the song. The content must be valid
+// audio of the given format, otherwise an *InvalidAudioError is returned.
+func (s *SongService) AssignFileToSong(songID uuid.UUID, format string, data io.ReadSeeker) (*model.SongFile, error) {
 	song, err := s.Store.GetSongByID(songID)
 	if err != nil {
 		return nil, fmt.Errorf("song not found")
 	}
 
-	sf := model.SongFile{SongID: song.ID, Format: format}
+	if report := ValidateAudio(data, format); !report.Valid() {
+		return nil, &InvalidAudioError{Report: report}
+	}
+	if _, err := data.Seek(0, io.SeekStart); err != nil {
+		return nil, fmt.Errorf("failed to read song file: %v", err)
+	}
+
+	sf := model.SongFile{ID: uuid.New(), SongID: song.ID, Format: format}
 
-	if err := s.Storage.Save(sf.FilePath(), data); err != nil {
+	hash := sha256.New()
+	if err := s.Storage.Save(sf.FilePath(), io.TeeReader(data, hash)); err != nil {
 		return nil, fmt.Errorf("failed to save song file")
 	}
+	sf.SHA256 = hex.EncodeToString(hash.Sum(nil))
 
-	duration, err := s.ProbeDuration(sf.FilePath())
+	blob, err := s.resolveDuplicate(&sf)
 	if err != nil {
 		_ = s.Storage.Delete(sf.FilePath())
-		return nil, fmt.Errorf("failed to probe song file duration: %v", err)
+		return nil, err
+	}
+	if blob != nil {
+		_ = s.Storage.Delete(sf.FilePath())
+		key := blob.BlobKey()
+		sf.BlobID = &key
 	}
-	sf.Duration = uint(duration * 1000)
-	if info, err := os.Stat(sf.FilePath()); err == nil {
-		sf.Size = info.Size()
+
+	if err := s.ProbeSongFile(&sf); err != nil {
+		if blob == nil {
+			_ = s.Storage.Delete(sf.FilePath())
+		}
+		return nil, fmt.Errorf("failed to probe song file: %v", err)
 	}
 
 	if err := s.Store.CreateSongFile(&sf); err != nil {
 		return nil, fmt.Errorf("failed to create song file record")
 	}
+	s.Waveforms.Enqueue(sf)
 
 	return &sf, nil
 }
@@ -207,7 +262,7 @@ func (s *SongService) AssignFileToSongByPath(songID uuid.UUID, sourcePath string
 		return nil, fmt.Errorf("song not found")
 	}
 
-	ext := strings.TrimPrefix(filepath.Ext(sourcePath), ".")
+	ext := strings.ToLower(strings.TrimPrefix(filepath.Ext(sourcePath), "."))
 	if ext == "" {
 		return nil, fmt.Errorf("could not determine file format from path")
 	}
@@ -221,27 +276,54 @@ func (s *SongService) AssignFileToSongByPath(songID uuid.UUID, sourcePath string
 	if !allowed[ext] {
 		return nil, fmt.Errorf("unsupported file format: %s", ext)
 	}
+	report, err := s.ValidateAudioFile(sourcePath)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read song file: %v", err)
+	}
+	if !report.Valid() {
+		return nil, &InvalidAudioError{Report: report}
+	}
 
-	sf := model.SongFile{SongID: song.ID, Format: ext}
-	destPath := sf.FilePath()
-
-	if err := s.Storage.Move(sourcePath, destPath); err != nil {
-		return nil, fmt.Errorf("failed to move song file: %v", err)
+	sf := model.SongFile{ID: uuid.New(), SongID: song.ID, Format: ext}
+	if sf.SHA256, err = HashFile(sourcePath); err != nil {
+		return nil, fmt.Errorf("failed to hash song file: %v", err)
 	}
 
-	duration, err := s.ProbeDuration(destPath)
+	// Duplicates are refused before the source is touched
+	blob, err := s.resolveDuplicate(&sf)
 	if err != nil {
-		_ = s.Storage.Delete(destPath)
-		return nil, fmt.Errorf("failed to probe song file duration: %v", err)
+		return nil, err
+	}
+	if blob != nil {
+		key := blob.BlobKey()
+		sf.BlobID = &key
+	}
+	destPath := sf.FilePath()
+
+	if blob == nil {
+		if err := s.Storage.Move(sourcePath, destPath); err != nil {
+			return nil, fmt.Errorf("failed to move song file: %v", err)
+		}
 	}
-	sf.Duration = uint(duration * 1000)
-	if info, err := os.Stat(destPath); err == nil {
-		sf.Size = info.Size()
+
+	if err := s.ProbeSongFile(&sf); err != nil {
+		if blob == nil {
+			_ = s.Storage.Delete(destPath)
+		}
+		return nil, fmt.Errorf("failed to probe song file: %v", err)
 	}
 
 	if err := s.Store.CreateSongFile(&sf); err != nil {
 		return nil, fmt.Errorf("failed to create song file record")
 	}
+	// A linked duplicate keeps its source until the record exists, so a failed
+	// assignment can be retried
+	if blob != nil {
+		if err := os.Remove(sourcePath); err != nil {
+			log.Printf("Warning: failed to remove linked duplicate %s: %v\n", sourcePath, err)
+		}
+	}
+	s.Waveforms.Enqueue(sf)
 
 	return &sf, nil
 }
@@ -268,11 +350,18 @@ func (s *SongService) DeleteSongFile(fileID uuid.UUID) error {
 		return fmt.Errorf("file not found")
 	}
 
-	// Delete from storage
+	// Delete from storage, unless other files share the audio
 	path := file.FilePath()
-	if err := s.Storage.Delete(path); err != nil {
-		log.Printf("Warning: failed to delete file from storage %s: %v\n", path, err)
-		// We continue to delete from DB even if storage delete fails (maybe file missing)
+	if users, err := s.Store.CountBlobUsers(file.BlobKey(), file.ID); err != nil || users > 0 {
+		log.Printf("Keeping %s, it is shared with %d other files\n", path, users)
+	} else {
+		if err := s.Storage.Delete(path); err != nil {
+			log.Printf("Warning: failed to delete file from storage %s: %v\n", path, err)
+			// We continue to delete from DB even if storage delete fails (maybe file missing)
+		}
+		if err := s.Storage.Delete(file.WaveformPath()); err != nil && !os.IsNotExist(err) {
+			log.Printf("Warning: failed to delete waveform from storage %s: %v\n", file.WaveformPath(), err)
+		}
 	}
 
 	// Delete from DB
@@ -291,77 +380,62 @@ func (s *SongService) GetSongsByAlbumID(albumID uuid.UUID) ([]model.Song, error)
 	return s.Store.GetSongsByAlbumID(albumID)
 }
 
-func (s *SongService) ProbeDuration(path string) (float64, error) {
+// AudioInfo describes the audio stream of a file. Fields that could not be
+// determined are zero.
+type AudioInfo struct {
+	Duration   float64 // seconds
+	Bitrate    int     // average, kbit/s
+	SampleRate int     // Hz
+	BitDepth   int     // lossless formats only
+	Channels   int
+	Codec      string // e.g. mp3, flac, pcm, vorbis, opus, aac, alac
+}
+
+// ProbeAudio probes the local file at path, e.g. before it is imported.
+func (s *SongService) ProbeAudio(path string) (AudioInfo, error) {
 	f, err := os.Open(path)
 	if err != nil {
-		return 0, err
+		return AudioInfo{}, err
 	}
 	defer f.Close()
+	return probeAudio(f, filepath.Ext(path))
+}
 
-	ext := strings.ToLower(filepath.Ext(path))
-	switch ext {
-	case ".mp3":
-		d := mp3.NewDecoder(f)
-		var duration float64
-		var frame mp3.Frame
-		var skipped int
-		for {
-			if err := d.Decode(&frame, &skipped); err != nil {
-				if err == io.EOF {
-					break
-				}
-				break
-			}
-			duration += frame.Duration().Seconds()
-		}
-		return duration, nil
-
-	case ".flac":
-		stream, err := flac.Parse(f)
-		if err != nil {
-			return 0, err
-		}
-		if stream.Info.SampleRate == 0 {
-			return 0, nil
-		}
-		return float64(stream.Info.NSamples) / float64(stream.Info.SampleRate), nil
-
-	default:
-		// Unsupported format for duration probing
-		log.Printf("Warning: Duration probing not supported for %s\n", ext)
-		return 0, nil
+// ValidateAudioFile validates the local file at path against the format of its extension.
+func (s *SongService) ValidateAudioFile(path string) (AudioValidation, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return AudioValidation{}, err
 	}
+	defer f.Close()
+	return ValidateAudio(f, strings.ToLower(strings.TrimPrefix(filepath.Ext(path), "."))), nil
 }
 
-func (s *SongService) resolveArtists(artistsInput []SongCreationArtist) ([]model.Artist, error) {
-	var artists []model.Artist
-	for _, a := range artistsInput {
-		var artist *model.Artist
-		var err error
-
-		// Try to parse as UUID first
-		if id, uuidErr := uuid.Parse(a.Identifier); uuidErr == nil {
-			artist, err = s.ArtistSvc.Store.GetArtistByID(id)
-			if err == nil {
-				log.Printf("Artist %s found by ID, using existing artist\n", a.Name)
-			} else {
-				artist = nil
-			}
-		}
-
-		if artist == nil {
-			artist, err = s.ArtistSvc.GetArtistByIdentifier(a.Identifier)
-			if err != nil {
-				log.Printf("Artist %s not found, creating new artist\n", a.Name)
-				artist, err = s.ArtistSvc.CreateArtist(a.Name, []string{a.Identifier})
-				if err != nil {
-					return nil, err
-				}
-			} else {
-				log.Printf("Artist %s found, using existing artist\n", a.Name)
-			}
-		}
-		artists = append(artists, *artist)
+// ProbeSongFile fills in the duration, size and audio properties of sf from its
+// stored file. Where the format does not give a bitrate the average over the
+// file is used.
+func (s *SongService) ProbeSongFile(sf *model.SongFile) error {
+	f, err := s.Storage.Open(s.AudioPath(sf))
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	info, err := probeAudio(f, "."+sf.Format)
+	if err != nil {
+		return err
+	}
+	sf.Duration = uint(info.Duration * 1000)
+	if stat, err := f.Stat(); err == nil {
+		sf.Size = stat.Size()
 	}
-	return artists, nil
+	sf.SampleRate = info.SampleRate
+	sf.BitDepth = info.BitDepth
+	sf.Channels = info.Channels
+	sf.Codec = info.Codec
+	sf.Bitrate = info.Bitrate
+	if sf.Bitrate == 0 && sf.Duration > 0 {
+		// bytes * 8 / ms = kbit/s
+		sf.Bitrate = int(sf.Size * 8 / int64(sf.Duration))
+	}
+	return nil
 }
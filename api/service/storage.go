@@ -0,0 +1,165 @@
+package service
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"io/fs"
+	"path/filepath"
+	"sync"
+	"time"
+
+	"github.com/ProjectDistribute/distributor/utils"
+)
+
+// FileStorage holds song files, renditions and covers. All reads of stored files
+// go through it, so it can live on local disk (utils.LocalFileStorage) or in an
+// object store (utils.S3FileStorage).
+type FileStorage interface {
+	Save(path string, r io.Reader) error
+	Exists(path string) bool
+	Delete(path string) error
+	// Move moves the local file at src into storage at dst.
+	Move(src, dst string) error
+	Open(path string) (utils.StoredFile, error)
+	Stat(path string) (fs.FileInfo, error)
+}
+
+// PresignedStorage is implemented by storages that can hand out temporary URLs to
+// their files.
+type PresignedStorage interface {
+	PresignGet(path string, expires time.Duration) (string, error)
+	// RedirectReads reports whether clients should download files from presigned
+	// URLs instead of through the server.
+	RedirectReads() bool
+}
+
+// ContextStorage is implemented by storages whose reads can be cancelled, so a
+// remote read does not outlive the request it serves.
+type ContextStorage interface {
+	OpenContext(ctx context.Context, path string) (utils.StoredFile, error)
+}
+
+// OpenContext opens the file at path with reads bound to ctx where the storage
+// supports it.
+func OpenContext(ctx context.Context, storage FileStorage, path string) (utils.StoredFile, error) {
+	if s, ok := CurrentStorage(storage).(ContextStorage); ok {
+		return s.OpenContext(ctx, path)
+	}
+	return storage.Open(path)
+}
+
+const (
+	StorageBackendLocal = "local"
+	StorageBackendS3    = "s3"
+)
+
+// StorageTarget names a storage backend. S3 buckets are configured with the S3_*
+// environment variables, so only local storage has further options.
+type StorageTarget struct {
+	Backend string `json:"backend" example:"local" validate:"required"`
+	// Root is the directory of local storage, the working directory if empty.
+	Root string `json:"root,omitempty" example:"/mnt/music"`
+}
+
+func (t StorageTarget) String() string {
+	if t.Backend == StorageBackendLocal && t.Root != "" {
+		return t.Backend + ":" + t.Root
+	}
+	return t.Backend
+}
+
+// Same reports whether t and other are the same storage location.
+func (t StorageTarget) Same(other StorageTarget) bool {
+	if t.Backend != other.Backend {
+		return false
+	}
+	if t.Backend != StorageBackendLocal {
+		return true
+	}
+	a, errA := filepath.Abs(t.Root)
+	b, errB := filepath.Abs(other.Root)
+	return errA == nil && errB == nil && a == b
+}
+
+// NewFileStorage opens the storage backend named by target.
+func NewFileStorage(target StorageTarget) (FileStorage, error) {
+	switch target.Backend {
+	case StorageBackendLocal:
+		return utils.LocalFileStorage{Root: target.Root}, nil
+	case StorageBackendS3:
+		return utils.NewS3FileStorageFromEnv()
+	default:
+		return nil, fmt.Errorf("unknown storage backend %q, use %s or %s", target.Backend, StorageBackendLocal, StorageBackendS3)
+	}
+}
+
+// TargetOf returns the StorageTarget describing storage.
+func TargetOf(storage FileStorage) StorageTarget {
+	switch s := CurrentStorage(storage).(type) {
+	case utils.LocalFileStorage:
+		return StorageTarget{Backend: StorageBackendLocal, Root: s.Root}
+	case *utils.S3FileStorage:
+		return StorageTarget{Backend: StorageBackendS3}
+	default:
+		return StorageTarget{Backend: fmt.Sprintf("%T", s)}
+	}
+}
+
+// SwitchableStorage is the FileStorage the services use. It delegates to another
+// storage that can be replaced while the server runs, which is how a storage
+// migration cuts over.
+type SwitchableStorage struct {
+	mu      sync.RWMutex
+	current FileStorage
+}
+
+func NewSwitchableStorage(storage FileStorage) *SwitchableStorage {
+	return &SwitchableStorage{current: storage}
+}
+
+func (s *SwitchableStorage) Current() FileStorage {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return s.current
+}
+
+func (s *SwitchableStorage) Switch(storage FileStorage) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.current = storage
+}
+
+func (s *SwitchableStorage) Save(path string, r io.Reader) error { return s.Current().Save(path, r) }
+func (s *SwitchableStorage) Exists(path string) bool             { return s.Current().Exists(path) }
+func (s *SwitchableStorage) Delete(path string) error            { return s.Current().Delete(path) }
+func (s *SwitchableStorage) Move(src, dst string) error          { return s.Current().Move(src, dst) }
+
+func (s *SwitchableStorage) Open(path string) (utils.StoredFile, error) {
+	return s.Current().Open(path)
+}
+
+func (s *SwitchableStorage) Stat(path string) (fs.FileInfo, error) {
+	return s.Current().Stat(path)
+}
+
+// CurrentStorage returns the storage a SwitchableStorage currently delegates to,
+// or storage itself.
+func CurrentStorage(storage FileStorage) FileStorage {
+	if s, ok := storage.(*SwitchableStorage); ok {
+		return s.Current()
+	}
+	return storage
+}
+
+// TranscodeInput returns what the transcoder should read the stored file at path
+// from: its location on local disk, a presigned URL otherwise.
+func TranscodeInput(storage FileStorage, path string) (string, error) {
+	switch s := CurrentStorage(storage).(type) {
+	case utils.LocalFileStorage:
+		return s.FullPath(path), nil
+	case PresignedStorage:
+		return s.PresignGet(path, 6*time.Hour)
+	}
+	return path, nil
+}
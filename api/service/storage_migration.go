@@ -0,0 +1,283 @@
+package service
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"time"
+
+	"github.com/ProjectDistribute/distributor/model"
+	"github.com/ProjectDistribute/distributor/store"
+	"gorm.io/gorm"
+)
+
+var (
+	ErrNoStorageMigration       = errors.New("no storage migration")
+	ErrStorageMigrationSame     = errors.New("destination is the storage in use")
+	ErrStorageMigrationNotReady = errors.New("storage migration has not completed")
+	ErrStorageMigrationFailures = errors.New("storage migration has files that failed to copy")
+)
+
+// storageMigrationSaveEvery is how many copied files the persisted counts may lag behind.
+const storageMigrationSaveEvery = 50
+
+// StorageMigrationService copies the stored files to another storage backend and
+// switches the server over to it.
+type StorageMigrationService struct {
+	Store          *store.StorageMigrationStore
+	SongStore      *store.SongStore
+	RenditionStore *store.RenditionStore
+	AlbumSvc       *AlbumService
+	Storage        *SwitchableStorage
+}
+
+// StoredItem is a file to migrate. SHA256 is the hash it must have, empty if unknown.
+type StoredItem struct {
+	Path   string
+	SHA256 string
+}
+
+func SourceTarget(m *model.StorageMigration) StorageTarget {
+	return StorageTarget{Backend: m.SourceBackend, Root: m.SourceRoot}
+}
+
+func DestTarget(m *model.StorageMigration) StorageTarget {
+	return StorageTarget{Backend: m.DestBackend, Root: m.DestRoot}
+}
+
+// Latest returns the most recent migration, ErrNoStorageMigration if there is none.
+func (s *StorageMigrationService) Latest() (*model.StorageMigration, error) {
+	m, err := s.Store.GetLatestMigration("")
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return nil, ErrNoStorageMigration
+	}
+	return m, err
+}
+
+// Begin creates a migration from the storage in use to target. An unfinished
+// migration between the same storages is picked up again instead.
+func (s *StorageMigrationService) Begin(target StorageTarget) (*model.StorageMigration, error) {
+	source := TargetOf(s.Storage)
+	if target.Same(source) {
+		return nil, ErrStorageMigrationSame
+	}
+	if _, err := NewFileStorage(target); err != nil {
+		return nil, err
+	}
+
+	latest, err := s.Latest()
+	if err != nil && !errors.Is(err, ErrNoStorageMigration) {
+		return nil, err
+	}
+	if latest != nil && latest.Status != model.StorageMigrationCutOver &&
+		SourceTarget(latest).Same(source) && DestTarget(latest).Same(target) {
+		latest.Status = model.StorageMigrationRunning
+		latest.Error = ""
+		latest.CompletedAt = nil
+		return latest, s.Store.UpdateMigration(latest)
+	}
+
+	m := &model.StorageMigration{
+		SourceBackend: source.Backend,
+		SourceRoot:    source.Root,
+		DestBackend:   target.Backend,
+		DestRoot:      target.Root,
+		Status:        model.StorageMigrationRunning,
+	}
+	return m, s.Store.CreateMigration(m)
+}
+
+// StoredItems lists every file the server keeps in storage: song files, renditions
+// and the waveforms and album covers that exist.
+func (s *StorageMigrationService) StoredItems() ([]StoredItem, error) {
+	files, err := s.SongStore.GetAllSongFiles()
+	if err != nil {
+		return nil, err
+	}
+	renditions, err := s.RenditionStore.GetAllRenditions()
+	if err != nil {
+		return nil, err
+	}
+	albums, err := s.AlbumSvc.Store.GetAllAlbums()
+	if err != nil {
+		return nil, err
+	}
+
+	var items []StoredItem
+	index := make(map[string]int)
+	add := func(path, hash string) {
+		if i, ok := index[path]; ok {
+			// Linked files share their audio, any of them may know its hash
+			if items[i].SHA256 == "" {
+				items[i].SHA256 = hash
+			}
+			return
+		}
+		index[path] = len(items)
+		items = append(items, StoredItem{Path: path, SHA256: hash})
+	}
+
+	for _, f := range files {
+		add(f.FilePath(), f.SHA256)
+		if s.Storage.Exists(f.WaveformPath()) {
+			add(f.WaveformPath(), "")
+		}
+	}
+	for _, r := range renditions {
+		add(r.FilePath(), "")
+	}
+	for _, a := range albums {
+		for _, res := range []string{"hq", "lq"} {
+			path := s.AlbumSvc.GetAlbumCoverPath(a.ID, "jpg", res)
+			if s.Storage.Exists(path) {
+				add(path, "")
+			}
+		}
+	}
+	return items, nil
+}
+
+// CopyPending copies the files m has not copied yet from source to dest and
+// returns how many it copied and how many failed.
+func (s *StorageMigrationService) CopyPending(m *model.StorageMigration, source, dest FileStorage, job *Job) (int, int, error) {
+	items, err := s.StoredItems()
+	if err != nil {
+		return 0, 0, err
+	}
+	done, err := s.Store.GetItemPaths(m.ID)
+	if err != nil {
+		return 0, 0, err
+	}
+
+	var pending []StoredItem
+	for _, item := range items {
+		if !done[item.Path] {
+			pending = append(pending, item)
+		}
+	}
+	m.Total = len(items)
+	m.Copied = len(items) - len(pending)
+	m.Failed = 0
+	job.AddTotal(len(pending))
+
+	copied := 0
+	for i, item := range pending {
+		hash, size, err := copyVerified(source, dest, item)
+		if err == nil {
+			err = s.Store.AddItem(&model.StorageMigrationItem{MigrationID: m.ID, Path: item.Path, SHA256: hash, Size: size})
+		}
+		if err != nil {
+			log.Printf("Failed to migrate %s: %v\n", item.Path, err)
+			job.Fail(item.Path, err)
+			m.Failed++
+		} else {
+			job.Advance()
+			m.Copied++
+			copied++
+		}
+
+		if (i+1)%storageMigrationSaveEvery == 0 {
+			if err := s.Store.UpdateMigration(m); err != nil {
+				log.Printf("Failed to save storage migration progress: %v\n", err)
+			}
+		}
+	}
+	return copied, m.Failed, s.Store.UpdateMigration(m)
+}
+
+// copyVerified copies the file to dest and reads it back, failing if the copy does
+// not hash the same as the source or the source not as expected.
+func copyVerified(source, dest FileStorage, item StoredItem) (string, int64, error) {
+	f, err := source.Open(item.Path)
+	if err != nil {
+		return "", 0, err
+	}
+	defer f.Close()
+
+	h := sha256.New()
+	counter := &countingWriter{}
+	if err := dest.Save(item.Path, io.TeeReader(f, io.MultiWriter(h, counter))); err != nil {
+		return "", 0, err
+	}
+	hash := hex.EncodeToString(h.Sum(nil))
+
+	copyHash, err := HashStoredFile(dest, item.Path)
+	if err != nil {
+		return "", 0, fmt.Errorf("reading back copy: %w", err)
+	}
+	if copyHash != hash {
+		_ = dest.Delete(item.Path)
+		return "", 0, fmt.Errorf("copy has SHA-256 %s, source has %s", copyHash, hash)
+	}
+	if item.SHA256 != "" && item.SHA256 != hash {
+		return "", 0, fmt.Errorf("source is corrupt: expected SHA-256 %s, found %s", item.SHA256, hash)
+	}
+	return hash, counter.n, nil
+}
+
+type countingWriter struct {
+	n int64
+}
+
+func (w *countingWriter) Write(p []byte) (int, error) {
+	w.n += int64(len(p))
+	return len(p), nil
+}
+
+// Cutover switches the server to the destination of a completed migration. Files
+// added since the migration completed are copied first, and once more after the
+// switch for those written in between.
+func (s *StorageMigrationService) Cutover(m *model.StorageMigration, force bool) error {
+	if m.Status != model.StorageMigrationCompleted {
+		return ErrStorageMigrationNotReady
+	}
+	source := s.Storage.Current()
+	if !TargetOf(source).Same(SourceTarget(m)) {
+		return fmt.Errorf("the server no longer uses the source storage %s", SourceTarget(m))
+	}
+	dest, err := NewFileStorage(DestTarget(m))
+	if err != nil {
+		return err
+	}
+
+	if _, failed, err := s.CopyPending(m, source, dest, &Job{}); err != nil {
+		return err
+	} else if failed > 0 && !force {
+		return ErrStorageMigrationFailures
+	}
+	s.Storage.Switch(dest)
+	log.Printf("Switched storage from %s to %s\n", SourceTarget(m), DestTarget(m))
+	if _, _, err := s.CopyPending(m, source, dest, &Job{}); err != nil {
+		log.Printf("Failed to copy files added during storage cutover: %v\n", err)
+	}
+
+	now := time.Now()
+	m.Status = model.StorageMigrationCutOver
+	m.CutoverAt = &now
+	return s.Store.UpdateMigration(m)
+}
+
+// ApplyCutover switches to the destination of the cut over migrations when the
+// server was started with their source storage, so a cutover survives restarts
+// until the storage configuration is updated.
+func (s *StorageMigrationService) ApplyCutover() error {
+	migrations, err := s.Store.GetMigrationsByStatus(model.StorageMigrationCutOver)
+	if err != nil {
+		return err
+	}
+	for _, m := range migrations {
+		if !TargetOf(s.Storage).Same(SourceTarget(&m)) {
+			continue
+		}
+		dest, err := NewFileStorage(DestTarget(&m))
+		if err != nil {
+			return err
+		}
+		s.Storage.Switch(dest)
+		log.Printf("Using storage %s from migration %d, update the storage configuration to match\n", DestTarget(&m), m.ID)
+	}
+	return nil
+}
@@ -0,0 +1,127 @@
+package service
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/ProjectDistribute/distributor/model"
+	"github.com/ProjectDistribute/distributor/store"
+	"github.com/ProjectDistribute/distributor/utils"
+	"github.com/google/uuid"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func newTestStorageMigrationService(t *testing.T, root string) *StorageMigrationService {
+	gdb := newTestDB(t)
+
+	storage := NewSwitchableStorage(utils.LocalFileStorage{Root: root})
+	return &StorageMigrationService{
+		Store:          store.NewStorageMigrationStore(gdb),
+		SongStore:      store.NewSongStore(gdb),
+		RenditionStore: store.NewRenditionStore(gdb),
+		AlbumSvc:       &AlbumService{Store: store.NewAlbumStore(gdb), Storage: storage},
+		Storage:        storage,
+	}
+}
+
+func addTestSongFile(t *testing.T, svc *StorageMigrationService, audio string) *model.SongFile {
+	hash, err := HashReader(strings.NewReader(audio))
+	require.NoError(t, err)
+	sf := &model.SongFile{ID: uuid.New(), SongID: uuid.New(), Format: "flac", SHA256: hash}
+	require.NoError(t, svc.SongStore.CreateSongFile(sf))
+	require.NoError(t, svc.Storage.Save(sf.FilePath(), strings.NewReader(audio)))
+	return sf
+}
+
+func readTestFile(t *testing.T, root, path string) string {
+	data, err := os.ReadFile(filepath.Join(root, path))
+	require.NoError(t, err)
+	return string(data)
+}
+
+func TestStorageMigration_CopiesResumesAndCutsOver(t *testing.T) {
+	src, dst := t.TempDir(), t.TempDir()
+	svc := newTestStorageMigrationService(t, src)
+
+	sf := addTestSongFile(t, svc, "first song")
+	album, err := svc.AlbumSvc.Store.CreateAlbum(&model.Album{Title: "Album"})
+	require.NoError(t, err)
+	cover := svc.AlbumSvc.GetAlbumCoverPath(album.ID, "jpg", "hq")
+	require.NoError(t, svc.Storage.Save(cover, strings.NewReader("cover")))
+
+	m, err := svc.Begin(StorageTarget{Backend: StorageBackendLocal, Root: dst})
+	require.NoError(t, err)
+	source := svc.Storage.Current()
+	dest, err := NewFileStorage(DestTarget(m))
+	require.NoError(t, err)
+
+	copied, failed, err := svc.CopyPending(m, source, dest, &Job{})
+	require.NoError(t, err)
+	assert.Equal(t, 2, copied)
+	assert.Equal(t, 0, failed)
+	assert.Equal(t, "first song", readTestFile(t, dst, sf.FilePath()))
+	assert.Equal(t, "cover", readTestFile(t, dst, cover))
+
+	// A restarted migration only copies what was added since
+	sf2 := addTestSongFile(t, svc, "second song")
+	again, err := svc.Begin(StorageTarget{Backend: StorageBackendLocal, Root: dst})
+	require.NoError(t, err)
+	assert.Equal(t, m.ID, again.ID)
+	copied, _, err = svc.CopyPending(again, source, dest, &Job{})
+	require.NoError(t, err)
+	assert.Equal(t, 1, copied)
+	assert.Equal(t, 3, again.Copied)
+
+	// Cutover is refused until the migration completed
+	assert.ErrorIs(t, svc.Cutover(again, false), ErrStorageMigrationNotReady)
+	again.Status = model.StorageMigrationCompleted
+	sf3 := addTestSongFile(t, svc, "third song")
+	require.NoError(t, svc.Cutover(again, false))
+
+	assert.Equal(t, model.StorageMigrationCutOver, again.Status)
+	assert.True(t, TargetOf(svc.Storage).Same(StorageTarget{Backend: StorageBackendLocal, Root: dst}))
+	assert.Equal(t, "second song", readTestFile(t, dst, sf2.FilePath()))
+	assert.Equal(t, "third song", readTestFile(t, dst, sf3.FilePath()))
+
+	// A server restarted with the old configuration switches again
+	svc.Storage.Switch(utils.LocalFileStorage{Root: src})
+	require.NoError(t, svc.ApplyCutover())
+	assert.True(t, TargetOf(svc.Storage).Same(StorageTarget{Backend: StorageBackendLocal, Root: dst}))
+}
+
+func TestStorageMigration_CorruptSourceFails(t *testing.T) {
+	src, dst := t.TempDir(), t.TempDir()
+	svc := newTestStorageMigrationService(t, src)
+
+	sf := addTestSongFile(t, svc, "original")
+	require.NoError(t, svc.Storage.Save(sf.FilePath(), strings.NewReader("bit rot")))
+
+	m, err := svc.Begin(StorageTarget{Backend: StorageBackendLocal, Root: dst})
+	require.NoError(t, err)
+	dest, err := NewFileStorage(DestTarget(m))
+	require.NoError(t, err)
+
+	copied, failed, err := svc.CopyPending(m, svc.Storage.Current(), dest, &Job{})
+	require.NoError(t, err)
+	assert.Equal(t, 0, copied)
+	assert.Equal(t, 1, failed)
+
+	m.Status = model.StorageMigrationCompleted
+	assert.ErrorIs(t, svc.Cutover(m, false), ErrStorageMigrationFailures)
+	assert.True(t, TargetOf(svc.Storage).Same(StorageTarget{Backend: StorageBackendLocal, Root: src}))
+	require.NoError(t, svc.Cutover(m, true))
+	assert.True(t, TargetOf(svc.Storage).Same(StorageTarget{Backend: StorageBackendLocal, Root: dst}))
+}
+
+func TestStorageMigration_RefusesCurrentStorage(t *testing.T) {
+	src := t.TempDir()
+	svc := newTestStorageMigrationService(t, src)
+
+	_, err := svc.Begin(StorageTarget{Backend: StorageBackendLocal, Root: src})
+	assert.ErrorIs(t, err, ErrStorageMigrationSame)
+	_, err = svc.Begin(StorageTarget{Backend: "tape"})
+	assert.Error(t, err)
+}
@@ -0,0 +1,141 @@
+package service
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/md5"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
+	"log"
+	"strings"
+
+	"github.com/ProjectDistribute/distributor/model"
+)
+
+var ErrInvalidCredentials = errors.New("wrong username or password")
+
+// SetSubsonicPassword stores the password used by Subsonic clients. Subsonic token
+// auth sends md5(password + salt), so the password is kept encrypted rather than hashed.
+// An empty password disables token auth for the user.
+func (s *UserService) SetSubsonicPassword(user *model.User, password string) error {
+	if password == "" {
+		user.SubsonicPassword = ""
+	} else {
+		enc, err := s.encryptSecret(password)
+		if err != nil {
+			return err
+		}
+		user.SubsonicPassword = enc
+	}
+	_, err := s.Store.UpdateUser(user)
+	return err
+}
+
+// AuthenticateSubsonic checks the credentials of a Subsonic request: either token and
+// salt (u, t, s) or a password (u, p), optionally hex encoded with an "enc:" prefix.
+// Passwords are accepted if they match the Subsonic password or the account password.
+func (s *UserService) AuthenticateSubsonic(username, password, token, salt string) (*model.User, error) {
+	user, err := s.authenticateSubsonic(username, password, token, salt)
+	if err != nil {
+		return nil, err
+	}
+	if user.IsBanned() {
+		return nil, ErrUserBanned
+	}
+	if user.PendingApproval {
+		return nil, ErrPendingApproval
+	}
+	return user, nil
+}
+
+func (s *UserService) authenticateSubsonic(username, password, token, salt string) (*model.User, error) {
+	user, err := s.Store.GetUserByUsername(username)
+	if err != nil {
+		return nil, ErrInvalidCredentials
+	}
+
+	subsonicPassword := ""
+	if user.SubsonicPassword != "" {
+		subsonicPassword, err = s.decryptSecret(user.SubsonicPassword)
+		if err != nil {
+			// Happens if the JWT secret was rotated, the user has to set a new Subsonic password
+			log.Printf("Failed to decrypt Subsonic password of %s: %v\n", user.Username, err)
+			subsonicPassword = ""
+		}
+	}
+
+	if token != "" {
+		if subsonicPassword == "" || salt == "" {
+			return nil, ErrInvalidCredentials
+		}
+		sum := md5.Sum([]byte(subsonicPassword + salt))
+		expected := hex.EncodeToString(sum[:])
+		if subtle.ConstantTimeCompare([]byte(expected), []byte(strings.ToLower(token))) != 1 {
+			return nil, ErrInvalidCredentials
+		}
+		return user, nil
+	}
+
+	if enc, ok := strings.CutPrefix(password, "enc:"); ok {
+		decoded, err := hex.DecodeString(enc)
+		if err != nil {
+			return nil, ErrInvalidCredentials
+		}
+		password = string(decoded)
+	}
+	if password == "" {
+		return nil, ErrInvalidCredentials
+	}
+	if subsonicPassword != "" && subtle.ConstantTimeCompare([]byte(subsonicPassword), []byte(password)) == 1 {
+		return user, nil
+	}
+	if s.CheckPassword(user, password) == nil {
+		return user, nil
+	}
+	return nil, ErrInvalidCredentials
+}
+
+func (s *UserService) secretCipher() (cipher.AEAD, error) {
+	key := sha256.Sum256([]byte("subsonic:" + s.JWTSecret))
+	block, err := aes.NewCipher(key[:])
+	if err != nil {
+		return nil, err
+	}
+	return cipher.NewGCM(block)
+}
+
+func (s *UserService) encryptSecret(plain string) (string, error) {
+	gcm, err := s.secretCipher()
+	if err != nil {
+		return "", err
+	}
+	nonce := make([]byte, gcm.NonceSize())
+	if _, err := rand.Read(nonce); err != nil {
+		return "", err
+	}
+	sealed := gcm.Seal(nonce, nonce, []byte(plain), nil)
+	return base64.StdEncoding.EncodeToString(sealed), nil
+}
+
+func (s *UserService) decryptSecret(enc string) (string, error) {
+	gcm, err := s.secretCipher()
+	if err != nil {
+		return "", err
+	}
+	data, err := base64.StdEncoding.DecodeString(enc)
+	if err != nil {
+		return "", err
+	}
+	if len(data) < gcm.NonceSize() {
+		return "", errors.New("encrypted secret is too short")
+	}
+	plain, err := gcm.Open(nil, data[:gcm.NonceSize()], data[gcm.NonceSize():], nil)
+	if err != nil {
+		return "", err
+	}
+	return string(plain), nil
+}
@@ -0,0 +1,84 @@
+package service
+
+import (
+	"github.com/ProjectDistribute/distributor/model"
+	"github.com/ProjectDistribute/distributor/utils"
+)
+
+// TagProposal is how a file would be mapped onto the library from its tags,
+// resolved the same way CreateSong and the library import resolve them.
+type TagProposal struct {
+	Title   string
+	Artists []ProposedArtist
+	// AlbumTitle is the tagged album, Album the existing album it matches.
+	AlbumTitle string
+	Album      *model.Album
+	// Song is the existing song with this title on the matched album.
+	Song *model.Song
+	// Problems lists what keeps the tags from creating a song as they are.
+	Problems []string
+}
+
+type ProposedArtist struct {
+	Name       string
+	Identifier string
+	// Artist is the existing artist with Identifier, nil if one would be created.
+	Artist *model.Artist
+}
+
+// SongCreationArtists returns the artists as CreateSong expects them, existing
+// artists by ID.
+func (p *TagProposal) SongCreationArtists() []SongCreationArtist {
+	artists := make([]SongCreationArtist, len(p.Artists))
+	for i, a := range p.Artists {
+		artists[i] = SongCreationArtist{Name: a.Name, Identifier: a.Identifier}
+		if a.Artist != nil {
+			artists[i].Identifier = a.Artist.ID.String()
+		}
+	}
+	return artists
+}
+
+// ProposeMapping resolves the artists, album and song the tags of the file name
+// refer to, without creating anything.
+func (s *LibraryService) ProposeMapping(tags *AudioTags, name string) (*TagProposal, error) {
+	p := &TagProposal{
+		Title:      tags.TitleOrFilename(name),
+		AlbumTitle: tags.Album,
+		Problems:   []string{},
+	}
+
+	var found []model.Artist
+	for _, artistName := range tags.ArtistNames() {
+		a := ProposedArtist{Name: artistName, Identifier: utils.Slugify(artistName)}
+		if artist, err := s.SongSvc.ArtistSvc.GetArtistByIdentifier(a.Identifier); err == nil {
+			a.Artist = artist
+			found = append(found, *artist)
+		}
+		p.Artists = append(p.Artists, a)
+	}
+	if len(p.Artists) == 0 {
+		p.Problems = append(p.Problems, "missing artist tag")
+	}
+	if p.AlbumTitle == "" {
+		p.Problems = append(p.Problems, "missing album tag")
+		return p, nil
+	}
+
+	// Only artists that already exist can match an album through its songs
+	album, err := s.AlbumSvc.FindAlbum(p.AlbumTitle, found)
+	if err != nil {
+		return nil, err
+	}
+	if album == nil {
+		return p, nil
+	}
+	p.Album = album
+
+	song, err := s.SongSvc.Store.GetSongByTitleAndAlbumID(p.Title, album.ID)
+	if err != nil {
+		return nil, err
+	}
+	p.Song = song
+	return p, nil
+}
@@ -0,0 +1,152 @@
+package service
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/dhowden/tag"
+	"github.com/dhowden/tag/mbz"
+)
+
+// AudioTags holds the subset of embedded metadata the server understands.
+type AudioTags struct {
+	Title       string
+	Artists     []string
+	AlbumArtist string
+	Album       string
+	Year        int
+	TrackNumber int
+	TrackTotal  int
+	DiscNumber  int
+	DiscTotal   int
+	Genre       string
+	ISRC        string
+	// Compilation is set by the iTunes compilation flag, e.g. on soundtracks and samplers.
+	Compilation bool
+
+	// MusicBrainz identifiers as written by Picard
+	MBRecordingID    string
+	MBTrackID        string
+	MBAlbumID        string
+	MBReleaseGroupID string
+	MBArtistIDs      []string
+	MBAlbumArtistIDs []string
+
+	Picture         []byte
+	PictureMIMEType string
+}
+
+// ReadTags parses ID3v2, Vorbis comment (FLAC/OGG) and MP4 tags from the file at path.
+func ReadTags(path string) (*AudioTags, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	return ReadTagsFrom(f)
+}
+
+// ReadTagsFrom parses the tags of an audio file from r, e.g. an upload.
+func ReadTagsFrom(r io.ReadSeeker) (*AudioTags, error) {
+	m, err := tag.ReadFrom(r)
+	if err != nil {
+		return nil, err
+	}
+
+	tags := &AudioTags{
+		Title:       strings.TrimSpace(m.Title()),
+		Artists:     splitArtists(m.Artist()),
+		AlbumArtist: strings.TrimSpace(m.AlbumArtist()),
+		Album:       strings.TrimSpace(m.Album()),
+		Year:        m.Year(),
+		Genre:       strings.TrimSpace(m.Genre()),
+	}
+	tags.TrackNumber, tags.TrackTotal = m.Track()
+	tags.DiscNumber, tags.DiscTotal = m.Disc()
+	tags.ISRC = strings.ToUpper(rawTag(m, "TSRC", "TRC", "isrc", "ISRC"))
+	tags.Compilation = rawTag(m, "TCMP", "TCP", "compilation") == "1"
+	if flag, ok := m.Raw()["cpil"].(int); ok {
+		tags.Compilation = flag == 1
+	}
+
+	ids := mbz.Extract(m)
+	tags.MBRecordingID = strings.TrimSpace(ids.Get(mbz.Recording))
+	tags.MBTrackID = strings.TrimSpace(ids.Get(mbz.Track))
+	if m.Format() == tag.VORBIS {
+		// Picard writes the recording as MUSICBRAINZ_TRACKID in Vorbis comments, which mbz reads as the track
+		tags.MBRecordingID = rawTag(m, "musicbrainz_trackid")
+		tags.MBTrackID = rawTag(m, "musicbrainz_releasetrackid")
+	}
+	tags.MBAlbumID = strings.TrimSpace(ids.Get(mbz.Album))
+	tags.MBReleaseGroupID = strings.TrimSpace(ids.Get(mbz.ReleaseGroup))
+	tags.MBArtistIDs = splitIDs(ids.Get(mbz.Artist))
+	tags.MBAlbumArtistIDs = splitIDs(ids.Get(mbz.AlbumArtist))
+
+	if pic := m.Picture(); pic != nil {
+		tags.Picture = pic.Data
+		tags.PictureMIMEType = pic.MIMEType
+	}
+
+	return tags, nil
+}
+
+// ArtistNames returns the tagged artists, falling back to the album artist.
+func (t *AudioTags) ArtistNames() []string {
+	if len(t.Artists) == 0 && t.AlbumArtist != "" {
+		return []string{t.AlbumArtist}
+	}
+	return t.Artists
+}
+
+// TitleOrFilename returns the tagged title, falling back to the file name without extension.
+func (t *AudioTags) TitleOrFilename(path string) string {
+	if t.Title != "" {
+		return t.Title
+	}
+	base := filepath.Base(path)
+	return strings.TrimSuffix(base, filepath.Ext(base))
+}
+
+// rawTag returns the first of the named raw frames, comments or atoms that is set.
+func rawTag(m tag.Metadata, names ...string) string {
+	raw := m.Raw()
+	for _, name := range names {
+		switch v := raw[name].(type) {
+		case string:
+			if v = strings.TrimSpace(strings.Trim(v, "\x00")); v != "" {
+				return v
+			}
+		case fmt.Stringer:
+			if s := strings.TrimSpace(v.String()); s != "" {
+				return s
+			}
+		}
+	}
+	return ""
+}
+
+// splitIDs splits a multi-value identifier tag, Picard joins them with "/" or "; ".
+func splitIDs(raw string) []string {
+	var ids []string
+	for _, part := range strings.FieldsFunc(raw, func(r rune) bool { return r == '/' || r == ';' || r == 0 }) {
+		if id := strings.TrimSpace(part); id != "" {
+			ids = append(ids, id)
+		}
+	}
+	return ids
+}
+
+// splitArtists splits a multi-value artist tag. ID3v2.4 uses NUL separators,
+// most taggers write "; " instead.
+func splitArtists(raw string) []string {
+	var artists []string
+	for _, part := range strings.FieldsFunc(raw, func(r rune) bool { return r == ';' || r == 0 }) {
+		if name := strings.TrimSpace(part); name != "" {
+			artists = append(artists, name)
+		}
+	}
+	return artists
+}
@@ -0,0 +1,129 @@
+package service
+
+import (
+	"bytes"
+	"encoding/binary"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func id3Frame(id string, data []byte) []byte {
+	size := len(data)
+	frame := []byte(id)
+	// ID3v2.4 frame sizes are syncsafe
+	frame = append(frame, byte(size>>21&0x7f), byte(size>>14&0x7f), byte(size>>7&0x7f), byte(size&0x7f), 0, 0)
+	return append(frame, data...)
+}
+
+func id3Text(text string) []byte {
+	return append([]byte{3}, text...)
+}
+
+func buildID3(frames ...[]byte) []byte {
+	body := bytes.Join(frames, nil)
+	size := len(body)
+	tag := []byte{'I', 'D', '3', 4, 0, 0, byte(size >> 21 & 0x7f), byte(size >> 14 & 0x7f), byte(size >> 7 & 0x7f), byte(size & 0x7f)}
+	return append(tag, body...)
+}
+
+func flacBlock(typ byte, last bool, data []byte) []byte {
+	if last {
+		typ |= 0x80
+	}
+	n := len(data)
+	return append([]byte{typ, byte(n >> 16), byte(n >> 8), byte(n)}, data...)
+}
+
+func vorbisComments(comments ...string) []byte {
+	var b bytes.Buffer
+	vendor := "test"
+	binary.Write(&b, binary.LittleEndian, uint32(len(vendor)))
+	b.WriteString(vendor)
+	binary.Write(&b, binary.LittleEndian, uint32(len(comments)))
+	for _, c := range comments {
+		binary.Write(&b, binary.LittleEndian, uint32(len(c)))
+		b.WriteString(c)
+	}
+	return b.Bytes()
+}
+
+func flacPicture(mime string, data []byte) []byte {
+	var b bytes.Buffer
+	binary.Write(&b, binary.BigEndian, uint32(3)) // front cover
+	binary.Write(&b, binary.BigEndian, uint32(len(mime)))
+	b.WriteString(mime)
+	binary.Write(&b, binary.BigEndian, uint32(0)) // no description
+	for _, v := range []uint32{600, 600, 24, 0} {
+		binary.Write(&b, binary.BigEndian, v)
+	}
+	binary.Write(&b, binary.BigEndian, uint32(len(data)))
+	b.Write(data)
+	return b.Bytes()
+}
+
+func TestReadTagsFrom_ID3v24(t *testing.T) {
+	file := buildID3(
+		id3Frame("TIT2", id3Text("Come Together")),
+		id3Frame("TPE1", id3Text("The Beatles")),
+		id3Frame("TALB", id3Text("Abbey Road")),
+		id3Frame("TRCK", id3Text("1/17")),
+		id3Frame("TPOS", id3Text("1/1")),
+		id3Frame("TCON", id3Text("Rock")),
+		id3Frame("TSRC", id3Text("gbaye0601690")),
+		id3Frame("TXXX", append(id3Text("MusicBrainz Album Id\x00"), "b8ee2ea5-5a1f-4a0d-b33e-7f5f3b2d8b8a"...)),
+		id3Frame("TXXX", append(id3Text("MusicBrainz Artist Id\x00"), "b10bbbfc-cf9e-42e0-be17-e2c3e1d2600d"...)),
+		id3Frame("UFID", append([]byte("http://musicbrainz.org\x00"), "5a4d4f2c-3f63-4c1b-9b6e-6f5b1b0e2d35"...)),
+	)
+
+	tags, err := ReadTagsFrom(bytes.NewReader(file))
+	require.NoError(t, err)
+	assert.Equal(t, "Come Together", tags.Title)
+	assert.Equal(t, []string{"The Beatles"}, tags.Artists)
+	assert.Equal(t, "Abbey Road", tags.Album)
+	assert.Equal(t, 1, tags.TrackNumber)
+	assert.Equal(t, 17, tags.TrackTotal)
+	assert.Equal(t, 1, tags.DiscNumber)
+	assert.False(t, tags.Compilation)
+	assert.Equal(t, "Rock", tags.Genre)
+	assert.Equal(t, "GBAYE0601690", tags.ISRC)
+	assert.Equal(t, "b8ee2ea5-5a1f-4a0d-b33e-7f5f3b2d8b8a", tags.MBAlbumID)
+	assert.Equal(t, []string{"b10bbbfc-cf9e-42e0-be17-e2c3e1d2600d"}, tags.MBArtistIDs)
+	assert.Equal(t, "5a4d4f2c-3f63-4c1b-9b6e-6f5b1b0e2d35", tags.MBRecordingID)
+}
+
+func TestReadTagsFrom_FLAC(t *testing.T) {
+	cover := []byte{0xff, 0xd8, 0xff, 0xe0, 'J', 'F', 'I', 'F'}
+	file := append([]byte("fLaC"), flacBlock(0, false, make([]byte, 34))...)
+	file = append(file, flacBlock(4, false, vorbisComments(
+		"TITLE=Something",
+		"ARTIST=George Harrison; The Beatles",
+		"ALBUM=Abbey Road",
+		"ALBUMARTIST=The Beatles",
+		"COMPILATION=1",
+		"TRACKNUMBER=2",
+		"DISCNUMBER=1",
+		"DATE=1969",
+		"ISRC=GBAYE0601691",
+		"MUSICBRAINZ_TRACKID=0a4e1c8f-6c0b-4d0c-9d35-1f4bb1c5e6e1",
+		"MUSICBRAINZ_ALBUMARTISTID=b10bbbfc-cf9e-42e0-be17-e2c3e1d2600d",
+		"MUSICBRAINZ_RELEASEGROUPID=9162580e-5df4-32de-80cc-f45a8d8a9b1d",
+	))...)
+	file = append(file, flacBlock(6, true, flacPicture("image/jpeg", cover))...)
+
+	tags, err := ReadTagsFrom(bytes.NewReader(file))
+	require.NoError(t, err)
+	assert.Equal(t, "Something", tags.Title)
+	assert.Equal(t, []string{"George Harrison", "The Beatles"}, tags.Artists)
+	assert.Equal(t, "The Beatles", tags.AlbumArtist)
+	assert.True(t, tags.Compilation)
+	assert.Equal(t, 2, tags.TrackNumber)
+	assert.Equal(t, 1969, tags.Year)
+	assert.Equal(t, "GBAYE0601691", tags.ISRC)
+	assert.Equal(t, "0a4e1c8f-6c0b-4d0c-9d35-1f4bb1c5e6e1", tags.MBRecordingID)
+	assert.Equal(t, []string{"b10bbbfc-cf9e-42e0-be17-e2c3e1d2600d"}, tags.MBAlbumArtistIDs)
+	assert.Equal(t, "9162580e-5df4-32de-80cc-f45a8d8a9b1d", tags.MBReleaseGroupID)
+	assert.Equal(t, cover, tags.Picture)
+	assert.Equal(t, "image/jpeg", tags.PictureMIMEType)
+}
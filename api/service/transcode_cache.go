@@ -0,0 +1,386 @@
+package service
+
+import (
+	"container/list"
+	"context"
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/ProjectDistribute/distributor/store"
+	"github.com/google/uuid"
+)
+
+const TranscodeCacheDir = "storage/transcodes"
+
+// DefaultTranscodeCacheMaxMB is used when the transcode_cache_max_mb setting is missing.
+// A setting of 0 disables the cache and streams are transcoded for every request.
+const DefaultTranscodeCacheMaxMB = 1024
+
+type transcodeCacheEntry struct {
+	key        string
+	path       string
+	fileID     uuid.UUID
+	opts       TranscodeOptions
+	size       int64
+	lastAccess time.Time
+	elem       *list.Element
+}
+
+// inflightTranscode lets concurrent requests for the same rendition share one encode.
+// The encode is cancelled once every waiting request has gone away.
+type inflightTranscode struct {
+	done    chan struct{}
+	err     error
+	waiters int
+	cancel  context.CancelFunc
+}
+
+type TranscodeCacheEntry struct {
+	FileID     uuid.UUID `json:"file_id"`
+	Format     string    `json:"format"`
+	Bitrate    int       `json:"bitrate"`
+	Size       int64     `json:"size"`
+	LastAccess time.Time `json:"last_access"`
+}
+
+type TranscodeCacheStats struct {
+	Entries  int     `json:"entries"`
+	Size     int64   `json:"size"`
+	MaxSize  int64   `json:"max_size"`
+	Hits     uint64  `json:"hits"`
+	Misses   uint64  `json:"misses"`
+	HitRate  float64 `json:"hit_rate"`
+	Encoding int     `json:"encoding"`
+}
+
+// TranscodeCache keeps transcoded renditions on disk, evicting the least recently
+// used ones once the cache grows beyond the transcode_cache_max_mb setting.
+type TranscodeCache struct {
+	Transcodes *TranscodeService
+	Settings   *store.SettingsStore
+	Dir        string
+
+	mu       sync.Mutex
+	entries  map[string]*transcodeCacheEntry
+	lru      *list.List // front = most recently used
+	size     int64
+	inflight map[string]*inflightTranscode
+	hits     uint64
+	misses   uint64
+}
+
+func NewTranscodeCache(transcodes *TranscodeService, settings *store.SettingsStore, dir string) (*TranscodeCache, error) {
+	c := &TranscodeCache{
+		Transcodes: transcodes,
+		Settings:   settings,
+		Dir:        dir,
+		entries:    make(map[string]*transcodeCacheEntry),
+		lru:        list.New(),
+		inflight:   make(map[string]*inflightTranscode),
+	}
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		return nil, err
+	}
+	if err := c.load(); err != nil {
+		return nil, err
+	}
+	return c, nil
+}
+
+// load indexes renditions left on disk by a previous run, oldest first.
+func (c *TranscodeCache) load() error {
+	dirEntries, err := os.ReadDir(c.Dir)
+	if err != nil {
+		return err
+	}
+
+	var loaded []*transcodeCacheEntry
+	for _, de := range dirEntries {
+		path := filepath.Join(c.Dir, de.Name())
+		if strings.HasPrefix(de.Name(), ".tmp-") {
+			_ = os.Remove(path)
+			continue
+		}
+		fileID, opts, ok := parseTranscodeCacheName(de.Name())
+		if !ok {
+			continue
+		}
+		info, err := de.Info()
+		if err != nil {
+			continue
+		}
+		loaded = append(loaded, &transcodeCacheEntry{
+			key:        transcodeCacheKey(fileID, opts),
+			path:       path,
+			fileID:     fileID,
+			opts:       opts,
+			size:       info.Size(),
+			lastAccess: info.ModTime(),
+		})
+	}
+
+	sort.Slice(loaded, func(i, j int) bool { return loaded[i].lastAccess.Before(loaded[j].lastAccess) })
+	for _, e := range loaded {
+		e.elem = c.lru.PushFront(e)
+		c.entries[e.key] = e
+		c.size += e.size
+	}
+	if len(loaded) > 0 {
+		log.Printf("Loaded %d cached transcodes (%d bytes)\n", len(loaded), c.size)
+	}
+	return nil
+}
+
+// Enabled reports whether the configured cache size allows caching at all.
+func (c *TranscodeCache) Enabled() bool {
+	return c.maxSize() > 0
+}
+
+func (c *TranscodeCache) maxSize() int64 {
+	mb := DefaultTranscodeCacheMaxMB
+	if val, err := c.Settings.Get("transcode_cache_max_mb"); err == nil && val != "" {
+		if parsed, err := strconv.Atoi(val); err == nil && parsed >= 0 {
+			mb = parsed
+		}
+	}
+	return int64(mb) * 1024 * 1024
+}
+
+// Open returns the cached rendition of the song file at src, encoding it first on a miss.
+// Concurrent misses for the same rendition wait for a single encode.
+func (c *TranscodeCache) Open(ctx context.Context, fileID uuid.UUID, src string, opts TranscodeOptions) (*os.File, error) {
+	key := transcodeCacheKey(fileID, opts)
+
+	c.mu.Lock()
+	if e, ok := c.entries[key]; ok {
+		f, err := os.Open(e.path)
+		if err == nil {
+			c.hits++
+			e.lastAccess = time.Now()
+			c.lru.MoveToFront(e.elem)
+			c.mu.Unlock()
+			return f, nil
+		}
+		// File vanished from disk, forget about it and encode again
+		c.removeLocked(e)
+	}
+	c.misses++
+
+	call, ok := c.inflight[key]
+	if !ok {
+		encodeCtx, cancel := context.WithCancel(context.Background())
+		call = &inflightTranscode{done: make(chan struct{}), cancel: cancel}
+		c.inflight[key] = call
+		go c.encode(encodeCtx, key, fileID, src, opts, call)
+	}
+	call.waiters++
+	c.mu.Unlock()
+
+	select {
+	case <-call.done:
+	case <-ctx.Done():
+		c.mu.Lock()
+		call.waiters--
+		if call.waiters == 0 {
+			call.cancel()
+			// Later requests must start a fresh encode instead of joining the cancelled one
+			if c.inflight[key] == call {
+				delete(c.inflight, key)
+			}
+		}
+		c.mu.Unlock()
+		return nil, ctx.Err()
+	}
+
+	if call.err != nil {
+		return nil, call.err
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	e, ok := c.entries[key]
+	if !ok {
+		return nil, fmt.Errorf("transcode of %s was evicted before it could be served", key)
+	}
+	return os.Open(e.path)
+}
+
+func (c *TranscodeCache) encode(ctx context.Context, key string, fileID uuid.UUID, src string, opts TranscodeOptions, call *inflightTranscode) {
+	defer call.cancel()
+
+	err := c.encodeToDisk(ctx, key, fileID, src, opts)
+
+	c.mu.Lock()
+	call.err = err
+	if c.inflight[key] == call {
+		delete(c.inflight, key)
+	}
+	c.mu.Unlock()
+	close(call.done)
+}
+
+func (c *TranscodeCache) encodeToDisk(ctx context.Context, key string, fileID uuid.UUID, src string, opts TranscodeOptions) error {
+	tmp, err := os.CreateTemp(c.Dir, ".tmp-"+key+"-*")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+
+	err = c.Transcodes.Transcode(ctx, src, opts, tmp)
+	if closeErr := tmp.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		return err
+	}
+
+	path := filepath.Join(c.Dir, transcodeCacheName(fileID, opts))
+	if err := os.Rename(tmp.Name(), path); err != nil {
+		return err
+	}
+	info, err := os.Stat(path)
+	if err != nil {
+		return err
+	}
+	max := c.maxSize()
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if old, ok := c.entries[key]; ok {
+		// Same path as the file we just renamed into place, only drop the bookkeeping
+		c.lru.Remove(old.elem)
+		c.size -= old.size
+	}
+	e := &transcodeCacheEntry{
+		key:        key,
+		path:       path,
+		fileID:     fileID,
+		opts:       opts,
+		size:       info.Size(),
+		lastAccess: time.Now(),
+	}
+	e.elem = c.lru.PushFront(e)
+	c.entries[key] = e
+	c.size += e.size
+	c.evictLocked(max, e)
+	return nil
+}
+
+// evictLocked drops least recently used renditions until the cache fits in max bytes.
+// keep is never evicted so the request that produced it can still be served. Callers
+// read max before taking the lock, it comes from the database.
+func (c *TranscodeCache) evictLocked(max int64, keep *transcodeCacheEntry) {
+	for c.size > max {
+		back := c.lru.Back()
+		if back == nil {
+			return
+		}
+		e := back.Value.(*transcodeCacheEntry)
+		if e == keep {
+			return
+		}
+		log.Printf("Evicting cached transcode %s (%d bytes)\n", e.key, e.size)
+		c.removeLocked(e)
+	}
+}
+
+// Trim applies the current size limit, e.g. after the setting was lowered.
+func (c *TranscodeCache) Trim() {
+	max := c.maxSize()
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.evictLocked(max, nil)
+}
+
+func (c *TranscodeCache) removeLocked(e *transcodeCacheEntry) {
+	if err := os.Remove(e.path); err != nil && !os.IsNotExist(err) {
+		log.Printf("Failed to remove cached transcode %s: %v\n", e.path, err)
+	}
+	c.lru.Remove(e.elem)
+	delete(c.entries, e.key)
+	c.size -= e.size
+}
+
+// Purge removes every cached rendition, or only those of fileID if it is not uuid.Nil.
+// It returns the number of removed renditions.
+func (c *TranscodeCache) Purge(fileID uuid.UUID) int {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	removed := 0
+	for _, e := range c.entries {
+		if fileID != uuid.Nil && e.fileID != fileID {
+			continue
+		}
+		c.removeLocked(e)
+		removed++
+	}
+	return removed
+}
+
+func (c *TranscodeCache) Stats() TranscodeCacheStats {
+	max := c.maxSize()
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	stats := TranscodeCacheStats{
+		Entries:  len(c.entries),
+		Size:     c.size,
+		MaxSize:  max,
+		Hits:     c.hits,
+		Misses:   c.misses,
+		Encoding: len(c.inflight),
+	}
+	if total := c.hits + c.misses; total > 0 {
+		stats.HitRate = float64(c.hits) / float64(total)
+	}
+	return stats
+}
+
+// Entries lists cached renditions, most recently used first.
+func (c *TranscodeCache) Entries() []TranscodeCacheEntry {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	entries := make([]TranscodeCacheEntry, 0, len(c.entries))
+	for el := c.lru.Front(); el != nil; el = el.Next() {
+		e := el.Value.(*transcodeCacheEntry)
+		entries = append(entries, TranscodeCacheEntry{
+			FileID:     e.fileID,
+			Format:     e.opts.Format,
+			Bitrate:    e.opts.Bitrate,
+			Size:       e.size,
+			LastAccess: e.lastAccess,
+		})
+	}
+	return entries
+}
+
+func transcodeCacheKey(fileID uuid.UUID, opts TranscodeOptions) string {
+	return fmt.Sprintf("%s_%s_%d", fileID, opts.Format, opts.Bitrate)
+}
+
+// transcodeCacheName is the on-disk name of a rendition: <file id>_<format>_<bitrate>.<format>
+func transcodeCacheName(fileID uuid.UUID, opts TranscodeOptions) string {
+	return transcodeCacheKey(fileID, opts) + "." + opts.Format
+}
+
+func parseTranscodeCacheName(name string) (uuid.UUID, TranscodeOptions, bool) {
+	parts := strings.Split(strings.TrimSuffix(name, filepath.Ext(name)), "_")
+	if len(parts) != 3 {
+		return uuid.Nil, TranscodeOptions{}, false
+	}
+	fileID, err := uuid.Parse(parts[0])
+	if err != nil {
+		return uuid.Nil, TranscodeOptions{}, false
+	}
+	bitrate, err := strconv.Atoi(parts[2])
+	if err != nil {
+		return uuid.Nil, TranscodeOptions{}, false
+	}
+	return fileID, TranscodeOptions{Format: parts[1], Bitrate: bitrate}, true
+}
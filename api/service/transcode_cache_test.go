@@ -0,0 +1,97 @@
+package service
+
+import (
+	"context"
+	"io"
+	"os"
+	"path/filepath"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/ProjectDistribute/distributor/store"
+	"github.com/google/uuid"
+	"github.com/stretchr/testify/assert"
+)
+
+type countingTranscoder struct {
+	FakeTranscoder
+	calls atomic.Int32
+}
+
+func (t *countingTranscoder) Transcode(ctx context.Context, src string, opts TranscodeOptions, w io.Writer) error {
+	t.calls.Add(1)
+	return t.FakeTranscoder.Transcode(ctx, src, opts, w)
+}
+
+func newTestTranscodeCache(t *testing.T, transcoder Transcoder) *TranscodeCache {
+	cache, err := NewTranscodeCache(NewTranscodeService(transcoder, 2), store.NewSettingsStore(newTestDB(t)), t.TempDir())
+	assert.NoError(t, err)
+	return cache
+}
+
+func TestTranscodeCache_CoalescesConcurrentMisses(t *testing.T) {
+	src := filepath.Join(t.TempDir(), "song.flac")
+	assert.NoError(t, os.WriteFile(src, []byte("audio"), 0o644))
+
+	transcoder := &countingTranscoder{FakeTranscoder: FakeTranscoder{Delay: 50 * time.Millisecond}}
+	cache := newTestTranscodeCache(t, transcoder)
+	fileID := uuid.New()
+	opts := TranscodeOptions{Format: "opus", Bitrate: 128}
+
+	var wg sync.WaitGroup
+	for i := 0; i < 5; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			f, err := cache.Open(context.Background(), fileID, src, opts)
+			if !assert.NoError(t, err) {
+				return
+			}
+			defer f.Close()
+			data, _ := io.ReadAll(f)
+			assert.Equal(t, "FAKE opus 128k\naudio", string(data))
+		}()
+	}
+	wg.Wait()
+
+	assert.Equal(t, int32(1), transcoder.calls.Load())
+
+	f, err := cache.Open(context.Background(), fileID, src, opts)
+	assert.NoError(t, err)
+	f.Close()
+	stats := cache.Stats()
+	assert.Equal(t, 1, stats.Entries)
+	assert.Equal(t, uint64(1), stats.Hits)
+	assert.Equal(t, uint64(5), stats.Misses)
+}
+
+func TestTranscodeCache_EvictsLeastRecentlyUsed(t *testing.T) {
+	src := filepath.Join(t.TempDir(), "song.flac")
+	assert.NoError(t, os.WriteFile(src, make([]byte, 400*1024), 0o644))
+
+	cache := newTestTranscodeCache(t, &FakeTranscoder{})
+	assert.NoError(t, cache.Settings.Set("transcode_cache_max_mb", "1"))
+
+	first, second, third := uuid.New(), uuid.New(), uuid.New()
+	opts := TranscodeOptions{Format: "mp3", Bitrate: 192}
+	for _, id := range []uuid.UUID{first, second, first, third} {
+		f, err := cache.Open(context.Background(), id, src, opts)
+		assert.NoError(t, err)
+		f.Close()
+	}
+
+	// second was used least recently and had to make room for third
+	var cached []uuid.UUID
+	for _, e := range cache.Entries() {
+		cached = append(cached, e.FileID)
+	}
+	assert.Equal(t, []uuid.UUID{third, first}, cached)
+	_, err := os.Stat(filepath.Join(cache.Dir, transcodeCacheName(second, opts)))
+	assert.True(t, os.IsNotExist(err))
+
+	assert.NoError(t, cache.Settings.Set("transcode_cache_max_mb", "0"))
+	assert.False(t, cache.Enabled())
+	assert.Equal(t, 2, cache.Purge(uuid.Nil))
+}
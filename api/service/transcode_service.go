@@ -0,0 +1,169 @@
+package service
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"os/exec"
+	"strconv"
+	"strings"
+)
+
+var ErrUnsupportedTranscodeFormat = errors.New("unsupported transcode format")
+
+// TranscodeOptions describes the rendition a client asked for.
+type TranscodeOptions struct {
+	Format  string // opus, mp3, aac or ogg (vorbis)
+	Bitrate int    // kbit/s
+}
+
+// transcodeFormats maps the supported target formats to their default bitrate.
+var transcodeFormats = map[string]int{
+	"opus": 128,
+	"mp3":  192,
+	"aac":  192,
+	"ogg":  160,
+}
+
+// ParseTranscodeOptions validates the format/bitrate query of a stream request.
+// A bitrate of 0 selects the format's default; other values are clamped to 32-320 kbit/s.
+func ParseTranscodeOptions(format string, bitrate int) (TranscodeOptions, error) {
+	format = strings.ToLower(format)
+	def, ok := transcodeFormats[format]
+	if !ok {
+		return TranscodeOptions{}, fmt.Errorf("%w: %s", ErrUnsupportedTranscodeFormat, format)
+	}
+	switch {
+	case bitrate == 0:
+		bitrate = def
+	case bitrate < 32:
+		bitrate = 32
+	case bitrate > 320:
+		bitrate = 320
+	}
+	return TranscodeOptions{Format: format, Bitrate: bitrate}, nil
+}
+
+// Transcoder converts the audio file at src into opts.Format and writes it to w.
+// Implementations must stop and return ctx.Err() once ctx is cancelled.
+type Transcoder interface {
+	Transcode(ctx context.Context, src string, opts TranscodeOptions, w io.Writer) error
+}
+
+// FFmpegTranscoder shells out to ffmpeg, writing the encoded stream to stdout.
+type FFmpegTranscoder struct {
+	Path string
+}
+
+// NewFFmpegTranscoder returns nil if no ffmpeg binary can be found in PATH.
+func NewFFmpegTranscoder() *FFmpegTranscoder {
+	path, err := exec.LookPath("ffmpeg")
+	if err != nil {
+		return nil
+	}
+	return &FFmpegTranscoder{Path: path}
+}
+
+func (t *FFmpegTranscoder) Transcode(ctx context.Context, src string, opts TranscodeOptions, w io.Writer) error {
+	var codec []string
+	switch opts.Format {
+	case "opus":
+		codec = []string{"-c:a", "libopus", "-f", "ogg"}
+	case "mp3":
+		codec = []string{"-c:a", "libmp3lame", "-f", "mp3"}
+	case "aac":
+		codec = []string{"-c:a", "aac", "-f", "adts"}
+	case "ogg":
+		codec = []string{"-c:a", "libvorbis", "-f", "ogg"}
+	default:
+		return fmt.Errorf("%w: %s", ErrUnsupportedTranscodeFormat, opts.Format)
+	}
+
+	args := []string{"-hide_banner", "-loglevel", "error", "-nostdin", "-i", src, "-map", "0:a:0", "-vn"}
+	args = append(args, "-b:a", strconv.Itoa(opts.Bitrate)+"k")
+	args = append(args, codec...)
+	args = append(args, "pipe:1")
+
+	stderr := &bytes.Buffer{}
+	cmd := exec.CommandContext(ctx, t.Path, args...)
+	cmd.Stdout = w
+	cmd.Stderr = stderr
+	if err := cmd.Run(); err != nil {
+		if ctx.Err() != nil {
+			return ctx.Err()
+		}
+		return fmt.Errorf("ffmpeg: %v: %s", err, strings.TrimSpace(stderr.String()))
+	}
+	return nil
+}
+
+// DecodePCM implements PCMDecoder.
+func (t *FFmpegTranscoder) DecodePCM(ctx context.Context, src string, channels int, w io.Writer) error {
+	args := []string{"-hide_banner", "-loglevel", "error", "-nostdin", "-i", src, "-map", "0:a:0", "-vn",
+		"-ac", strconv.Itoa(channels), "-ar", strconv.Itoa(PCMSampleRate), "-f", "f32le", "pipe:1"}
+
+	stderr := &bytes.Buffer{}
+	cmd := exec.CommandContext(ctx, t.Path, args...)
+	cmd.Stdout = w
+	cmd.Stderr = stderr
+	if err := cmd.Run(); err != nil {
+		if ctx.Err() != nil {
+			return ctx.Err()
+		}
+		return fmt.Errorf("ffmpeg: %v: %s", err, strings.TrimSpace(stderr.String()))
+	}
+	return nil
+}
+
+// TranscodeService bounds how many transcodes run at the same time.
+type TranscodeService struct {
+	Transcoder Transcoder
+	slots      chan struct{}
+}
+
+func NewTranscodeService(transcoder Transcoder, workers int) *TranscodeService {
+	if workers < 1 {
+		workers = 1
+	}
+	return &TranscodeService{
+		Transcoder: transcoder,
+		slots:      make(chan struct{}, workers),
+	}
+}
+
+// Transcode waits for a free worker slot and then runs the transcoder.
+// It gives up waiting as soon as ctx is cancelled, e.g. when the client disconnects.
+func (s *TranscodeService) Transcode(ctx context.Context, src string, opts TranscodeOptions, w io.Writer) error {
+	select {
+	case s.slots <- struct{}{}:
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+	defer func() { <-s.slots }()
+
+	return s.Transcoder.Transcode(ctx, src, opts, w)
+}
+
+// DecodePCM waits for a free worker slot like Transcode and decodes src with the
+// transcoder, so analysis jobs do not starve streaming of workers.
+func (s *TranscodeService) DecodePCM(ctx context.Context, src string, channels int, w io.Writer) error {
+	decoder, ok := s.Transcoder.(PCMDecoder)
+	if !ok {
+		return ErrNoDecoder
+	}
+	select {
+	case s.slots <- struct{}{}:
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+	defer func() { <-s.slots }()
+
+	return decoder.DecodePCM(ctx, src, channels, w)
+}
+
+// Busy returns the number of transcodes currently running.
+func (s *TranscodeService) Busy() int {
+	return len(s.slots)
+}
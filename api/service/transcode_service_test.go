@@ -0,0 +1,61 @@
+package service
+
+import (
+	"bytes"
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestParseTranscodeOptions(t *testing.T) {
+	opts, err := ParseTranscodeOptions("OPUS", 0)
+	assert.NoError(t, err)
+	assert.Equal(t, TranscodeOptions{Format: "opus", Bitrate: 128}, opts)
+
+	opts, err = ParseTranscodeOptions("mp3", 1000)
+	assert.NoError(t, err)
+	assert.Equal(t, 320, opts.Bitrate)
+
+	_, err = ParseTranscodeOptions("flac", 128)
+	assert.ErrorIs(t, err, ErrUnsupportedTranscodeFormat)
+}
+
+func TestTranscodeService_Fake(t *testing.T) {
+	src := filepath.Join(t.TempDir(), "song.flac")
+	assert.NoError(t, os.WriteFile(src, []byte("audio"), 0o644))
+
+	svc := NewTranscodeService(&FakeTranscoder{}, 1)
+	out := &bytes.Buffer{}
+	err := svc.Transcode(context.Background(), src, TranscodeOptions{Format: "opus", Bitrate: 96}, out)
+	assert.NoError(t, err)
+	assert.Equal(t, "FAKE opus 96k\naudio", out.String())
+	assert.Equal(t, 0, svc.Busy())
+}
+
+func TestTranscodeService_PoolBoundAndCancellation(t *testing.T) {
+	src := filepath.Join(t.TempDir(), "song.flac")
+	assert.NoError(t, os.WriteFile(src, []byte("audio"), 0o644))
+
+	svc := NewTranscodeService(&FakeTranscoder{Delay: time.Hour}, 1)
+	opts := TranscodeOptions{Format: "mp3", Bitrate: 192}
+
+	// Occupy the only worker slot until the first client goes away
+	firstCtx, disconnectFirst := context.WithCancel(context.Background())
+	firstDone := make(chan error, 1)
+	go func() { firstDone <- svc.Transcode(firstCtx, src, opts, &bytes.Buffer{}) }()
+	assert.Eventually(t, func() bool { return svc.Busy() == 1 }, time.Second, time.Millisecond)
+
+	// A second request cannot get a slot and gives up when its context ends
+	waitCtx, cancel := context.WithTimeout(context.Background(), 20*time.Millisecond)
+	defer cancel()
+	err := svc.Transcode(waitCtx, src, opts, &bytes.Buffer{})
+	assert.ErrorIs(t, err, context.DeadlineExceeded)
+
+	disconnectFirst()
+	assert.ErrorIs(t, <-firstDone, context.Canceled)
+	assert.Equal(t, 0, svc.Busy())
+}
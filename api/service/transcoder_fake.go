@@ -0,0 +1,77 @@
+package service
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"strings"
+	"time"
+)
+
+// FakeTranscoder is a Transcoder for tests and machines without ffmpeg.
+// It writes a one-line header naming the target rendition followed by the untouched source bytes.
+type FakeTranscoder struct {
+	// Delay is waited out (or cancelled) before anything is written.
+	Delay time.Duration
+}
+
+func (t *FakeTranscoder) Transcode(ctx context.Context, src string, opts TranscodeOptions, w io.Writer) error {
+	if t.Delay > 0 {
+		select {
+		case <-time.After(t.Delay):
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+	}
+
+	f, err := openTranscodeInput(ctx, src)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	if _, err := fmt.Fprintf(w, "FAKE %s %dk\n", opts.Format, opts.Bitrate); err != nil {
+		return err
+	}
+
+	buf := make([]byte, 32*1024)
+	for {
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+		n, err := f.Read(buf)
+		if n > 0 {
+			if _, werr := w.Write(buf[:n]); werr != nil {
+				return werr
+			}
+		}
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+	}
+}
+
+// openTranscodeInput opens src, a local path or a presigned URL from TranscodeInput.
+func openTranscodeInput(ctx context.Context, src string) (io.ReadCloser, error) {
+	if !strings.HasPrefix(src, "http://") && !strings.HasPrefix(src, "https://") {
+		return os.Open(src)
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, src, nil)
+	if err != nil {
+		return nil, err
+	}
+	res, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	if res.StatusCode != http.StatusOK {
+		res.Body.Close()
+		return nil, fmt.Errorf("fetching transcode input: %s", res.Status)
+	}
+	return res.Body, nil
+}
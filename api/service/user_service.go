@@ -14,19 +14,29 @@ import (
 type UserService struct {
 	Store           *store.UserStore
 	PlaylistService *PlaylistService
+	Sessions        *store.SessionStore
+	Audit           *store.AuditStore
+	Invites         *store.InviteStore
+	APIKeys         *store.APIKeyStore
+	Identities      *store.IdentityStore
+	Settings        *store.SettingsStore
 	JWTSecret       string
 }
 
 func (s *UserService) CreateUser(username, password string) (*model.User, error) {
+	return s.createUser(&model.User{Username: username}, password)
+}
+
+// createUser stores user with the hash of password and gives it a root folder.
+// Access related fields such as PendingApproval are set by the caller beforehand,
+// so the account never exists without them.
+func (s *UserService) createUser(user *model.User, password string) (*model.User, error) {
 	hash, err := bcrypt.GenerateFromPassword([]byte(password), bcrypt.DefaultCost)
 	if err != nil {
 		return nil, err
 	}
 
-	user := &model.User{
-		Username:     username,
-		PasswordHash: string(hash),
-	}
+	user.PasswordHash = string(hash)
 	err = s.Store.CreateUser(user)
 	if err != nil {
 		return nil, err
@@ -41,7 +51,16 @@ func (s *UserService) CreateUser(username, password string) (*model.User, error)
 }
 
 func (s *UserService) DeleteUser(user *model.User) error {
-	return s.Store.DeleteUser(user)
+	if err := s.Store.DeleteUser(user); err != nil {
+		return err
+	}
+	if _, err := s.Sessions.RevokeUserSessions(user.ID); err != nil {
+		return err
+	}
+	if err := s.Identities.DeleteIdentitiesByUserID(user.ID); err != nil {
+		return err
+	}
+	return s.APIKeys.RevokeUserAPIKeys(user.ID)
 }
 
 func (s *UserService) GetUserByUsername(username string) (*model.User, error) {
@@ -62,13 +81,17 @@ func (s *UserService) UpdatePassword(user *model.User, newPassword string) error
 	return err
 }
 
-func (s *UserService) GenerateToken(user *model.User) (string, error) {
+// GenerateToken issues an access token for a session of the user.
+func (s *UserService) GenerateToken(user *model.User, sessionID uuid.UUID, expires time.Time) (string, error) {
 	claims := &middleware.JwtCustomClaims{
 		RegisteredClaims: jwt.RegisteredClaims{
 			Subject:   user.ID.String(),
-			ExpiresAt: jwt.NewNumericDate(time.Now().Add(time.Hour * 24 * 30)),
+			IssuedAt:  jwt.NewNumericDate(time.Now()),
+			ExpiresAt: jwt.NewNumericDate(expires),
 		},
-		Admin: user.IsAdmin,
+		Admin:     user.IsAdmin,
+		Role:      user.Role,
+		SessionID: sessionID.String(),
 	}
 	token := jwt.NewWithClaims(jwt.SigningMethodHS256, claims)
 	t, err := token.SignedString([]byte(s.JWTSecret))
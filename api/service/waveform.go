@@ -0,0 +1,274 @@
+package service
+
+import (
+	"bytes"
+	"context"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"math"
+	"sync"
+	"time"
+
+	"github.com/ProjectDistribute/distributor/model"
+)
+
+// WaveformBuckets is the number of min/max pairs a waveform has at most.
+const WaveformBuckets = 1000
+
+// waveformStep is the resolution frames are first reduced to, before the length
+// of the stream is known.
+const waveformStep = 256
+
+var ErrInvalidWaveform = errors.New("invalid waveform data")
+
+// Waveform holds min/max peaks of a mono mixdown, in the layout of the
+// audiowaveform data format (version 2, 8 bit) so players such as peaks.js can
+// read it as is.
+type Waveform struct {
+	SampleRate      int
+	SamplesPerPixel int
+	// Data holds a min and a max per bucket, -128 to 127.
+	Data []int8
+}
+
+// Length is the number of buckets.
+func (w *Waveform) Length() int {
+	return len(w.Data) / 2
+}
+
+// MarshalBinary encodes w in the audiowaveform .dat format.
+func (w *Waveform) MarshalBinary() ([]byte, error) {
+	var buf bytes.Buffer
+	header := []int32{2, 1, int32(w.SampleRate), int32(w.SamplesPerPixel), int32(w.Length()), 1} // version, flags (8 bit), ..., channels
+	if err := binary.Write(&buf, binary.LittleEndian, header); err != nil {
+		return nil, err
+	}
+	if err := binary.Write(&buf, binary.LittleEndian, w.Data); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+// UnmarshalBinary decodes the .dat format written by MarshalBinary.
+func (w *Waveform) UnmarshalBinary(b []byte) error {
+	var header [6]int32
+	if err := binary.Read(bytes.NewReader(b), binary.LittleEndian, &header); err != nil {
+		return ErrInvalidWaveform
+	}
+	version, flags, length := header[0], header[1], int(header[4])
+	if version != 2 || flags != 1 || header[5] != 1 || length < 0 || len(b) != 24+2*length {
+		return ErrInvalidWaveform
+	}
+	w.SampleRate = int(header[2])
+	w.SamplesPerPixel = int(header[3])
+	w.Data = make([]int8, 2*length)
+	for i := range w.Data {
+		w.Data[i] = int8(b[24+i])
+	}
+	return nil
+}
+
+// ComputeWaveform reads PCMSampleRate, PCMChannels float32 PCM from r and
+// reduces it to at most WaveformBuckets min/max pairs.
+func ComputeWaveform(r io.Reader) (*Waveform, error) {
+	var mins, maxs []float64
+	lo, hi, n := math.Inf(1), math.Inf(-1), 0
+	err := readPCM(r, PCMChannels, func(frame []float64) {
+		v := 0.0
+		for _, x := range frame {
+			v += x
+		}
+		v /= float64(len(frame))
+		lo, hi = min(lo, v), max(hi, v)
+		n++
+		if n == waveformStep {
+			mins, maxs = append(mins, lo), append(maxs, hi)
+			lo, hi, n = math.Inf(1), math.Inf(-1), 0
+		}
+	})
+	if err != nil {
+		return nil, err
+	}
+	if n > 0 {
+		mins, maxs = append(mins, lo), append(maxs, hi)
+	}
+
+	// Merge the steps into buckets of a whole number of steps
+	per := (len(mins) + WaveformBuckets - 1) / WaveformBuckets
+	if per == 0 {
+		per = 1
+	}
+	w := &Waveform{SampleRate: PCMSampleRate, SamplesPerPixel: per * waveformStep}
+	for i := 0; i < len(mins); i += per {
+		end := min(i+per, len(mins))
+		lo, hi := mins[i], maxs[i]
+		for j := i + 1; j < end; j++ {
+			lo, hi = min(lo, mins[j]), max(hi, maxs[j])
+		}
+		w.Data = append(w.Data, toInt8(lo), toInt8(hi))
+	}
+	return w, nil
+}
+
+func toInt8(v float64) int8 {
+	return int8(max(-128, min(127, math.Round(v*128))))
+}
+
+// waveformQueueSize bounds the files waiting for a waveform. Files that do not
+// fit are left to the backfill run by the doctor.
+const waveformQueueSize = 1024
+
+// WaveformService generates the peaks waveform of song files for the player's
+// scrubber and stores it next to the audio. Requested waveforms are generated one
+// at a time by a single worker, so ingestion never holds more than one decoding
+// slot for them.
+type WaveformService struct {
+	Storage FileStorage
+	Decoder PCMDecoder // nil when no decoder is available
+
+	mu       sync.Mutex
+	queue    chan model.SongFile
+	queued   map[string]bool // by WaveformPath
+	inflight map[string]*waveformCall
+}
+
+// waveformCall is a generation in progress, shared by everyone asking for it.
+type waveformCall struct {
+	done     chan struct{}
+	waveform *Waveform
+	err      error
+}
+
+func NewWaveformService(storage FileStorage, decoder PCMDecoder) *WaveformService {
+	s := &WaveformService{
+		Storage:  storage,
+		Decoder:  decoder,
+		queue:    make(chan model.SongFile, waveformQueueSize),
+		queued:   make(map[string]bool),
+		inflight: make(map[string]*waveformCall),
+	}
+	if decoder != nil {
+		go s.work()
+	}
+	return s
+}
+
+// Get returns the stored waveform of file.
+func (s *WaveformService) Get(file *model.SongFile) (*Waveform, error) {
+	f, err := s.Storage.Open(file.WaveformPath())
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	b, err := io.ReadAll(f)
+	if err != nil {
+		return nil, err
+	}
+	w := &Waveform{}
+	return w, w.UnmarshalBinary(b)
+}
+
+func (s *WaveformService) Exists(file *model.SongFile) bool {
+	return s.Storage.Exists(file.WaveformPath())
+}
+
+// Generate decodes file and stores its waveform, replacing an existing one. A call
+// for a file whose waveform is already being generated waits for that result.
+func (s *WaveformService) Generate(ctx context.Context, file *model.SongFile) (*Waveform, error) {
+	if s.Decoder == nil {
+		return nil, ErrNoDecoder
+	}
+	path := file.WaveformPath()
+
+	s.mu.Lock()
+	if call, ok := s.inflight[path]; ok {
+		s.mu.Unlock()
+		select {
+		case <-call.done:
+			return call.waveform, call.err
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		}
+	}
+	call := &waveformCall{done: make(chan struct{})}
+	s.inflight[path] = call
+	s.mu.Unlock()
+
+	call.waveform, call.err = s.generate(ctx, file)
+
+	s.mu.Lock()
+	delete(s.inflight, path)
+	s.mu.Unlock()
+	close(call.done)
+	return call.waveform, call.err
+}
+
+func (s *WaveformService) generate(ctx context.Context, file *model.SongFile) (*Waveform, error) {
+	src, err := TranscodeInput(s.Storage, file.FilePath())
+	if err != nil {
+		return nil, err
+	}
+
+	pr, pw := io.Pipe()
+	go func() {
+		pw.CloseWithError(s.Decoder.DecodePCM(ctx, src, PCMChannels, pw))
+	}()
+	w, err := ComputeWaveform(pr)
+	pr.Close()
+	if err != nil {
+		return nil, err
+	}
+
+	data, err := w.MarshalBinary()
+	if err != nil {
+		return nil, err
+	}
+	if err := s.Storage.Save(file.WaveformPath(), bytes.NewReader(data)); err != nil {
+		return nil, fmt.Errorf("failed to save waveform: %v", err)
+	}
+	return w, nil
+}
+
+// Enqueue asks the worker to generate the waveform of file unless it already has
+// one, e.g. because it is linked to a file that was analyzed. It reports whether
+// the waveform is queued or being generated.
+func (s *WaveformService) Enqueue(file model.SongFile) bool {
+	if s == nil || s.Decoder == nil || s.Exists(&file) {
+		return false
+	}
+	path := file.WaveformPath()
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.queued[path] || s.inflight[path] != nil {
+		return true
+	}
+	select {
+	case s.queue <- file:
+		s.queued[path] = true
+		return true
+	default:
+		log.Printf("Waveform queue is full, leaving file %s to the backfill\n", file.ID)
+		return false
+	}
+}
+
+func (s *WaveformService) work() {
+	for file := range s.queue {
+		s.mu.Lock()
+		delete(s.queued, file.WaveformPath())
+		s.mu.Unlock()
+		if s.Exists(&file) {
+			continue
+		}
+
+		ctx, cancel := context.WithTimeout(context.Background(), 10*time.Minute)
+		if _, err := s.Generate(ctx, &file); err != nil {
+			log.Printf("Failed to generate waveform of file %s: %v\n", file.ID, err)
+		}
+		cancel()
+	}
+}
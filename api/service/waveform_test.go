@@ -0,0 +1,99 @@
+package service
+
+import (
+	"bytes"
+	"context"
+	"encoding/binary"
+	"io"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/ProjectDistribute/distributor/model"
+	"github.com/ProjectDistribute/distributor/utils"
+	"github.com/google/uuid"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestComputeWaveform(t *testing.T) {
+	w, err := ComputeWaveform(bytes.NewReader(sinePCM(997, 0.5, 10)))
+	require.NoError(t, err)
+	// 10 s are 1875 steps of 256 frames, merged two at a time
+	assert.Equal(t, 938, w.Length())
+	assert.Equal(t, 512, w.SamplesPerPixel)
+	assert.Equal(t, PCMSampleRate, w.SampleRate)
+	for i := 0; i < w.Length(); i++ {
+		assert.InDelta(t, -64, w.Data[2*i], 1)
+		assert.InDelta(t, 64, w.Data[2*i+1], 1)
+	}
+
+	// Short files keep the step resolution
+	w, err = ComputeWaveform(bytes.NewReader(sinePCM(997, 1, 0.1)))
+	require.NoError(t, err)
+	assert.Equal(t, 19, w.Length())
+	assert.Equal(t, waveformStep, w.SamplesPerPixel)
+	assert.EqualValues(t, 127, w.Data[1])
+}
+
+func TestWaveform_Binary(t *testing.T) {
+	w := &Waveform{SampleRate: 48000, SamplesPerPixel: 512, Data: []int8{-3, 5, -128, 127}}
+	data, err := w.MarshalBinary()
+	require.NoError(t, err)
+	require.Len(t, data, 24+4)
+	assert.Equal(t, uint32(2), binary.LittleEndian.Uint32(data[0:]))  // version
+	assert.Equal(t, uint32(1), binary.LittleEndian.Uint32(data[4:]))  // 8 bit
+	assert.Equal(t, uint32(2), binary.LittleEndian.Uint32(data[16:])) // length
+	assert.Equal(t, uint32(1), binary.LittleEndian.Uint32(data[20:])) // channels
+
+	var decoded Waveform
+	require.NoError(t, decoded.UnmarshalBinary(data))
+	assert.Equal(t, *w, decoded)
+
+	assert.ErrorIs(t, decoded.UnmarshalBinary(data[:26]), ErrInvalidWaveform)
+}
+
+// blockingDecoder decodes a short sine once release is closed.
+type blockingDecoder struct {
+	release chan struct{}
+	calls   atomic.Int32
+}
+
+func (d *blockingDecoder) DecodePCM(ctx context.Context, src string, channels int, w io.Writer) error {
+	d.calls.Add(1)
+	<-d.release
+	_, err := w.Write(sinePCM(997, 0.5, 0.1))
+	return err
+}
+
+func TestWaveformService_DedupesGeneration(t *testing.T) {
+	decoder := &blockingDecoder{release: make(chan struct{})}
+	svc := NewWaveformService(utils.LocalFileStorage{Root: t.TempDir()}, decoder)
+	file := model.SongFile{ID: uuid.New(), SongID: uuid.New(), Format: "flac"}
+
+	// Concurrent requests and the queue share one decode
+	var started, wg sync.WaitGroup
+	for i := 0; i < 4; i++ {
+		started.Add(1)
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			started.Done()
+			_, err := svc.Generate(context.Background(), &file)
+			assert.NoError(t, err)
+		}()
+	}
+	started.Wait()
+	require.Eventually(t, func() bool { return decoder.calls.Load() == 1 }, time.Second, time.Millisecond)
+	time.Sleep(10 * time.Millisecond)
+	assert.True(t, svc.Enqueue(file))
+	assert.True(t, svc.Enqueue(file))
+	close(decoder.release)
+	wg.Wait()
+
+	require.Eventually(t, func() bool { return svc.Exists(&file) }, time.Second, time.Millisecond)
+	assert.False(t, svc.Enqueue(file), "nothing to do once the waveform exists")
+	time.Sleep(10 * time.Millisecond)
+	assert.EqualValues(t, 1, decoder.calls.Load())
+}
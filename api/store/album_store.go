@@ -16,6 +16,12 @@ func NewAlbumStore(db *gorm.DB) *AlbumStore {
 	return &AlbumStore{db: db}
 }
 
+// withSongs preloads the album artists, genres and the songs in album order with
+// their artists and files, which carry the loudness of the songs.
+func (as *AlbumStore) withSongs() *gorm.DB {
+	return as.db.Preload("AlbumArtists").Preload("Genres").Preload("Songs", orderAlbumSongs).Preload("Songs.Artists").Preload("Songs.SongFiles")
+}
+
 func (as *AlbumStore) CreateAlbum(album *model.Album) (*model.Album, error) {
 	if err := as.db.Create(album).Error; err != nil {
 		return nil, err
@@ -27,9 +33,19 @@ func (as *AlbumStore) UpdateAlbum(album *model.Album) error {
 	return as.db.Save(album).Error
 }
 
+// ReplaceAlbumArtists sets the album artists and marks the album as changed for sync.
+func (as *AlbumStore) ReplaceAlbumArtists(album *model.Album, artists []model.Artist) error {
+	return as.db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Model(album).Association("AlbumArtists").Replace(artists); err != nil {
+			return err
+		}
+		return tx.Model(album).Update("updated_at", time.Now()).Error
+	})
+}
+
 func (as *AlbumStore) GetAlbumsByTitle(title string) ([]model.Album, error) {
 	var albums []model.Album
-	if err := as.db.Preload("Songs").Preload("Songs.Artists").Where("title = ?", title).Find(&albums).Error; err != nil {
+	if err := as.withSongs().Where("title = ?", title).Find(&albums).Error; err != nil {
 		return nil, err
 	}
 	return albums, nil
@@ -37,7 +53,7 @@ func (as *AlbumStore) GetAlbumsByTitle(title string) ([]model.Album, error) {
 
 func (as *AlbumStore) GetAlbumByID(uuid uuid.UUID) (*model.Album, error) {
 	var album model.Album
-	if err := as.db.Preload("Songs").Preload("Songs.Artists").First(&album, "id = ?", uuid).Error; err != nil {
+	if err := as.withSongs().First(&album, "id = ?", uuid).Error; err != nil {
 		return nil, err
 	}
 	return &album, nil
@@ -61,7 +77,7 @@ func (as *AlbumStore) GetDeletedAlbums(since time.Time) ([]uuid.UUID, error) {
 
 func (as *AlbumStore) GetAlbumsByIDs(ids []uuid.UUID) ([]model.Album, error) {
 	var albums []model.Album
-	err := as.db.Preload("Songs").Preload("Songs.Artists").Where("id IN ?", ids).Find(&albums).Error
+	err := as.withSongs().Where("id IN ?", ids).Find(&albums).Error
 	if err != nil {
 		return nil, err
 	}
@@ -69,13 +85,45 @@ func (as *AlbumStore) GetAlbumsByIDs(ids []uuid.UUID) ([]model.Album, error) {
 }
 
 func (as *AlbumStore) GetAlbumsPaginated(page, limit int) ([]model.Album, bool, error) {
-	return Paginate[model.Album](as.db, page, limit, "created_at desc", []string{"Songs", "Songs.Artists"})
+	return Paginate[model.Album](as.withSongs(), page, limit, "created_at desc", nil)
 }
 
 func (as *AlbumStore) GetAllAlbums() ([]model.Album, error) {
 	var albums []model.Album
-	if err := as.db.Preload("Songs").Preload("Songs.Artists").Find(&albums).Error; err != nil {
+	if err := as.withSongs().Find(&albums).Error; err != nil {
 		return nil, err
 	}
 	return albums, nil
 }
+
+// SearchAlbums matches albums by title. An empty query matches every album.
+func (as *AlbumStore) SearchAlbums(query string, limit, offset int) ([]model.Album, error) {
+	var albums []model.Album
+	db := as.withSongs()
+	if query != "" {
+		db = db.Where("title LIKE ?", "%"+query+"%")
+	}
+	err := db.Order("title").Limit(limit).Offset(offset).Find(&albums).Error
+	return albums, err
+}
+
+// GetAlbumDurations sums up the song durations (in ms) of the given albums.
+// Songs with several files count with their longest file.
+func (as *AlbumStore) GetAlbumDurations(ids []uuid.UUID) (map[uuid.UUID]uint, error) {
+	var rows []struct {
+		AlbumID  uuid.UUID
+		Duration uint
+	}
+	err := as.db.Raw(`SELECT songs.album_id AS album_id, SUM(f.duration) AS duration FROM songs
+		JOIN (SELECT song_id, MAX(duration) AS duration FROM song_files WHERE deleted_at IS NULL GROUP BY song_id) f ON f.song_id = songs.id
+		WHERE songs.deleted_at IS NULL AND songs.album_id IN ?
+		GROUP BY songs.album_id`, ids).Scan(&rows).Error
+	if err != nil {
+		return nil, err
+	}
+	durations := make(map[uuid.UUID]uint, len(rows))
+	for _, r := range rows {
+		durations[r.AlbumID] = r.Duration
+	}
+	return durations, nil
+}
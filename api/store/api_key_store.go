@@ -0,0 +1,67 @@
+package store
+
+import (
+	"time"
+
+	"github.com/ProjectDistribute/distributor/model"
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+)
+
+type APIKeyStore struct {
+	db *gorm.DB
+}
+
+func NewAPIKeyStore(db *gorm.DB) *APIKeyStore {
+	return &APIKeyStore{db: db}
+}
+
+func (ks *APIKeyStore) CreateAPIKey(key *model.APIKey) error {
+	return ks.db.Create(key).Error
+}
+
+func (ks *APIKeyStore) GetAPIKeyByID(id uuid.UUID) (*model.APIKey, error) {
+	var key model.APIKey
+	if err := ks.db.First(&key, "id = ?", id).Error; err != nil {
+		return nil, err
+	}
+	return &key, nil
+}
+
+func (ks *APIKeyStore) GetAPIKeyByHash(hash string) (*model.APIKey, error) {
+	var key model.APIKey
+	if err := ks.db.First(&key, "key_hash = ?", hash).Error; err != nil {
+		return nil, err
+	}
+	return &key, nil
+}
+
+// GetAPIKeysByUserID returns the keys of a user, newest first, including revoked ones.
+func (ks *APIKeyStore) GetAPIKeysByUserID(userID uuid.UUID) ([]model.APIKey, error) {
+	var keys []model.APIKey
+	err := ks.db.Where("user_id = ?", userID).Order("created_at desc").Find(&keys).Error
+	return keys, err
+}
+
+func (ks *APIKeyStore) GetAPIKeys() ([]model.APIKey, error) {
+	var keys []model.APIKey
+	err := ks.db.Order("created_at desc").Find(&keys).Error
+	return keys, err
+}
+
+func (ks *APIKeyStore) TouchAPIKey(id uuid.UUID, lastUsed time.Time, ip string) error {
+	return ks.db.Model(&model.APIKey{}).Where("id = ?", id).
+		Updates(map[string]interface{}{"last_used_at": lastUsed, "last_used_ip": ip}).Error
+}
+
+func (ks *APIKeyStore) RevokeAPIKey(id uuid.UUID) error {
+	return ks.db.Model(&model.APIKey{}).
+		Where("id = ? AND revoked_at IS NULL", id).
+		Update("revoked_at", time.Now()).Error
+}
+
+func (ks *APIKeyStore) RevokeUserAPIKeys(userID uuid.UUID) error {
+	return ks.db.Model(&model.APIKey{}).
+		Where("user_id = ? AND revoked_at IS NULL", userID).
+		Update("revoked_at", time.Now()).Error
+}
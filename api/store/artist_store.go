@@ -92,14 +92,17 @@ func (as *ArtistStore) GetArtistsByIDs(ids []uuid.UUID) ([]model.Artist, error)
 	return artists, nil
 }
 
+// GetAlbumsForArtist returns the albums the artist is credited on, as album artist or
+// on one of the songs.
 func (as *ArtistStore) GetAlbumsForArtist(artistID uuid.UUID) ([]model.Album, error) {
 	var albums []model.Album
-	// Join songs -> song_artists to find albums for this artist
-	err := as.db.
-		Joins("JOIN songs ON songs.album_id = albums.id").
+	onSongs := as.db.Table("songs").
+		Select("songs.album_id").
 		Joins("JOIN song_artists ON song_artists.song_id = songs.id").
-		Where("song_artists.artist_id = ?", artistID).
-		Distinct().
+		Where("song_artists.artist_id = ? AND songs.deleted_at IS NULL", artistID)
+	asAlbumArtist := as.db.Table("album_artists").Select("album_id").Where("artist_id = ?", artistID)
+	err := as.db.Preload("AlbumArtists").
+		Where("albums.id IN (?) OR albums.id IN (?)", onSongs, asAlbumArtist).
 		Find(&albums).Error
 	if err != nil {
 		return nil, err
@@ -110,3 +113,39 @@ func (as *ArtistStore) GetAlbumsForArtist(artistID uuid.UUID) ([]model.Album, er
 func (as *ArtistStore) GetArtistsPaginated(page, limit int) ([]model.Artist, bool, error) {
 	return Paginate[model.Artist](as.db, page, limit, "name asc", nil)
 }
+
+// SearchArtists matches artists by name. An empty query matches every artist.
+func (as *ArtistStore) SearchArtists(query string, limit, offset int) ([]model.Artist, error) {
+	var artists []model.Artist
+	db := as.db
+	if query != "" {
+		db = db.Where("name LIKE ?", "%"+query+"%")
+	}
+	err := db.Order("name").Limit(limit).Offset(offset).Find(&artists).Error
+	return artists, err
+}
+
+// GetAlbumCounts returns how many albums every artist appears on.
+func (as *ArtistStore) GetAlbumCounts() (map[uuid.UUID]int, error) {
+	var rows []struct {
+		ArtistID uuid.UUID
+		Count    int
+	}
+	err := as.db.Raw(`SELECT artist_id, COUNT(DISTINCT album_id) AS count FROM (
+			SELECT song_artists.artist_id AS artist_id, songs.album_id AS album_id FROM song_artists
+			JOIN songs ON songs.id = song_artists.song_id
+			WHERE songs.deleted_at IS NULL
+			UNION
+			SELECT album_artists.artist_id, album_artists.album_id FROM album_artists
+			JOIN albums ON albums.id = album_artists.album_id
+			WHERE albums.deleted_at IS NULL
+		) GROUP BY artist_id`).Scan(&rows).Error
+	if err != nil {
+		return nil, err
+	}
+	counts := make(map[uuid.UUID]int, len(rows))
+	for _, r := range rows {
+		counts[r.ArtistID] = r.Count
+	}
+	return counts, nil
+}
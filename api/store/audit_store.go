@@ -0,0 +1,39 @@
+package store
+
+import (
+	"github.com/ProjectDistribute/distributor/model"
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+)
+
+type AuditStore struct {
+	db *gorm.DB
+}
+
+func NewAuditStore(db *gorm.DB) *AuditStore {
+	return &AuditStore{db: db}
+}
+
+func (as *AuditStore) CreateAuditEntry(entry *model.AuditEntry) error {
+	return as.db.Create(entry).Error
+}
+
+// GetAuditEntries returns audit entries newest first, optionally filtered by target user and action.
+func (as *AuditStore) GetAuditEntries(targetID uuid.UUID, action string, limit, offset int) ([]model.AuditEntry, int64, error) {
+	query := as.db.Model(&model.AuditEntry{})
+	if targetID != uuid.Nil {
+		query = query.Where("target_id = ?", targetID)
+	}
+	if action != "" {
+		query = query.Where("action = ?", action)
+	}
+
+	var total int64
+	if err := query.Count(&total).Error; err != nil {
+		return nil, 0, err
+	}
+
+	var entries []model.AuditEntry
+	err := query.Order("created_at desc, id desc").Limit(limit).Offset(offset).Find(&entries).Error
+	return entries, total, err
+}
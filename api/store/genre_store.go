@@ -0,0 +1,181 @@
+package store
+
+import (
+	"errors"
+	"time"
+
+	"github.com/ProjectDistribute/distributor/model"
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+)
+
+type GenreStore struct {
+	db *gorm.DB
+}
+
+func NewGenreStore(db *gorm.DB) *GenreStore {
+	return &GenreStore{db: db}
+}
+
+func (gs *GenreStore) CreateGenre(genre *model.Genre) error {
+	return gs.db.Create(genre).Error
+}
+
+func (gs *GenreStore) UpdateGenre(genre *model.Genre) error {
+	return gs.db.Save(genre).Error
+}
+
+func (gs *GenreStore) GetGenreByID(id uuid.UUID) (*model.Genre, error) {
+	var genre model.Genre
+	if err := gs.db.First(&genre, "id = ?", id).Error; err != nil {
+		return nil, err
+	}
+	return &genre, nil
+}
+
+// GetGenreByName looks up a genre of the given kind by its case-insensitive name.
+// It returns nil if there is none.
+func (gs *GenreStore) GetGenreByName(name, kind string) (*model.Genre, error) {
+	var genre model.Genre
+	err := gs.db.Where("LOWER(name) = LOWER(?) AND kind = ?", name, kind).First(&genre).Error
+	if err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, nil
+		}
+		return nil, err
+	}
+	return &genre, nil
+}
+
+func (gs *GenreStore) GetGenresByIDs(ids []uuid.UUID) ([]model.Genre, error) {
+	var genres []model.Genre
+	if err := gs.db.Where("id IN ?", ids).Find(&genres).Error; err != nil {
+		return nil, err
+	}
+	return genres, nil
+}
+
+// GetGenresPaginated lists genres by name, only those of the given kind unless it is empty.
+func (gs *GenreStore) GetGenresPaginated(page, limit int, kind string) ([]model.Genre, bool, error) {
+	db := gs.db
+	if kind != "" {
+		db = db.Where("kind = ?", kind)
+	}
+	return Paginate[model.Genre](db, page, limit, "name asc", nil)
+}
+
+// GetSongsForGenre pages through the songs of a genre by title.
+func (gs *GenreStore) GetSongsForGenre(genreID uuid.UUID, page, limit int) ([]model.Song, bool, error) {
+	ids := gs.db.Table("song_genres").Select("song_id").Where("genre_id = ?", genreID)
+	return Paginate[model.Song](gs.db.Where("id IN (?)", ids), page, limit, "title asc", []string{"SongFiles", "Album", "Artists", "Genres"})
+}
+
+// GetAlbumsForGenre pages through the albums of a genre by title.
+func (gs *GenreStore) GetAlbumsForGenre(genreID uuid.UUID, page, limit int) ([]model.Album, bool, error) {
+	ids := gs.db.Table("album_genres").Select("album_id").Where("genre_id = ?", genreID)
+	return Paginate[model.Album](gs.db.Where("id IN (?)", ids), page, limit, "title asc", []string{"AlbumArtists", "Genres", "Songs", "Songs.Artists"})
+}
+
+// GetGenreUsage returns the IDs of the songs and albums a genre is set on.
+func (gs *GenreStore) GetGenreUsage(genreID uuid.UUID) (songIDs, albumIDs []uuid.UUID, err error) {
+	err = gs.db.Table("song_genres").
+		Joins("JOIN songs ON songs.id = song_genres.song_id AND songs.deleted_at IS NULL").
+		Where("song_genres.genre_id = ?", genreID).
+		Pluck("song_genres.song_id", &songIDs).Error
+	if err != nil {
+		return nil, nil, err
+	}
+	err = gs.db.Table("album_genres").
+		Joins("JOIN albums ON albums.id = album_genres.album_id AND albums.deleted_at IS NULL").
+		Where("album_genres.genre_id = ?", genreID).
+		Pluck("album_genres.album_id", &albumIDs).Error
+	return songIDs, albumIDs, err
+}
+
+// GenreCounts is how many songs and albums a genre is set on.
+type GenreCounts struct {
+	Songs  int
+	Albums int
+}
+
+func (gs *GenreStore) GetGenreCounts(ids []uuid.UUID) (map[uuid.UUID]GenreCounts, error) {
+	var rows []struct {
+		GenreID uuid.UUID
+		Songs   int
+		Albums  int
+	}
+	err := gs.db.Raw(`SELECT genre_id, SUM(songs) AS songs, SUM(albums) AS albums FROM (
+			SELECT song_genres.genre_id AS genre_id, COUNT(*) AS songs, 0 AS albums FROM song_genres
+			JOIN songs ON songs.id = song_genres.song_id
+			WHERE songs.deleted_at IS NULL AND song_genres.genre_id IN ?
+			GROUP BY song_genres.genre_id
+			UNION ALL
+			SELECT album_genres.genre_id, 0, COUNT(*) FROM album_genres
+			JOIN albums ON albums.id = album_genres.album_id
+			WHERE albums.deleted_at IS NULL AND album_genres.genre_id IN ?
+			GROUP BY album_genres.genre_id
+		) GROUP BY genre_id`, ids, ids).Scan(&rows).Error
+	if err != nil {
+		return nil, err
+	}
+	counts := make(map[uuid.UUID]GenreCounts, len(rows))
+	for _, r := range rows {
+		counts[r.GenreID] = GenreCounts{Songs: r.Songs, Albums: r.Albums}
+	}
+	return counts, nil
+}
+
+// ReplaceSongGenres sets the genres of a song and marks it as changed for sync.
+func (gs *GenreStore) ReplaceSongGenres(song *model.Song, genres []model.Genre) error {
+	return gs.db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Model(song).Association("Genres").Replace(genres); err != nil {
+			return err
+		}
+		return tx.Model(song).Update("updated_at", time.Now()).Error
+	})
+}
+
+// ReplaceAlbumGenres sets the genres of an album and marks it as changed for sync.
+func (gs *GenreStore) ReplaceAlbumGenres(album *model.Album, genres []model.Genre) error {
+	return gs.db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Model(album).Association("Genres").Replace(genres); err != nil {
+			return err
+		}
+		return tx.Model(album).Update("updated_at", time.Now()).Error
+	})
+}
+
+// DeleteGenre removes a genre from its songs and albums, which are marked as changed
+// for sync, and deletes it.
+func (gs *GenreStore) DeleteGenre(genre *model.Genre) error {
+	return gs.db.Transaction(func(tx *gorm.DB) error {
+		now := time.Now()
+		songs := tx.Table("song_genres").Select("song_id").Where("genre_id = ?", genre.ID)
+		if err := tx.Model(&model.Song{}).Where("id IN (?)", songs).Update("updated_at", now).Error; err != nil {
+			return err
+		}
+		albums := tx.Table("album_genres").Select("album_id").Where("genre_id = ?", genre.ID)
+		if err := tx.Model(&model.Album{}).Where("id IN (?)", albums).Update("updated_at", now).Error; err != nil {
+			return err
+		}
+		if err := tx.Exec("DELETE FROM song_genres WHERE genre_id = ?", genre.ID).Error; err != nil {
+			return err
+		}
+		if err := tx.Exec("DELETE FROM album_genres WHERE genre_id = ?", genre.ID).Error; err != nil {
+			return err
+		}
+		return tx.Delete(genre).Error
+	})
+}
+
+func (gs *GenreStore) GetChangedGenres(since time.Time) ([]uuid.UUID, error) {
+	var ids []uuid.UUID
+	err := gs.db.Model(&model.Genre{}).Where("updated_at > ?", since).Pluck("id", &ids).Error
+	return ids, err
+}
+
+func (gs *GenreStore) GetDeletedGenres(since time.Time) ([]uuid.UUID, error) {
+	var ids []uuid.UUID
+	err := gs.db.Model(&model.Genre{}).Unscoped().Where("deleted_at > ?", since).Pluck("id", &ids).Error
+	return ids, err
+}
@@ -0,0 +1,39 @@
+package store
+
+import (
+	"github.com/ProjectDistribute/distributor/model"
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+)
+
+type IdentityStore struct {
+	db *gorm.DB
+}
+
+func NewIdentityStore(db *gorm.DB) *IdentityStore {
+	return &IdentityStore{db: db}
+}
+
+func (is *IdentityStore) CreateIdentity(identity *model.UserIdentity) error {
+	return is.db.Create(identity).Error
+}
+
+func (is *IdentityStore) GetIdentity(issuer, subject string) (*model.UserIdentity, error) {
+	var identity model.UserIdentity
+	if err := is.db.First(&identity, "issuer = ? AND subject = ?", issuer, subject).Error; err != nil {
+		return nil, err
+	}
+	return &identity, nil
+}
+
+func (is *IdentityStore) UpdateIdentity(identity *model.UserIdentity) error {
+	return is.db.Save(identity).Error
+}
+
+func (is *IdentityStore) DeleteIdentity(id uuid.UUID) error {
+	return is.db.Delete(&model.UserIdentity{}, "id = ?", id).Error
+}
+
+func (is *IdentityStore) DeleteIdentitiesByUserID(userID uuid.UUID) error {
+	return is.db.Delete(&model.UserIdentity{}, "user_id = ?", userID).Error
+}
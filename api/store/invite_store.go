@@ -0,0 +1,65 @@
+package store
+
+import (
+	"time"
+
+	"github.com/ProjectDistribute/distributor/model"
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+)
+
+type InviteStore struct {
+	db *gorm.DB
+}
+
+func NewInviteStore(db *gorm.DB) *InviteStore {
+	return &InviteStore{db: db}
+}
+
+func (is *InviteStore) CreateInvite(invite *model.Invite) error {
+	return is.db.Create(invite).Error
+}
+
+func (is *InviteStore) GetInviteByID(id uuid.UUID) (*model.Invite, error) {
+	var invite model.Invite
+	if err := is.db.First(&invite, "id = ?", id).Error; err != nil {
+		return nil, err
+	}
+	return &invite, nil
+}
+
+func (is *InviteStore) GetInviteByCode(code string) (*model.Invite, error) {
+	var invite model.Invite
+	if err := is.db.First(&invite, "code = ?", code).Error; err != nil {
+		return nil, err
+	}
+	return &invite, nil
+}
+
+func (is *InviteStore) GetInvites() ([]model.Invite, error) {
+	var invites []model.Invite
+	err := is.db.Order("created_at desc").Find(&invites).Error
+	return invites, err
+}
+
+func (is *InviteStore) RevokeInvite(id uuid.UUID) error {
+	return is.db.Model(&model.Invite{}).
+		Where("id = ? AND revoked_at IS NULL", id).
+		Update("revoked_at", time.Now()).Error
+}
+
+// UseInvite counts one use of the invite. It reports false if the invite was used up,
+// revoked or expired in the meantime.
+func (is *InviteStore) UseInvite(id uuid.UUID) (bool, error) {
+	res := is.db.Model(&model.Invite{}).
+		Where("id = ? AND revoked_at IS NULL AND (expires_at IS NULL OR expires_at > ?) AND (max_uses = 0 OR uses < max_uses)", id, time.Now()).
+		Update("uses", gorm.Expr("uses + 1"))
+	return res.RowsAffected == 1, res.Error
+}
+
+// ReleaseInvite gives back a use taken by UseInvite, e.g. when creating the user failed.
+func (is *InviteStore) ReleaseInvite(id uuid.UUID) error {
+	return is.db.Model(&model.Invite{}).
+		Where("id = ? AND uses > 0", id).
+		Update("uses", gorm.Expr("uses - 1")).Error
+}
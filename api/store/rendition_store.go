@@ -0,0 +1,57 @@
+package store
+
+import (
+	"time"
+
+	"github.com/ProjectDistribute/distributor/model"
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+)
+
+type RenditionStore struct {
+	db *gorm.DB
+}
+
+func NewRenditionStore(db *gorm.DB) *RenditionStore {
+	return &RenditionStore{db: db}
+}
+
+func (rs *RenditionStore) CreateRendition(r *model.SongRendition) error {
+	return rs.db.Create(r).Error
+}
+
+func (rs *RenditionStore) GetRenditionByID(id uuid.UUID) (*model.SongRendition, error) {
+	var r model.SongRendition
+	if err := rs.db.First(&r, "id = ?", id).Error; err != nil {
+		return nil, err
+	}
+	return &r, nil
+}
+
+func (rs *RenditionStore) GetRenditionsBySongFileID(fileID uuid.UUID) ([]model.SongRendition, error) {
+	var renditions []model.SongRendition
+	err := rs.db.Where("song_file_id = ?", fileID).Order("profile").Find(&renditions).Error
+	return renditions, err
+}
+
+func (rs *RenditionStore) GetAllRenditions() ([]model.SongRendition, error) {
+	var renditions []model.SongRendition
+	err := rs.db.Find(&renditions).Error
+	return renditions, err
+}
+
+func (rs *RenditionStore) DeleteRendition(id uuid.UUID) error {
+	return rs.db.Delete(&model.SongRendition{}, id).Error
+}
+
+func (rs *RenditionStore) GetChangedRenditions(since time.Time) ([]uuid.UUID, error) {
+	var ids []uuid.UUID
+	err := rs.db.Model(&model.SongRendition{}).Where("updated_at > ?", since).Pluck("id", &ids).Error
+	return ids, err
+}
+
+func (rs *RenditionStore) GetDeletedRenditions(since time.Time) ([]uuid.UUID, error) {
+	var ids []uuid.UUID
+	err := rs.db.Model(&model.SongRendition{}).Unscoped().Where("deleted_at > ?", since).Pluck("id", &ids).Error
+	return ids, err
+}
@@ -0,0 +1,18 @@
+package store
+
+import (
+	"github.com/ProjectDistribute/distributor/model"
+	"gorm.io/gorm"
+)
+
+type ScrobbleStore struct {
+	db *gorm.DB
+}
+
+func NewScrobbleStore(db *gorm.DB) *ScrobbleStore {
+	return &ScrobbleStore{db: db}
+}
+
+func (ss *ScrobbleStore) CreateScrobble(scrobble *model.Scrobble) error {
+	return ss.db.Create(scrobble).Error
+}
@@ -0,0 +1,75 @@
+package store
+
+import (
+	"time"
+
+	"github.com/ProjectDistribute/distributor/model"
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+)
+
+type SessionStore struct {
+	db *gorm.DB
+}
+
+func NewSessionStore(db *gorm.DB) *SessionStore {
+	return &SessionStore{db: db}
+}
+
+func (ss *SessionStore) CreateSession(session *model.Session) error {
+	return ss.db.Create(session).Error
+}
+
+func (ss *SessionStore) GetSessionByID(id uuid.UUID) (*model.Session, error) {
+	var session model.Session
+	if err := ss.db.First(&session, "id = ?", id).Error; err != nil {
+		return nil, err
+	}
+	return &session, nil
+}
+
+func (ss *SessionStore) GetSessionByRefreshTokenHash(hash string) (*model.Session, error) {
+	var session model.Session
+	if err := ss.db.First(&session, "refresh_token_hash = ?", hash).Error; err != nil {
+		return nil, err
+	}
+	return &session, nil
+}
+
+// GetActiveSessionsByUserID returns the sessions of a user that are neither revoked nor expired, most recently used first.
+func (ss *SessionStore) GetActiveSessionsByUserID(userID uuid.UUID) ([]model.Session, error) {
+	var sessions []model.Session
+	err := ss.db.
+		Where("user_id = ? AND revoked_at IS NULL AND expires_at > ?", userID, time.Now()).
+		Order("last_used_at desc").
+		Find(&sessions).Error
+	return sessions, err
+}
+
+func (ss *SessionStore) UpdateSession(session *model.Session) error {
+	return ss.db.Save(session).Error
+}
+
+func (ss *SessionStore) TouchSession(id uuid.UUID, lastUsed time.Time) error {
+	return ss.db.Model(&model.Session{}).Where("id = ?", id).Update("last_used_at", lastUsed).Error
+}
+
+func (ss *SessionStore) RevokeSession(id uuid.UUID) error {
+	return ss.db.Model(&model.Session{}).
+		Where("id = ? AND revoked_at IS NULL", id).
+		Update("revoked_at", time.Now()).Error
+}
+
+// RevokeUserSessions revokes every session of a user and returns how many were still active.
+func (ss *SessionStore) RevokeUserSessions(userID uuid.UUID) (int64, error) {
+	res := ss.db.Model(&model.Session{}).
+		Where("user_id = ? AND revoked_at IS NULL", userID).
+		Update("revoked_at", time.Now())
+	return res.RowsAffected, res.Error
+}
+
+// DeleteStaleSessions removes sessions that expired or were revoked before the given time.
+func (ss *SessionStore) DeleteStaleSessions(before time.Time) (int64, error) {
+	res := ss.db.Where("expires_at < ? OR revoked_at < ?", before, before).Delete(&model.Session{})
+	return res.RowsAffected, res.Error
+}
@@ -13,6 +13,12 @@ type SongStore struct {
 	db *gorm.DB
 }
 
+// orderAlbumSongs sorts songs as they appear on their album. Songs without a disc
+// number count as disc 1, songs without a track number go last on their disc.
+func orderAlbumSongs(db *gorm.DB) *gorm.DB {
+	return db.Order("CASE WHEN disc_number = 0 THEN 1 ELSE disc_number END, track_number = 0, track_number, title")
+}
+
 func NewSongStore(db *gorm.DB) *SongStore {
 	return &SongStore{db: db}
 }
@@ -52,13 +58,54 @@ func (ss *SongStore) DeleteSongFile(id uuid.UUID) error {
 
 func (ss *SongStore) GetSongFilesBySongID(songID uuid.UUID) ([]model.SongFile, error) {
 	var files []model.SongFile
-	err := ss.db.Where("song_id = ?", songID).Find(&files).Error
+	err := ss.db.Preload("Renditions", func(db *gorm.DB) *gorm.DB {
+		return db.Order("profile")
+	}).Where("song_id = ?", songID).Find(&files).Error
 	if err != nil {
 		return nil, err
 	}
 	return files, nil
 }
 
+// GetSongFilesBySHA256 returns the files with the given audio hash, oldest first.
+func (ss *SongStore) GetSongFilesBySHA256(hash string) ([]model.SongFile, error) {
+	var files []model.SongFile
+	err := ss.db.Where("sha256 = ?", hash).Order("created_at").Find(&files).Error
+	return files, err
+}
+
+// GetSharedAudioFiles returns the files whose audio hash is shared by more than one song.
+func (ss *SongStore) GetSharedAudioFiles() ([]model.SongFile, error) {
+	shared := ss.db.Model(&model.SongFile{}).
+		Select("sha256").
+		Where("sha256 <> ''").
+		Group("sha256").
+		Having("COUNT(DISTINCT song_id) > 1")
+	var files []model.SongFile
+	err := ss.db.Where("sha256 IN (?)", shared).Order("sha256, created_at").Find(&files).Error
+	return files, err
+}
+
+// CountBlobUsers counts the files other than exceptID stored under blobKey.
+func (ss *SongStore) CountBlobUsers(blobKey, exceptID uuid.UUID) (int64, error) {
+	var count int64
+	err := ss.db.Model(&model.SongFile{}).
+		Where("(id = ? OR blob_id = ?) AND id <> ?", blobKey, blobKey, exceptID).
+		Count(&count).Error
+	return count, err
+}
+
+func (ss *SongStore) GetAllSongFiles() ([]model.SongFile, error) {
+	var files []model.SongFile
+	err := ss.db.Find(&files).Error
+	return files, err
+}
+
+// UpdateSongFileLoudness saves the loudness fields of sf.
+func (ss *SongStore) UpdateSongFileLoudness(sf *model.SongFile) error {
+	return ss.db.Model(sf).Select("LoudnessAnalyzedAt", "Loudness", "TruePeak", "TrackGain", "AlbumGain", "AlbumPeak").Updates(sf).Error
+}
+
 func (ss *SongStore) GetFileByID(fileID uuid.UUID) (*model.SongFile, error) {
 	var file model.SongFile
 	err := ss.db.First(&file, fileID).Error
@@ -70,7 +117,7 @@ func (ss *SongStore) GetFileByID(fileID uuid.UUID) (*model.SongFile, error) {
 
 func (ss *SongStore) GetAllSongs() ([]model.Song, error) {
 	var songs []model.Song
-	err := ss.db.Preload("SongFiles").Preload("Album").Preload("Artists").Find(&songs).Error
+	err := ss.db.Preload("SongFiles").Preload("Album").Preload("Artists").Preload("Genres").Find(&songs).Error
 	if err != nil {
 		return nil, err
 	}
@@ -79,7 +126,7 @@ func (ss *SongStore) GetAllSongs() ([]model.Song, error) {
 
 func (ss *SongStore) GetLatestSongs() ([]model.Song, error) {
 	var songs []model.Song
-	err := ss.db.Preload("SongFiles").Preload("Album").Preload("Artists").Order("created_at desc").Limit(50).Find(&songs).Error
+	err := ss.db.Preload("SongFiles").Preload("Album").Preload("Artists").Preload("Genres").Order("created_at desc").Limit(50).Find(&songs).Error
 	if err != nil {
 		return nil, err
 	}
@@ -107,7 +154,7 @@ func (ss *SongStore) DeleteSong(song *model.Song) error {
 
 func (ss *SongStore) GetSongByTitleAndAlbumID(title string, albumID uuid.UUID) (*model.Song, error) {
 	var song model.Song
-	err := ss.db.Preload("Album").Preload("Artists").Where("title = ? AND album_id = ?", title, albumID).First(&song).Error
+	err := ss.db.Preload("Album").Preload("Artists").Preload("Genres").Where("title = ? AND album_id = ?", title, albumID).First(&song).Error
 	if err != nil {
 		if errors.Is(err, gorm.ErrRecordNotFound) {
 			return nil, nil
@@ -131,7 +178,7 @@ func (ss *SongStore) GetDeletedSongs(since time.Time) ([]uuid.UUID, error) {
 
 func (ss *SongStore) GetSongsByIDs(ids []uuid.UUID) ([]model.Song, error) {
 	var songs []model.Song
-	err := ss.db.Preload("SongFiles").Preload("Album").Preload("Artists").Where("id IN ?", ids).Find(&songs).Error
+	err := ss.db.Preload("SongFiles").Preload("Album").Preload("Artists").Preload("Genres").Where("id IN ?", ids).Find(&songs).Error
 	if err != nil {
 		return nil, err
 	}
@@ -139,14 +186,25 @@ func (ss *SongStore) GetSongsByIDs(ids []uuid.UUID) ([]model.Song, error) {
 }
 
 func (ss *SongStore) GetSongsPaginated(page, limit int) ([]model.Song, bool, error) {
-	return Paginate[model.Song](ss.db, page, limit, "created_at desc", []string{"SongFiles", "Album", "Artists"})
+	return Paginate[model.Song](ss.db, page, limit, "created_at desc", []string{"SongFiles", "Album", "Artists", "Genres"})
 }
 
 func (ss *SongStore) GetSongsByAlbumID(albumID uuid.UUID) ([]model.Song, error) {
 	var songs []model.Song
-	err := ss.db.Preload("SongFiles").Preload("Album").Preload("Artists").Where("album_id = ?", albumID).Find(&songs).Error
+	err := ss.db.Preload("SongFiles").Preload("Album").Preload("Artists").Preload("Genres").Where("album_id = ?", albumID).Scopes(orderAlbumSongs).Find(&songs).Error
 	if err != nil {
 		return nil, err
 	}
 	return songs, nil
 }
+
+// SearchSongs matches songs by title. An empty query matches every song.
+func (ss *SongStore) SearchSongs(query string, limit, offset int) ([]model.Song, error) {
+	var songs []model.Song
+	db := ss.db.Preload("SongFiles").Preload("Album").Preload("Artists").Preload("Genres")
+	if query != "" {
+		db = db.Where("title LIKE ?", "%"+query+"%")
+	}
+	err := db.Order("title").Limit(limit).Offset(offset).Find(&songs).Error
+	return songs, err
+}
@@ -0,0 +1,38 @@
+package store
+
+import (
+	"time"
+
+	"github.com/ProjectDistribute/distributor/model"
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+type StarStore struct {
+	db *gorm.DB
+}
+
+func NewStarStore(db *gorm.DB) *StarStore {
+	return &StarStore{db: db}
+}
+
+func (ss *StarStore) Star(userID, itemID uuid.UUID, itemType string) error {
+	star := model.Star{UserID: userID, ItemID: itemID, ItemType: itemType, CreatedAt: time.Now()}
+	return ss.db.Clauses(clause.OnConflict{DoNothing: true}).Create(&star).Error
+}
+
+func (ss *StarStore) Unstar(userID, itemID uuid.UUID) error {
+	return ss.db.Delete(&model.Star{}, "user_id = ? AND item_id = ?", userID, itemID).Error
+}
+
+// GetStars returns when the user starred each item, optionally limited to one item type.
+func (ss *StarStore) GetStars(userID uuid.UUID, itemType string) ([]model.Star, error) {
+	var stars []model.Star
+	query := ss.db.Where("user_id = ?", userID)
+	if itemType != "" {
+		query = query.Where("item_type = ?", itemType)
+	}
+	err := query.Order("created_at desc").Find(&stars).Error
+	return stars, err
+}
@@ -0,0 +1,67 @@
+package store
+
+import (
+	"github.com/ProjectDistribute/distributor/model"
+	"gorm.io/gorm"
+)
+
+type StorageMigrationStore struct {
+	db *gorm.DB
+}
+
+func NewStorageMigrationStore(db *gorm.DB) *StorageMigrationStore {
+	return &StorageMigrationStore{db: db}
+}
+
+func (ms *StorageMigrationStore) CreateMigration(m *model.StorageMigration) error {
+	return ms.db.Create(m).Error
+}
+
+func (ms *StorageMigrationStore) UpdateMigration(m *model.StorageMigration) error {
+	return ms.db.Save(m).Error
+}
+
+// GetLatestMigration returns the most recent migration, with the given status if
+// one is passed.
+func (ms *StorageMigrationStore) GetLatestMigration(status string) (*model.StorageMigration, error) {
+	query := ms.db.Order("id desc")
+	if status != "" {
+		query = query.Where("status = ?", status)
+	}
+	var m model.StorageMigration
+	if err := query.First(&m).Error; err != nil {
+		return nil, err
+	}
+	return &m, nil
+}
+
+// GetMigrationsByStatus returns the migrations with the given status, oldest first.
+func (ms *StorageMigrationStore) GetMigrationsByStatus(status string) ([]model.StorageMigration, error) {
+	var migrations []model.StorageMigration
+	err := ms.db.Where("status = ?", status).Order("id").Find(&migrations).Error
+	return migrations, err
+}
+
+func (ms *StorageMigrationStore) AddItem(item *model.StorageMigrationItem) error {
+	return ms.db.Save(item).Error
+}
+
+// GetItemPaths returns the paths already copied by the migration.
+func (ms *StorageMigrationStore) GetItemPaths(migrationID uint) (map[string]bool, error) {
+	var paths []string
+	err := ms.db.Model(&model.StorageMigrationItem{}).Where("migration_id = ?", migrationID).Pluck("path", &paths).Error
+	if err != nil {
+		return nil, err
+	}
+	copied := make(map[string]bool, len(paths))
+	for _, p := range paths {
+		copied[p] = true
+	}
+	return copied, nil
+}
+
+func (ms *StorageMigrationStore) CountItems(migrationID uint) (int64, error) {
+	var count int64
+	err := ms.db.Model(&model.StorageMigrationItem{}).Where("migration_id = ?", migrationID).Count(&count).Error
+	return count, err
+}
@@ -1,6 +1,8 @@
 package store
 
 import (
+	"time"
+
 	"github.com/ProjectDistribute/distributor/model"
 	"github.com/google/uuid"
 	"gorm.io/gorm"
@@ -22,7 +24,7 @@ func (us *UserStore) CreateUser(user *model.User) error {
 }
 
 func (us *UserStore) PromoteUserToAdmin(user *model.User) error {
-	user.IsAdmin = true
+	user.SetRole(model.RoleAdmin)
 	return us.db.Save(user).Error
 }
 
@@ -53,7 +55,12 @@ func (us *UserStore) UpdateUser(user *model.User) (*model.User, error) {
 	return user, nil
 }
 
-func (us *UserStore) SetAdminStatus(user *model.User, isAdmin bool) error {
-	user.IsAdmin = isAdmin
+// RevokeTokens records that access tokens of the user issued before at are invalid.
+func (us *UserStore) RevokeTokens(userID uuid.UUID, at time.Time) error {
+	return us.db.Model(&model.User{}).Where("id = ?", userID).Update("tokens_revoked_at", at).Error
+}
+
+func (us *UserStore) SetRole(user *model.User, role string) error {
+	user.SetRole(role)
 	return us.db.Save(user).Error
 }
@@ -0,0 +1,120 @@
+package task
+
+import (
+	"context"
+	"fmt"
+	"log"
+
+	"github.com/ProjectDistribute/distributor/model"
+	"github.com/ProjectDistribute/distributor/service"
+	"github.com/google/uuid"
+)
+
+// AnalyzeLoudness measures the EBU R128 loudness of song files and stores their
+// track and album gain. The album gain depends on every song of the album, so an
+// album is measured as a whole when any of its files has not been analyzed yet,
+// or always when all is set. Songs without an album get an album gain equal to
+// their track gain.
+func AnalyzeLoudness(loudnessSvc *service.LoudnessService, job *service.Job, all bool) error {
+	songs, err := loudnessSvc.SongStore.GetAllSongs()
+	if err != nil {
+		return err
+	}
+
+	var order []uuid.UUID
+	albums := make(map[uuid.UUID][]model.Song)
+	for _, s := range songs {
+		key := s.AlbumID
+		if key == uuid.Nil {
+			key = s.ID
+		}
+		if _, ok := albums[key]; !ok {
+			order = append(order, key)
+		}
+		albums[key] = append(albums[key], s)
+	}
+
+	var todo [][]model.Song
+	total := 0
+	for _, key := range order {
+		group := albums[key]
+		files, pending := 0, all
+		for _, s := range group {
+			for _, f := range s.SongFiles {
+				files++
+				pending = pending || f.LoudnessAnalyzedAt == nil
+			}
+		}
+		if pending && files > 0 {
+			todo = append(todo, group)
+			total += files
+		}
+	}
+
+	job.SetTotal(total)
+	job.SetMessage(fmt.Sprintf("%d albums to analyze", len(todo)))
+	log.Printf("Analyzing loudness of %d files in %d albums", total, len(todo))
+
+	for _, group := range todo {
+		analyzeAlbumLoudness(loudnessSvc, job, group)
+	}
+	return nil
+}
+
+func analyzeAlbumLoudness(loudnessSvc *service.LoudnessService, job *service.Job, songs []model.Song) {
+	// Linked files share their audio, it is decoded once
+	measured := make(map[string]*service.Loudness)
+	results := make(map[uuid.UUID]*service.Loudness)
+	var tracks []*service.Loudness
+
+	for _, s := range songs {
+		// Each song counts once towards the album, with its best file
+		var best *model.SongFile
+		for i := range s.SongFiles {
+			f := &s.SongFiles[i]
+			path := f.FilePath()
+			l, ok := measured[path]
+			if !ok {
+				var err error
+				if l, err = loudnessSvc.Measure(context.Background(), f); err != nil {
+					log.Printf("Failed to analyze loudness of file %s: %v", f.ID, err)
+					job.Fail(f.ID.String(), err)
+					continue
+				}
+				measured[path] = l
+			}
+			results[f.ID] = l
+			if best == nil || preferredFile(f, best) {
+				best = f
+			}
+		}
+		if best != nil {
+			tracks = append(tracks, results[best.ID])
+		}
+	}
+
+	album := service.AlbumLoudness(tracks)
+	for _, s := range songs {
+		for i := range s.SongFiles {
+			f := &s.SongFiles[i]
+			l, ok := results[f.ID]
+			if !ok {
+				continue
+			}
+			if err := loudnessSvc.Save(f, l, album); err != nil {
+				job.Fail(f.ID.String(), err)
+				continue
+			}
+			job.Advance()
+		}
+	}
+}
+
+// preferredFile reports whether a is a better source than b: lossless first, then
+// the higher bitrate.
+func preferredFile(a, b *model.SongFile) bool {
+	if (a.BitDepth > 0) != (b.BitDepth > 0) {
+		return a.BitDepth > 0
+	}
+	return a.Bitrate > b.Bitrate
+}
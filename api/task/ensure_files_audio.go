@@ -0,0 +1,34 @@
+package task
+
+import (
+	"log"
+
+	"github.com/ProjectDistribute/distributor/model"
+	"github.com/ProjectDistribute/distributor/service"
+	"gorm.io/gorm"
+)
+
+// EnsureFilesAudioInfo probes files that are missing their duration or audio properties.
+func EnsureFilesAudioInfo(db *gorm.DB, songSvc service.SongService) {
+	var files []model.SongFile
+	if err := db.Find(&files).Error; err != nil {
+		log.Printf("Error fetching files: %v", err)
+		return
+	}
+	for _, file := range files {
+		if file.Duration > 0 && file.SampleRate > 0 && file.Codec != "" {
+			continue
+		}
+
+		if err := songSvc.ProbeSongFile(&file); err != nil {
+			log.Printf("Error probing file %s: %v", file.FilePath(), err)
+			continue
+		}
+
+		if err := db.Save(&file).Error; err != nil {
+			log.Printf("Error updating audio info for file %s: %v", file.FilePath(), err)
+			continue
+		}
+		log.Printf("Updated file %s: %d ms, %d kbit/s, %d Hz, %d channels", file.FilePath(), file.Duration, file.Bitrate, file.SampleRate, file.Channels)
+	}
+}
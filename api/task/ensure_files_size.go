@@ -2,13 +2,13 @@ package task
 
 import (
 	"log"
-	"os"
 
 	"github.com/ProjectDistribute/distributor/model"
+	"github.com/ProjectDistribute/distributor/service"
 	"gorm.io/gorm"
 )
 
-func EnsureFilesSize(db *gorm.DB) {
+func EnsureFilesSize(db *gorm.DB, songSvc service.SongService) {
 	var files []model.SongFile
 	if err := db.Find(&files).Error; err != nil {
 		log.Printf("Error fetching files: %v", err)
@@ -20,8 +20,8 @@ func EnsureFilesSize(db *gorm.DB) {
 			continue
 		}
 
-		path := file.FilePath()
-		info, err := os.Stat(path)
+		path := songSvc.AudioPath(&file)
+		info, err := songSvc.Storage.Stat(path)
 		if err != nil {
 			log.Printf("Error stating file %s: %v", path, err)
 			continue
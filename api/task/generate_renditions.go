@@ -0,0 +1,78 @@
+package task
+
+import (
+	"context"
+	"fmt"
+	"log"
+
+	"github.com/ProjectDistribute/distributor/model"
+	"github.com/ProjectDistribute/distributor/service"
+	"github.com/google/uuid"
+)
+
+// GenerateRenditions brings the stored renditions in line with the rendition_profiles setting:
+// renditions of removed profiles or deleted files are dropped, missing ones are encoded.
+func GenerateRenditions(renditionSvc *service.RenditionService, job *service.Job) error {
+	profiles := renditionSvc.Profiles()
+	wanted := make(map[string]bool, len(profiles))
+	for _, p := range profiles {
+		wanted[service.RenditionProfileName(p)] = true
+	}
+
+	files, err := renditionSvc.SongStore.GetAllSongFiles()
+	if err != nil {
+		return err
+	}
+	fileExists := make(map[uuid.UUID]bool, len(files))
+	for _, f := range files {
+		fileExists[f.ID] = true
+	}
+
+	existing, err := renditionSvc.Store.GetAllRenditions()
+	if err != nil {
+		return err
+	}
+	have := make(map[string]bool, len(existing))
+	removed := 0
+	for i := range existing {
+		r := &existing[i]
+		if wanted[r.Profile] && fileExists[r.SongFileID] {
+			have[r.SongFileID.String()+"/"+r.Profile] = true
+			continue
+		}
+		if err := renditionSvc.DeleteRendition(r); err != nil {
+			log.Printf("Failed to remove stale rendition %s: %v", r.ID, err)
+			continue
+		}
+		removed++
+	}
+
+	type pending struct {
+		file *model.SongFile
+		opts service.TranscodeOptions
+	}
+	var todo []pending
+	for i := range files {
+		for _, p := range profiles {
+			if !have[files[i].ID.String()+"/"+service.RenditionProfileName(p)] {
+				todo = append(todo, pending{file: &files[i], opts: p})
+			}
+		}
+	}
+
+	job.SetTotal(len(todo))
+	job.SetMessage(fmt.Sprintf("%d profiles configured, %d stale renditions removed", len(profiles), removed))
+	log.Printf("Generating %d renditions, removed %d stale ones", len(todo), removed)
+
+	for _, p := range todo {
+		item := p.file.ID.String() + " " + service.RenditionProfileName(p.opts)
+		if _, err := renditionSvc.Generate(context.Background(), p.file, p.opts); err != nil {
+			log.Printf("Failed to generate rendition %s: %v", item, err)
+			job.Fail(item, err)
+			continue
+		}
+		job.Advance()
+	}
+
+	return nil
+}
@@ -0,0 +1,111 @@
+package task
+
+import (
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/ProjectDistribute/distributor/db"
+	"github.com/ProjectDistribute/distributor/model"
+	"github.com/ProjectDistribute/distributor/service"
+	"github.com/ProjectDistribute/distributor/store"
+	"github.com/ProjectDistribute/distributor/utils"
+	"github.com/google/uuid"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"gorm.io/driver/sqlite"
+	"gorm.io/gorm"
+)
+
+func newTestRenditionService(t *testing.T) *service.RenditionService {
+	gdb, err := gorm.Open(sqlite.Open(filepath.Join(t.TempDir(), "test.db")), &gorm.Config{})
+	require.NoError(t, err)
+	require.NoError(t, db.AutoMigrate(gdb))
+	return &service.RenditionService{
+		Store:      store.NewRenditionStore(gdb),
+		SongStore:  store.NewSongStore(gdb),
+		Settings:   store.NewSettingsStore(gdb),
+		Storage:    utils.LocalFileStorage{Root: t.TempDir()},
+		Transcodes: service.NewTranscodeService(&service.FakeTranscoder{}, 1),
+	}
+}
+
+func addTestSongFile(t *testing.T, svc *service.RenditionService, audio string) *model.SongFile {
+	sf := &model.SongFile{ID: uuid.New(), SongID: uuid.New(), Format: "flac"}
+	require.NoError(t, svc.SongStore.CreateSongFile(sf))
+	require.NoError(t, svc.Storage.Save(sf.FilePath(), strings.NewReader(audio)))
+	return sf
+}
+
+// addTestRendition stores a rendition of fileID as if an earlier run had generated it.
+func addTestRendition(t *testing.T, svc *service.RenditionService, fileID uuid.UUID, profile string) *model.SongRendition {
+	format, _, _ := strings.Cut(profile, "-")
+	r := &model.SongRendition{SongFileID: fileID, Profile: profile, Format: format}
+	require.NoError(t, svc.Store.CreateRendition(r))
+	require.NoError(t, svc.Storage.Save(r.FilePath(), strings.NewReader("old")))
+	return r
+}
+
+func runGenerateRenditions(t *testing.T, svc *service.RenditionService) service.JobSnapshot {
+	job, err := service.NewJobService().Start("renditions", func(job *service.Job) error {
+		return GenerateRenditions(svc, job)
+	})
+	require.NoError(t, err)
+	require.Eventually(t, func() bool { return !job.Running() }, 5*time.Second, 10*time.Millisecond)
+	return job.Snapshot()
+}
+
+func TestGenerateRenditions_Reconciles(t *testing.T) {
+	svc := newTestRenditionService(t)
+	require.NoError(t, svc.Settings.Set("rendition_profiles", "opus-128,aac-256"))
+
+	first := addTestSongFile(t, svc, "first")
+	second := addTestSongFile(t, svc, "second")
+	kept := addTestRendition(t, svc, first.ID, "opus-128")
+	staleProfile := addTestRendition(t, svc, first.ID, "mp3-320")
+	deletedFile := addTestRendition(t, svc, uuid.New(), "opus-128")
+
+	snap := runGenerateRenditions(t, svc)
+	assert.Equal(t, service.JobStatusCompleted, snap.Status)
+	assert.Equal(t, 3, snap.Total)
+	assert.Equal(t, 3, snap.Processed)
+	assert.Zero(t, snap.Failed)
+
+	renditions, err := svc.Store.GetAllRenditions()
+	require.NoError(t, err)
+	got := make(map[string]model.SongRendition)
+	for _, r := range renditions {
+		got[r.SongFileID.String()+"/"+r.Profile] = r
+	}
+	assert.Len(t, got, 4)
+	assert.Equal(t, kept.ID, got[first.ID.String()+"/opus-128"].ID, "existing renditions are not encoded again")
+	assert.Contains(t, got, first.ID.String()+"/aac-256")
+	assert.Contains(t, got, second.ID.String()+"/opus-128")
+	assert.Contains(t, got, second.ID.String()+"/aac-256")
+
+	assert.False(t, svc.Storage.Exists(staleProfile.FilePath()), "renditions of removed profiles are deleted")
+	assert.False(t, svc.Storage.Exists(deletedFile.FilePath()), "renditions of deleted files are deleted")
+	generated := got[second.ID.String()+"/aac-256"]
+	assert.True(t, svc.Storage.Exists(generated.FilePath()))
+	assert.NotZero(t, generated.Size)
+
+	// A second run has nothing to do
+	snap = runGenerateRenditions(t, svc)
+	assert.Zero(t, snap.Total)
+}
+
+func TestGenerateRenditions_NoProfilesRemovesAll(t *testing.T) {
+	svc := newTestRenditionService(t)
+	sf := addTestSongFile(t, svc, "audio")
+	r := addTestRendition(t, svc, sf.ID, "opus-128")
+
+	snap := runGenerateRenditions(t, svc)
+	assert.Equal(t, service.JobStatusCompleted, snap.Status)
+	assert.Zero(t, snap.Total)
+
+	renditions, err := svc.Store.GetAllRenditions()
+	require.NoError(t, err)
+	assert.Empty(t, renditions)
+	assert.False(t, svc.Storage.Exists(r.FilePath()))
+}
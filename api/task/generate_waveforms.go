@@ -0,0 +1,45 @@
+package task
+
+import (
+	"context"
+	"log"
+
+	"github.com/ProjectDistribute/distributor/model"
+	"github.com/ProjectDistribute/distributor/service"
+	"gorm.io/gorm"
+)
+
+// GenerateMissingWaveforms generates the waveform of every song file that has
+// none, e.g. files ingested before waveforms existed or while no decoder was
+// available. Linked files share their waveform, it is generated once.
+func GenerateMissingWaveforms(db *gorm.DB, waveformSvc *service.WaveformService, job *service.Job) error {
+	var files []model.SongFile
+	if err := db.Find(&files).Error; err != nil {
+		return err
+	}
+
+	seen := make(map[string]bool)
+	var todo []*model.SongFile
+	for i := range files {
+		path := files[i].WaveformPath()
+		if seen[path] {
+			continue
+		}
+		seen[path] = true
+		if !waveformSvc.Exists(&files[i]) {
+			todo = append(todo, &files[i])
+		}
+	}
+
+	job.SetTotal(len(todo))
+	log.Printf("Generating %d missing waveforms", len(todo))
+	for _, f := range todo {
+		if _, err := waveformSvc.Generate(context.Background(), f); err != nil {
+			log.Printf("Failed to generate waveform of file %s: %v", f.ID, err)
+			job.Fail(f.ID.String(), err)
+			continue
+		}
+		job.Advance()
+	}
+	return nil
+}
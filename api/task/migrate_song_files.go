@@ -0,0 +1,152 @@
+package task
+
+import (
+	"fmt"
+	"log"
+
+	"github.com/ProjectDistribute/distributor/model"
+	"github.com/ProjectDistribute/distributor/service"
+	"github.com/ProjectDistribute/distributor/store"
+	"github.com/ProjectDistribute/distributor/utils"
+	"gorm.io/gorm"
+)
+
+// MigrateSongFilePaths moves song files from storage/songs/<song ID>.<format> to
+// storage/songs/<file ID>.<format>.
+//
+// With the old layout a second upload of the same format overwrote the first file
+// while adding another record, so several records can share one old path. The
+// surviving audio is that of the newest record, it gets the file and the older
+// records are linked to it and take over its audio properties. Records are linked
+// before the file is moved and records that already have their file are skipped,
+// so an interrupted migration picks up where it stopped when run again.
+//
+// The migration is only marked complete once every record has its file. Until then
+// SongService.AudioPath falls back to the legacy path and file cleanup is refused,
+// so running it against the wrong storage does not orphan any audio.
+func MigrateSongFilePaths(db *gorm.DB, storage utils.LocalFileStorage, settings *store.SettingsStore, job *service.Job) error {
+	if service.SongFilePathsMigrated(settings) {
+		return nil
+	}
+
+	var files []model.SongFile
+	if err := db.Unscoped().Order("created_at").Find(&files).Error; err != nil {
+		return err
+	}
+
+	byLegacyPath := make(map[string][]model.SongFile)
+	var order []string
+	for _, file := range files {
+		path := file.LegacyFilePath()
+		if _, ok := byLegacyPath[path]; !ok {
+			order = append(order, path)
+		}
+		byLegacyPath[path] = append(byLegacyPath[path], file)
+	}
+	job.SetTotal(len(order))
+
+	var migrated, failed, missing int
+	for _, legacy := range order {
+		// Records uploaded with the new layout, or migrated already, have their file
+		var pending []model.SongFile
+		for _, file := range byLegacyPath[legacy] {
+			if !storage.Exists(file.FilePath()) {
+				pending = append(pending, file)
+			}
+		}
+		if len(pending) == 0 {
+			job.Skip()
+			continue
+		}
+		if !storage.Exists(legacy) {
+			if live := countLive(pending); live > 0 {
+				log.Printf("Song file %s is missing, %d records left without a file\n", legacy, live)
+				job.Fail(legacy, errMissingFile)
+				missing += live
+			} else {
+				job.Skip()
+			}
+			continue
+		}
+
+		if err := migrateLegacyFile(db, storage, legacy, pending); err != nil {
+			log.Printf("Error migrating song file %s: %v\n", legacy, err)
+			job.Fail(legacy, err)
+			failed++
+			continue
+		}
+		migrated++
+		job.Advance()
+	}
+
+	if migrated > 0 {
+		log.Printf("Migrated %d song files to the per-file layout\n", migrated)
+	}
+	if failed > 0 {
+		return fmt.Errorf("%d song files could not be migrated", failed)
+	}
+	if missing > 0 {
+		return fmt.Errorf("%d song file records have no file at either path", missing)
+	}
+	return service.MarkSongFilePathsMigrated(settings)
+}
+
+// countLive counts the records of files that were not deleted.
+func countLive(files []model.SongFile) int {
+	n := 0
+	for _, file := range files {
+		if !file.DeletedAt.Valid {
+			n++
+		}
+	}
+	return n
+}
+
+// migrateLegacyFile moves the audio at legacy to the newest of records, which are
+// ordered by creation, and links the others to it.
+func migrateLegacyFile(db *gorm.DB, storage utils.LocalFileStorage, legacy string, records []model.SongFile) error {
+	var owner *model.SongFile
+	for i := len(records) - 1; i >= 0; i-- {
+		if records[i].BlobID == nil {
+			owner = &records[i]
+			break
+		}
+	}
+	if owner == nil {
+		return fmt.Errorf("no record owns the audio")
+	}
+
+	linked := 0
+	for _, file := range records {
+		if file.ID == owner.ID || file.BlobID != nil {
+			continue
+		}
+		// The audio these were uploaded with was overwritten, what is left is the owner's
+		err := db.Unscoped().Model(&file).Updates(map[string]any{
+			"blob_id":              owner.ID,
+			"duration":             owner.Duration,
+			"size":                 owner.Size,
+			"bitrate":              owner.Bitrate,
+			"sample_rate":          owner.SampleRate,
+			"bit_depth":            owner.BitDepth,
+			"channels":             owner.Channels,
+			"codec":                owner.Codec,
+			"sha256":               owner.SHA256,
+			"loudness_analyzed_at": owner.LoudnessAnalyzedAt,
+			"loudness":             owner.Loudness,
+			"true_peak":            owner.TruePeak,
+			"track_gain":           owner.TrackGain,
+			"album_gain":           owner.AlbumGain,
+			"album_peak":           owner.AlbumPeak,
+		}).Error
+		if err != nil {
+			return err
+		}
+		linked++
+	}
+	if linked > 0 {
+		log.Printf("Song file %s was shared by %d records, linked them to the newest\n", legacy, linked+1)
+	}
+	// Move takes its source as a path on disk, not one in storage
+	return storage.Move(storage.FullPath(legacy), owner.FilePath())
+}
@@ -0,0 +1,57 @@
+package task
+
+import (
+	"fmt"
+	"log"
+	"time"
+
+	"github.com/ProjectDistribute/distributor/model"
+	"github.com/ProjectDistribute/distributor/service"
+)
+
+// maxStorageMigrationPasses bounds how often a migration goes over the files again
+// to pick up those added or failed during the previous pass.
+const maxStorageMigrationPasses = 5
+
+// MigrateStorage copies every stored file to the destination of m, skipping files
+// copied before an interruption. The server keeps using the source storage.
+func MigrateStorage(svc *service.StorageMigrationService, m *model.StorageMigration, job *service.Job) error {
+	err := migrateStorage(svc, m, job)
+	if err != nil {
+		m.Status = model.StorageMigrationFailed
+		m.Error = err.Error()
+	} else {
+		now := time.Now()
+		m.Status = model.StorageMigrationCompleted
+		m.CompletedAt = &now
+	}
+	if err := svc.Store.UpdateMigration(m); err != nil {
+		log.Printf("Failed to save storage migration %d: %v", m.ID, err)
+	}
+	return err
+}
+
+func migrateStorage(svc *service.StorageMigrationService, m *model.StorageMigration, job *service.Job) error {
+	source := svc.Storage.Current()
+	if !service.TargetOf(source).Same(service.SourceTarget(m)) {
+		return fmt.Errorf("the server no longer uses the source storage %s", service.SourceTarget(m))
+	}
+	dest, err := service.NewFileStorage(service.DestTarget(m))
+	if err != nil {
+		return err
+	}
+
+	job.SetMessage(fmt.Sprintf("Copying files from %s to %s", service.SourceTarget(m), service.DestTarget(m)))
+	for pass := 0; pass < maxStorageMigrationPasses; pass++ {
+		copied, failed, err := svc.CopyPending(m, source, dest, job)
+		if err != nil {
+			return err
+		}
+		log.Printf("Storage migration %d pass %d: %d copied, %d failed, %d of %d done", m.ID, pass+1, copied, failed, m.Copied, m.Total)
+		if copied == 0 {
+			break
+		}
+	}
+	job.SetMessage(fmt.Sprintf("%d of %d files copied to %s", m.Copied, m.Total, service.DestTarget(m)))
+	return nil
+}
@@ -0,0 +1,55 @@
+package task
+
+import (
+	"errors"
+	"io/fs"
+	"log"
+	"path/filepath"
+	"strings"
+
+	"github.com/ProjectDistribute/distributor/service"
+	"github.com/ProjectDistribute/distributor/utils"
+)
+
+// ScanLibrary walks root and imports every supported audio file it finds.
+// Files whose song already has a file of the same format are skipped and left in place.
+func ScanLibrary(librarySvc *service.LibraryService, root string, job *service.Job) error {
+	var paths []string
+	err := filepath.WalkDir(root, func(path string, d fs.DirEntry, err error) error {
+		if err != nil {
+			log.Printf("Error scanning %s: %v", path, err)
+			return nil
+		}
+		if d.IsDir() {
+			return nil
+		}
+		ext := strings.TrimPrefix(filepath.Ext(path), ".")
+		if utils.IsAudioFormat(ext) {
+			paths = append(paths, path)
+		}
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+
+	job.SetTotal(len(paths))
+	log.Printf("Library scan found %d audio files in %s", len(paths), root)
+
+	for _, path := range paths {
+		res, err := librarySvc.ImportFile(path)
+		if errors.Is(err, service.ErrAlreadyImported) {
+			job.Skip()
+			continue
+		}
+		if err != nil {
+			log.Printf("Failed to import %s: %v", path, err)
+			job.Fail(path, err)
+			continue
+		}
+		log.Printf("Imported %s as song %s (%s)", path, res.Song.ID, res.Song.Title)
+		job.Advance()
+	}
+
+	return nil
+}
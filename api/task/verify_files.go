@@ -0,0 +1,78 @@
+package task
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"time"
+
+	"github.com/ProjectDistribute/distributor/model"
+	"github.com/ProjectDistribute/distributor/service"
+	"gorm.io/gorm"
+)
+
+var (
+	errMissingFile = errors.New("audio is missing from storage")
+	errCorruptFile = errors.New("audio changed since import")
+)
+
+// VerifyFilesIntegrity hashes the stored audio of every song file and compares it
+// with the hash recorded on import, flagging files whose audio changed on disk.
+// Audio shared by linked files is hashed once. Corrupt and missing files are
+// reported as failed items of job.
+func VerifyFilesIntegrity(db *gorm.DB, songSvc service.SongService, job *service.Job) error {
+	var files []model.SongFile
+	if err := db.Find(&files).Error; err != nil {
+		return err
+	}
+	job.SetTotal(len(files))
+
+	checked, hashed, corrupt := 0, 0, 0
+	hashes := make(map[string]string)
+	for _, file := range files {
+		path := songSvc.AudioPath(&file)
+		hash, ok := hashes[path]
+		if !ok {
+			if !songSvc.Storage.Exists(path) {
+				job.Fail(file.ID.String(), errMissingFile)
+				continue
+			}
+			var err error
+			if hash, err = service.HashStoredFile(songSvc.Storage, path); err != nil {
+				log.Printf("Error hashing file %s: %v", path, err)
+				job.Fail(file.ID.String(), err)
+				continue
+			}
+			hashes[path] = hash
+		}
+		checked++
+
+		now := time.Now()
+		updates := map[string]any{"verified_at": now}
+		var failure error
+		switch {
+		case file.SHA256 == "":
+			// Files without a hash take their current audio as correct
+			updates["sha256"] = hash
+			hashed++
+		case file.SHA256 != hash:
+			updates["corrupt"] = true
+			corrupt++
+			failure = errCorruptFile
+			log.Printf("File %s is corrupt: expected SHA-256 %s, found %s", path, file.SHA256, hash)
+		default:
+			updates["corrupt"] = false
+		}
+		if err := db.Model(&file).UpdateColumns(updates).Error; err != nil {
+			log.Printf("Error updating integrity of file %s: %v", path, err)
+		}
+		if failure != nil {
+			job.Fail(file.ID.String(), failure)
+		} else {
+			job.Advance()
+		}
+	}
+
+	job.SetMessage(fmt.Sprintf("%d files checked, %d hashed for the first time, %d corrupt", checked, hashed, corrupt))
+	return nil
+}
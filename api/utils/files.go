@@ -27,7 +27,26 @@ func AudioContentType(format string) string {
 		return "audio/ogg"
 	case "m4a":
 		return "audio/mp4"
+	case "opus":
+		return "audio/ogg; codecs=opus"
+	case "aac":
+		return "audio/aac"
 	default:
 		return "application/octet-stream"
 	}
 }
+
+// IsAudioFormat reports whether format is one of the audio formats the server accepts.
+func IsAudioFormat(format string) bool {
+	switch strings.ToLower(format) {
+	case "mp3", "flac", "wav", "ogg", "m4a":
+		return true
+	}
+	return false
+}
+
+// Slugify mirrors the identifier format the admin panel generates for artists
+// ("Daft Punk" -> "daft-punk").
+func Slugify(name string) string {
+	return strings.Join(strings.Fields(strings.ToLower(name)), "-")
+}
@@ -2,13 +2,33 @@ package utils
 
 import (
 	"io"
+	"io/fs"
 	"os"
 	"path/filepath"
 )
 
-type LocalFileStorage struct{}
+// StoredFile is a file opened from a FileStorage. Seeking lets it serve Range requests.
+type StoredFile interface {
+	io.ReadSeekCloser
+	Stat() (fs.FileInfo, error)
+}
+
+// LocalFileStorage stores files on local disk, below Root if it is set and relative
+// to the working directory otherwise.
+type LocalFileStorage struct {
+	Root string
+}
+
+// FullPath returns where the file at path lives on disk.
+func (s LocalFileStorage) FullPath(path string) string {
+	if s.Root == "" {
+		return path
+	}
+	return filepath.Join(s.Root, path)
+}
 
-func (LocalFileStorage) Save(path string, r io.Reader) error {
+func (s LocalFileStorage) Save(path string, r io.Reader) error {
+	path = s.FullPath(path)
 	if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
 		return err
 	}
@@ -21,18 +41,45 @@ func (LocalFileStorage) Save(path string, r io.Reader) error {
 	return err
 }
 
-func (LocalFileStorage) Exists(path string) bool {
-	_, err := os.Stat(path)
+func (s LocalFileStorage) Exists(path string) bool {
+	_, err := os.Stat(s.FullPath(path))
 	return err == nil
 }
 
-func (LocalFileStorage) Delete(path string) error {
-	return os.Remove(path)
+func (s LocalFileStorage) Delete(path string) error {
+	return os.Remove(s.FullPath(path))
 }
 
-func (LocalFileStorage) Move(src, dst string) error {
-	if err := os.MkdirAll(filepath.Dir(dst), 0o755); err != nil {
+// Move moves the local file at src to dst, copying it when they are on different file systems.
+func (s LocalFileStorage) Move(src, dst string) error {
+	full := s.FullPath(dst)
+	if err := os.MkdirAll(filepath.Dir(full), 0o755); err != nil {
+		return err
+	}
+	if err := os.Rename(src, full); err == nil {
+		return nil
+	}
+
+	f, err := os.Open(src)
+	if err != nil {
 		return err
 	}
-	return os.Rename(src, dst)
+	defer f.Close()
+	if err := s.Save(dst, f); err != nil {
+		_ = os.Remove(full)
+		return err
+	}
+	return os.Remove(src)
+}
+
+func (s LocalFileStorage) Open(path string) (StoredFile, error) {
+	f, err := os.Open(s.FullPath(path))
+	if err != nil {
+		return nil, err
+	}
+	return f, nil
+}
+
+func (s LocalFileStorage) Stat(path string) (fs.FileInfo, error) {
+	return os.Stat(s.FullPath(path))
 }
@@ -0,0 +1,496 @@
+package utils
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/xml"
+	"fmt"
+	"io"
+	"io/fs"
+	"net"
+	"net/http"
+	"net/url"
+	"os"
+	"path"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const (
+	s3Algorithm       = "AWS4-HMAC-SHA256"
+	s3UnsignedPayload = "UNSIGNED-PAYLOAD"
+	s3TimeFormat      = "20060102T150405Z"
+	s3DateFormat      = "20060102"
+
+	// s3RequestTimeout bounds requests that do not stream an object body.
+	s3RequestTimeout = time.Minute
+	// s3MinUploadRate is the slowest upload, in bytes per second, that is waited for
+	// on top of s3RequestTimeout.
+	s3MinUploadRate = 256 * 1024
+)
+
+// S3FileStorage stores files as objects in an S3-compatible bucket (AWS S3, MinIO,
+// Garage, R2, ...). Storage paths are used as object keys below Prefix.
+//
+// Requests are signed with AWS Signature Version 4. Payloads are not signed, so the
+// endpoint should use HTTPS outside of trusted networks.
+type S3FileStorage struct {
+	Endpoint  *url.URL
+	Region    string
+	Bucket    string
+	AccessKey string
+	SecretKey string
+	// PathStyle addresses the bucket as <endpoint>/<bucket> instead of <bucket>.<endpoint>,
+	// which most self-hosted servers need.
+	PathStyle bool
+	Prefix    string
+	// Redirect makes clients download files straight from the bucket with presigned URLs.
+	Redirect bool
+	Client   *http.Client
+	// RequestTimeout bounds requests other than object reads, s3RequestTimeout if zero.
+	// Reads stream for as long as the caller reads and are bounded by its context.
+	RequestTimeout time.Duration
+
+	// now is replaced in tests.
+	now func() time.Time
+}
+
+// NewS3FileStorageFromEnv configures an S3FileStorage from the S3_* environment variables.
+func NewS3FileStorageFromEnv() (*S3FileStorage, error) {
+	endpoint, err := url.Parse(Getenv("S3_ENDPOINT", "https://s3.amazonaws.com"))
+	if err != nil || endpoint.Host == "" {
+		return nil, fmt.Errorf("S3_ENDPOINT must be a URL")
+	}
+	s := &S3FileStorage{
+		Endpoint:  endpoint,
+		Region:    Getenv("S3_REGION", "us-east-1"),
+		Bucket:    Getenv("S3_BUCKET", ""),
+		AccessKey: Getenv("S3_ACCESS_KEY_ID", ""),
+		SecretKey: Getenv("S3_SECRET_ACCESS_KEY", ""),
+		PathStyle: Getenv("S3_PATH_STYLE", "true") == "true",
+		Prefix:    Getenv("S3_PREFIX", ""),
+		Redirect:  Getenv("S3_REDIRECT", "false") == "true",
+		Client:    newS3Client(),
+	}
+	if s.Bucket == "" || s.AccessKey == "" || s.SecretKey == "" {
+		return nil, fmt.Errorf("S3_BUCKET, S3_ACCESS_KEY_ID and S3_SECRET_ACCESS_KEY are required")
+	}
+	return s, nil
+}
+
+var defaultS3Client = newS3Client()
+
+// newS3Client returns a client that gives up on unreachable or unresponsive endpoints.
+// It has no overall timeout, object reads last as long as a song plays.
+func newS3Client() *http.Client {
+	transport := http.DefaultTransport.(*http.Transport).Clone()
+	transport.DialContext = (&net.Dialer{Timeout: 10 * time.Second, KeepAlive: 30 * time.Second}).DialContext
+	transport.TLSHandshakeTimeout = 10 * time.Second
+	transport.ResponseHeaderTimeout = 30 * time.Second
+	return &http.Client{Transport: transport}
+}
+
+// S3Error is an error response of the S3 API.
+type S3Error struct {
+	StatusCode int
+	Code       string `xml:"Code"`
+	Message    string `xml:"Message"`
+}
+
+func (e *S3Error) Error() string {
+	if e.Code == "" {
+		return fmt.Sprintf("s3: %s", http.StatusText(e.StatusCode))
+	}
+	return fmt.Sprintf("s3: %s: %s", e.Code, e.Message)
+}
+
+// Is makes missing objects match fs.ErrNotExist, so os.IsNotExist style checks keep working.
+func (e *S3Error) Is(target error) bool {
+	return target == fs.ErrNotExist && e.StatusCode == http.StatusNotFound
+}
+
+func (s *S3FileStorage) Save(p string, r io.Reader) error {
+	// S3 needs the length up front, spool streams of unknown size to disk
+	body, size, cleanup, err := sizedBody(r)
+	if err != nil {
+		return err
+	}
+	defer cleanup()
+
+	ctx, cancel := context.WithTimeout(context.Background(), s.requestTimeout()+time.Duration(size/s3MinUploadRate)*time.Second)
+	defer cancel()
+	req, err := s.newRequest(ctx, http.MethodPut, p, body)
+	if err != nil {
+		return err
+	}
+	req.ContentLength = size
+	res, err := s.do(req)
+	if err != nil {
+		return err
+	}
+	res.Body.Close()
+	return nil
+}
+
+func (s *S3FileStorage) Exists(p string) bool {
+	_, err := s.Stat(p)
+	return err == nil
+}
+
+func (s *S3FileStorage) Delete(p string) error {
+	ctx, cancel := context.WithTimeout(context.Background(), s.requestTimeout())
+	defer cancel()
+	req, err := s.newRequest(ctx, http.MethodDelete, p, nil)
+	if err != nil {
+		return err
+	}
+	res, err := s.do(req)
+	if err != nil {
+		return err
+	}
+	res.Body.Close()
+	return nil
+}
+
+// Move uploads the local file at src to dst and removes src.
+func (s *S3FileStorage) Move(src, dst string) error {
+	f, err := os.Open(src)
+	if err != nil {
+		return err
+	}
+	err = s.Save(dst, f)
+	f.Close()
+	if err != nil {
+		return err
+	}
+	return os.Remove(src)
+}
+
+func (s *S3FileStorage) Stat(p string) (fs.FileInfo, error) {
+	return s.stat(context.Background(), p)
+}
+
+func (s *S3FileStorage) stat(ctx context.Context, p string) (fs.FileInfo, error) {
+	ctx, cancel := context.WithTimeout(ctx, s.requestTimeout())
+	defer cancel()
+	req, err := s.newRequest(ctx, http.MethodHead, p, nil)
+	if err != nil {
+		return nil, err
+	}
+	res, err := s.do(req)
+	if err != nil {
+		return nil, err
+	}
+	res.Body.Close()
+
+	info := &s3FileInfo{name: path.Base(p), size: res.ContentLength}
+	info.modTime, _ = http.ParseTime(res.Header.Get("Last-Modified"))
+	return info, nil
+}
+
+// Open returns the object at p. Reads are served by ranged GET requests starting
+// at the current offset, so seeking is cheap.
+func (s *S3FileStorage) Open(p string) (StoredFile, error) {
+	return s.OpenContext(context.Background(), p)
+}
+
+// OpenContext is Open with reads that are cancelled with ctx, e.g. when the client
+// the object is served to goes away.
+func (s *S3FileStorage) OpenContext(ctx context.Context, p string) (StoredFile, error) {
+	info, err := s.stat(ctx, p)
+	if err != nil {
+		return nil, err
+	}
+	return &s3Object{storage: s, ctx: ctx, path: p, info: info}, nil
+}
+
+// PresignGet returns a URL that downloads the object at p without credentials until it expires.
+func (s *S3FileStorage) PresignGet(p string, expires time.Duration) (string, error) {
+	u := s.objectURL(p)
+	now := s.clock().UTC()
+	q := url.Values{}
+	q.Set("X-Amz-Algorithm", s3Algorithm)
+	q.Set("X-Amz-Credential", s.AccessKey+"/"+s.credentialScope(now))
+	q.Set("X-Amz-Date", now.Format(s3TimeFormat))
+	q.Set("X-Amz-Expires", strconv.Itoa(int(expires.Seconds())))
+	q.Set("X-Amz-SignedHeaders", "host")
+	u.RawQuery = canonicalQuery(q)
+
+	canonical := strings.Join([]string{
+		http.MethodGet,
+		u.EscapedPath(),
+		u.RawQuery,
+		"host:" + u.Host + "\n",
+		"host",
+		s3UnsignedPayload,
+	}, "\n")
+	u.RawQuery += "&X-Amz-Signature=" + s.signature(now, canonical)
+	return u.String(), nil
+}
+
+// RedirectReads reports whether clients should be sent to presigned URLs.
+func (s *S3FileStorage) RedirectReads() bool {
+	return s.Redirect
+}
+
+func (s *S3FileStorage) requestTimeout() time.Duration {
+	if s.RequestTimeout > 0 {
+		return s.RequestTimeout
+	}
+	return s3RequestTimeout
+}
+
+func (s *S3FileStorage) clock() time.Time {
+	if s.now != nil {
+		return s.now()
+	}
+	return time.Now()
+}
+
+func (s *S3FileStorage) objectURL(p string) *url.URL {
+	key := strings.TrimPrefix(path.Join(s.Prefix, p), "/")
+	u := *s.Endpoint
+	u.RawQuery = ""
+	basePath := strings.TrimSuffix(u.Path, "/")
+	if s.PathStyle {
+		u.Path = basePath + "/" + s.Bucket + "/" + key
+	} else {
+		u.Host = s.Bucket + "." + u.Host
+		u.Path = basePath + "/" + key
+	}
+	u.RawPath = escapePath(u.Path)
+	return &u
+}
+
+func (s *S3FileStorage) newRequest(ctx context.Context, method, p string, body io.Reader) (*http.Request, error) {
+	req, err := http.NewRequestWithContext(ctx, method, s.objectURL(p).String(), body)
+	if err != nil {
+		return nil, err
+	}
+	s.sign(req)
+	return req, nil
+}
+
+// sign adds a Signature Version 4 Authorization header to req.
+func (s *S3FileStorage) sign(req *http.Request) {
+	now := s.clock().UTC()
+	req.Header.Set("X-Amz-Date", now.Format(s3TimeFormat))
+	req.Header.Set("X-Amz-Content-Sha256", s3UnsignedPayload)
+
+	signed := []string{"host", "x-amz-content-sha256", "x-amz-date"}
+	headers := "host:" + req.URL.Host + "\n" +
+		"x-amz-content-sha256:" + s3UnsignedPayload + "\n" +
+		"x-amz-date:" + req.Header.Get("X-Amz-Date") + "\n"
+	canonical := strings.Join([]string{
+		req.Method,
+		req.URL.EscapedPath(),
+		canonicalQuery(req.URL.Query()),
+		headers,
+		strings.Join(signed, ";"),
+		s3UnsignedPayload,
+	}, "\n")
+
+	req.Header.Set("Authorization", fmt.Sprintf("%s Credential=%s/%s, SignedHeaders=%s, Signature=%s",
+		s3Algorithm, s.AccessKey, s.credentialScope(now), strings.Join(signed, ";"), s.signature(now, canonical)))
+}
+
+func (s *S3FileStorage) credentialScope(t time.Time) string {
+	return t.Format(s3DateFormat) + "/" + s.Region + "/s3/aws4_request"
+}
+
+func (s *S3FileStorage) signature(t time.Time, canonicalRequest string) string {
+	hash := sha256.Sum256([]byte(canonicalRequest))
+	stringToSign := strings.Join([]string{
+		s3Algorithm,
+		t.Format(s3TimeFormat),
+		s.credentialScope(t),
+		hex.EncodeToString(hash[:]),
+	}, "\n")
+
+	key := hmacSHA256([]byte("AWS4"+s.SecretKey), t.Format(s3DateFormat))
+	key = hmacSHA256(key, s.Region)
+	key = hmacSHA256(key, "s3")
+	key = hmacSHA256(key, "aws4_request")
+	return hex.EncodeToString(hmacSHA256(key, stringToSign))
+}
+
+// do sends req and turns error responses into an S3Error.
+func (s *S3FileStorage) do(req *http.Request) (*http.Response, error) {
+	client := s.Client
+	if client == nil {
+		client = defaultS3Client
+	}
+	res, err := client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	if res.StatusCode < 300 {
+		return res, nil
+	}
+	defer res.Body.Close()
+	s3err := &S3Error{StatusCode: res.StatusCode}
+	if body, err := io.ReadAll(io.LimitReader(res.Body, 64*1024)); err == nil {
+		_ = xml.Unmarshal(body, s3err)
+	}
+	return nil, s3err
+}
+
+func hmacSHA256(key []byte, data string) []byte {
+	mac := hmac.New(sha256.New, key)
+	mac.Write([]byte(data))
+	return mac.Sum(nil)
+}
+
+// escapePath percent-encodes every byte of p except unreserved characters and slashes, as SigV4 expects.
+func escapePath(p string) string {
+	var b strings.Builder
+	for i := 0; i < len(p); i++ {
+		c := p[i]
+		if c == '/' || c == '-' || c == '_' || c == '.' || c == '~' ||
+			('a' <= c && c <= 'z') || ('A' <= c && c <= 'Z') || ('0' <= c && c <= '9') {
+			b.WriteByte(c)
+			continue
+		}
+		fmt.Fprintf(&b, "%%%02X", c)
+	}
+	return b.String()
+}
+
+func canonicalQuery(q url.Values) string {
+	keys := make([]string, 0, len(q))
+	for k := range q {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	var parts []string
+	for _, k := range keys {
+		vals := append([]string(nil), q[k]...)
+		sort.Strings(vals)
+		for _, v := range vals {
+			parts = append(parts, escapePath(k)+"="+strings.ReplaceAll(escapePath(v), "/", "%2F"))
+		}
+	}
+	return strings.Join(parts, "&")
+}
+
+// sizedBody returns r with its length, spooling it to a temporary file unless the size is already known.
+func sizedBody(r io.Reader) (io.Reader, int64, func(), error) {
+	switch v := r.(type) {
+	case *os.File:
+		if info, err := v.Stat(); err == nil && info.Mode().IsRegular() {
+			pos, err := v.Seek(0, io.SeekCurrent)
+			if err == nil {
+				return v, info.Size() - pos, func() {}, nil
+			}
+		}
+	case interface{ Len() int }:
+		return r, int64(v.Len()), func() {}, nil
+	}
+
+	tmp, err := os.CreateTemp("", ".s3-upload-*")
+	if err != nil {
+		return nil, 0, nil, err
+	}
+	cleanup := func() {
+		tmp.Close()
+		os.Remove(tmp.Name())
+	}
+	size, err := io.Copy(tmp, r)
+	if err == nil {
+		_, err = tmp.Seek(0, io.SeekStart)
+	}
+	if err != nil {
+		cleanup()
+		return nil, 0, nil, err
+	}
+	return tmp, size, cleanup, nil
+}
+
+type s3FileInfo struct {
+	name    string
+	size    int64
+	modTime time.Time
+}
+
+func (i *s3FileInfo) Name() string       { return i.name }
+func (i *s3FileInfo) Size() int64        { return i.size }
+func (i *s3FileInfo) Mode() fs.FileMode  { return 0o444 }
+func (i *s3FileInfo) ModTime() time.Time { return i.modTime }
+func (i *s3FileInfo) IsDir() bool        { return false }
+func (i *s3FileInfo) Sys() any           { return nil }
+
+// s3Object reads an object with ranged GET requests.
+type s3Object struct {
+	storage *S3FileStorage
+	ctx     context.Context
+	path    string
+	info    fs.FileInfo
+	offset  int64
+	body    io.ReadCloser
+}
+
+func (o *s3Object) Stat() (fs.FileInfo, error) {
+	return o.info, nil
+}
+
+func (o *s3Object) Read(b []byte) (int, error) {
+	if o.offset >= o.info.Size() {
+		return 0, io.EOF
+	}
+	if o.body == nil {
+		req, err := o.storage.newRequest(o.ctx, http.MethodGet, o.path, nil)
+		if err != nil {
+			return 0, err
+		}
+		req.Header.Set("Range", fmt.Sprintf("bytes=%d-", o.offset))
+		res, err := o.storage.do(req)
+		if err != nil {
+			return 0, err
+		}
+		o.body = res.Body
+	}
+	n, err := o.body.Read(b)
+	o.offset += int64(n)
+	if err == io.EOF && o.offset < o.info.Size() {
+		err = io.ErrUnexpectedEOF
+	}
+	return n, err
+}
+
+func (o *s3Object) Seek(offset int64, whence int) (int64, error) {
+	var abs int64
+	switch whence {
+	case io.SeekStart:
+		abs = offset
+	case io.SeekCurrent:
+		abs = o.offset + offset
+	case io.SeekEnd:
+		abs = o.info.Size() + offset
+	default:
+		return 0, fmt.Errorf("s3: invalid whence %d", whence)
+	}
+	if abs < 0 {
+		return 0, fmt.Errorf("s3: negative position")
+	}
+	if abs != o.offset {
+		o.closeBody()
+		o.offset = abs
+	}
+	return abs, nil
+}
+
+func (o *s3Object) Close() error {
+	o.closeBody()
+	return nil
+}
+
+func (o *s3Object) closeBody() {
+	if o.body != nil {
+		o.body.Close()
+		o.body = nil
+	}
+}